@@ -0,0 +1,164 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/model"
+)
+
+// The operator commands run the same maintenance tasks as the admin
+// endpoints, but against the configured database and storage backends
+// directly, so they don't need admin_endpoints to be enabled. Each command
+// registers its flags and returns the function that runs it.
+var commands = map[string]func(flags *flag.FlagSet) func() error{
+	"migrate-storage":   migrateStorageCommand,
+	"check-storage":     checkStorageCommand,
+	"reencrypt-storage": reencryptStorageCommand,
+	"recover-storage":   recoverStorageCommand,
+	"sync-mirrors":      syncMirrorsCommand,
+	"export":            exportCommand,
+	"import":            importCommand,
+}
+
+func migrateStorageCommand(flags *flag.FlagSet) func() error {
+	migration := model.StorageMigration{}
+	flags.StringVar(&migration.Target, "target", "", "The storage backend to copy packages and artifacts to.")
+	flags.StringVar(&migration.Source, "source", "", "The storage backend to copy from. Defaults to all other backends.")
+	flags.BoolVar(&migration.Retire, "retire", false, "Unregister the source URIs once they've been copied.")
+	return func() error {
+		return model.MigrateStorage(&migration, os.Stdout)
+	}
+}
+
+func checkStorageCommand(flags *flag.FlagSet) func() error {
+	check := model.StorageCheck{}
+	flags.BoolVar(&check.DeleteOrphans, "delete-orphans", false, "Delete the orphaned packages.")
+	flags.BoolVar(&check.Force, "force", false, "Delete orphans even from backends without any registered packages.")
+	return func() error {
+		return model.CheckStorage(&check, os.Stdout)
+	}
+}
+
+func reencryptStorageCommand(flags *flag.FlagSet) func() error {
+	reencryption := model.StorageReencryption{}
+	flags.BoolVar(&reencryption.DryRun, "dry-run", false, "Only list the packages that need to be re-encrypted.")
+	return func() error {
+		return model.ReencryptStorage(&reencryption, os.Stdout)
+	}
+}
+
+func recoverStorageCommand(flags *flag.FlagSet) func() error {
+	recovery := model.StorageRecovery{}
+	flags.StringVar(&recovery.Backend, "backend", "", "The storage backend to recover from. Defaults to the primary backend.")
+	flags.BoolVar(&recovery.DryRun, "dry-run", false, "Only report what's missing from the database.")
+	return func() error {
+		return model.RecoverFromStorage(&recovery, os.Stdout)
+	}
+}
+
+func syncMirrorsCommand(flags *flag.FlagSet) func() error {
+	mirrorSync := model.MirrorSync{}
+	flags.StringVar(&mirrorSync.Namespace, "namespace", "", "The namespace to synchronise. Defaults to all mirrored namespaces.")
+	return func() error {
+		return model.SyncMirrors(&mirrorSync, os.Stdout)
+	}
+}
+
+// A failed export removes the bundle, rather than leaving a truncated one
+// behind.
+func exportCommand(flags *flag.FlagSet) func() error {
+	export := model.NamespaceExport{}
+	flags.StringVar(&export.Namespace, "namespace", "", "The namespace to export.")
+	output := flags.String("output", "", "The file to write the bundle to. Defaults to <namespace>.tgz.")
+	return func() error {
+		if export.Namespace == "" {
+			return fmt.Errorf("Missing -namespace")
+		}
+		path := *output
+		if path == "" {
+			path = export.Namespace + ".tgz"
+		}
+		bundle, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		err = model.ExportNamespace(&export, bundle)
+		if closeErr := bundle.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+			return err
+		}
+		fmt.Printf("Exported namespace '%s' to '%s'\n", export.Namespace, path)
+		return nil
+	}
+}
+
+func importCommand(flags *flag.FlagSet) func() error {
+	input := flags.String("bundle", "", "The bundle to import.")
+	return func() error {
+		if *input == "" {
+			return fmt.Errorf("Missing -bundle")
+		}
+		bundle, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer bundle.Close()
+		return model.ImportBundle(bundle, os.Stdout)
+	}
+}
+
+// Runs the operator command named by args[1] and exits when it's done. Does
+// nothing if args[1] isn't a command, in which case the Inventory should be
+// started as usual.
+//
+// Usage: escape-inventory COMMAND [FLAGS] [CONFIG_FILE]
+func RunCommand(args []string) {
+	if len(args) < 2 {
+		return
+	}
+	name := args[1]
+	command, ok := commands[name]
+	if !ok {
+		return
+	}
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: escape-inventory %s [FLAGS] [CONFIG_FILE]\n", name)
+		flags.PrintDefaults()
+	}
+	run := command(flags)
+	flags.Parse(args[2:])
+	Config = loadAndActivateConfig(append([]string{args[0]}, flags.Args()...))
+	err := run()
+	// The in-memory database is only persisted through its snapshot.
+	if saveErr := dao.SaveSnapshot(); err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		log.Fatalln("ERROR:", err.Error())
+	}
+	os.Exit(0)
+}
@@ -20,8 +20,12 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/ankyra/escape-inventory/config"
@@ -73,14 +77,76 @@ func activateConfig(conf *config.Config) error {
 		return err
 	}
 	log.Printf("INFO: Activating '%s' storage backend\n", conf.StorageBackend)
+	for _, backend := range conf.StorageBackends {
+		if backend != conf.StorageBackend {
+			log.Printf("INFO: Replicating packages to '%s' storage backend\n", backend)
+		}
+	}
 	if err := storage.LoadFromConfig(conf); err != nil {
 		return err
 	}
+	if err := model.InitDownloadSigning(conf.DownloadSigningKey); err != nil {
+		return err
+	}
+	for namespace, upstream := range conf.Mirrors {
+		log.Printf("INFO: Mirroring namespace '%s' from upstream inventory '%s'\n", namespace, redactURL(upstream))
+	}
+	return model.InitMirrors(conf.Mirrors)
+}
+
+// Only the server saves snapshots and synchronises mirrors in the background;
+// the operator commands run once and exit.
+func startBackgroundTasks(conf *config.Config) error {
+	if conf.Database == "memory" && conf.DatabaseSettings.SnapshotPath != "" {
+		if err := activateSnapshots(conf.DatabaseSettings); err != nil {
+			return err
+		}
+	}
+	if conf.MirrorSyncInterval != "" && len(conf.Mirrors) > 0 {
+		interval, err := time.ParseDuration(conf.MirrorSyncInterval)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("Invalid mirror_sync_interval '%s'", conf.MirrorSyncInterval)
+		}
+		log.Printf("INFO: Synchronising mirrored namespaces every %s\n", interval)
+		model.StartMirrorSync(interval)
+	}
 	return nil
 }
 
-func loadAndActivateConfig() *config.Config {
-	configFile := getConfigLocation(os.Args)
+func activateSnapshots(settings config.DatabaseSettings) error {
+	log.Printf("INFO: Saving the database to '%s' on shutdown\n", settings.SnapshotPath)
+	if settings.SnapshotInterval != "" {
+		interval, err := time.ParseDuration(settings.SnapshotInterval)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("Invalid snapshot_interval '%s'", settings.SnapshotInterval)
+		}
+		log.Printf("INFO: Saving the database every %s\n", interval)
+		dao.StartSnapshots(interval)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Printf("INFO: Saving the database to '%s'\n", settings.SnapshotPath)
+		if err := dao.SaveSnapshot(); err != nil {
+			log.Fatalln("ERROR:", err.Error())
+		}
+		os.Exit(0)
+	}()
+	return nil
+}
+
+// Strips credentials from the URL, so that they don't end up in the logs.
+func redactURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return parsed.Redacted()
+}
+
+func loadAndActivateConfig(args []string) *config.Config {
+	configFile := getConfigLocation(args)
 	conf, err := loadConfig(configFile)
 	if err != nil {
 		log.Fatalln("ERROR:", err.Error())
@@ -119,7 +185,15 @@ func GetHandler(router *mux.Router) http.Handler {
 		log.Printf("INFO: Enabling basic authentication.\n")
 		users := map[string]string{}
 		users[Config.BasicAuthUsername] = Config.BasicAuthPassword
-		middleware.Use(basicauth.BasicAuth("escape", users))
+		auth := basicauth.BasicAuth("escape", users)
+		middleware.Use(negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+			// Signed download links are authenticated by their signature.
+			if strings.HasPrefix(r.URL.Path, model.SignedDownloadPathPrefix) {
+				next(w, r)
+				return
+			}
+			auth(w, r, next)
+		}))
 	}
 	middleware.UseHandler(router)
 
@@ -127,13 +201,16 @@ func GetHandler(router *mux.Router) http.Handler {
 }
 
 func LoadConfig() *config.Config {
-	fmt.Println(EscapeLogo)
+	fmt.Print(EscapeLogo + "\n")
 	for _, arg := range os.Args[1:] {
 		if arg == "--version" {
 			os.Exit(0)
 		}
 	}
-	Config = loadAndActivateConfig()
+	Config = loadAndActivateConfig(os.Args)
+	if err := startBackgroundTasks(Config); err != nil {
+		log.Fatalln("ERROR:", err.Error())
+	}
 	return Config
 }
 
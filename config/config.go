@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -28,29 +29,51 @@ import (
 )
 
 type DatabaseSettings struct {
-	Path        string `json:"path" yaml:"path"`
-	PostgresUrl string `json:"postgres_url" yaml:"postgres_url"`
+	Path             string `json:"path" yaml:"path"`
+	PostgresUrl      string `json:"postgres_url" yaml:"postgres_url"`
+	MysqlDsn         string `json:"mysql_dsn" yaml:"mysql_dsn"`
+	SnapshotPath     string `json:"snapshot_path" yaml:"snapshot_path"`
+	SnapshotInterval string `json:"snapshot_interval" yaml:"snapshot_interval"`
 }
 
 type StorageSettings struct {
-	Path        string `json:"path" yaml:"path"`
-	Bucket      string `json:"bucket" yaml:"bucket"`
-	Credentials string `json:"credentials" yaml:"credentials"`
+	Path              string            `json:"path" yaml:"path"`
+	Bucket            string            `json:"bucket" yaml:"bucket"`
+	Credentials       string            `json:"credentials" yaml:"credentials"`
+	Endpoint          string            `json:"endpoint" yaml:"endpoint"`
+	Region            string            `json:"region" yaml:"region"`
+	AccessKeyID       string            `json:"access_key_id" yaml:"access_key_id"`
+	SecretAccessKey   string            `json:"secret_access_key" yaml:"secret_access_key"`
+	PathStyle         bool              `json:"path_style" yaml:"path_style"`
+	Account           string            `json:"account" yaml:"account"`
+	Container         string            `json:"container" yaml:"container"`
+	AccountKey        string            `json:"account_key" yaml:"account_key"`
+	SASToken          string            `json:"sas_token" yaml:"sas_token"`
+	URL               string            `json:"url" yaml:"url"`
+	Headers           map[string]string `json:"headers" yaml:"headers"`
+	EncryptionKeyFile string            `json:"encryption_key_file" yaml:"encryption_key_file"`
 }
 
 type Config struct {
-	Port              string           `json:"port" yaml:"port"`
-	Database          string           `json:"database" yaml:"database"`
-	DatabaseSettings  DatabaseSettings `json:"database_settings" yaml:"database_settings"`
-	StorageBackend    string           `json:"storage_backend" yaml:"storage_backend"`
-	StorageSettings   StorageSettings  `json:"storage_settings" yaml:"storage_settings"`
-	EventServiceURL   string           `json:"event_service_url" yaml:"event_service_url"`
-	UserServiceURL    string           `json:"user_service_url" yaml:"user_service_url"`
-	StateServiceURL   string           `json:"state_service_url" yaml:"state_service_url"`
-	WebHook           string           `json:"web_hook" yaml:"web_hook"`
-	Dev               bool             `json:"dev" yaml:"dev"`
-	BasicAuthUsername string           `json:"basic_auth_username" yaml:"basic_auth_username"`
-	BasicAuthPassword string           `json:"basic_auth_password" yaml:"basic_auth_password"`
+	Port               string                     `json:"port" yaml:"port"`
+	Database           string                     `json:"database" yaml:"database"`
+	DatabaseSettings   DatabaseSettings           `json:"database_settings" yaml:"database_settings"`
+	StorageBackend     string                     `json:"storage_backend" yaml:"storage_backend"`
+	StorageBackends    []string                   `json:"storage_backends" yaml:"storage_backends"`
+	StorageSettings    StorageSettings            `json:"storage_settings" yaml:"storage_settings"`
+	BackendSettings    map[string]StorageSettings `json:"backend_settings" yaml:"backend_settings"`
+	UploadSessionsPath string                     `json:"upload_sessions_path" yaml:"upload_sessions_path"`
+	EventServiceURL    string                     `json:"event_service_url" yaml:"event_service_url"`
+	UserServiceURL     string                     `json:"user_service_url" yaml:"user_service_url"`
+	StateServiceURL    string                     `json:"state_service_url" yaml:"state_service_url"`
+	WebHook            string                     `json:"web_hook" yaml:"web_hook"`
+	Dev                bool                       `json:"dev" yaml:"dev"`
+	AdminEndpoints     bool                       `json:"admin_endpoints" yaml:"admin_endpoints"`
+	BasicAuthUsername  string                     `json:"basic_auth_username" yaml:"basic_auth_username"`
+	BasicAuthPassword  string                     `json:"basic_auth_password" yaml:"basic_auth_password"`
+	DownloadSigningKey string                     `json:"download_signing_key" yaml:"download_signing_key"`
+	Mirrors            map[string]string          `json:"mirrors" yaml:"mirrors"`
+	MirrorSyncInterval string                     `json:"mirror_sync_interval" yaml:"mirror_sync_interval"`
 }
 
 func NewConfig(env []string) (*Config, error) {
@@ -70,15 +93,25 @@ func replaceMissingValuesWithDefaults(config *Config) {
 	if config.DatabaseSettings.Path == "" && config.Database == "ql" {
 		config.DatabaseSettings.Path = "/var/lib/escape/inventory.db"
 	}
+	if config.DatabaseSettings.Path == "" && config.Database == "sqlite" {
+		config.DatabaseSettings.Path = "/var/lib/escape/inventory.sqlite"
+	}
 	if config.StorageBackend == "" {
 		config.StorageBackend = "local"
 	}
-	if config.StorageSettings.Path == "" && config.StorageBackend == "local" {
+	if config.StorageSettings.Path == "" && config.UsesStorageBackend("local") {
 		config.StorageSettings.Path = "/var/lib/escape/releases"
 	}
+	if settings, ok := config.BackendSettings["local"]; ok && settings.Path == "" {
+		settings.Path = "/var/lib/escape/releases"
+		config.BackendSettings["local"] = settings
+	}
 	if config.DatabaseSettings.PostgresUrl == "" && config.Database == "postgres" {
 		config.DatabaseSettings.PostgresUrl = "postgres://postgres:@localhost/postgres?sslmode=disable"
 	}
+	if config.DatabaseSettings.MysqlDsn == "" && config.Database == "mysql" {
+		config.DatabaseSettings.MysqlDsn = "root:@tcp(localhost:3306)/inventory"
+	}
 	if config.BasicAuthUsername == "" {
 		config.BasicAuthUsername = "escape"
 	}
@@ -122,14 +155,38 @@ func processEnvironmentOverrides(config *Config, env []string) *Config {
 			config.DatabaseSettings.Path = value
 		} else if key == "DATABASE_SETTINGS_POSTGRES_URL" {
 			config.DatabaseSettings.PostgresUrl = value
+		} else if key == "DATABASE_SETTINGS_MYSQL_DSN" {
+			config.DatabaseSettings.MysqlDsn = value
+		} else if key == "DATABASE_SETTINGS_SNAPSHOT_PATH" {
+			config.DatabaseSettings.SnapshotPath = value
+		} else if key == "DATABASE_SETTINGS_SNAPSHOT_INTERVAL" {
+			config.DatabaseSettings.SnapshotInterval = value
 		} else if key == "STORAGE_BACKEND" {
 			config.StorageBackend = value
-		} else if key == "STORAGE_SETTINGS_PATH" {
-			config.StorageSettings.Path = value
-		} else if key == "STORAGE_SETTINGS_BUCKET" {
-			config.StorageSettings.Bucket = value
-		} else if key == "STORAGE_SETTINGS_CREDENTIALS" {
-			config.StorageSettings.Credentials = value
+		} else if key == "STORAGE_BACKENDS" {
+			config.StorageBackends = []string{}
+			for _, backend := range strings.Split(value, ",") {
+				if backend = strings.TrimSpace(backend); backend != "" {
+					config.StorageBackends = append(config.StorageBackends, backend)
+				}
+			}
+		} else if strings.HasPrefix(key, "STORAGE_SETTINGS_") {
+			setStorageSetting(&config.StorageSettings, strings.TrimPrefix(key, "STORAGE_SETTINGS_"), value)
+		} else if strings.HasPrefix(key, "BACKEND_SETTINGS_") {
+			// BACKEND_SETTINGS_S3_BUCKET sets the bucket of the s3 backend.
+			parts := strings.SplitN(strings.TrimPrefix(key, "BACKEND_SETTINGS_"), "_", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			backend := strings.ToLower(parts[0])
+			if config.BackendSettings == nil {
+				config.BackendSettings = map[string]StorageSettings{}
+			}
+			settings := config.BackendSettings[backend]
+			setStorageSetting(&settings, parts[1], value)
+			config.BackendSettings[backend] = settings
+		} else if key == "UPLOAD_SESSIONS_PATH" {
+			config.UploadSessionsPath = value
 		} else if key == "WEB_HOOK" {
 			config.WebHook = value
 		} else if key == "USER_SERVICE_URL" {
@@ -142,6 +199,22 @@ func processEnvironmentOverrides(config *Config, env []string) *Config {
 			config.BasicAuthUsername = value
 		} else if key == "BASIC_AUTH_PASSWORD" {
 			config.BasicAuthPassword = value
+		} else if key == "DOWNLOAD_SIGNING_KEY" {
+			config.DownloadSigningKey = value
+		} else if key == "MIRRORS" {
+			// MIRRORS=ns=https://upstream,ns2=https://upstream
+			config.Mirrors = map[string]string{}
+			for _, mirror := range strings.Split(value, ",") {
+				parts := strings.SplitN(strings.TrimSpace(mirror), "=", 2)
+				if len(parts) == 2 && parts[0] != "" {
+					config.Mirrors[parts[0]] = parts[1]
+				}
+			}
+		} else if key == "MIRROR_SYNC_INTERVAL" {
+			config.MirrorSyncInterval = value
+		} else if key == "ADMIN_ENDPOINTS" {
+			valueBool, _ := strconv.ParseBool(value)
+			config.AdminEndpoints = valueBool
 		} else if key == "DEV" {
 			valueBool, _ := strconv.ParseBool(value)
 			config.Dev = valueBool
@@ -150,6 +223,72 @@ func processEnvironmentOverrides(config *Config, env []string) *Config {
 	return config
 }
 
+// Sets one of the storage settings from an environment variable, where key is
+// the part of the variable's name after the STORAGE_SETTINGS_ or
+// BACKEND_SETTINGS_<BACKEND>_ prefix.
+func setStorageSetting(settings *StorageSettings, key, value string) {
+	if key == "PATH" {
+		settings.Path = value
+	} else if key == "BUCKET" {
+		settings.Bucket = value
+	} else if key == "CREDENTIALS" {
+		settings.Credentials = value
+	} else if key == "ENDPOINT" {
+		settings.Endpoint = value
+	} else if key == "REGION" {
+		settings.Region = value
+	} else if key == "ACCESS_KEY_ID" {
+		settings.AccessKeyID = value
+	} else if key == "SECRET_ACCESS_KEY" {
+		settings.SecretAccessKey = value
+	} else if key == "PATH_STYLE" {
+		valueBool, _ := strconv.ParseBool(value)
+		settings.PathStyle = valueBool
+	} else if key == "ACCOUNT" {
+		settings.Account = value
+	} else if key == "CONTAINER" {
+		settings.Container = value
+	} else if key == "ACCOUNT_KEY" {
+		settings.AccountKey = value
+	} else if key == "SAS_TOKEN" {
+		settings.SASToken = value
+	} else if key == "ENCRYPTION_KEY_FILE" {
+		settings.EncryptionKeyFile = value
+	} else if key == "URL" {
+		settings.URL = value
+	} else if strings.HasPrefix(key, "HEADERS_") {
+		// HEADERS_X_API_KEY sets the X-Api-Key header.
+		name := strings.Replace(strings.TrimPrefix(key, "HEADERS_"), "_", "-", -1)
+		if settings.Headers == nil {
+			settings.Headers = map[string]string{}
+		}
+		settings.Headers[http.CanonicalHeaderKey(name)] = value
+	}
+}
+
+// Returns the settings the backend is initialised with: its entry in
+// BackendSettings if it has one, or the shared StorageSettings otherwise.
+func (c *Config) StorageSettingsFor(backend string) StorageSettings {
+	if settings, ok := c.BackendSettings[backend]; ok {
+		return settings
+	}
+	return c.StorageSettings
+}
+
+// Returns true if the backend is either the primary storage backend or one of
+// the backends that packages are replicated to.
+func (c *Config) UsesStorageBackend(backend string) bool {
+	if c.StorageBackend == backend {
+		return true
+	}
+	for _, b := range c.StorageBackends {
+		if b == backend {
+			return true
+		}
+	}
+	return false
+}
+
 func PathExists(path string) bool {
 	_, err := os.Stat(path)
 	return !os.IsNotExist(err)
@@ -18,22 +18,39 @@ package dao
 
 import (
 	"fmt"
+	"log"
+	"time"
 
 	core "github.com/ankyra/escape-core"
 	"github.com/ankyra/escape-inventory/config"
 	"github.com/ankyra/escape-inventory/dao/mem"
+	"github.com/ankyra/escape-inventory/dao/mysql"
 	"github.com/ankyra/escape-inventory/dao/postgres"
 	"github.com/ankyra/escape-inventory/dao/ql"
+	"github.com/ankyra/escape-inventory/dao/sqlite"
 	. "github.com/ankyra/escape-inventory/dao/types"
 )
 
 var GlobalDAO = mem.NewInMemoryDAO()
 
+// Where the in-memory database is saved. Empty when it isn't.
+var snapshotPath string
+
 func LoadFromConfig(conf *config.Config) error {
+	snapshotPath = ""
 	if conf.Database == "" {
 		return fmt.Errorf("Missing database configuration variable")
 	} else if conf.Database == "memory" {
-		GlobalDAO = mem.NewInMemoryDAO()
+		if conf.DatabaseSettings.SnapshotPath == "" {
+			GlobalDAO = mem.NewInMemoryDAO()
+			return nil
+		}
+		dao, err := mem.LoadSnapshot(conf.DatabaseSettings.SnapshotPath)
+		if err != nil {
+			return err
+		}
+		GlobalDAO = dao
+		snapshotPath = conf.DatabaseSettings.SnapshotPath
 		return nil
 	} else if conf.Database == "ql" {
 		dao, err := ql.NewQLDAO(conf.DatabaseSettings.Path)
@@ -42,6 +59,13 @@ func LoadFromConfig(conf *config.Config) error {
 		}
 		GlobalDAO = dao
 		return nil
+	} else if conf.Database == "sqlite" {
+		dao, err := sqlite.NewSQLiteDAO(conf.DatabaseSettings.Path)
+		if err != nil {
+			return err
+		}
+		GlobalDAO = dao
+		return nil
 	} else if conf.Database == "postgres" {
 		dao, err := postgres.NewPostgresDAO(conf.DatabaseSettings.PostgresUrl)
 		if err != nil {
@@ -49,12 +73,47 @@ func LoadFromConfig(conf *config.Config) error {
 		}
 		GlobalDAO = dao
 		return nil
+	} else if conf.Database == "mysql" {
+		dao, err := mysql.NewMySQLDAO(conf.DatabaseSettings.MysqlDsn)
+		if err != nil {
+			return err
+		}
+		GlobalDAO = dao
+		return nil
 	}
 
 	return fmt.Errorf("Unknown database backend: %s", conf.Database)
 }
 func TestSetup() {
 	GlobalDAO = mem.NewInMemoryDAO()
+	snapshotPath = ""
+}
+
+// Saves the in-memory database to the configured snapshot path. Does nothing
+// when snapshots aren't configured.
+func SaveSnapshot() error {
+	if snapshotPath == "" {
+		return nil
+	}
+	return mem.SaveSnapshot(GlobalDAO, snapshotPath)
+}
+
+// Runs SaveSnapshot in the background every interval.
+func StartSnapshots(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := SaveSnapshot(); err != nil {
+				log.Printf("Error: %s\n", err.Error())
+			}
+		}
+	}()
+}
+
+// The DAO that is passed to f should be used for everything that needs to be
+// part of the transaction. Using the global functions from f can block until
+// the transaction is done, depending on the database.
+func RunInTransaction(f func(DAO) error) error {
+	return GlobalDAO.RunInTransaction(f)
 }
 
 func GetNamespace(namespace string) (*Project, error) {
@@ -109,6 +168,10 @@ func UpdateApplication(app *Application) error {
 	return GlobalDAO.UpdateApplication(app)
 }
 
+func DeleteApplication(app *Application) error {
+	return GlobalDAO.DeleteApplication(app)
+}
+
 func GetApplication(namespace, name string) (*Application, error) {
 	return GlobalDAO.GetApplication(namespace, name)
 }
@@ -135,6 +198,10 @@ func UpdateRelease(release *Release) error {
 	return GlobalDAO.UpdateRelease(release)
 }
 
+func IncrementDownloads(release *Release) error {
+	return GlobalDAO.IncrementDownloads(release)
+}
+
 func GetRelease(namespace, name, releaseId string) (*Release, error) {
 	return GlobalDAO.GetRelease(namespace, name, releaseId)
 }
@@ -144,6 +211,9 @@ func GetReleaseByTag(namespace, name, tag string) (*Release, error) {
 func TagRelease(release *Release, tag string) error {
 	return GlobalDAO.TagRelease(release, tag)
 }
+func GetReleaseTags(app *Application) (map[string]string, error) {
+	return GlobalDAO.GetReleaseTags(app)
+}
 
 func GetProviders(providerName string) (map[string]*MinimalReleaseMetadata, error) {
 	return GlobalDAO.GetProviders(providerName)
@@ -161,6 +231,22 @@ func FindAllVersions(app *Application) ([]string, error) {
 	return GlobalDAO.FindAllVersions(app)
 }
 
+func GetArtifacts(release *Release) ([]*Artifact, error) {
+	return GlobalDAO.GetArtifacts(release)
+}
+
+func AddArtifact(release *Release, artifact *Artifact) error {
+	return GlobalDAO.AddArtifact(release, artifact)
+}
+
+func UpdateArtifactURIs(release *Release, artifact *Artifact) error {
+	return GlobalDAO.UpdateArtifactURIs(release, artifact)
+}
+
+func FindAllDraftVersions(app *Application) ([]string, error) {
+	return GlobalDAO.FindAllDraftVersions(app)
+}
+
 func GetPackageURIs(r *Release) ([]string, error) {
 	return GlobalDAO.GetPackageURIs(r)
 }
@@ -169,6 +255,14 @@ func AddPackageURI(r *Release, uri string) error {
 	return GlobalDAO.AddPackageURI(r, uri)
 }
 
+func DeleteRelease(r *Release) error {
+	return GlobalDAO.DeleteRelease(r)
+}
+
+func RemovePackageURI(r *Release, uri string) error {
+	return GlobalDAO.RemovePackageURI(r, uri)
+}
+
 func SetDependencies(r *Release, deps []*Dependency) error {
 	return GlobalDAO.SetDependencies(r, deps)
 }
@@ -177,6 +271,14 @@ func GetDependencies(r *Release) ([]*Dependency, error) {
 	return GlobalDAO.GetDependencies(r)
 }
 
+func SetDependencyTree(r *Release, tree []*DependencyTree) error {
+	return GlobalDAO.SetDependencyTree(r, tree)
+}
+
+func GetDependencyTree(r *Release) ([]*DependencyTree, error) {
+	return GlobalDAO.GetDependencyTree(r)
+}
+
 func GetDownstreamDependencies(r *Release) ([]*Dependency, error) {
 	return GlobalDAO.GetDownstreamDependencies(r)
 }
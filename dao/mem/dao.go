@@ -27,9 +27,11 @@ type application struct {
 }
 
 type release struct {
-	Release      *Release
-	Packages     []string
-	Dependencies []*Dependency
+	Release        *Release
+	Packages       []string
+	Artifacts      []*Artifact
+	Dependencies   []*Dependency
+	DependencyTree []*DependencyTree
 }
 
 type dao struct {
@@ -45,6 +47,10 @@ type dao struct {
 }
 
 func NewInMemoryDAO() DAO {
+	return &lockingDAO{dao: newDAO()}
+}
+
+func newDAO() *dao {
 	return &dao{
 		namespaceMetadata: map[string]*Project{},
 		namespaceHooks:    map[*Project]Hooks{},
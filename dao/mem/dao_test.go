@@ -17,8 +17,13 @@ limitations under the License.
 package mem
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	core "github.com/ankyra/escape-core"
 	"github.com/ankyra/escape-inventory/dao/types"
 	. "gopkg.in/check.v1"
 )
@@ -32,3 +37,214 @@ var _ = Suite(&memSuite{})
 func (s *memSuite) Test_DAO(c *C) {
 	types.ValidateDAO(NewInMemoryDAO, c)
 }
+
+func (s *memSuite) Test_DAO_can_be_used_concurrently(c *C) {
+	dao := NewInMemoryDAO()
+	errors := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			for j := 0; j < 100; j++ {
+				name := fmt.Sprintf("project-%d-%d", i, j)
+				if err := dao.AddNamespace(types.NewProject(name)); err != nil {
+					errors <- err
+					return
+				}
+				if err := dao.AddApplication(types.NewApplication(name, "app")); err != nil {
+					errors <- err
+					return
+				}
+			}
+			errors <- nil
+		}(i)
+		go func() {
+			for j := 0; j < 100; j++ {
+				namespaces, err := dao.GetNamespaces()
+				if err != nil {
+					errors <- err
+					return
+				}
+				for name := range namespaces {
+					dao.GetApplications(name)
+				}
+			}
+			errors <- nil
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		c.Assert(<-errors, IsNil)
+	}
+	namespaces, err := dao.GetNamespaces()
+	c.Assert(err, IsNil)
+	c.Assert(namespaces, HasLen, 1000)
+}
+
+func (s *memSuite) Test_Releases_are_copies(c *C) {
+	dao := NewInMemoryDAO()
+	c.Assert(dao.AddNamespace(types.NewProject("_")), IsNil)
+	app := types.NewApplication("_", "name")
+	c.Assert(dao.AddApplication(app), IsNil)
+	metadata := core.NewReleaseMetadata("name", "1")
+	metadata.Project = "_"
+	release := types.NewRelease(app, metadata)
+	c.Assert(dao.AddRelease(release), IsNil)
+	release.Downloads = 10
+
+	stored, err := dao.GetRelease("_", "name", "name-v1")
+	c.Assert(err, IsNil)
+	c.Assert(stored.Downloads, Equals, 0)
+	stored.Downloads = 1
+	again, err := dao.GetRelease("_", "name", "name-v1")
+	c.Assert(err, IsNil)
+	c.Assert(again.Downloads, Equals, 0)
+
+	stored.ProcessedDependencies = true
+	c.Assert(dao.UpdateRelease(stored), IsNil)
+	again, err = dao.GetRelease("_", "name", "name-v1")
+	c.Assert(err, IsNil)
+	c.Assert(again.ProcessedDependencies, Equals, true)
+}
+
+func (s *memSuite) Test_Dependency_trees_are_copies(c *C) {
+	dao := NewInMemoryDAO()
+	c.Assert(dao.AddNamespace(types.NewProject("_")), IsNil)
+	app := types.NewApplication("_", "name")
+	c.Assert(dao.AddApplication(app), IsNil)
+	metadata := core.NewReleaseMetadata("name", "1")
+	metadata.Project = "_"
+	release := types.NewRelease(app, metadata)
+	c.Assert(dao.AddRelease(release), IsNil)
+	tree := []*types.DependencyTree{types.NewDependencyTree(types.NewDependency("_", "lib", "1"))}
+	c.Assert(dao.SetDependencyTree(release, tree), IsNil)
+	tree[0].Dependency.Version = "2"
+
+	stored, err := dao.GetDependencyTree(release)
+	c.Assert(err, IsNil)
+	c.Assert(stored[0].Dependency.Version, Equals, "1")
+	stored[0].Children = append(stored[0].Children, types.NewDependencyTree(types.NewDependency("_", "base", "1")))
+	again, err := dao.GetDependencyTree(release)
+	c.Assert(err, IsNil)
+	c.Assert(again[0].Children, HasLen, 0)
+}
+
+func (s *memSuite) Test_SaveSnapshot_and_LoadSnapshot(c *C) {
+	dao := NewInMemoryDAO()
+	prj := types.NewProject("project")
+	prj.Description = "My project"
+	c.Assert(dao.AddNamespace(prj), IsNil)
+	c.Assert(dao.SetNamespaceHooks(prj, types.Hooks{"slack": {"url": "http://example.com"}}), IsNil)
+	app := types.NewApplication("project", "app")
+	c.Assert(dao.AddApplication(app), IsNil)
+	c.Assert(dao.SetApplicationHooks(app, types.Hooks{"web": {"url": "http://example.com"}}), IsNil)
+	metadata := core.NewReleaseMetadata("app", "1.0")
+	metadata.Project = "project"
+	metadata.SetProvides([]string{"kubernetes"})
+	rel := types.NewRelease(app, metadata)
+	rel.UploadedBy = "user"
+	c.Assert(dao.AddRelease(rel), IsNil)
+	c.Assert(dao.TagRelease(rel, "stable"), IsNil)
+	c.Assert(dao.AddPackageURI(rel, "gcs://bucket/app-v1.0.tgz"), IsNil)
+	c.Assert(dao.AddArtifact(rel, &types.Artifact{Name: "app", Platform: "linux", Arch: "amd64"}), IsNil)
+	dep := &types.Dependency{Project: "project", Application: "lib", Version: "0.1", DeployScope: true}
+	c.Assert(dao.SetDependencies(rel, []*types.Dependency{dep}), IsNil)
+	c.Assert(dao.SetDependencyTree(rel, []*types.DependencyTree{{Dependency: dep}}), IsNil)
+	c.Assert(dao.SetApplicationSubscribesToUpdatesFrom(app, []*types.Application{types.NewApplication("project", "lib")}), IsNil)
+	c.Assert(dao.RegisterProviders(metadata), IsNil)
+	_, err := dao.GetUserMetrics("user")
+	c.Assert(err, IsNil)
+	c.Assert(dao.SetUserMetrics("user", types.NewMetrics(0), types.NewMetrics(1)), IsNil)
+
+	dir, err := ioutil.TempDir("", "escape-inventory-snapshot")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshots", "inventory.json")
+	c.Assert(SaveSnapshot(dao, path), IsNil)
+	loaded, err := LoadSnapshot(path)
+	c.Assert(err, IsNil)
+
+	prj, err = loaded.GetNamespace("project")
+	c.Assert(err, IsNil)
+	c.Assert(prj.Description, Equals, "My project")
+	hooks, err := loaded.GetNamespaceHooks(prj)
+	c.Assert(err, IsNil)
+	c.Assert(hooks["slack"]["url"], Equals, "http://example.com")
+	app, err = loaded.GetApplication("project", "app")
+	c.Assert(err, IsNil)
+	hooks, err = loaded.GetApplicationHooks(app)
+	c.Assert(err, IsNil)
+	c.Assert(hooks["web"]["url"], Equals, "http://example.com")
+	rel, err = loaded.GetReleaseByTag("project", "app", "stable")
+	c.Assert(err, IsNil)
+	c.Assert(rel.Version, Equals, "1.0")
+	c.Assert(rel.UploadedBy, Equals, "user")
+	c.Assert(rel.Application, Equals, app)
+	c.Assert(rel.Metadata.GetReleaseId(), Equals, "app-v1.0")
+	uris, err := loaded.GetPackageURIs(rel)
+	c.Assert(err, IsNil)
+	c.Assert(uris, DeepEquals, []string{"gcs://bucket/app-v1.0.tgz"})
+	artifacts, err := loaded.GetArtifacts(rel)
+	c.Assert(err, IsNil)
+	c.Assert(artifacts, HasLen, 1)
+	c.Assert(artifacts[0].Platform, Equals, "linux")
+	deps, err := loaded.GetDependencies(rel)
+	c.Assert(err, IsNil)
+	c.Assert(deps, DeepEquals, []*types.Dependency{dep})
+	tree, err := loaded.GetDependencyTree(rel)
+	c.Assert(err, IsNil)
+	c.Assert(tree, HasLen, 1)
+	c.Assert(tree[0].Dependency, DeepEquals, dep)
+	versions, err := loaded.FindAllVersions(app)
+	c.Assert(err, IsNil)
+	c.Assert(versions, DeepEquals, []string{"1.0"})
+	downstream, err := loaded.GetDownstreamHooks(types.NewApplication("project", "lib"))
+	c.Assert(err, IsNil)
+	c.Assert(downstream, HasLen, 1)
+	c.Assert((*downstream[0])["web"]["url"], Equals, "http://example.com")
+	providers, err := loaded.GetProviders("kubernetes")
+	c.Assert(err, IsNil)
+	c.Assert(providers["project/app-v1.0"].Version, Equals, "1.0")
+	metrics, err := loaded.GetUserMetrics("user")
+	c.Assert(err, IsNil)
+	c.Assert(metrics.ProjectCount, Equals, 1)
+}
+
+func (s *memSuite) Test_SaveSnapshot_replaces_previous_snapshot(c *C) {
+	dir, err := ioutil.TempDir("", "escape-inventory-snapshot")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "inventory.json")
+	dao := NewInMemoryDAO()
+	c.Assert(dao.AddNamespace(types.NewProject("project")), IsNil)
+	c.Assert(SaveSnapshot(dao, path), IsNil)
+	c.Assert(dao.HardDeleteNamespace("project"), IsNil)
+	c.Assert(SaveSnapshot(dao, path), IsNil)
+
+	loaded, err := LoadSnapshot(path)
+	c.Assert(err, IsNil)
+	_, err = loaded.GetNamespace("project")
+	c.Assert(err, Equals, types.NotFound)
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 1)
+}
+
+func (s *memSuite) Test_LoadSnapshot_returns_empty_DAO_if_snapshot_doesnt_exist(c *C) {
+	dao, err := LoadSnapshot("testdata/doesnt_exist.json")
+	c.Assert(err, IsNil)
+	namespaces, err := dao.GetNamespaces()
+	c.Assert(err, IsNil)
+	c.Assert(namespaces, HasLen, 0)
+}
+
+func (s *memSuite) Test_LoadSnapshot_fails_if_snapshot_is_invalid(c *C) {
+	dir, err := ioutil.TempDir("", "escape-inventory-snapshot")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "inventory.json")
+	c.Assert(ioutil.WriteFile(path, []byte("{invalid"), 0644), IsNil)
+	_, err = LoadSnapshot(path)
+	c.Assert(err, Not(IsNil))
+
+	c.Assert(ioutil.WriteFile(path, []byte(`{"version": 100}`), 0644), IsNil)
+	_, err = LoadSnapshot(path)
+	c.Assert(err, ErrorMatches, "Unsupported database snapshot version 100 in .*")
+}
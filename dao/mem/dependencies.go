@@ -8,31 +8,67 @@ func (a *dao) GetAllReleasesWithoutProcessedDependencies() ([]*Release, error) {
 	result := []*Release{}
 	for _, rel := range a.releases {
 		if !rel.Release.ProcessedDependencies {
-			result = append(result, rel.Release)
+			result = append(result, copyRelease(rel.Release))
 		}
 	}
 	return result, nil
 }
 
 func (a *dao) SetDependencies(release *Release, depends []*Dependency) error {
-	r := a.releases[release]
-	r.Dependencies = depends
+	r, ok := a.lookupRelease(release)
+	if !ok {
+		return NotFound
+	}
+	r.Dependencies = copyDependencies(depends)
 	return nil
 }
 
 func (a *dao) GetDependencies(release *Release) ([]*Dependency, error) {
-	r, ok := a.releases[release]
+	r, ok := a.lookupRelease(release)
 	if !ok {
 		return []*Dependency{}, nil
 	}
-	return r.Dependencies, nil
+	return copyDependencies(r.Dependencies), nil
 }
 
 func (a *dao) SetDependencyTree(release *Release, depends []*DependencyTree) error {
+	r, ok := a.lookupRelease(release)
+	if !ok {
+		return NotFound
+	}
+	r.DependencyTree = copyDependencyTrees(depends)
 	return nil
 }
+
 func (a *dao) GetDependencyTree(release *Release) ([]*DependencyTree, error) {
-	return nil, nil
+	r, ok := a.lookupRelease(release)
+	if !ok || r.DependencyTree == nil {
+		return []*DependencyTree{}, nil
+	}
+	return copyDependencyTrees(r.DependencyTree), nil
+}
+
+// Trees built with shared subtrees are copied in full.
+func copyDependencyTrees(trees []*DependencyTree) []*DependencyTree {
+	result := []*DependencyTree{}
+	for _, tree := range trees {
+		dep := *tree.Dependency
+		result = append(result, &DependencyTree{
+			Dependency: &dep,
+			Children:   copyDependencyTrees(tree.Children),
+			Truncated:  tree.Truncated,
+		})
+	}
+	return result
+}
+
+func copyDependencies(deps []*Dependency) []*Dependency {
+	result := []*Dependency{}
+	for _, dep := range deps {
+		d := *dep
+		result = append(result, &d)
+	}
+	return result
 }
 
 func (a *dao) GetDownstreamDependencies(release *Release) ([]*Dependency, error) {
@@ -0,0 +1,333 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mem
+
+import (
+	"sync"
+
+	core "github.com/ankyra/escape-core"
+	. "github.com/ankyra/escape-inventory/dao/types"
+)
+
+// The in-memory DAO is shared between requests, so every call goes through a
+// read-write lock. Transactions hold on to the write lock until they're done.
+// GetUserMetrics creates missing metrics, so it needs the write lock as well.
+type lockingDAO struct {
+	lock   sync.RWMutex
+	saving sync.Mutex
+	dao    *dao
+}
+
+func (a *lockingDAO) GetNamespace(namespace string) (*Project, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetNamespace(namespace)
+}
+
+func (a *lockingDAO) AddNamespace(namespace *Project) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.AddNamespace(namespace)
+}
+
+func (a *lockingDAO) HardDeleteNamespace(namespace string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.HardDeleteNamespace(namespace)
+}
+
+func (a *lockingDAO) UpdateNamespace(project *Project) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.UpdateNamespace(project)
+}
+
+func (a *lockingDAO) GetNamespaces() (map[string]*Project, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetNamespaces()
+}
+
+func (a *lockingDAO) GetNamespacesByNames(namespaces []string) (map[string]*Project, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetNamespacesByNames(namespaces)
+}
+
+func (a *lockingDAO) GetNamespacesForUser(namespaces []string) (map[string]*Project, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetNamespacesForUser(namespaces)
+}
+
+func (a *lockingDAO) GetNamespacesFilteredBy(query *NamespacesFilter) (map[string]*Project, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetNamespacesFilteredBy(query)
+}
+
+func (a *lockingDAO) GetNamespaceHooks(namespace *Project) (Hooks, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetNamespaceHooks(namespace)
+}
+
+func (a *lockingDAO) SetNamespaceHooks(namespace *Project, hooks Hooks) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.SetNamespaceHooks(namespace, hooks)
+}
+
+func (a *lockingDAO) GetApplication(project, name string) (*Application, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetApplication(project, name)
+}
+
+func (a *lockingDAO) AddApplication(app *Application) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.AddApplication(app)
+}
+
+func (a *lockingDAO) UpdateApplication(app *Application) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.UpdateApplication(app)
+}
+
+func (a *lockingDAO) DeleteApplication(app *Application) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.DeleteApplication(app)
+}
+
+func (a *lockingDAO) GetApplications(project string) (map[string]*Application, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetApplications(project)
+}
+
+func (a *lockingDAO) FindAllVersions(app *Application) ([]string, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.FindAllVersions(app)
+}
+
+func (a *lockingDAO) FindAllDraftVersions(app *Application) ([]string, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.FindAllDraftVersions(app)
+}
+
+func (a *lockingDAO) GetApplicationHooks(app *Application) (Hooks, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetApplicationHooks(app)
+}
+
+func (a *lockingDAO) SetApplicationHooks(app *Application, hooks Hooks) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.SetApplicationHooks(app, hooks)
+}
+
+func (a *lockingDAO) GetDownstreamHooks(app *Application) ([]*Hooks, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetDownstreamHooks(app)
+}
+
+func (a *lockingDAO) SetApplicationSubscribesToUpdatesFrom(app *Application, upstream []*Application) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.SetApplicationSubscribesToUpdatesFrom(app, upstream)
+}
+
+func (a *lockingDAO) GetRelease(namespace, name, releaseId string) (*Release, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetRelease(namespace, name, releaseId)
+}
+
+func (a *lockingDAO) GetReleaseByTag(namespace, name, tag string) (*Release, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetReleaseByTag(namespace, name, tag)
+}
+
+func (a *lockingDAO) TagRelease(rel *Release, tag string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.TagRelease(rel, tag)
+}
+
+func (a *lockingDAO) GetReleaseTags(app *Application) (map[string]string, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetReleaseTags(app)
+}
+
+func (a *lockingDAO) AddRelease(rel *Release) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.AddRelease(rel)
+}
+
+func (a *lockingDAO) UpdateRelease(r *Release) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.UpdateRelease(r)
+}
+
+func (a *lockingDAO) IncrementDownloads(r *Release) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.IncrementDownloads(r)
+}
+
+func (a *lockingDAO) GetAllReleases() ([]*Release, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetAllReleases()
+}
+
+func (a *lockingDAO) GetPackageURIs(release *Release) ([]string, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetPackageURIs(release)
+}
+
+func (a *lockingDAO) AddPackageURI(release *Release, uri string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.AddPackageURI(release, uri)
+}
+
+func (a *lockingDAO) RemovePackageURI(release *Release, uri string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.RemovePackageURI(release, uri)
+}
+
+func (a *lockingDAO) GetArtifacts(release *Release) ([]*Artifact, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetArtifacts(release)
+}
+
+func (a *lockingDAO) AddArtifact(release *Release, artifact *Artifact) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.AddArtifact(release, artifact)
+}
+
+func (a *lockingDAO) UpdateArtifactURIs(release *Release, artifact *Artifact) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.UpdateArtifactURIs(release, artifact)
+}
+
+func (a *lockingDAO) DeleteRelease(rel *Release) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.DeleteRelease(rel)
+}
+
+func (a *lockingDAO) GetProviders(providerName string) (map[string]*MinimalReleaseMetadata, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetProviders(providerName)
+}
+
+func (a *lockingDAO) GetProvidersFilteredBy(providerName string, query *ProvidersFilter) (map[string]*MinimalReleaseMetadata, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetProvidersFilteredBy(providerName, query)
+}
+
+func (a *lockingDAO) RegisterProviders(release *core.ReleaseMetadata) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.RegisterProviders(release)
+}
+
+func (a *lockingDAO) GetAllReleasesWithoutProcessedDependencies() ([]*Release, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetAllReleasesWithoutProcessedDependencies()
+}
+
+func (a *lockingDAO) SetDependencies(release *Release, depends []*Dependency) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.SetDependencies(release, depends)
+}
+
+func (a *lockingDAO) GetDependencies(release *Release) ([]*Dependency, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetDependencies(release)
+}
+
+func (a *lockingDAO) SetDependencyTree(release *Release, depends []*DependencyTree) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.SetDependencyTree(release, depends)
+}
+
+func (a *lockingDAO) GetDependencyTree(release *Release) ([]*DependencyTree, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetDependencyTree(release)
+}
+
+func (a *lockingDAO) GetDownstreamDependencies(release *Release) ([]*Dependency, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetDownstreamDependencies(release)
+}
+
+func (a *lockingDAO) GetDownstreamDependenciesFilteredBy(release *Release, query *DownstreamDependenciesFilter) ([]*Dependency, error) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.dao.GetDownstreamDependenciesFilteredBy(release, query)
+}
+
+func (a *lockingDAO) GetUserMetrics(userID string) (*Metrics, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.GetUserMetrics(userID)
+}
+
+func (a *lockingDAO) SetUserMetrics(userID string, previous, new *Metrics) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.SetUserMetrics(userID, previous, new)
+}
+
+func (a *lockingDAO) RunInTransaction(f func(DAO) error) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.RunInTransaction(f)
+}
+
+func (a *lockingDAO) WipeDatabase() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.dao.WipeDatabase()
+}
@@ -14,7 +14,11 @@ func (a *dao) UpdateNamespace(project *Project) error {
 }
 
 func (a *dao) GetNamespaces() (map[string]*Project, error) {
-	return a.namespaceMetadata, nil
+	result := map[string]*Project{}
+	for name, namespace := range a.namespaceMetadata {
+		result[name] = namespace
+	}
+	return result, nil
 }
 
 func (a *dao) GetNamespacesByNames(namespaces []string) (map[string]*Project, error) {
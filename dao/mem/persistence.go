@@ -0,0 +1,300 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mem
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	core "github.com/ankyra/escape-core"
+	. "github.com/ankyra/escape-inventory/dao/types"
+)
+
+const snapshotFormatVersion = 1
+
+type persistedState struct {
+	Version       int                                           `json:"version"`
+	Namespaces    []*persistedNamespace                         `json:"namespaces"`
+	Subscriptions []*persistedSubscription                      `json:"subscriptions"`
+	Metrics       map[string]*Metrics                           `json:"metrics"`
+	Providers     map[string]map[string]*MinimalReleaseMetadata `json:"providers"`
+}
+
+type persistedNamespace struct {
+	Namespace *Project         `json:"namespace"`
+	Hooks     Hooks            `json:"hooks"`
+	Units     []*persistedUnit `json:"units"`
+}
+
+type persistedUnit struct {
+	Unit     *Application        `json:"unit"`
+	Hooks    Hooks               `json:"hooks"`
+	Releases []*persistedRelease `json:"releases"`
+	Tags     map[string]string   `json:"tags"`
+}
+
+type persistedRelease struct {
+	ReleaseId             string            `json:"release_id"`
+	Version               string            `json:"version"`
+	Metadata              json.RawMessage   `json:"metadata"`
+	ProcessedDependencies bool              `json:"processed_dependencies"`
+	Downloads             int               `json:"downloads"`
+	UploadedBy            string            `json:"uploaded_by"`
+	UploadedAt            time.Time         `json:"uploaded_at"`
+	PackageSHA256         string            `json:"package_sha256"`
+	PackageSize           int64             `json:"package_size"`
+	Draft                 bool              `json:"draft"`
+	Packages              []string          `json:"packages"`
+	Artifacts             []*Artifact       `json:"artifacts"`
+	Dependencies          []*Dependency     `json:"dependencies"`
+	DependencyTree        []*DependencyTree `json:"dependency_tree"`
+}
+
+type persistedSubscription struct {
+	Project  string         `json:"project"`
+	Name     string         `json:"name"`
+	Upstream []*Application `json:"upstream"`
+}
+
+// Returns an in-memory DAO with the state that was saved to path by
+// SaveSnapshot. The DAO starts out empty if there's no snapshot at path yet.
+func LoadSnapshot(path string) (DAO, error) {
+	result := newDAO()
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &lockingDAO{dao: result}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Couldn't read database snapshot '%s': %s", path, err.Error())
+	}
+	state := persistedState{}
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("Couldn't unmarshal database snapshot '%s': %s", path, err.Error())
+	}
+	if state.Version != snapshotFormatVersion {
+		return nil, fmt.Errorf("Unsupported database snapshot version %d in '%s'", state.Version, path)
+	}
+	if err := result.load(&state); err != nil {
+		return nil, fmt.Errorf("Couldn't load database snapshot '%s': %s", path, err.Error())
+	}
+	return &lockingDAO{dao: result}, nil
+}
+
+// Writes the state of an in-memory DAO to path. The snapshot is written to a
+// temporary file first and then renamed, so that a crash halfway through
+// doesn't leave a truncated snapshot behind.
+func SaveSnapshot(d DAO, path string) error {
+	l, ok := d.(*lockingDAO)
+	if !ok {
+		return fmt.Errorf("Only the in-memory database can be saved to a snapshot")
+	}
+	// Makes sure an older snapshot can't replace a newer one.
+	l.saving.Lock()
+	defer l.saving.Unlock()
+	l.lock.RLock()
+	content, err := json.Marshal(l.dao.persistedState())
+	l.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (a *dao) persistedState() *persistedState {
+	state := &persistedState{
+		Version:       snapshotFormatVersion,
+		Namespaces:    []*persistedNamespace{},
+		Subscriptions: []*persistedSubscription{},
+		Metrics:       a.metrics,
+		Providers:     a.providers,
+	}
+	names := []string{}
+	for name := range a.namespaceMetadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prj := a.namespaceMetadata[name]
+		namespace := &persistedNamespace{
+			Namespace: prj,
+			Hooks:     a.namespaceHooks[prj],
+			Units:     []*persistedUnit{},
+		}
+		for _, app := range a.namespaces[name] {
+			namespace.Units = append(namespace.Units, a.persistedUnit(app))
+		}
+		sort.Slice(namespace.Units, func(i, j int) bool {
+			return namespace.Units[i].Unit.Name < namespace.Units[j].Unit.Name
+		})
+		state.Namespaces = append(state.Namespaces, namespace)
+	}
+	for app, upstream := range a.subscriptions {
+		state.Subscriptions = append(state.Subscriptions, &persistedSubscription{
+			Project:  app.Project,
+			Name:     app.Name,
+			Upstream: upstream,
+		})
+	}
+	return state
+}
+
+func (a *dao) persistedUnit(app *application) *persistedUnit {
+	unit := &persistedUnit{
+		Unit:     app.App,
+		Hooks:    a.applicationHooks[app.App],
+		Releases: []*persistedRelease{},
+		Tags:     map[string]string{},
+	}
+	for _, rel := range app.Releases {
+		r := rel.Release
+		unit.Releases = append(unit.Releases, &persistedRelease{
+			ReleaseId:             r.ReleaseId,
+			Version:               r.Version,
+			Metadata:              json.RawMessage(r.Metadata.ToJson()),
+			ProcessedDependencies: r.ProcessedDependencies,
+			Downloads:             r.Downloads,
+			UploadedBy:            r.UploadedBy,
+			UploadedAt:            r.UploadedAt,
+			PackageSHA256:         r.PackageSHA256,
+			PackageSize:           r.PackageSize,
+			Draft:                 r.Draft,
+			Packages:              rel.Packages,
+			Artifacts:             rel.Artifacts,
+			Dependencies:          rel.Dependencies,
+			DependencyTree:        rel.DependencyTree,
+		})
+	}
+	sort.Slice(unit.Releases, func(i, j int) bool {
+		return unit.Releases[i].ReleaseId < unit.Releases[j].ReleaseId
+	})
+	for tag, rel := range app.Tags {
+		unit.Tags[tag] = rel.Release.ReleaseId
+	}
+	return unit
+}
+
+func (a *dao) load(state *persistedState) error {
+	for _, namespace := range state.Namespaces {
+		prj := namespace.Namespace
+		if prj == nil {
+			return fmt.Errorf("Missing namespace")
+		}
+		apps := map[string]*application{}
+		a.namespaceMetadata[prj.Name] = prj
+		a.namespaceHooks[prj] = loadedHooks(namespace.Hooks)
+		a.namespaces[prj.Name] = apps
+		for _, unit := range namespace.Units {
+			if unit.Unit == nil {
+				return fmt.Errorf("Missing unit in namespace '%s'", prj.Name)
+			}
+			app, err := a.loadUnit(unit)
+			if err != nil {
+				return err
+			}
+			apps[app.App.Name] = app
+		}
+	}
+	for _, sub := range state.Subscriptions {
+		app, ok := a.namespaces[sub.Project][sub.Name]
+		if !ok {
+			continue
+		}
+		a.subscriptions[app.App] = sub.Upstream
+	}
+	if state.Metrics != nil {
+		a.metrics = state.Metrics
+	}
+	if state.Providers != nil {
+		a.providers = state.Providers
+	}
+	return nil
+}
+
+func (a *dao) loadUnit(unit *persistedUnit) (*application, error) {
+	app := &application{unit.Unit, map[string]*release{}, map[string]*release{}}
+	a.apps[unit.Unit] = app
+	a.applicationHooks[unit.Unit] = loadedHooks(unit.Hooks)
+	for _, r := range unit.Releases {
+		metadata, err := core.NewReleaseMetadataFromJsonString(string(r.Metadata))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid metadata for release '%s': %s", r.ReleaseId, err.Error())
+		}
+		rel := &release{
+			Release: &Release{
+				Application:           unit.Unit,
+				ReleaseId:             r.ReleaseId,
+				Version:               r.Version,
+				Metadata:              metadata,
+				ProcessedDependencies: r.ProcessedDependencies,
+				Downloads:             r.Downloads,
+				UploadedBy:            r.UploadedBy,
+				UploadedAt:            r.UploadedAt,
+				PackageSHA256:         r.PackageSHA256,
+				PackageSize:           r.PackageSize,
+				Draft:                 r.Draft,
+			},
+			Packages:       r.Packages,
+			Artifacts:      r.Artifacts,
+			Dependencies:   r.Dependencies,
+			DependencyTree: r.DependencyTree,
+		}
+		if rel.Packages == nil {
+			rel.Packages = []string{}
+		}
+		app.Releases[r.ReleaseId] = rel
+		a.releases[rel.Release] = rel
+	}
+	for tag, releaseId := range unit.Tags {
+		rel, ok := app.Releases[releaseId]
+		if !ok {
+			return nil, fmt.Errorf("Tag '%s' of '%s/%s' points to unknown release '%s'", tag, unit.Unit.Project, unit.Unit.Name, releaseId)
+		}
+		app.Tags[tag] = rel
+	}
+	return app, nil
+}
+
+func loadedHooks(hooks Hooks) Hooks {
+	if hooks == nil {
+		return NewHooks()
+	}
+	return hooks
+}
@@ -17,7 +17,7 @@ func (a *dao) GetRelease(namespace, name, releaseId string) (*Release, error) {
 	if !ok {
 		return nil, NotFound
 	}
-	return release.Release, nil
+	return copyRelease(release.Release), nil
 }
 
 func (a *dao) GetReleaseByTag(namespace, name, tag string) (*Release, error) {
@@ -33,7 +33,7 @@ func (a *dao) GetReleaseByTag(namespace, name, tag string) (*Release, error) {
 	if !ok {
 		return nil, NotFound
 	}
-	return release.Release, nil
+	return copyRelease(release.Release), nil
 }
 
 func (a *dao) TagRelease(rel *Release, tag string) error {
@@ -53,6 +53,22 @@ func (a *dao) TagRelease(rel *Release, tag string) error {
 	return nil
 }
 
+func (a *dao) GetReleaseTags(app *Application) (map[string]string, error) {
+	result := map[string]string{}
+	prj, ok := a.namespaces[app.Project]
+	if !ok {
+		return result, nil
+	}
+	application, ok := prj[app.Name]
+	if !ok {
+		return result, nil
+	}
+	for tag, release := range application.Tags {
+		result[tag] = release.Release.Version
+	}
+	return result, nil
+}
+
 func (a *dao) AddRelease(rel *Release) error {
 	apps, ok := a.namespaces[rel.Application.Project]
 	if !ok {
@@ -67,38 +83,111 @@ func (a *dao) AddRelease(rel *Release) error {
 	if alreadyExists {
 		return AlreadyExists
 	}
+	stored := copyRelease(rel)
 	app.Releases[key] = &release{
-		Release:  rel,
+		Release:  stored,
 		Packages: []string{},
 	}
 	apps[rel.Application.Name] = app
 	a.namespaces[rel.Application.Project] = apps
-	a.releases[rel] = app.Releases[key]
+	a.releases[stored] = app.Releases[key]
 	return nil
 }
 
-func (a *dao) UpdateRelease(r *Release) error {
+func (a *dao) UpdateRelease(rel *Release) error {
+	r, ok := a.lookupRelease(rel)
+	if !ok {
+		return NotFound
+	}
+	updated := *rel
+	updated.Application = r.Release.Application
+	updated.Downloads = r.Release.Downloads
+	*r.Release = updated
+	return nil
+}
+
+func (a *dao) IncrementDownloads(rel *Release) error {
+	r, ok := a.lookupRelease(rel)
+	if !ok {
+		return NotFound
+	}
+	r.Release.Downloads += 1
+	return nil
+}
+
+// Releases are stored and handed out as copies, so that changes made by
+// callers outside of the lock don't race with readers of the stored release.
+// Changes are written back with UpdateRelease.
+func copyRelease(rel *Release) *Release {
+	result := *rel
+	return &result
+}
+
+// Finds the stored release by its id, because the caller's release is a copy.
+func (a *dao) lookupRelease(rel *Release) (*release, bool) {
+	prj, ok := a.namespaces[rel.Application.Project]
+	if !ok {
+		return nil, false
+	}
+	app, ok := prj[rel.Application.Name]
+	if !ok {
+		return nil, false
+	}
+	r, ok := app.Releases[rel.ReleaseId]
+	return r, ok
+}
+
+func (a *dao) DeleteRelease(rel *Release) error {
+	prj, ok := a.namespaces[rel.Application.Project]
+	if !ok {
+		return NotFound
+	}
+	app, ok := prj[rel.Application.Name]
+	if !ok {
+		return NotFound
+	}
+	r, ok := app.Releases[rel.ReleaseId]
+	if !ok {
+		return NotFound
+	}
+	for tag, tagged := range app.Tags {
+		if tagged == r {
+			delete(app.Tags, tag)
+		}
+	}
+	// Providers are registered under the project in the release metadata.
+	key := rel.Metadata.Project + "-" + rel.Metadata.Name
+	for _, store := range a.providers {
+		if provider, ok := store[key]; ok && provider.Version == rel.Version {
+			delete(store, key)
+		}
+	}
+	delete(a.releases, r.Release)
+	delete(app.Releases, rel.ReleaseId)
 	return nil
 }
 
 func (a *dao) GetAllReleases() ([]*Release, error) {
 	result := []*Release{}
 	for _, rel := range a.releases {
-		result = append(result, rel.Release)
+		result = append(result, copyRelease(rel.Release))
 	}
 	return result, nil
 }
 
 func (a *dao) GetPackageURIs(release *Release) ([]string, error) {
-	r, ok := a.releases[release]
+	r, ok := a.lookupRelease(release)
 	if !ok {
 		return []string{}, nil
 	}
-	return r.Packages, nil
+	return append([]string{}, r.Packages...), nil
 }
 
 func (a *dao) AddPackageURI(release *Release, uri string) error {
-	r := a.releases[release]
+	r, ok := a.lookupRelease(release)
+	if !ok {
+		return NotFound
+	}
 	for _, u := range r.Packages {
 		if u == uri {
 			return AlreadyExists
@@ -107,3 +196,67 @@ func (a *dao) AddPackageURI(release *Release, uri string) error {
 	r.Packages = append(r.Packages, uri)
 	return nil
 }
+
+func (a *dao) RemovePackageURI(release *Release, uri string) error {
+	r, ok := a.lookupRelease(release)
+	if !ok {
+		return NotFound
+	}
+	packages := []string{}
+	for _, u := range r.Packages {
+		if u != uri {
+			packages = append(packages, u)
+		}
+	}
+	if len(packages) == len(r.Packages) {
+		return NotFound
+	}
+	r.Packages = packages
+	return nil
+}
+
+func (a *dao) GetArtifacts(release *Release) ([]*Artifact, error) {
+	r, ok := a.lookupRelease(release)
+	if !ok {
+		return []*Artifact{}, nil
+	}
+	result := []*Artifact{}
+	for _, artifact := range r.Artifacts {
+		result = append(result, copyArtifact(artifact))
+	}
+	return result, nil
+}
+
+func (a *dao) AddArtifact(release *Release, artifact *Artifact) error {
+	r, ok := a.lookupRelease(release)
+	if !ok {
+		return NotFound
+	}
+	for _, existing := range r.Artifacts {
+		if existing.Name == artifact.Name {
+			return AlreadyExists
+		}
+	}
+	r.Artifacts = append(r.Artifacts, copyArtifact(artifact))
+	return nil
+}
+
+func (a *dao) UpdateArtifactURIs(release *Release, artifact *Artifact) error {
+	r, ok := a.lookupRelease(release)
+	if !ok {
+		return NotFound
+	}
+	for _, existing := range r.Artifacts {
+		if existing.Name == artifact.Name {
+			existing.URIs = append([]string{}, artifact.URIs...)
+			return nil
+		}
+	}
+	return NotFound
+}
+
+func copyArtifact(artifact *Artifact) *Artifact {
+	result := *artifact
+	result.URIs = append([]string{}, artifact.URIs...)
+	return &result
+}
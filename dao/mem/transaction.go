@@ -0,0 +1,204 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mem
+
+import (
+	"reflect"
+
+	. "github.com/ankyra/escape-inventory/dao/types"
+)
+
+// The state is copied before the transaction starts and restored if it fails.
+// Stored objects are restored in place, so the pointers the DAO keeps
+// internally (and the applications it hands out, which aren't copied) stay
+// valid; releases are only ever handed out as copies. The caller holds the
+// write lock, so transactions run one at a time.
+func (a *dao) RunInTransaction(f func(DAO) error) error {
+	s := a.snapshot()
+	defer func() {
+		if p := recover(); p != nil {
+			a.restore(s)
+			panic(p)
+		}
+	}()
+	if err := f(&transaction{a}); err != nil {
+		a.restore(s)
+		return err
+	}
+	return nil
+}
+
+type transaction struct {
+	*dao
+}
+
+func (t *transaction) RunInTransaction(f func(DAO) error) error {
+	return f(t)
+}
+
+type snapshot struct {
+	namespaceMetadata map[string]*Project
+	namespaceHooks    map[*Project]Hooks
+	namespaces        map[string]map[string]*application
+	apps              map[*Application]*application
+	applicationHooks  map[*Application]Hooks
+	subscriptions     map[*Application][]*Application
+	releases          map[*Release]*release
+	metrics           map[string]*Metrics
+	providers         map[string]map[string]*MinimalReleaseMetadata
+
+	projectValues      map[*Project]Project
+	applicationValues  map[*Application]Application
+	appEntryValues     map[*application]application
+	releaseValues      map[*Release]Release
+	releaseEntryValues map[*release]release
+	metricsValues      map[*Metrics]Metrics
+	providerValues     map[*MinimalReleaseMetadata]MinimalReleaseMetadata
+}
+
+func (a *dao) snapshot() *snapshot {
+	s := &snapshot{
+		namespaceMetadata:  map[string]*Project{},
+		namespaceHooks:     map[*Project]Hooks{},
+		namespaces:         map[string]map[string]*application{},
+		apps:               map[*Application]*application{},
+		applicationHooks:   map[*Application]Hooks{},
+		subscriptions:      map[*Application][]*Application{},
+		releases:           map[*Release]*release{},
+		metrics:            map[string]*Metrics{},
+		providers:          map[string]map[string]*MinimalReleaseMetadata{},
+		projectValues:      map[*Project]Project{},
+		applicationValues:  map[*Application]Application{},
+		appEntryValues:     map[*application]application{},
+		releaseValues:      map[*Release]Release{},
+		releaseEntryValues: map[*release]release{},
+		metricsValues:      map[*Metrics]Metrics{},
+		providerValues:     map[*MinimalReleaseMetadata]MinimalReleaseMetadata{},
+	}
+	for name, prj := range a.namespaceMetadata {
+		s.namespaceMetadata[name] = prj
+		s.projectValues[prj] = *prj
+	}
+	for prj, hooks := range a.namespaceHooks {
+		s.namespaceHooks[prj] = hooks
+	}
+	for name, apps := range a.namespaces {
+		s.namespaces[name] = map[string]*application{}
+		for appName, app := range apps {
+			s.namespaces[name][appName] = app
+			s.saveApplication(app)
+		}
+	}
+	for key, app := range a.apps {
+		s.apps[key] = app
+		s.applicationValues[key] = *key
+		s.saveApplication(app)
+	}
+	for app, hooks := range a.applicationHooks {
+		s.applicationHooks[app] = hooks
+	}
+	for app, upstream := range a.subscriptions {
+		s.subscriptions[app] = upstream
+	}
+	for key, rel := range a.releases {
+		s.releases[key] = rel
+		s.releaseValues[key] = *key
+		s.releaseEntryValues[rel] = *rel
+	}
+	for user, metrics := range a.metrics {
+		s.metrics[user] = metrics
+		s.metricsValues[metrics] = *metrics
+	}
+	for provider, store := range a.providers {
+		s.providers[provider] = map[string]*MinimalReleaseMetadata{}
+		for key, metadata := range store {
+			s.providers[provider][key] = metadata
+			s.providerValues[metadata] = *metadata
+		}
+	}
+	return s
+}
+
+// The release and tag maps of applications are changed in place, so they're
+// copied as well.
+func (s *snapshot) saveApplication(app *application) {
+	if _, saved := s.appEntryValues[app]; saved {
+		return
+	}
+	value := application{
+		App:      app.App,
+		Releases: map[string]*release{},
+		Tags:     map[string]*release{},
+	}
+	for id, rel := range app.Releases {
+		value.Releases[id] = rel
+	}
+	for tag, rel := range app.Tags {
+		value.Tags[tag] = rel
+	}
+	s.appEntryValues[app] = value
+	s.applicationValues[app.App] = *app.App
+}
+
+// Only objects that were changed are written back, because the other objects
+// can still be read outside of the lock by whoever they were handed out to.
+func (a *dao) restore(s *snapshot) {
+	a.namespaceMetadata = s.namespaceMetadata
+	a.namespaceHooks = s.namespaceHooks
+	a.namespaces = s.namespaces
+	a.apps = s.apps
+	a.applicationHooks = s.applicationHooks
+	a.subscriptions = s.subscriptions
+	a.releases = s.releases
+	a.metrics = s.metrics
+	a.providers = s.providers
+	for prj, value := range s.projectValues {
+		if !reflect.DeepEqual(*prj, value) {
+			*prj = value
+		}
+	}
+	for app, value := range s.applicationValues {
+		if !reflect.DeepEqual(*app, value) {
+			*app = value
+		}
+	}
+	for app, value := range s.appEntryValues {
+		if !reflect.DeepEqual(*app, value) {
+			*app = value
+		}
+	}
+	for rel, value := range s.releaseValues {
+		if !reflect.DeepEqual(*rel, value) {
+			*rel = value
+		}
+	}
+	for rel, value := range s.releaseEntryValues {
+		if !reflect.DeepEqual(*rel, value) {
+			*rel = value
+		}
+	}
+	for metrics, value := range s.metricsValues {
+		if !reflect.DeepEqual(*metrics, value) {
+			*metrics = value
+		}
+	}
+	for metadata, value := range s.providerValues {
+		if !reflect.DeepEqual(*metadata, value) {
+			*metadata = value
+		}
+	}
+}
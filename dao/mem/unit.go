@@ -31,7 +31,23 @@ func (a *dao) FindAllVersions(app *Application) ([]string, error) {
 		return versions, nil
 	}
 	for _, r := range application.Releases {
-		versions = append(versions, r.Release.Version)
+		if !r.Release.Draft {
+			versions = append(versions, r.Release.Version)
+		}
+	}
+	return versions, nil
+}
+
+func (a *dao) FindAllDraftVersions(app *Application) ([]string, error) {
+	application := a.apps[app]
+	versions := []string{}
+	if application == nil {
+		return versions, nil
+	}
+	for _, r := range application.Releases {
+		if r.Release.Draft {
+			versions = append(versions, r.Release.Version)
+		}
 	}
 	return versions, nil
 }
@@ -64,6 +80,26 @@ func (a *dao) UpdateApplication(app *Application) error {
 	return nil
 }
 
+func (a *dao) DeleteApplication(app *Application) error {
+	apps, ok := a.namespaces[app.Project]
+	if !ok {
+		return NotFound
+	}
+	unit, ok := apps[app.Name]
+	if !ok {
+		return NotFound
+	}
+	for subscriber := range a.subscriptions {
+		if subscriber.Project == app.Project && subscriber.Name == app.Name {
+			delete(a.subscriptions, subscriber)
+		}
+	}
+	delete(a.applicationHooks, unit.App)
+	delete(a.apps, unit.App)
+	delete(apps, app.Name)
+	return nil
+}
+
 func (a *dao) GetApplicationHooks(app *Application) (Hooks, error) {
 	apps, ok := a.namespaces[app.Project]
 	if !ok {
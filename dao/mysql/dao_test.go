@@ -0,0 +1,68 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/ankyra/escape-inventory/dao/types"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type mysqlSuite struct{}
+
+var _ = Suite(&mysqlSuite{})
+
+func (s *mysqlSuite) Test_DAO(c *C) {
+	enableTest := false
+	for _, e := range os.Environ() {
+		if e == "ENABLE_MYSQL_TESTS=1" {
+			enableTest = true
+		}
+	}
+	if enableTest {
+		types.ValidateDAO(func() types.DAO {
+
+			// Empty database
+			dsn := "root:@tcp(localhost:3306)/inventory"
+			db, err := sql.Open("mysql", dsn)
+			c.Assert(err, IsNil)
+			for _, table := range []string{"`release`", "release_tags", "package", "release_artifact", "acl",
+				"application", "project", "release_dependency", "release_dependency_tree", "subscriptions", "metrics", "providers"} {
+				db.Exec("DELETE FROM " + table)
+			}
+			c.Assert(db.Close(), IsNil)
+
+			// Create unit
+			dao, err := NewMySQLDAO(dsn)
+			c.Assert(err, IsNil)
+			return dao
+		}, c)
+	} else {
+		println("MySQL tests have not been enabled. Use ENABLE_MYSQL_TESTS=1 to do so")
+	}
+}
+
+func (s *mysqlSuite) Test_NewMySQLDAO_fails_if_DSN_is_invalid(c *C) {
+	_, err := NewMySQLDAO("root:secret@localhost:3306/inventory")
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Matches, "Invalid MySQL DSN: .*")
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/mattes/migrate/database"
+)
+
+// The vendored migrate library doesn't come with a MySQL driver, so the
+// migrations are applied through this one. Everything runs on a single
+// connection, because the migration lock is tied to the session that took
+// it. The driver isn't registered with the library, which means it can't be
+// opened by URL.
+type migrationDriver struct {
+	conn *sql.Conn
+}
+
+// Inventories that share a database and start at the same time wait for each
+// other's migrations.
+const migrationLock = "escape-inventory-migrations"
+const migrationLockTimeout = 60
+
+func newMigrationDriver(db *sql.DB) (*migrationDriver, error) {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.ExecContext(context.Background(), `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL, dirty BOOLEAN NOT NULL)`)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &migrationDriver{conn: conn}, nil
+}
+
+func (m *migrationDriver) Open(url string) (database.Driver, error) {
+	return nil, fmt.Errorf("The MySQL migration driver can't be opened by URL")
+}
+
+func (m *migrationDriver) Close() error {
+	return m.conn.Close()
+}
+
+func (m *migrationDriver) Lock() error {
+	var locked sql.NullInt64
+	err := m.conn.QueryRowContext(context.Background(), `SELECT GET_LOCK(?, ?)`, migrationLock, migrationLockTimeout).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return database.ErrLocked
+	}
+	return nil
+}
+
+func (m *migrationDriver) Unlock() error {
+	_, err := m.conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, migrationLock)
+	return err
+}
+
+// MySQL commits schema changes straight away, so migrations don't run in a
+// transaction. A migration that fails halfway leaves the database dirty.
+func (m *migrationDriver) Run(migration io.Reader) error {
+	query, err := ioutil.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+	if _, err := m.conn.ExecContext(context.Background(), string(query)); err != nil {
+		return &database.Error{OrigErr: err, Query: query}
+	}
+	return nil
+}
+
+func (m *migrationDriver) SetVersion(version int, dirty bool) error {
+	ctx := context.Background()
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM schema_migrations`); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if version >= 0 {
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, dirty) VALUES (?, ?)`, version, dirty); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (m *migrationDriver) Version() (int, bool, error) {
+	var version int
+	var dirty bool
+	err := m.conn.QueryRowContext(context.Background(), `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return database.NilVersion, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	return version, dirty, nil
+}
+
+func (m *migrationDriver) Drop() error {
+	ctx := context.Background()
+	rows, err := m.conn.QueryContext(ctx, `SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE()`)
+	if err != nil {
+		return err
+	}
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	for _, table := range tables {
+		if _, err := m.conn.ExecContext(ctx, "DROP TABLE `"+table+"`"); err != nil {
+			return err
+		}
+	}
+	_, err = m.conn.ExecContext(ctx, `CREATE TABLE schema_migrations (version BIGINT NOT NULL, dirty BOOLEAN NOT NULL)`)
+	return err
+}
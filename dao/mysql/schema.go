@@ -0,0 +1,304 @@
+// Code generated by go-bindata.
+// sources:
+// dao/mysql/schemas/1_initial_schema.down.sql
+// dao/mysql/schemas/1_initial_schema.up.sql
+// dao/mysql/schemas/2_release_dependency_trees.down.sql
+// dao/mysql/schemas/2_release_dependency_trees.up.sql
+// DO NOT EDIT!
+
+package mysql
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func bindataRead(data []byte, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("Read %q: %v", name, err)
+	}
+
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, gz)
+	clErr := gz.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("Read %q: %v", name, err)
+	}
+	if clErr != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+type asset struct {
+	bytes []byte
+	info  os.FileInfo
+}
+
+type bindataFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi bindataFileInfo) Name() string {
+	return fi.name
+}
+func (fi bindataFileInfo) Size() int64 {
+	return fi.size
+}
+func (fi bindataFileInfo) Mode() os.FileMode {
+	return fi.mode
+}
+func (fi bindataFileInfo) ModTime() time.Time {
+	return fi.modTime
+}
+func (fi bindataFileInfo) IsDir() bool {
+	return false
+}
+func (fi bindataFileInfo) Sys() interface{} {
+	return nil
+}
+
+var __1_initial_schemaDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x6c\x8d\x31\x0a\x02\x41\x0c\x45\xfb\x3d\xc5\xde\x63\x2b\x45\x3b\x41\x11\x7b\x37\x66\xbe\x4b\x74\x9c\x09\x99\x28\x78\x7b\x11\x2c\x0c\x4c\x99\xf7\xfe\x23\x9b\xe3\xfe\x30\x9e\x56\xeb\xdd\x76\x7c\xc0\x4d\xb8\x4d\xc3\x1f\x23\xce\xe1\x56\xab\x2f\x49\xb0\xb8\x32\x64\x50\xc3\x99\xcc\xe5\x4a\xec\x31\x21\xbe\xd3\x82\x6e\x90\xa0\x28\x09\x85\xdf\x5d\xed\xb4\xc4\x47\xf3\xcf\xcc\x81\xb6\xe7\xa5\xb1\x89\xba\xd4\x12\xf7\xa4\x9a\x85\xe9\x2b\x02\x57\xab\x37\xb0\x4f\xc3\x67\x00\xf1\x54\x13\xae\xff\x00\x00\x00")
+
+func _1_initial_schemaDownSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__1_initial_schemaDownSql,
+		"1_initial_schema.down.sql",
+	)
+}
+
+func _1_initial_schemaDownSql() (*asset, error) {
+	bytes, err := _1_initial_schemaDownSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "1_initial_schema.down.sql", size: 255, mode: os.FileMode(420), modTime: time.Unix(1792306067, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __1_initial_schemaUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xac\x56\x5d\x6f\x9b\x30\x14\x7d\xcf\xaf\xf0\x5b\x13\x89\x49\x6b\xd6\x46\x9d\xa6\x3d\xd0\x96\x6e\xd1\x68\x32\xa5\x64\x5a\x9f\xa8\x63\xdf\x50\xaf\x04\x5b\xb6\xe9\xd6\x4d\xfb\xef\x13\x09\x18\x02\x01\xd2\xc1\x23\xbe\x1f\xbe\xe7\xf8\xdc\x23\xae\x16\x8e\xed\x39\xc8\xb3\x2f\x5d\x07\x09\xc9\x7f\x00\xd1\x68\x38\x40\x08\xa1\x08\x6f\x00\x7d\xb3\x17\x57\x9f\xed\xc5\xf0\xdd\x78\x64\x6d\x4f\x29\x28\x22\x99\xd0\x8c\x47\xc8\x73\xbe\x7b\xbb\x53\x2e\x83\xe5\xc2\x35\xd9\xe3\xf3\xc9\x08\x5d\x3b\x37\xf6\xd2\xf5\xd0\xc9\xc9\x2e\x27\xe4\x01\x2f\x94\x3c\x72\xfe\xa4\x4c\xc5\xc5\xe9\xfb\xf1\x08\xcd\xe6\x1e\x9a\x2d\x5d\x37\xaf\xfd\xf3\x37\xad\x66\xca\x17\xf1\x2a\x64\x04\x5d\xce\xe7\xae\x63\xcf\x4c\xce\x8d\xed\xde\x39\xbb\xa4\xaf\x8b\xe9\xad\xbd\xb8\x47\x5f\x9c\xfb\x61\x32\xfe\x68\x90\x8f\x91\x5c\x73\xe7\x78\x1f\x63\xbd\xbe\xd8\xac\xce\xd0\xd5\xdc\x75\x6d\xcf\xc9\xbe\xfd\x15\x8b\x3e\x0c\x06\x7b\x7c\x60\x21\x42\x46\xf0\x16\xeb\x01\x4e\x4e\xc7\x17\x29\x29\x19\x71\x47\xb2\x15\x62\x0d\x4a\xfb\xcf\x20\x55\xd2\xfa\x35\xac\xc5\x22\xe4\x98\x02\xf5\x57\x2f\xa6\x6e\x72\x56\x2d\x33\x79\x58\xa3\xcb\xe9\xa7\xe9\xcc\x33\x29\x6f\xff\x8b\xff\x32\xb5\x56\xa6\x96\x8e\x1c\xab\x78\x65\x28\x52\x68\xd8\x4c\x67\x0d\xfd\xc5\x1e\x7e\x6d\xf1\x5e\x56\x4d\xa7\x22\xca\xb4\x91\xb5\x5d\x04\xeb\xe0\x25\xa5\xd3\x1e\x24\xf7\x20\x21\x04\xac\xe0\x01\x0d\x9b\x10\xa7\x59\x3e\xa3\x26\x98\xa8\x67\x17\x2c\xeb\xca\x30\xb0\x01\x8d\x29\xd6\x18\xdd\x3a\xd7\xd3\xe5\x6d\xae\xaa\x14\x4e\xb5\x42\x48\x4e\x40\x29\xa0\x3e\x05\x01\x11\x85\x88\x30\x50\x4d\x2b\x48\xf9\xcf\x28\x91\x9e\xaa\x91\x5d\x7f\x02\x16\x98\x3c\xe1\x00\x7c\xf5\x88\xc7\xe7\x93\xbd\x66\x55\x1d\x9f\x94\x6a\xd8\x6f\xc8\xda\x56\x92\xd3\xfe\x54\xe2\xb5\x36\x50\x2b\x59\x0d\xb6\x63\x65\x4f\xd0\xd7\x92\x64\xcf\xad\x71\xd0\xba\x23\x45\xd3\xaa\x0a\x47\xe3\xc0\x9c\x4e\xce\xda\x04\x73\x70\x1d\x0a\x17\x58\x48\xe3\xa0\x27\x6c\x46\x60\x2f\x6d\x08\x6b\x76\xa2\x16\x05\x05\x51\xef\x0a\x49\xb0\xa6\x61\x12\xaa\x6d\xba\x8a\x59\x48\x7d\x45\xb8\x80\x4c\x23\xa6\x2a\xe4\x2f\x87\x22\x4c\xf9\xf0\x4b\x43\xb4\xe5\x3a\x8d\xb4\xc9\xa9\x64\x42\xe9\x38\x56\x11\x93\x65\x30\x58\xc5\x91\x3b\x3e\x4b\xba\x29\x6d\x6f\xd1\x68\x44\xb1\x64\x87\x4e\x7b\x73\x80\x35\x0b\xa1\xb8\xc9\x59\xf8\xcd\x69\x95\xc8\x7c\x50\x0b\xc5\x92\xf5\xbd\x99\x58\x6a\xb6\xc6\x44\x77\xe2\xcb\x34\xa9\x6a\x51\x84\x58\xaf\xb9\xdc\x1c\x67\x73\x58\x92\xc7\xe3\x32\x5f\x63\x9e\xc7\x98\x66\x2c\x99\xda\xfe\xe9\x98\x8c\x06\x4d\xe7\x64\x58\x06\x7b\x57\xd9\x4a\xfe\xcc\x28\xc8\x8e\x36\x99\xee\xd0\xb1\x3f\x74\xd9\xad\xd5\xfc\x76\x07\xcd\x6a\x3b\x02\xc7\x24\x6c\x83\x1c\x48\x1e\x97\xcc\x2e\xd7\x9e\x00\xb9\x61\x6a\x6b\x4d\xd3\x99\xd7\x30\x7c\xde\xa5\xe3\xc4\x1b\xd0\x92\x91\xec\xa1\x62\x05\xb2\xb8\x15\xc9\x3f\x41\xe1\x7e\xc3\x73\x32\x84\x4f\x78\x1c\x69\xb4\xe7\x08\xaf\x9d\xe5\xdf\x00\xe2\x93\x6d\x63\xf9\x0c\x00\x00")
+
+func _1_initial_schemaUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__1_initial_schemaUpSql,
+		"1_initial_schema.up.sql",
+	)
+}
+
+func _1_initial_schemaUpSql() (*asset, error) {
+	bytes, err := _1_initial_schemaUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "1_initial_schema.up.sql", size: 3321, mode: os.FileMode(420), modTime: time.Unix(1792306067, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __2_release_dependency_treesDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x24\x00\xdb\xff\x44\x52\x4f\x50\x20\x54\x41\x42\x4c\x45\x20\x72\x65\x6c\x65\x61\x73\x65\x5f\x64\x65\x70\x65\x6e\x64\x65\x6e\x63\x79\x5f\x74\x72\x65\x65\x3b\x0a\x03\x00\xb5\x1e\x84\x84\x24\x00\x00\x00")
+
+func _2_release_dependency_treesDownSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__2_release_dependency_treesDownSql,
+		"2_release_dependency_trees.down.sql",
+	)
+}
+
+func _2_release_dependency_treesDownSql() (*asset, error) {
+	bytes, err := _2_release_dependency_treesDownSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "2_release_dependency_trees.down.sql", size: 36, mode: os.FileMode(420), modTime: time.Unix(1792306298, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __2_release_dependency_treesUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x64\x8f\x41\x4b\xc3\x40\x10\x85\xef\xfb\x2b\xde\x31\x81\x5c\xac\x1e\x0a\xa5\x87\x35\x19\xb1\xb8\x69\xcb\x76\x22\xf6\x94\xa6\xc9\x14\x22\xed\xb6\xec\x46\xc1\x7f\x2f\x89\x89\x1e\x3c\xce\x7b\xc3\xf7\xf8\x52\x4b\x9a\x09\xac\x1f\x0d\xc1\xcb\x59\xaa\x20\x65\x23\x37\x71\x8d\xb8\xfa\xab\xec\xbc\x08\x22\x05\x00\x37\x7f\x7d\x97\xba\xc3\xab\xb6\xe9\xb3\xb6\xd1\xfd\x2c\x4e\x86\xc2\x55\x17\xf9\x4d\xef\x66\xf3\x31\xfe\x14\x1f\xda\xab\xfb\xff\x3f\x30\x73\xca\x56\x45\xce\xf4\xc6\x58\x6f\x18\xeb\xc2\x98\x9f\x76\x6b\x57\xb9\xb6\x7b\xbc\xd0\x3e\x1a\x27\x93\x61\x22\x99\x88\xb1\x8a\x91\xd1\x93\x2e\x0c\xa3\x27\xef\x88\x97\x1f\xdd\x69\x7e\x39\x3e\x20\xdd\x18\xa3\x99\xa6\xbb\x3c\xb6\x6e\xa1\x54\xb1\xcd\x7a\xcb\xc3\x28\x78\xc0\x8e\xb8\xf7\xa9\x25\x04\x69\xfe\x7c\x5b\x09\x58\xe2\x54\x9d\x83\x2c\xd4\xf7\x00\xd3\x45\x3a\xc5\x1b\x01\x00\x00")
+
+func _2_release_dependency_treesUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__2_release_dependency_treesUpSql,
+		"2_release_dependency_trees.up.sql",
+	)
+}
+
+func _2_release_dependency_treesUpSql() (*asset, error) {
+	bytes, err := _2_release_dependency_treesUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "2_release_dependency_trees.up.sql", size: 283, mode: os.FileMode(420), modTime: time.Unix(1792306376, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+// Asset loads and returns the asset for the given name.
+// It returns an error if the asset could not be found or
+// could not be loaded.
+func Asset(name string) ([]byte, error) {
+	cannonicalName := strings.Replace(name, "\\", "/", -1)
+	if f, ok := _bindata[cannonicalName]; ok {
+		a, err := f()
+		if err != nil {
+			return nil, fmt.Errorf("Asset %s can't read by error: %v", name, err)
+		}
+		return a.bytes, nil
+	}
+	return nil, fmt.Errorf("Asset %s not found", name)
+}
+
+// MustAsset is like Asset but panics when Asset would return an error.
+// It simplifies safe initialization of global variables.
+func MustAsset(name string) []byte {
+	a, err := Asset(name)
+	if err != nil {
+		panic("asset: Asset(" + name + "): " + err.Error())
+	}
+
+	return a
+}
+
+// AssetInfo loads and returns the asset info for the given name.
+// It returns an error if the asset could not be found or
+// could not be loaded.
+func AssetInfo(name string) (os.FileInfo, error) {
+	cannonicalName := strings.Replace(name, "\\", "/", -1)
+	if f, ok := _bindata[cannonicalName]; ok {
+		a, err := f()
+		if err != nil {
+			return nil, fmt.Errorf("AssetInfo %s can't read by error: %v", name, err)
+		}
+		return a.info, nil
+	}
+	return nil, fmt.Errorf("AssetInfo %s not found", name)
+}
+
+// AssetNames returns the names of the assets.
+func AssetNames() []string {
+	names := make([]string, 0, len(_bindata))
+	for name := range _bindata {
+		names = append(names, name)
+	}
+	return names
+}
+
+// _bindata is a table, holding each asset generator, mapped to its name.
+var _bindata = map[string]func() (*asset, error){
+	"1_initial_schema.down.sql": _1_initial_schemaDownSql,
+	"1_initial_schema.up.sql": _1_initial_schemaUpSql,
+	"2_release_dependency_trees.down.sql": _2_release_dependency_treesDownSql,
+	"2_release_dependency_trees.up.sql": _2_release_dependency_treesUpSql,
+}
+
+// AssetDir returns the file names below a certain
+// directory embedded in the file by go-bindata.
+// For example if you run go-bindata on data/... and data contains the
+// following hierarchy:
+//     data/
+//       foo.txt
+//       img/
+//         a.png
+//         b.png
+// then AssetDir("data") would return []string{"foo.txt", "img"}
+// AssetDir("data/img") would return []string{"a.png", "b.png"}
+// AssetDir("foo.txt") and AssetDir("notexist") would return an error
+// AssetDir("") will return []string{"data"}.
+func AssetDir(name string) ([]string, error) {
+	node := _bintree
+	if len(name) != 0 {
+		cannonicalName := strings.Replace(name, "\\", "/", -1)
+		pathList := strings.Split(cannonicalName, "/")
+		for _, p := range pathList {
+			node = node.Children[p]
+			if node == nil {
+				return nil, fmt.Errorf("Asset %s not found", name)
+			}
+		}
+	}
+	if node.Func != nil {
+		return nil, fmt.Errorf("Asset %s not found", name)
+	}
+	rv := make([]string, 0, len(node.Children))
+	for childName := range node.Children {
+		rv = append(rv, childName)
+	}
+	return rv, nil
+}
+
+type bintree struct {
+	Func     func() (*asset, error)
+	Children map[string]*bintree
+}
+var _bintree = &bintree{nil, map[string]*bintree{
+	"1_initial_schema.down.sql": &bintree{_1_initial_schemaDownSql, map[string]*bintree{}},
+	"1_initial_schema.up.sql": &bintree{_1_initial_schemaUpSql, map[string]*bintree{}},
+	"2_release_dependency_trees.down.sql": &bintree{_2_release_dependency_treesDownSql, map[string]*bintree{}},
+	"2_release_dependency_trees.up.sql": &bintree{_2_release_dependency_treesUpSql, map[string]*bintree{}},
+}}
+
+// RestoreAsset restores an asset under the given directory
+func RestoreAsset(dir, name string) error {
+	data, err := Asset(name)
+	if err != nil {
+		return err
+	}
+	info, err := AssetInfo(name)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(_filePath(dir, filepath.Dir(name)), os.FileMode(0755))
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(_filePath(dir, name), data, info.Mode())
+	if err != nil {
+		return err
+	}
+	err = os.Chtimes(_filePath(dir, name), info.ModTime(), info.ModTime())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RestoreAssets restores an asset under the given directory recursively
+func RestoreAssets(dir, name string) error {
+	children, err := AssetDir(name)
+	// File
+	if err != nil {
+		return RestoreAsset(dir, name)
+	}
+	// Dir
+	for _, child := range children {
+		err = RestoreAssets(dir, filepath.Join(name, child))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func _filePath(dir, name string) string {
+	cannonicalName := strings.Replace(name, "\\", "/", -1)
+	return filepath.Join(append([]string{dir}, strings.Split(cannonicalName, "/")...)...)
+}
+
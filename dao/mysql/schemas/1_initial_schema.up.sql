@@ -0,0 +1,109 @@
+CREATE TABLE project (
+    name VARCHAR(32),
+    description TEXT,
+    orgURL VARCHAR(256) DEFAULT '',
+    logo TEXT,
+    hooks VARCHAR(8192) NOT NULL DEFAULT '{}',
+    is_public BOOLEAN DEFAULT FALSE,
+    PRIMARY KEY(name)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE application (
+    name VARCHAR(128),
+    project VARCHAR(32),
+    description TEXT,
+    latest_version VARCHAR(256) DEFAULT '',
+    logo TEXT,
+    uploaded_by VARCHAR(64) DEFAULT '',
+    uploaded_at BIGINT DEFAULT 0,
+    hooks VARCHAR(8192) NOT NULL DEFAULT '{}',
+    PRIMARY KEY(name, project)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE subscriptions (
+    project VARCHAR(32),
+    name VARCHAR(128),
+    subscription_project VARCHAR(32),
+    subscription_name VARCHAR(128),
+    PRIMARY KEY(project, name, subscription_project, subscription_name)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE `release` (
+    name VARCHAR(128),
+    release_id VARCHAR(256),
+    version VARCHAR(32),
+    metadata MEDIUMTEXT,
+    project VARCHAR(32),
+    processed_dependencies BOOLEAN DEFAULT FALSE,
+    downloads BIGINT DEFAULT 0,
+    uploaded_by VARCHAR(64) DEFAULT '',
+    uploaded_at BIGINT DEFAULT 0,
+    package_sha256 VARCHAR(64) NOT NULL DEFAULT '',
+    package_size BIGINT NOT NULL DEFAULT 0,
+    draft BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY(name, version, project)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE release_tags (
+    project VARCHAR(32),
+    application VARCHAR(128),
+    tag VARCHAR(64),
+    version VARCHAR(32),
+    PRIMARY KEY(project, application, tag)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE release_dependency (
+    project VARCHAR(32),
+    name VARCHAR(128),
+    version VARCHAR(32),
+    dep_project VARCHAR(32),
+    dep_name VARCHAR(128),
+    dep_version VARCHAR(32),
+    build_scope BOOLEAN,
+    deploy_scope BOOLEAN,
+    is_extension BOOLEAN DEFAULT FALSE,
+    PRIMARY KEY(project, name, version, dep_project, dep_name, dep_version)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE package (
+    project VARCHAR(32),
+    release_id VARCHAR(256),
+    uri VARCHAR(256),
+    uploaded_by VARCHAR(64) DEFAULT '',
+    uploaded_at BIGINT DEFAULT 0,
+    filesize BIGINT DEFAULT -1,
+    PRIMARY KEY(release_id, uri, project)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE release_artifact (
+    project VARCHAR(32),
+    release_id VARCHAR(256),
+    artifact VARCHAR(128),
+    platform VARCHAR(64) NOT NULL DEFAULT '',
+    arch VARCHAR(64) NOT NULL DEFAULT '',
+    sha256 VARCHAR(64) NOT NULL DEFAULT '',
+    size BIGINT NOT NULL DEFAULT 0,
+    uris TEXT NOT NULL,
+    PRIMARY KEY(project, release_id, artifact)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE providers (
+    project VARCHAR(32),
+    application VARCHAR(128),
+    version VARCHAR(32),
+    description TEXT,
+    provider VARCHAR(32),
+    PRIMARY KEY(project, application, provider)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE acl (
+    project VARCHAR(32),
+    group_name VARCHAR(256),
+    permission INT,
+    PRIMARY KEY(project, group_name)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE metrics (
+    user_id VARCHAR(64) PRIMARY KEY,
+    project_count INT DEFAULT 0
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
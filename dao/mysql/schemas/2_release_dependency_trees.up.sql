@@ -0,0 +1,9 @@
+CREATE TABLE release_dependency_tree (
+    project VARCHAR(32),
+    name VARCHAR(128),
+    version VARCHAR(32),
+    tree MEDIUMTEXT NOT NULL,
+    PRIMARY KEY(project, name, version)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+UPDATE `release` SET processed_dependencies = false;
@@ -53,6 +53,7 @@ func (s *memSuite) Test_DAO(c *C) {
 			_, err = db.Exec(`TRUNCATE application CASCADE`)
 			_, err = db.Exec(`TRUNCATE project CASCADE`)
 			_, err = db.Exec(`TRUNCATE release_dependency CASCADE`)
+			_, err = db.Exec(`TRUNCATE release_dependency_tree CASCADE`)
 			_, err = db.Exec(`TRUNCATE subscriptions CASCADE`)
 			_, err = db.Exec(`TRUNCATE metrics CASCADE`)
 			_, err = db.Exec(`TRUNCATE feed_events CASCADE`)
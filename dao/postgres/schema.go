@@ -15,6 +15,10 @@
 // dao/postgres/schemas/1_initial_schema.up.sql
 // dao/postgres/schemas/20_release_tags.up.sql
 // dao/postgres/schemas/21_project_is_public.up.sql
+// dao/postgres/schemas/22_package_checksums.up.sql
+// dao/postgres/schemas/23_draft_releases.up.sql
+// dao/postgres/schemas/24_release_artifacts.up.sql
+// dao/postgres/schemas/25_release_dependency_trees.up.sql
 // dao/postgres/schemas/2_project_metadata.down.sql
 // dao/postgres/schemas/2_project_metadata.up.sql
 // dao/postgres/schemas/3_migrate_existing_projects.up.sql
@@ -393,6 +397,86 @@ func _21_project_is_publicUpSql() (*asset, error) {
 	return a, nil
 }
 
+var __22_package_checksumsUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\x28\x4a\xcd\x49\x4d\x2c\x4e\x55\x70\x74\x71\x51\x70\xf6\xf7\x09\xf5\xf5\x53\x28\x48\x4c\xce\x4e\x4c\x4f\x8d\x2f\xce\x48\x34\x32\x35\x53\x08\x73\x0c\x72\xf6\x70\x0c\xd2\x30\x33\xd1\x54\xf0\xf3\x0f\x51\xf0\x0b\xf5\xf1\x51\x70\x71\x75\x73\x0c\xf5\x09\x51\x50\x57\xb7\xe6\x22\xd6\xb8\xcc\xaa\x54\x05\x27\x4f\x77\x4f\xbf\x10\x4c\x73\x0c\xac\xb9\x00\x03\x00\xf1\x43\xb9\x80\x96\x00\x00\x00")
+
+func _22_package_checksumsUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__22_package_checksumsUpSql,
+		"22_package_checksums.up.sql",
+	)
+}
+
+func _22_package_checksumsUpSql() (*asset, error) {
+	bytes, err := _22_package_checksumsUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "22_package_checksums.up.sql", size: 150, mode: os.FileMode(420), modTime: time.Unix(1792300605, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __23_draft_releasesUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x45\x00\xba\xff\x41\x4c\x54\x45\x52\x20\x54\x41\x42\x4c\x45\x20\x72\x65\x6c\x65\x61\x73\x65\x20\x41\x44\x44\x20\x43\x4f\x4c\x55\x4d\x4e\x20\x64\x72\x61\x66\x74\x20\x42\x4f\x4f\x4c\x45\x41\x4e\x20\x4e\x4f\x54\x20\x4e\x55\x4c\x4c\x20\x44\x45\x46\x41\x55\x4c\x54\x20\x66\x61\x6c\x73\x65\x3b\x0a\x03\x00\x24\xb7\x2c\x07\x45\x00\x00\x00")
+
+func _23_draft_releasesUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__23_draft_releasesUpSql,
+		"23_draft_releases.up.sql",
+	)
+}
+
+func _23_draft_releasesUpSql() (*asset, error) {
+	bytes, err := _23_draft_releasesUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "23_draft_releases.up.sql", size: 69, mode: os.FileMode(420), modTime: time.Unix(1792302907, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __24_release_artifactsUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x90\x41\x6b\x83\x30\x1c\x47\xef\x7e\x8a\xff\x4d\x03\x1e\xb6\x6c\xca\x60\xa7\xb8\x65\x43\x96\xd9\x22\x11\x2a\xa5\x94\x10\x23\xa6\x58\x94\x98\xf6\xd0\x4f\x5f\x68\x63\x2e\xed\xc1\xf3\x7b\xbf\xdf\xe1\x7d\x95\x94\x70\x0a\x9c\x64\x8c\x82\x51\xbd\x12\x93\xda\x0b\x63\x75\x2b\xa4\x85\x28\x00\x00\x18\xcd\x70\x50\xd2\xc2\x59\x18\xd9\x09\x13\xbd\x61\x14\xdf\xc0\xec\xeb\xc6\x33\x9c\xa4\x0e\xfa\x93\x19\xbd\xe2\x0f\x87\xc6\x5e\xd8\x76\x30\x47\xbf\x4a\xdf\x11\x14\x2b\x0e\x45\xc5\x18\x7c\xd3\x1f\x52\x31\x0e\x61\x38\x1f\xc9\x6e\x99\x39\x75\x02\x27\xe9\x42\x57\x5f\x14\x64\xf9\x6f\x5e\xf0\x47\xe9\xe5\xee\x9c\x8c\x9e\x80\xd3\xcd\x13\x23\xdc\xee\xdc\xd1\xba\xcc\xff\x49\x59\xc3\x1f\xad\x23\x57\x2a\xf6\x25\x75\x13\xfb\x10\x28\x40\x9f\xc1\x75\x00\xd2\x4c\x73\x26\x70\x01\x00\x00")
+
+func _24_release_artifactsUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__24_release_artifactsUpSql,
+		"24_release_artifacts.up.sql",
+	)
+}
+
+func _24_release_artifactsUpSql() (*asset, error) {
+	bytes, err := _24_release_artifactsUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "24_release_artifacts.up.sql", size: 368, mode: os.FileMode(420), modTime: time.Unix(1792303409, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __25_release_dependency_treesUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x64\x8f\xc1\x4a\x86\x40\x14\x85\xf7\xf3\x14\x67\x37\x0a\x6e\xfa\xdb\x04\xd2\x62\xca\x09\xa2\xc9\xc4\xae\x90\x44\xc8\x30\xde\xc8\xb0\x51\x66\x44\xe8\xed\x23\x33\x5b\xb4\x3d\xf7\x70\xbe\xef\x5e\xd7\x5a\x91\x06\xa9\x2b\xa3\x11\x78\x64\x1b\xb9\xeb\x79\x66\xdf\xb3\x77\x9f\xdd\x12\x98\x91\x08\x00\x98\xc3\xf4\xce\x6e\xc1\x6a\x83\x7b\xb3\x21\x39\x3f\xa5\xd9\x76\xf0\xf6\x83\x8f\xf4\xec\x74\xb1\xc7\x2b\x87\x38\x4c\xfe\x7f\x7f\xdb\x24\xfd\x44\x28\x1f\x08\x65\x63\x0c\x0a\x7d\xa3\x1a\x43\x90\xcf\x2f\xf2\xa7\x54\xd5\xb7\xf7\xaa\x6e\x71\xa7\xdb\x64\x27\x67\x1b\x29\xfb\x1d\x4e\x45\x9a\x0b\xd1\x54\x85\xa2\x43\x1d\x8f\x9a\xbe\x45\x1d\xc7\xc8\xfd\xdf\x23\x03\x47\x5c\x42\xbe\xda\x31\xb2\xcc\xc5\xd7\x00\xe2\xda\x3c\xb8\xf6\x00\x00\x00")
+
+func _25_release_dependency_treesUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__25_release_dependency_treesUpSql,
+		"25_release_dependency_trees.up.sql",
+	)
+}
+
+func _25_release_dependency_treesUpSql() (*asset, error) {
+	bytes, err := _25_release_dependency_treesUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "25_release_dependency_trees.up.sql", size: 246, mode: os.FileMode(420), modTime: time.Unix(1792306376, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var __2_project_metadataDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x72\x09\xf2\x0f\x50\x08\x71\x74\xf2\x71\x55\x28\x28\xca\xcf\x4a\x4d\x2e\xb1\xe6\x02\x04\x00\x00\xff\xff\xa5\x8e\xd4\xaa\x14\x00\x00\x00")
 
 func _2_project_metadataDownSqlBytes() ([]byte, error) {
@@ -680,6 +764,10 @@ var _bindata = map[string]func() (*asset, error){
 	"1_initial_schema.up.sql": _1_initial_schemaUpSql,
 	"20_release_tags.up.sql": _20_release_tagsUpSql,
 	"21_project_is_public.up.sql": _21_project_is_publicUpSql,
+	"22_package_checksums.up.sql": _22_package_checksumsUpSql,
+	"23_draft_releases.up.sql": _23_draft_releasesUpSql,
+	"24_release_artifacts.up.sql": _24_release_artifactsUpSql,
+	"25_release_dependency_trees.up.sql": _25_release_dependency_treesUpSql,
 	"2_project_metadata.down.sql": _2_project_metadataDownSql,
 	"2_project_metadata.up.sql": _2_project_metadataUpSql,
 	"3_migrate_existing_projects.up.sql": _3_migrate_existing_projectsUpSql,
@@ -748,6 +836,10 @@ var _bintree = &bintree{nil, map[string]*bintree{
 	"1_initial_schema.up.sql": &bintree{_1_initial_schemaUpSql, map[string]*bintree{}},
 	"20_release_tags.up.sql": &bintree{_20_release_tagsUpSql, map[string]*bintree{}},
 	"21_project_is_public.up.sql": &bintree{_21_project_is_publicUpSql, map[string]*bintree{}},
+	"22_package_checksums.up.sql": &bintree{_22_package_checksumsUpSql, map[string]*bintree{}},
+	"23_draft_releases.up.sql": &bintree{_23_draft_releasesUpSql, map[string]*bintree{}},
+	"24_release_artifacts.up.sql": &bintree{_24_release_artifactsUpSql, map[string]*bintree{}},
+	"25_release_dependency_trees.up.sql": &bintree{_25_release_dependency_treesUpSql, map[string]*bintree{}},
 	"2_project_metadata.down.sql": &bintree{_2_project_metadataDownSql, map[string]*bintree{}},
 	"2_project_metadata.up.sql": &bintree{_2_project_metadataUpSql, map[string]*bintree{}},
 	"3_migrate_existing_projects.up.sql": &bintree{_3_migrate_existing_projectsUpSql, map[string]*bintree{}},
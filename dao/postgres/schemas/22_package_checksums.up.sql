@@ -0,0 +1,2 @@
+ALTER TABLE release ADD COLUMN package_sha256 VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE release ADD COLUMN package_size BIGINT NOT NULL DEFAULT 0;
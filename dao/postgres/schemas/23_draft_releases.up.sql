@@ -0,0 +1 @@
+ALTER TABLE release ADD COLUMN draft BOOLEAN NOT NULL DEFAULT false;
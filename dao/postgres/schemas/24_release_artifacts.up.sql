@@ -0,0 +1,11 @@
+CREATE TABLE release_artifact (
+    project varchar(32),
+    release_id varchar(256),
+    artifact varchar(128),
+    platform varchar(64) NOT NULL DEFAULT '',
+    arch varchar(64) NOT NULL DEFAULT '',
+    sha256 varchar(64) NOT NULL DEFAULT '',
+    size BIGINT NOT NULL DEFAULT 0,
+    uris TEXT NOT NULL DEFAULT '[]',
+    PRIMARY KEY(project, release_id, artifact)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE release_dependency_tree (
+    project varchar(32),
+    name varchar(128),
+    version varchar(32),
+    tree TEXT NOT NULL DEFAULT '[]',
+    PRIMARY KEY(project, name, version)
+);
+
+UPDATE release SET processed_dependencies = 'false';
@@ -78,6 +78,7 @@ func NewQLDAO(path string) (DAO, error) {
 						      VALUES ($1, $2, $3, $4, $5, $6, $7)`,
 		UpdateApplicationQuery: `UPDATE application SET description = $1, latest_version = $2, logo = $3, uploaded_by = $4, uploaded_at = $5 
 								 WHERE name = $6 AND project = $7`,
+		DeleteApplicationQuery: `DELETE FROM application WHERE project = $1 AND name = $2`,
 		GetApplicationsQuery: `SELECT name, project, description, latest_version, logo, uploaded_by, uploaded_at
 								  FROM application WHERE project = $1`,
 		GetApplicationHooksQuery: `SELECT hooks FROM application WHERE project = $1 AND name = $2`,
@@ -91,15 +92,23 @@ func NewQLDAO(path string) (DAO, error) {
 											AND subscriptions.subscription_project = $1 
 								  			AND subscriptions.subscription_name = $2`,
 
-		AddReleaseQuery: "INSERT INTO release(project, name, release_id, version, metadata, uploaded_by, uploaded_at) VALUES($1, $2, $3, $4, $5, $6, $7)",
-		GetReleaseQuery: `SELECT metadata, processed_dependencies, downloads, uploaded_by, uploaded_at
+		AddReleaseQuery: "INSERT INTO release(project, name, release_id, version, metadata, uploaded_by, uploaded_at, draft) VALUES($1, $2, $3, $4, $5, $6, $7, $8)",
+		GetReleaseQuery: `SELECT metadata, processed_dependencies, downloads, uploaded_by, uploaded_at, package_sha256, package_size, draft
 						  FROM release 
 						  WHERE project = $1 AND name = $2 AND release_id = $3`,
-		UpdateReleaseQuery:                              `UPDATE release SET processed_dependencies = $1, downloads = $2 WHERE project = $3 AND name = $4 AND release_id = $5`,
-		GetAllReleasesQuery:                             "SELECT project, metadata, processed_dependencies, downloads, uploaded_by, uploaded_at FROM release",
-		GetAllReleasesWithoutProcessedDependenciesQuery: `SELECT project, metadata, processed_dependencies, downloads, uploaded_by, uploaded_at FROM release WHERE processed_dependencies = false`,
-		FindAllVersionsQuery:                            "SELECT version FROM release WHERE project = $1 AND name = $2",
-		GetReleaseByTagQuery: `SELECT r.metadata, r.processed_dependencies, r.downloads, r.uploaded_by, r.uploaded_at 
+		UpdateReleaseQuery:                              `UPDATE release SET processed_dependencies = $1, package_sha256 = $2, package_size = $3, draft = $4 WHERE project = $5 AND name = $6 AND release_id = $7`,
+		IncrementDownloadsQuery:                         `UPDATE release SET downloads = downloads + 1 WHERE project = $1 AND name = $2 AND release_id = $3`,
+		GetAllReleasesQuery:                             "SELECT project, metadata, processed_dependencies, downloads, uploaded_by, uploaded_at, package_sha256, package_size, draft FROM release",
+		GetAllReleasesWithoutProcessedDependenciesQuery: `SELECT project, metadata, processed_dependencies, downloads, uploaded_by, uploaded_at, package_sha256, package_size, draft FROM release WHERE processed_dependencies = false`,
+		FindAllVersionsQuery:                            "SELECT version FROM release WHERE project = $1 AND name = $2 AND draft = false",
+		FindAllDraftVersionsQuery:                       "SELECT version FROM release WHERE project = $1 AND name = $2 AND draft = true",
+		DeleteReleaseQuery:                              `DELETE FROM release WHERE project = $1 AND name = $2 AND release_id = $3`,
+		DeleteReleaseTagsQuery:                          `DELETE FROM release_tags WHERE project = $1 AND application = $2 AND version = $3`,
+		DeleteReleaseDependenciesQuery:                  `DELETE FROM release_dependency WHERE project = $1 AND name = $2 AND version = $3`,
+		DeleteReleasePackageURIsQuery:                   `DELETE FROM package WHERE project = $1 AND release_id = $2`,
+		DeleteReleaseArtifactsQuery:                     `DELETE FROM release_artifact WHERE project = $1 AND release_id = $2`,
+		DeleteReleaseProvidersQuery:                     `DELETE FROM providers WHERE project = $1 AND application = $2 AND version = $3`,
+		GetReleaseByTagQuery: `SELECT r.metadata, r.processed_dependencies, r.downloads, r.uploaded_by, r.uploaded_at, r.package_sha256, r.package_size, r.draft 
 							    FROM release AS r, release_tags AS rt 
 								WHERE rt.project = $1 AND rt.application = $2 AND rt.tag = $3 
 								  AND rt.version = r.version 
@@ -107,9 +116,17 @@ func NewQLDAO(path string) (DAO, error) {
 								  AND rt.application = r.name`,
 		AddReleaseTagQuery:    `INSERT INTO release_tags(project, application, tag, version) VALUES ($1, $2, $3, $4)`,
 		UpdateReleaseTagQuery: `UPDATE release_tags SET version = $4 WHERE project = $1 AND application = $2 AND tag = $3`,
+		GetReleaseTagsQuery:   `SELECT tag, version FROM release_tags WHERE project = $1 AND application = $2`,
 
-		GetPackageURIsQuery: "SELECT uri FROM package WHERE project = $1 AND release_id = $2",
-		AddPackageURIQuery:  "INSERT INTO package (project, release_id, uri) VALUES ($1, $2, $3)",
+		GetPackageURIsQuery:   "SELECT uri FROM package WHERE project = $1 AND release_id = $2",
+		AddPackageURIQuery:    "INSERT INTO package (project, release_id, uri) VALUES ($1, $2, $3)",
+		RemovePackageURIQuery: "DELETE FROM package WHERE project = $1 AND release_id = $2 AND uri = $3",
+
+		GetArtifactsQuery: `SELECT artifact, platform, arch, sha256, size, uris FROM release_artifact
+							WHERE project = $1 AND release_id = $2 ORDER BY artifact`,
+		AddArtifactQuery: `INSERT INTO release_artifact (project, release_id, artifact, platform, arch, sha256, size, uris)
+						   VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		UpdateArtifactURIsQuery: `UPDATE release_artifact SET uris = $1 WHERE project = $2 AND release_id = $3 AND artifact = $4`,
 
 		InsertDependencyQuery: `INSERT INTO release_dependency(project, name, version,
 										dep_project, dep_name, dep_version,
@@ -123,6 +140,9 @@ func NewQLDAO(path string) (DAO, error) {
 									  build_scope, deploy_scope, is_extension
 							   FROM release_dependency 
 							   WHERE dep_project = $1 AND dep_name = $2 AND dep_version = $3`,
+		DeleteDependencyTreeQuery: `DELETE FROM release_dependency_tree WHERE project = $1 AND name = $2 AND version = $3`,
+		InsertDependencyTreeQuery: `INSERT INTO release_dependency_tree(project, name, version, tree) VALUES ($1, $2, $3, $4)`,
+		GetDependencyTreeQuery:    `SELECT tree FROM release_dependency_tree WHERE project = $1 AND name = $2 AND version = $3`,
 		CreateUserIDMetricsQuery:                  `INSERT INTO metrics(user_id) VALUES($1)`,
 		GetMetricsByUserIDQuery:                   `SELECT project_count FROM metrics WHERE user_id = $1`,
 		SetProjectCountMetricForUser:              `UPDATE metrics SET project_count = $3 WHERE user_id = $1 AND project_count = $2`,
@@ -131,8 +151,10 @@ func NewQLDAO(path string) (DAO, error) {
 		SetProviderQuery:                          `INSERT INTO providers(project, application, version, description, provider) VALUES ($1, $2, $3, $4, $5)`,
 		UpdateProviderQuery:                       `UPDATE providers SET version = $3, description = $4 WHERE project = $1 AND application = $2 AND provider = $5`,
 		HardDeleteProjectPackageURIsQuery:         `DELETE FROM package WHERE project = $1`,
+		HardDeleteProjectArtifactsQuery:           `DELETE FROM release_artifact WHERE project = $1`,
 		HardDeleteProjectUnitSubscriptions:        `DELETE FROM subscriptions WHERE project = $1`,
 		HardDeleteProjectReleaseDependenciesQuery: `DELETE FROM release_dependency WHERE project = $1`,
+		HardDeleteProjectDependencyTreesQuery:     `DELETE FROM release_dependency_tree WHERE project = $1`,
 		HardDeleteProjectReleasesQuery:            `DELETE FROM release WHERE project = $1`,
 		HardDeleteProjectApplicationsQuery:        `DELETE FROM application WHERE project = $1`,
 		HardDeleteProjectQuery:                    `DELETE FROM project WHERE name = $1 `,
@@ -140,10 +162,12 @@ func NewQLDAO(path string) (DAO, error) {
 			queries := []string{
 				`TRUNCATE TABLE release`,
 				`TRUNCATE TABLE package`,
+				`TRUNCATE TABLE release_artifact`,
 				`TRUNCATE TABLE acl`,
 				`TRUNCATE TABLE application`,
 				`TRUNCATE TABLE project`,
 				`TRUNCATE TABLE release_dependency`,
+				`TRUNCATE TABLE release_dependency_tree`,
 				`TRUNCATE TABLE subscriptions`,
 				`TRUNCATE TABLE metrics`,
 				`TRUNCATE TABLE providers`,
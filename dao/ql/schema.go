@@ -1,5 +1,9 @@
 // Code generated by go-bindata.
 // sources:
+// dao/ql/schemas/10_package_checksums.up.sql
+// dao/ql/schemas/11_draft_releases.up.sql
+// dao/ql/schemas/12_release_artifacts.up.sql
+// dao/ql/schemas/13_release_dependency_trees.up.sql
 // dao/ql/schemas/1_initial_schema.down.sql
 // dao/ql/schemas/1_initial_schema.up.sql
 // dao/ql/schemas/2_metrics.down.sql
@@ -79,6 +83,86 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
+var __10_package_checksumsUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xec\x94\x4f\x8b\xd4\x30\x14\xc0\xcf\xc9\xa7\x78\xec\x69\x47\x72\x10\x41\x2f\x3d\x75\x3b\x19\x09\x4c\x13\x6d\x33\xb0\xb7\x92\x69\x9e\x6b\x9d\x4e\x13\x9a\xa8\xe8\xa7\x97\xba\x69\xa9\xbb\xc5\x8b\xe0\x69\x8f\x79\xff\x42\x7e\xef\x47\xee\xf8\x7b\x21\x41\x57\xb9\xac\xf3\x42\x0b\x25\x33\x4a\xf6\x95\xfa\x00\x42\xee\xf9\x3d\x8c\xd8\xa3\x09\xd8\xf8\x4b\x46\x29\x29\x2a\x9e\x6b\x0e\x3a\xbf\x3b\x72\x10\x07\x90\x4a\x03\xbf\x17\xb5\xae\x21\x5e\x7d\x93\x8a\xe1\x96\x12\x32\x98\x2b\x42\x88\x63\x37\x3c\x30\x4a\xc8\x3c\xa7\xb3\xab\xe0\x37\x1c\x43\xe7\x86\x55\xe4\x8a\xd1\x58\x13\x0d\x9c\x7b\x77\x9e\xfa\xfc\xe8\xbe\x60\x1b\x57\x25\x7e\x74\x2d\x86\x80\xb6\xb1\xe8\x71\xb0\x38\xb4\x1d\x06\x38\x3b\xd7\xc3\x9e\x1f\xf2\xd3\x51\xc3\x27\xd3\x07\x9c\xda\xad\xfb\x3e\xf4\xce\xd8\x00\xdd\x10\x97\xf4\xeb\x29\xf5\xd5\x4f\x09\xb4\xcd\xf9\x47\x9a\xbe\xe4\x6f\x6e\xfe\x28\x30\xf1\x79\xb7\x37\xed\xc5\x3c\x60\x13\x3e\x9b\x37\x6f\xdf\x6d\x0f\x58\x6a\xba\x9f\xf8\x6c\xc2\x6e\xe2\x29\x64\xcd\x2b\x0d\x42\x6a\xb5\x06\x78\x3b\xc1\x63\x0b\xfb\xce\x32\x48\xa8\x18\xcc\x84\x18\x24\x34\x0c\xb6\x89\x30\x58\x1e\xcf\x60\xf5\xd8\xd5\xc1\xc4\x1d\x25\xa4\xe6\x47\x5e\x68\xf8\x6f\x77\xc2\xa1\x52\xe5\x7c\xd1\x44\xe1\xb7\x6e\x8f\x4e\x2d\xd1\x42\x95\xa5\xd0\x19\xa5\x5b\x7e\xfe\x45\xc3\x17\x05\xff\x41\xc1\x19\x5e\x32\xe2\xd5\xe3\xa6\x56\x62\x3e\xd9\xd6\x93\x4c\x5a\xcb\x49\x8a\x8f\x27\x9e\xfe\x8f\xcd\xed\x34\xfe\x02\x4a\xce\x27\x48\xba\x2f\xba\x25\xe0\xbb\x8c\x16\xaa\x2c\x85\xce\xe8\xaf\x01\x00\x34\xd9\x25\x54\xa5\x04\x00\x00")
+
+func _10_package_checksumsUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__10_package_checksumsUpSql,
+		"10_package_checksums.up.sql",
+	)
+}
+
+func _10_package_checksumsUpSql() (*asset, error) {
+	bytes, err := _10_package_checksumsUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "10_package_checksums.up.sql", size: 1189, mode: os.FileMode(420), modTime: time.Unix(1792300637, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __11_draft_releasesUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xec\x94\xcf\x6f\xd3\x30\x14\xc7\xcf\xf1\x5f\xf1\xb4\xd3\x8a\x7c\x40\x48\x70\xc9\x29\x4b\x5d\x64\xa9\x71\x20\x71\xa5\xdd\x22\xb7\x7e\x1b\xa6\x69\x6c\xc5\x06\xc4\xfe\x7a\x14\xe6\x44\xde\x1a\x71\x43\xe2\xc0\xf1\xfd\xd4\xcb\xe7\xfb\x8d\xef\xd8\x47\x2e\x40\x36\x85\x68\x8b\x52\xf2\x5a\xe4\x24\xdb\x36\xf5\x27\xe0\x62\xcb\xee\x61\xc4\x1e\x95\xc7\xce\x9d\x73\x42\xb2\xb2\x61\x85\x64\x20\x8b\xbb\x3d\x03\xbe\x03\x51\x4b\x60\xf7\xbc\x95\x2d\x84\x8b\xeb\x62\x33\xdc\x92\x2c\x1b\xd4\x05\xc1\x87\xd1\x0c\x8f\x94\x64\xd9\xbc\xc7\xe8\x24\xf9\x1d\x47\x6f\xec\x90\x64\x2e\x18\x94\x56\x41\xc1\xb1\xb7\xc7\x69\xce\x8d\xf6\x2b\x9e\x42\xd2\xe2\x46\x7b\x42\xef\x51\x77\x1a\x1d\x0e\x1a\x87\x93\x41\x0f\x47\x6b\x7b\xd8\xb2\x5d\x71\xd8\x4b\x78\x50\xbd\xc7\x69\x5c\xdb\x1f\x43\x6f\x95\xf6\x60\x86\xb0\x94\xdf\x4e\xa5\x6f\x6e\x2a\xa0\xee\x8e\x3f\xe3\xf6\xa5\x7e\x73\xf3\xa2\x41\x85\xeb\x69\xa7\x4e\x67\xf5\x88\x9d\xff\xa2\xde\xbd\xff\xb0\xbe\x60\xe9\x31\x4f\x78\xbd\x41\x8f\xea\x21\xac\x9f\xbd\x99\x58\x73\xd1\xb2\x46\x02\x17\xb2\x4e\xe1\xde\x4e\x60\xe9\xa2\x8b\xd1\x14\x22\x46\x0a\x33\x3d\x0a\x11\x1b\x85\x75\x5a\x14\x16\x30\x14\x12\x10\x49\xa0\x02\x85\x97\x1f\x99\xc4\xe6\x09\x37\x24\xcb\x5a\xb6\x67\xa5\x84\x7f\xe4\x22\xd8\x35\x75\x35\x9f\x31\x11\xfc\x6d\xe3\x67\xaf\x2e\xd9\xb2\xae\x2a\x2e\x73\x42\xd6\x7c\xff\x07\x7b\xff\xb7\xf6\x5f\xb2\xf6\x0c\x36\x7a\xe9\xcd\xb3\x8a\x89\xe1\x5f\x29\xf9\xaa\x12\x25\x3b\x08\xfe\xf9\xc0\xe2\x9b\xb5\xaa\x5c\xe7\xce\x50\x8b\x39\x82\xf8\x1b\x2d\x46\x8d\x62\x6c\x72\x52\xd6\x55\xc5\x65\x4e\x7e\x0d\x00\x6a\xc3\x79\x10\x19\x05\x00\x00")
+
+func _11_draft_releasesUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__11_draft_releasesUpSql,
+		"11_draft_releases.up.sql",
+	)
+}
+
+func _11_draft_releasesUpSql() (*asset, error) {
+	bytes, err := _11_draft_releasesUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "11_draft_releases.up.sql", size: 1305, mode: os.FileMode(420), modTime: time.Unix(1792302907, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __12_release_artifactsUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x64\xcf\x41\x6b\x84\x30\x14\x04\xe0\x7b\x7e\xc5\x1c\x15\x3c\x15\xda\x4b\x4f\xb6\x4d\x21\x50\x22\xad\x11\xbc\x49\x88\xb1\xbe\xd6\x55\x49\xde\x5e\xf6\xd7\x2f\xec\xba\xb2\xae\xd7\x6f\x26\xe1\xcd\xfb\x8f\xcc\x8d\x84\xc9\xdf\xbe\x24\x82\x1f\xbc\x8d\xbe\xb1\x81\xa9\xb3\x8e\x91\x08\x00\x98\xc3\xf4\xe7\x1d\x23\x72\xa0\xf1\x37\xbb\xd8\xad\x4a\xed\x86\xd7\x97\xf7\x38\x0f\x96\xbb\x29\x1c\x1e\x9a\xae\xdf\x40\xec\xed\xd3\xf3\xcb\x96\xe8\xe4\x41\x23\x5f\xbf\x39\x06\x8a\x6b\x9c\xbe\x0a\xb1\xdc\x5e\x69\xf5\x5d\x49\x28\xfd\x21\x6b\xa8\x4f\xe8\xc2\x40\xd6\xaa\x34\xe5\x6e\x50\x33\xff\xa3\xd0\x3b\x4e\x96\x85\xd9\x9a\x50\x9b\xc1\x06\xa6\xce\x3a\x4e\xc5\x79\x00\x03\xa7\xf6\x01\x25\x01\x00\x00")
+
+func _12_release_artifactsUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__12_release_artifactsUpSql,
+		"12_release_artifacts.up.sql",
+	)
+}
+
+func _12_release_artifactsUpSql() (*asset, error) {
+	bytes, err := _12_release_artifactsUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "12_release_artifacts.up.sql", size: 293, mode: os.FileMode(420), modTime: time.Unix(1792303409, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __13_release_dependency_treesUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x74\x8f\xc1\x8a\x83\x30\x18\x84\xef\x79\x8a\x39\xba\xe0\x1b\xc8\x1e\xdc\x35\x85\x40\x89\x6d\x8d\xe0\x4d\x44\xa7\xc5\xd6\x46\x49\xa4\xd0\xb7\x2f\x8a\x52\x3c\x78\xfd\x7e\xfe\x99\x6f\xfe\x2f\x32\x36\x12\x26\xfe\x3b\x4a\x38\x76\xac\x3c\xcb\x86\x03\x6d\x43\x5b\xbf\xcb\xd1\x91\x08\x04\x00\x0c\xae\xbf\xb3\x1e\xe1\x47\xd7\xda\x5b\x38\x33\x5b\x3d\xb9\x01\x2f\x3a\xdf\xf6\x76\xc3\xe6\x8c\x15\xfc\x44\x42\x2c\xa5\xb9\x56\xe7\x5c\x42\xe9\x44\x16\x50\x07\xe8\xd4\x40\x16\x2a\x33\xd9\x9e\x49\x39\x3c\x90\xea\xbd\x6b\xb0\x18\x86\xb3\x56\xb8\xba\x4c\x8d\xf9\x29\x99\x66\x2e\x8f\xc8\xa4\x99\xe6\xd4\xf4\x9e\xcd\x37\xa6\xa5\xc7\x2f\xae\x55\xe7\x19\x89\xcf\x00\x08\x4a\x76\x93\x1a\x01\x00\x00")
+
+func _13_release_dependency_treesUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__13_release_dependency_treesUpSql,
+		"13_release_dependency_trees.up.sql",
+	)
+}
+
+func _13_release_dependency_treesUpSql() (*asset, error) {
+	bytes, err := _13_release_dependency_treesUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "13_release_dependency_trees.up.sql", size: 282, mode: os.FileMode(420), modTime: time.Unix(1792306376, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var __1_initial_schemaDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x72\x09\xf2\x0f\x50\x08\x71\x74\xf2\x71\x55\x28\x4a\xcd\x49\x4d\x2c\x4e\xb5\xe6\x42\x12\x2b\x48\x4c\xce\x4e\x4c\x47\x15\x4b\x4c\xce\x41\x55\x53\x94\x9f\x95\x9a\x5c\x82\xaa\xa6\xa0\x20\x27\x33\x39\xb1\x24\x33\x3f\x0f\x45\x1c\x6a\x47\x7c\x4a\x6a\x41\x6a\x5e\x4a\x6a\x5e\x72\x25\x8a\x74\x71\x69\x52\x71\x72\x51\x66\x01\x48\x5f\xb1\x35\x20\x00\x00\xff\xff\xb3\x3e\xc0\xc0\x9c\x00\x00\x00")
 
 func _1_initial_schemaDownSqlBytes() ([]byte, error) {
@@ -371,6 +455,10 @@ func AssetNames() []string {
 
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
+	"10_package_checksums.up.sql": _10_package_checksumsUpSql,
+	"11_draft_releases.up.sql": _11_draft_releasesUpSql,
+	"12_release_artifacts.up.sql": _12_release_artifactsUpSql,
+	"13_release_dependency_trees.up.sql": _13_release_dependency_treesUpSql,
 	"1_initial_schema.down.sql": _1_initial_schemaDownSql,
 	"1_initial_schema.up.sql": _1_initial_schemaUpSql,
 	"2_metrics.down.sql": _2_metricsDownSql,
@@ -425,6 +513,10 @@ type bintree struct {
 	Children map[string]*bintree
 }
 var _bintree = &bintree{nil, map[string]*bintree{
+	"10_package_checksums.up.sql": &bintree{_10_package_checksumsUpSql, map[string]*bintree{}},
+	"11_draft_releases.up.sql": &bintree{_11_draft_releasesUpSql, map[string]*bintree{}},
+	"12_release_artifacts.up.sql": &bintree{_12_release_artifactsUpSql, map[string]*bintree{}},
+	"13_release_dependency_trees.up.sql": &bintree{_13_release_dependency_treesUpSql, map[string]*bintree{}},
 	"1_initial_schema.down.sql": &bintree{_1_initial_schemaDownSql, map[string]*bintree{}},
 	"1_initial_schema.up.sql": &bintree{_1_initial_schemaUpSql, map[string]*bintree{}},
 	"2_metrics.down.sql": &bintree{_2_metricsDownSql, map[string]*bintree{}},
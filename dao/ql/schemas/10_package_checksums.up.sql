@@ -0,0 +1,44 @@
+BEGIN TRANSACTION;
+	DROP INDEX release_pk;
+
+	CREATE TABLE IF NOT EXISTS tmp_release (
+		name string,
+		release_id string,
+		version string,
+		metadata blob,
+		project string,
+		processed_dependencies bool DEFAULT false,
+		downloads int DEFAULT 0,
+		uploaded_by string DEFAULT "",
+		uploaded_at int DEFAULT 0,
+		package_sha256 string DEFAULT "",
+		package_size int DEFAULT 0,
+	);
+
+	INSERT INTO tmp_release(name, release_id, version, metadata, project, processed_dependencies, downloads, uploaded_by, uploaded_at)
+		SELECT name, release_id, version, metadata, project, processed_dependencies, downloads, uploaded_by, uploaded_at FROM release;
+
+	DROP TABLE release;
+COMMIT;
+
+BEGIN TRANSACTION;
+	CREATE TABLE IF NOT EXISTS release (
+		name string,
+		release_id string,
+		version string,
+		metadata blob,
+		project string,
+		processed_dependencies bool DEFAULT false,
+		downloads int DEFAULT 0,
+		uploaded_by string DEFAULT "",
+		uploaded_at int DEFAULT 0,
+		package_sha256 string DEFAULT "",
+		package_size int DEFAULT 0,
+	);
+
+	INSERT INTO release SELECT * FROM tmp_release;
+
+	DROP TABLE tmp_release;
+
+	CREATE UNIQUE INDEX IF NOT EXISTS release_pk ON release (name, version, project);
+COMMIT;
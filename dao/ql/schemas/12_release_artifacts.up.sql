@@ -0,0 +1,12 @@
+CREATE TABLE release_artifact (
+    project string,
+    release_id string,
+    artifact string,
+    platform string,
+    arch string,
+    sha256 string,
+    size int,
+    uris string,
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS release_artifact_pk ON release_artifact(project, release_id, artifact)
@@ -0,0 +1,10 @@
+CREATE TABLE release_dependency_tree (
+    project string,
+    name string,
+    version string,
+    tree string,
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS release_dependency_tree_pk ON release_dependency_tree(project, name, version);
+
+UPDATE release SET processed_dependencies = false;
@@ -30,6 +30,13 @@ func (s *SQLHelper) UpdateApplication(app *Application) error {
 	)
 }
 
+func (s *SQLHelper) DeleteApplication(app *Application) error {
+	if err := s.PrepareAndExec(s.DeleteSubscriptionsQuery, app.Project, app.Name); err != nil {
+		return err
+	}
+	return s.PrepareAndExecUpdate(s.DeleteApplicationQuery, app.Project, app.Name)
+}
+
 func (s *SQLHelper) GetApplications(namespace string) (map[string]*Application, error) {
 	rows, err := s.PrepareAndQuery(s.GetApplicationsQuery, namespace)
 	if err != nil {
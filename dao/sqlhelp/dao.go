@@ -2,6 +2,8 @@ package sqlhelp
 
 import (
 	"database/sql"
+	"regexp"
+	"strconv"
 
 	. "github.com/ankyra/escape-inventory/dao/types"
 )
@@ -12,6 +14,17 @@ type SQLHelper struct {
 	WipeDatabaseFunc        func(*SQLHelper) error
 	IsUniqueConstraintError func(error) bool
 
+	// Set for databases that only support positional (?) insert marks. The
+	// numeric marks in the queries are rewritten and the arguments reordered
+	// to match, so that the queries can be written like the other dialects.
+	RewriteNumericInsertMarks bool
+
+	// Set for databases that abort a transaction when one of its statements
+	// fails, like Postgres.
+	UseSavepoints bool
+
+	tx *sql.Tx
+
 	GetProjectQuery           string
 	AddProjectQuery           string
 	UpdateProjectQuery        string
@@ -23,6 +36,7 @@ type SQLHelper struct {
 
 	AddApplicationQuery      string
 	UpdateApplicationQuery   string
+	DeleteApplicationQuery   string
 	GetApplicationsQuery     string
 	GetApplicationQuery      string
 	GetApplicationHooksQuery string
@@ -34,21 +48,38 @@ type SQLHelper struct {
 
 	AddReleaseQuery                                 string
 	UpdateReleaseQuery                              string
+	IncrementDownloadsQuery                         string
 	GetReleaseQuery                                 string
 	GetAllReleasesQuery                             string
 	GetAllReleasesWithoutProcessedDependenciesQuery string
 	FindAllVersionsQuery                            string
+	FindAllDraftVersionsQuery                       string
+	DeleteReleaseQuery                              string
+	DeleteReleaseTagsQuery                          string
+	DeleteReleaseDependenciesQuery                  string
+	DeleteReleasePackageURIsQuery                   string
+	DeleteReleaseArtifactsQuery                     string
+	DeleteReleaseProvidersQuery                     string
 
 	GetReleaseByTagQuery  string
 	UpdateReleaseTagQuery string
 	AddReleaseTagQuery    string
+	GetReleaseTagsQuery   string
 
 	InsertDependencyQuery          string
 	GetDependenciesQuery           string
 	GetDownstreamDependenciesQuery string
+	DeleteDependencyTreeQuery      string
+	InsertDependencyTreeQuery      string
+	GetDependencyTreeQuery         string
 
-	GetPackageURIsQuery string
-	AddPackageURIQuery  string
+	GetPackageURIsQuery   string
+	AddPackageURIQuery    string
+	RemovePackageURIQuery string
+
+	GetArtifactsQuery       string
+	AddArtifactQuery        string
+	UpdateArtifactURIsQuery string
 
 	CreateUserIDMetricsQuery     string
 	GetMetricsByUserIDQuery      string
@@ -60,8 +91,10 @@ type SQLHelper struct {
 	UpdateProviderQuery         string
 
 	HardDeleteProjectPackageURIsQuery         string
+	HardDeleteProjectArtifactsQuery           string
 	HardDeleteProjectUnitSubscriptions        string
 	HardDeleteProjectReleaseDependenciesQuery string
+	HardDeleteProjectDependencyTreesQuery     string
 	HardDeleteProjectReleasesQuery            string
 	HardDeleteProjectApplicationsQuery        string
 	HardDeleteProjectQuery                    string
@@ -80,7 +113,29 @@ func (s *SQLHelper) ReadRowsIntoStringArray(rows *sql.Rows) ([]string, error) {
 	return result, nil
 }
 
+var numericInsertMark = regexp.MustCompile(`\$[0-9]+`)
+
+func (s *SQLHelper) bind(query string, arg []interface{}) (string, []interface{}) {
+	if !s.RewriteNumericInsertMarks {
+		return query, arg
+	}
+	result := []interface{}{}
+	query = numericInsertMark.ReplaceAllStringFunc(query, func(mark string) string {
+		i, _ := strconv.Atoi(mark[1:])
+		if i < 1 || i > len(arg) {
+			return mark
+		}
+		result = append(result, arg[i-1])
+		return "?"
+	})
+	return query, result
+}
+
 func (s *SQLHelper) PrepareAndQuery(query string, arg ...interface{}) (*sql.Rows, error) {
+	query, arg = s.bind(query, arg)
+	if s.tx != nil {
+		return s.tx.Query(query, arg...)
+	}
 	stmt, err := s.DB.Prepare(query)
 	if err != nil {
 		return nil, err
@@ -89,79 +144,104 @@ func (s *SQLHelper) PrepareAndQuery(query string, arg ...interface{}) (*sql.Rows
 	return stmt.Query(arg...)
 }
 
-func (s *SQLHelper) PrepareAndExec(query string, arg ...interface{}) error {
-	tx, err := s.DB.Begin()
-	if err != nil {
-		return err
+// Statements run in a transaction of their own, unless the helper is bound to
+// a transaction by RunInTransaction. A statement that fails in a bound
+// transaction is undone without aborting the rest of the transaction, so
+// that errors like duplicate keys can still be handled by the caller.
+func (s *SQLHelper) exec(query string, arg []interface{}) (sql.Result, error) {
+	query, arg = s.bind(query, arg)
+	if s.tx == nil {
+		tx, err := s.DB.Begin()
+		if err != nil {
+			return nil, err
+		}
+		result, err := tx.Exec(query, arg...)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		return result, tx.Commit()
 	}
-
-	_, err = tx.Exec(query, arg...)
+	if !s.UseSavepoints {
+		return s.tx.Exec(query, arg...)
+	}
+	if _, err := s.tx.Exec("SAVEPOINT sqlhelp_statement"); err != nil {
+		return nil, err
+	}
+	result, err := s.tx.Exec(query, arg...)
 	if err != nil {
-		tx.Rollback()
-		return err
+		if _, rollbackErr := s.tx.Exec("ROLLBACK TO SAVEPOINT sqlhelp_statement"); rollbackErr != nil {
+			return nil, rollbackErr
+		}
+		return nil, err
+	}
+	if _, err := s.tx.Exec("RELEASE SAVEPOINT sqlhelp_statement"); err != nil {
+		return nil, err
 	}
+	return result, nil
+}
 
-	return tx.Commit()
+func (s *SQLHelper) PrepareAndExec(query string, arg ...interface{}) error {
+	_, err := s.exec(query, arg)
+	return err
 }
 
 func (s *SQLHelper) PrepareAndExecInsert(query string, arg ...interface{}) error {
-	tx, err := s.DB.Begin()
-	if err != nil {
-		return err
+	_, err := s.exec(query, arg)
+	if err != nil && s.IsUniqueConstraintError(err) {
+		return AlreadyExists
 	}
+	return err
+}
 
-	_, err = tx.Exec(query, arg...)
+func (s *SQLHelper) PrepareAndExecInsertIgnoreDups(query string, arg ...interface{}) error {
+	_, err := s.exec(query, arg)
+	if err != nil && s.IsUniqueConstraintError(err) {
+		return nil
+	}
+	return err
+}
 
+func (s *SQLHelper) PrepareAndExecUpdate(query string, arg ...interface{}) error {
+	result, err := s.exec(query, arg)
 	if err != nil {
-		tx.Rollback()
 		if s.IsUniqueConstraintError(err) {
 			return AlreadyExists
 		}
 		return err
 	}
-	return tx.Commit()
-}
-
-func (s *SQLHelper) PrepareAndExecInsertIgnoreDups(query string, arg ...interface{}) error {
-	tx, err := s.DB.Begin()
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-
-	_, err = tx.Exec(query, arg...)
-	if err != nil {
-		tx.Rollback()
-		if s.IsUniqueConstraintError(err) {
-			return nil
-		}
-		return err
+	if rowsAffected == 0 {
+		return NotFound
 	}
-	return tx.Commit()
+	return nil
 }
 
-func (s *SQLHelper) PrepareAndExecUpdate(query string, arg ...interface{}) error {
+// Binds a copy of the helper to a new transaction, which is committed if f
+// succeeds. Helpers that are already bound run f in their transaction.
+func (s *SQLHelper) RunInTransaction(f func(DAO) error) error {
+	if s.tx != nil {
+		return f(s)
+	}
 	tx, err := s.DB.Begin()
 	if err != nil {
 		return err
 	}
-
-	result, err := tx.Exec(query, arg...)
-	if err != nil {
-		tx.Rollback()
-		if s.IsUniqueConstraintError(err) {
-			return AlreadyExists
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
 		}
-		return err
-	}
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
+	}()
+	helper := *s
+	helper.tx = tx
+	if err := f(&helper); err != nil {
 		tx.Rollback()
 		return err
 	}
-	if rowsAffected == 0 {
-		tx.Rollback()
-		return NotFound
-	}
 	return tx.Commit()
 }
 
@@ -0,0 +1,44 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlhelp
+
+import (
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type sqlhelpSuite struct{}
+
+var _ = Suite(&sqlhelpSuite{})
+
+func (s *sqlhelpSuite) Test_bind_leaves_queries_alone_by_default(c *C) {
+	helper := &SQLHelper{}
+	query, args := helper.bind(`UPDATE t SET a = $2 WHERE b = $1`, []interface{}{"b", "a"})
+	c.Assert(query, Equals, `UPDATE t SET a = $2 WHERE b = $1`)
+	c.Assert(args, DeepEquals, []interface{}{"b", "a"})
+}
+
+func (s *sqlhelpSuite) Test_bind_rewrites_numeric_insert_marks(c *C) {
+	helper := &SQLHelper{RewriteNumericInsertMarks: true}
+	query, args := helper.bind(`UPDATE t SET a = $2, c = $10 WHERE b = $1 AND d = $2`,
+		[]interface{}{"b", "a", 3, 4, 5, 6, 7, 8, 9, "c"})
+	c.Assert(query, Equals, `UPDATE t SET a = ?, c = ? WHERE b = ? AND d = ?`)
+	c.Assert(args, DeepEquals, []interface{}{"a", "c", "b", "a"})
+}
@@ -2,6 +2,7 @@ package sqlhelp
 
 import (
 	"database/sql"
+	"encoding/json"
 	"strconv"
 	"strings"
 
@@ -43,10 +44,35 @@ func (s *SQLHelper) GetDependencies(release *Release) ([]*Dependency, error) {
 }
 
 func (s *SQLHelper) SetDependencyTree(release *Release, depends []*DependencyTree) error {
-	return nil
+	tree, err := json.Marshal(depends)
+	if err != nil {
+		return err
+	}
+	app := release.Application
+	if err := s.PrepareAndExec(s.DeleteDependencyTreeQuery, app.Project, app.Name, release.Version); err != nil {
+		return err
+	}
+	return s.PrepareAndExecInsert(s.InsertDependencyTreeQuery, app.Project, app.Name, release.Version, string(tree))
 }
+
 func (s *SQLHelper) GetDependencyTree(release *Release) ([]*DependencyTree, error) {
-	return nil, nil
+	app := release.Application
+	rows, err := s.PrepareAndQuery(s.GetDependencyTreeQuery, app.Project, app.Name, release.Version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := []*DependencyTree{}
+	for rows.Next() {
+		var tree string
+		if err := rows.Scan(&tree); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(tree), &result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
 }
 
 func (s *SQLHelper) GetDownstreamDependencies(release *Release) ([]*Dependency, error) {
@@ -117,7 +117,6 @@ func (s *SQLHelper) GetNamespacesByNames(namespaces []string) (map[string]*Proje
 		result[prj.Name] = prj
 	}
 	return result, nil
-	return nil, nil
 }
 
 func (s *SQLHelper) GetNamespacesForUser(namespaces []string) (map[string]*Project, error) {
@@ -166,7 +165,6 @@ func (s *SQLHelper) GetNamespacesForUser(namespaces []string) (map[string]*Proje
 		result[prj.Name] = prj
 	}
 	return result, nil
-	return nil, nil
 }
 
 func (s *SQLHelper) GetNamespacesFilteredBy(f *NamespacesFilter) (map[string]*Project, error) {
@@ -225,9 +223,15 @@ func (s *SQLHelper) HardDeleteNamespace(namespace string) error {
 	if err := s.PrepareAndExec(s.HardDeleteProjectReleaseDependenciesQuery, namespace); err != nil {
 		return err
 	}
+	if err := s.PrepareAndExec(s.HardDeleteProjectDependencyTreesQuery, namespace); err != nil {
+		return err
+	}
 	if err := s.PrepareAndExec(s.HardDeleteProjectPackageURIsQuery, namespace); err != nil {
 		return err
 	}
+	if err := s.PrepareAndExec(s.HardDeleteProjectArtifactsQuery, namespace); err != nil {
+		return err
+	}
 	if err := s.PrepareAndExec(s.HardDeleteProjectReleasesQuery, namespace); err != nil {
 		return err
 	}
@@ -2,6 +2,7 @@ package sqlhelp
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	core "github.com/ankyra/escape-core"
@@ -17,13 +18,24 @@ func (s *SQLHelper) AddRelease(release *Release) error {
 		[]byte(release.Metadata.ToJson()),
 		release.UploadedBy,
 		release.UploadedAt.Unix(),
+		release.Draft,
 	)
 }
 
 func (s *SQLHelper) UpdateRelease(release *Release) error {
 	return s.PrepareAndExecUpdate(s.UpdateReleaseQuery,
 		release.ProcessedDependencies,
-		release.Downloads,
+		release.PackageSHA256,
+		release.PackageSize,
+		release.Draft,
+		release.Application.Project,
+		release.Application.Name,
+		release.ReleaseId,
+	)
+}
+
+func (s *SQLHelper) IncrementDownloads(release *Release) error {
+	return s.PrepareAndExecUpdate(s.IncrementDownloadsQuery,
 		release.Application.Project,
 		release.Application.Name,
 		release.ReleaseId,
@@ -37,6 +49,37 @@ func (s *SQLHelper) AddPackageURI(release *Release, uri string) error {
 		uri)
 }
 
+func (s *SQLHelper) RemovePackageURI(release *Release, uri string) error {
+	return s.PrepareAndExecUpdate(s.RemovePackageURIQuery,
+		release.Application.Project,
+		release.ReleaseId,
+		uri)
+}
+
+func (s *SQLHelper) DeleteRelease(release *Release) error {
+	app := release.Application
+	if err := s.PrepareAndExec(s.DeleteReleaseTagsQuery, app.Project, app.Name, release.Version); err != nil {
+		return err
+	}
+	if err := s.PrepareAndExec(s.DeleteReleaseDependenciesQuery, app.Project, app.Name, release.Version); err != nil {
+		return err
+	}
+	if err := s.PrepareAndExec(s.DeleteDependencyTreeQuery, app.Project, app.Name, release.Version); err != nil {
+		return err
+	}
+	if err := s.PrepareAndExec(s.DeleteReleasePackageURIsQuery, app.Project, release.ReleaseId); err != nil {
+		return err
+	}
+	if err := s.PrepareAndExec(s.DeleteReleaseArtifactsQuery, app.Project, release.ReleaseId); err != nil {
+		return err
+	}
+	// Providers are registered under the project in the release metadata.
+	if err := s.PrepareAndExec(s.DeleteReleaseProvidersQuery, release.Metadata.Project, release.Metadata.Name, release.Version); err != nil {
+		return err
+	}
+	return s.PrepareAndExecUpdate(s.DeleteReleaseQuery, app.Project, app.Name, release.ReleaseId)
+}
+
 func (s *SQLHelper) FindAllVersions(app *Application) ([]string, error) {
 	rows, err := s.PrepareAndQuery(s.FindAllVersionsQuery, app.Project, app.Name)
 	if err != nil {
@@ -45,6 +88,14 @@ func (s *SQLHelper) FindAllVersions(app *Application) ([]string, error) {
 	return s.ReadRowsIntoStringArray(rows)
 }
 
+func (s *SQLHelper) FindAllDraftVersions(app *Application) ([]string, error) {
+	rows, err := s.PrepareAndQuery(s.FindAllDraftVersionsQuery, app.Project, app.Name)
+	if err != nil {
+		return nil, err
+	}
+	return s.ReadRowsIntoStringArray(rows)
+}
+
 func (s *SQLHelper) GetRelease(namespace, name, releaseId string) (*Release, error) {
 	rows, err := s.PrepareAndQuery(s.GetReleaseQuery, namespace, name, releaseId)
 	if err != nil {
@@ -77,6 +128,23 @@ func (s *SQLHelper) TagRelease(rel *Release, tag string) error {
 	return err
 }
 
+func (s *SQLHelper) GetReleaseTags(app *Application) (map[string]string, error) {
+	rows, err := s.PrepareAndQuery(s.GetReleaseTagsQuery, app.Project, app.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := map[string]string{}
+	for rows.Next() {
+		var tag, version string
+		if err := rows.Scan(&tag, &version); err != nil {
+			return nil, err
+		}
+		result[tag] = version
+	}
+	return result, nil
+}
+
 func (s *SQLHelper) GetAllReleases() ([]*Release, error) {
 	rows, err := s.PrepareAndQuery(s.GetAllReleasesQuery)
 	if err != nil {
@@ -93,12 +161,61 @@ func (s *SQLHelper) GetPackageURIs(release *Release) ([]string, error) {
 	return s.ReadRowsIntoStringArray(rows)
 }
 
+func (s *SQLHelper) GetArtifacts(release *Release) ([]*Artifact, error) {
+	rows, err := s.PrepareAndQuery(s.GetArtifactsQuery, release.Application.Project, release.ReleaseId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := []*Artifact{}
+	for rows.Next() {
+		var urisString string
+		artifact := &Artifact{}
+		if err := rows.Scan(&artifact.Name, &artifact.Platform, &artifact.Arch, &artifact.SHA256, &artifact.Size, &urisString); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(urisString), &artifact.URIs); err != nil {
+			return nil, err
+		}
+		result = append(result, artifact)
+	}
+	return result, nil
+}
+
+func (s *SQLHelper) AddArtifact(release *Release, artifact *Artifact) error {
+	uris, err := json.Marshal(artifact.URIs)
+	if err != nil {
+		return err
+	}
+	return s.PrepareAndExecInsert(s.AddArtifactQuery,
+		release.Application.Project,
+		release.ReleaseId,
+		artifact.Name,
+		artifact.Platform,
+		artifact.Arch,
+		artifact.SHA256,
+		artifact.Size,
+		string(uris))
+}
+
+func (s *SQLHelper) UpdateArtifactURIs(release *Release, artifact *Artifact) error {
+	uris, err := json.Marshal(artifact.URIs)
+	if err != nil {
+		return err
+	}
+	return s.PrepareAndExecUpdate(s.UpdateArtifactURIsQuery,
+		string(uris),
+		release.Application.Project,
+		release.ReleaseId,
+		artifact.Name)
+}
+
 func (s *SQLHelper) scanRelease(namespace, name string, rows *sql.Rows) (*Release, error) {
-	var metadataJson, uploadedBy string
-	var processedDependencies bool
+	var metadataJson, uploadedBy, packageSHA256 string
+	var processedDependencies, draft bool
 	var downloads int
-	var uploadedAt int64
-	if err := rows.Scan(&metadataJson, &processedDependencies, &downloads, &uploadedBy, &uploadedAt); err != nil {
+	var uploadedAt, packageSize int64
+	if err := rows.Scan(&metadataJson, &processedDependencies, &downloads, &uploadedBy, &uploadedAt, &packageSHA256, &packageSize, &draft); err != nil {
 		return nil, err
 	}
 	metadata, err := core.NewReleaseMetadataFromJsonString(metadataJson)
@@ -110,6 +227,9 @@ func (s *SQLHelper) scanRelease(namespace, name string, rows *sql.Rows) (*Releas
 	rel.Downloads = downloads
 	rel.UploadedBy = uploadedBy
 	rel.UploadedAt = time.Unix(uploadedAt, 0)
+	rel.PackageSHA256 = packageSHA256
+	rel.PackageSize = packageSize
+	rel.Draft = draft
 	return rel, nil
 }
 
@@ -117,11 +237,11 @@ func (s *SQLHelper) scanReleases(rows *sql.Rows) ([]*Release, error) {
 	defer rows.Close()
 	result := []*Release{}
 	for rows.Next() {
-		var namespace, metadataJson, uploadedBy string
-		var processedDependencies bool
+		var namespace, metadataJson, uploadedBy, packageSHA256 string
+		var processedDependencies, draft bool
 		var downloads int
-		var uploadedAt int64
-		if err := rows.Scan(&namespace, &metadataJson, &processedDependencies, &downloads, &uploadedBy, &uploadedAt); err != nil {
+		var uploadedAt, packageSize int64
+		if err := rows.Scan(&namespace, &metadataJson, &processedDependencies, &downloads, &uploadedBy, &uploadedAt, &packageSHA256, &packageSize, &draft); err != nil {
 			return nil, err
 		}
 		metadata, err := core.NewReleaseMetadataFromJsonString(metadataJson)
@@ -133,6 +253,9 @@ func (s *SQLHelper) scanReleases(rows *sql.Rows) ([]*Release, error) {
 		rel.Downloads = downloads
 		rel.UploadedBy = uploadedBy
 		rel.UploadedAt = time.Unix(uploadedAt, 0)
+		rel.PackageSHA256 = packageSHA256
+		rel.PackageSize = packageSize
+		rel.Draft = draft
 		result = append(result, rel)
 	}
 	return result, nil
@@ -0,0 +1,194 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/ankyra/escape-inventory/dao/sqlhelp"
+	. "github.com/ankyra/escape-inventory/dao/types"
+	"github.com/mattes/migrate"
+	"github.com/mattes/migrate/source/go-bindata"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Writers wait for each other instead of failing straight away, and write
+// transactions take their lock when they start, so that two transactions
+// can't deadlock upgrading a read lock.
+const connectionOptions = "_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+
+func NewSQLiteDAO(path string) (DAO, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?"+connectionOptions)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't open SQLite database '%s': %s", path, err.Error())
+	}
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("Couldn't open SQLite database '%s': %s", path, err.Error())
+	}
+	driver, err := newMigrationDriver(db)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't initialise SQLite database '%s': %s", path, err.Error())
+	}
+	s, err := bindata.WithInstance(bindata.Resource(AssetNames(),
+		func(name string) ([]byte, error) {
+			return Asset(name)
+		}))
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't initialise SQLite database '%s': %s", path, err.Error())
+	}
+	m, err := migrate.NewWithInstance("go-bindata", s, "sqlite", driver)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't initialise migrations for SQLite database '%s': %s", path, err.Error())
+	}
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return nil, fmt.Errorf("Couldn't apply migrations to SQLite database '%s': %s", path, err.Error())
+	}
+
+	return &sqlhelp.SQLHelper{
+		DB: db,
+		UseNumericInsertMarks:     false,
+		GetProjectQuery:           `SELECT name, description, orgURL, logo, is_public FROM project WHERE name = ?1`,
+		AddProjectQuery:           `INSERT INTO project(name, description, orgURL, logo, is_public) VALUES (?1, ?2, ?3, ?4, ?5)`,
+		UpdateProjectQuery:        `UPDATE project SET name = ?1, description = ?2, orgURL = ?3, logo = ?4, is_public = ?6 WHERE name = ?5`,
+		GetProjectsQuery:          `SELECT name, description, orgURL, logo, is_public FROM project`,
+		GetNamespacesByNamesQuery: `SELECT name, description, orgURL, logo, is_public FROM project WHERE name`,
+		GetNamespacesForUserQuery: `SELECT name, description, orgURL, logo, is_public FROM project WHERE is_public = true`,
+		GetProjectHooksQuery:      `SELECT hooks FROM project WHERE name = ?1`,
+		SetProjectHooksQuery:      `UPDATE project SET hooks = ?1 WHERE name = ?2`,
+
+		GetApplicationQuery: `SELECT name, project, description, latest_version, logo, uploaded_by, uploaded_at 
+							     FROM application WHERE project = ?1 AND name = ?2`,
+		AddApplicationQuery: `INSERT INTO application(name, project, description, latest_version, logo, uploaded_by, uploaded_at)
+						      VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)`,
+		UpdateApplicationQuery: `UPDATE application 
+								 SET description = ?1, latest_version = ?2, logo = ?3,
+                                     uploaded_by = ?4, uploaded_at = ?5
+								 WHERE name = ?6 AND project = ?7`,
+		DeleteApplicationQuery: `DELETE FROM application WHERE project = ?1 AND name = ?2`,
+		GetApplicationsQuery: `SELECT name, project, description, latest_version, logo, uploaded_by, uploaded_at
+								  FROM application WHERE project = ?1`,
+		GetApplicationHooksQuery: `SELECT hooks FROM application WHERE project = ?1 AND name = ?2`,
+		SetApplicationHooksQuery: `UPDATE application SET hooks = ?1 WHERE project = ?2 AND name = ?3`,
+		DeleteSubscriptionsQuery: `DELETE FROM subscriptions WHERE project = ?1 AND name = ?2`,
+		AddSubscriptionQuery:     `INSERT INTO subscriptions (project, name, subscription_project, subscription_name) VALUES (?1, ?2, ?3, ?4);`,
+		GetDownstreamSubscriptionsQuery: `SELECT app.hooks FROM 
+								subscriptions AS sub
+								JOIN application AS app 
+								ON sub.project = app.project AND sub.name = app.name
+								WHERE sub.subscription_project = ?1 
+								  AND sub.subscription_name = ?2`,
+
+		AddReleaseQuery: `INSERT INTO 
+                          release(project, name, release_id, version, metadata, uploaded_by, uploaded_at, draft) 
+                          VALUES(?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)`,
+		UpdateReleaseQuery:                              `UPDATE release SET processed_dependencies = ?1, package_sha256 = ?2, package_size = ?3, draft = ?4 WHERE project = ?5 AND name = ?6 AND release_id = ?7`,
+		IncrementDownloadsQuery:                         `UPDATE release SET downloads = downloads + 1 WHERE project = ?1 AND name = ?2 AND release_id = ?3`,
+		GetReleaseQuery:                                 `SELECT metadata, processed_dependencies, downloads, uploaded_by, uploaded_at, package_sha256, package_size, draft FROM release WHERE project = ?1 AND name = ?2 AND release_id = ?3`,
+		GetAllReleasesQuery:                             "SELECT project, metadata, processed_dependencies, downloads, uploaded_by, uploaded_at, package_sha256, package_size, draft FROM release",
+		GetAllReleasesWithoutProcessedDependenciesQuery: `SELECT project, metadata, processed_dependencies, downloads, uploaded_by, uploaded_at, package_sha256, package_size, draft FROM release WHERE processed_dependencies = false`,
+		FindAllVersionsQuery:                            "SELECT version FROM release WHERE project = ?1 AND name = ?2 AND draft = false",
+		FindAllDraftVersionsQuery:                       "SELECT version FROM release WHERE project = ?1 AND name = ?2 AND draft = true",
+		DeleteReleaseQuery:                              `DELETE FROM release WHERE project = ?1 AND name = ?2 AND release_id = ?3`,
+		DeleteReleaseTagsQuery:                          `DELETE FROM release_tags WHERE project = ?1 AND application = ?2 AND version = ?3`,
+		DeleteReleaseDependenciesQuery:                  `DELETE FROM release_dependency WHERE project = ?1 AND name = ?2 AND version = ?3`,
+		DeleteReleasePackageURIsQuery:                   `DELETE FROM package WHERE project = ?1 AND release_id = ?2`,
+		DeleteReleaseArtifactsQuery:                     `DELETE FROM release_artifact WHERE project = ?1 AND release_id = ?2`,
+		DeleteReleaseProvidersQuery:                     `DELETE FROM providers WHERE project = ?1 AND application = ?2 AND version = ?3`,
+
+		GetReleaseByTagQuery: `SELECT metadata, processed_dependencies, downloads, uploaded_by, uploaded_at, package_sha256, package_size, draft 
+							    FROM release, release_tags AS rt 
+								WHERE rt.project = ?1 AND rt.application = ?2 AND rt.tag = ?3 
+								  AND rt.version = release.version 
+								  AND rt.project = release.project 
+								  AND rt.application = release.name`,
+		AddReleaseTagQuery:    `INSERT INTO release_tags(project, application, tag, version) VALUES (?1, ?2, ?3, ?4)`,
+		UpdateReleaseTagQuery: `UPDATE release_tags SET version = ?4 WHERE project = ?1 AND application = ?2 AND tag = ?3`,
+		GetReleaseTagsQuery:   `SELECT tag, version FROM release_tags WHERE project = ?1 AND application = ?2`,
+
+		InsertDependencyQuery: `INSERT INTO release_dependency(project, name, version,
+										dep_project, dep_name, dep_version,
+										build_scope, deploy_scope, is_extension)
+								VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9)`,
+		GetDependenciesQuery: `SELECT dep_project, dep_name, dep_version, 
+									  build_scope, deploy_scope, is_extension
+							   FROM release_dependency 
+							   WHERE project = ?1 AND name = ?2 AND version = ?3`,
+		GetDownstreamDependenciesQuery: `SELECT project, name, version, 
+							   build_scope, deploy_scope, is_extension
+							   FROM release_dependency 
+							   WHERE dep_project = ?1 AND dep_name = ?2 AND dep_version = ?3`,
+		DeleteDependencyTreeQuery: `DELETE FROM release_dependency_tree WHERE project = ?1 AND name = ?2 AND version = ?3`,
+		InsertDependencyTreeQuery: `INSERT INTO release_dependency_tree(project, name, version, tree) VALUES (?1, ?2, ?3, ?4)`,
+		GetDependencyTreeQuery:    `SELECT tree FROM release_dependency_tree WHERE project = ?1 AND name = ?2 AND version = ?3`,
+
+		GetPackageURIsQuery:   "SELECT uri FROM package WHERE project = ?1 AND release_id = ?2",
+		AddPackageURIQuery:    "INSERT INTO package (project, release_id, uri) VALUES (?1, ?2, ?3)",
+		RemovePackageURIQuery: "DELETE FROM package WHERE project = ?1 AND release_id = ?2 AND uri = ?3",
+
+		GetArtifactsQuery: `SELECT artifact, platform, arch, sha256, size, uris FROM release_artifact
+							WHERE project = ?1 AND release_id = ?2 ORDER BY artifact`,
+		AddArtifactQuery: `INSERT INTO release_artifact (project, release_id, artifact, platform, arch, sha256, size, uris)
+						   VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)`,
+		UpdateArtifactURIsQuery: `UPDATE release_artifact SET uris = ?1 WHERE project = ?2 AND release_id = ?3 AND artifact = ?4`,
+
+		CreateUserIDMetricsQuery:                  `INSERT INTO metrics(user_id) VALUES(?1)`,
+		GetMetricsByUserIDQuery:                   `SELECT project_count FROM metrics WHERE user_id = ?1`,
+		SetProjectCountMetricForUser:              `UPDATE metrics SET project_count = ?3 WHERE user_id = ?1 AND project_count = ?2`,
+		GetProviderReleasesQuery:                  `SELECT project, application, version, description FROM providers WHERE provider = ?1`,
+		GetProvidersForReleaseQuery:               `SELECT provider, version FROM providers WHERE project = ?1 AND application = ?2`,
+		SetProviderQuery:                          `INSERT INTO providers(project, application, version, description, provider) VALUES (?1, ?2, ?3, ?4, ?5)`,
+		UpdateProviderQuery:                       `UPDATE providers SET version = ?3, description = ?4 WHERE project = ?1 AND application = ?2 AND provider = ?5`,
+		HardDeleteProjectPackageURIsQuery:         `DELETE FROM package WHERE project = ?1`,
+		HardDeleteProjectArtifactsQuery:           `DELETE FROM release_artifact WHERE project = ?1`,
+		HardDeleteProjectUnitSubscriptions:        `DELETE FROM subscriptions WHERE project = ?1`,
+		HardDeleteProjectReleaseDependenciesQuery: `DELETE FROM release_dependency WHERE project = ?1`,
+		HardDeleteProjectDependencyTreesQuery:     `DELETE FROM release_dependency_tree WHERE project = ?1`,
+		HardDeleteProjectReleasesQuery:            `DELETE FROM release WHERE project = ?1`,
+		HardDeleteProjectApplicationsQuery:        `DELETE FROM application WHERE project = ?1`,
+		HardDeleteProjectQuery:                    `DELETE FROM project WHERE name = ?1 `,
+		WipeDatabaseFunc: func(s *sqlhelp.SQLHelper) error {
+			queries := []string{
+				`DELETE FROM release`,
+				`DELETE FROM release_tags`,
+				`DELETE FROM package`,
+				`DELETE FROM release_artifact`,
+				`DELETE FROM acl`,
+				`DELETE FROM application`,
+				`DELETE FROM project`,
+				`DELETE FROM release_dependency`,
+				`DELETE FROM release_dependency_tree`,
+				`DELETE FROM subscriptions`,
+				`DELETE FROM metrics`,
+				`DELETE FROM providers`,
+			}
+
+			for _, query := range queries {
+				if err := s.PrepareAndExec(query); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+		IsUniqueConstraintError: func(err error) bool {
+			sqliteErr, ok := err.(sqlite3.Error)
+			return ok && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey ||
+				sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique)
+		},
+	}, nil
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlite
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/ankyra/escape-inventory/dao/types"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type sqliteSuite struct{}
+
+var _ = Suite(&sqliteSuite{})
+
+func (s *sqliteSuite) Test_DAO(c *C) {
+	os.Mkdir("testdata", os.ModePerm)
+	types.ValidateDAO(func() types.DAO {
+		dbName := fmt.Sprintf("./testdata/%s.db", types.RandomString(6))
+		dao, err := NewSQLiteDAO(dbName)
+		c.Assert(err, IsNil)
+		return dao
+	}, c)
+	os.RemoveAll("testdata")
+}
+
+func (s *sqliteSuite) Test_NewSQLiteDAO_applies_migrations_once(c *C) {
+	os.Mkdir("testdata", os.ModePerm)
+	defer os.RemoveAll("testdata")
+	dbName := fmt.Sprintf("./testdata/%s.db", types.RandomString(6))
+	dao, err := NewSQLiteDAO(dbName)
+	c.Assert(err, IsNil)
+	c.Assert(dao.AddNamespace(types.NewProject("test")), IsNil)
+
+	dao, err = NewSQLiteDAO(dbName)
+	c.Assert(err, IsNil)
+	_, err = dao.GetNamespace("test")
+	c.Assert(err, IsNil)
+}
+
+func (s *sqliteSuite) Test_NewSQLiteDAO_fails_if_directory_doesnt_exist(c *C) {
+	_, err := NewSQLiteDAO("./does-not-exist/inventory.db")
+	c.Assert(err, Not(IsNil))
+}
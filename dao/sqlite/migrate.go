@@ -0,0 +1,142 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/mattes/migrate/database"
+)
+
+// The vendored migrate library doesn't come with a SQLite driver, so the
+// migrations are applied through this one. It works on an open database and
+// isn't registered with the library, which means it can't be opened by URL.
+type migrationDriver struct {
+	db       *sql.DB
+	isLocked bool
+}
+
+func newMigrationDriver(db *sql.DB) (*migrationDriver, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL, dirty BOOLEAN NOT NULL)`)
+	if err != nil {
+		return nil, err
+	}
+	return &migrationDriver{db: db}, nil
+}
+
+func (m *migrationDriver) Open(url string) (database.Driver, error) {
+	return nil, fmt.Errorf("The SQLite migration driver can't be opened by URL")
+}
+
+func (m *migrationDriver) Close() error {
+	return nil
+}
+
+// Migrations are only run at startup, so an in-process lock is enough.
+// SQLite's own locking keeps concurrent migrations from other processes from
+// interleaving.
+func (m *migrationDriver) Lock() error {
+	if m.isLocked {
+		return database.ErrLocked
+	}
+	m.isLocked = true
+	return nil
+}
+
+func (m *migrationDriver) Unlock() error {
+	m.isLocked = false
+	return nil
+}
+
+func (m *migrationDriver) Run(migration io.Reader) error {
+	query, err := ioutil.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+	return m.exec(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(string(query)); err != nil {
+			return &database.Error{OrigErr: err, Query: query}
+		}
+		return nil
+	})
+}
+
+func (m *migrationDriver) SetVersion(version int, dirty bool) error {
+	return m.exec(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM schema_migrations`); err != nil {
+			return err
+		}
+		if version < 0 {
+			return nil
+		}
+		_, err := tx.Exec(`INSERT INTO schema_migrations (version, dirty) VALUES (?1, ?2)`, version, dirty)
+		return err
+	})
+}
+
+func (m *migrationDriver) Version() (int, bool, error) {
+	var version int
+	var dirty bool
+	err := m.db.QueryRow(`SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return database.NilVersion, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	return version, dirty, nil
+}
+
+func (m *migrationDriver) Drop() error {
+	rows, err := m.db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		return err
+	}
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	return m.exec(func(tx *sql.Tx) error {
+		for _, table := range tables {
+			if _, err := tx.Exec(`DROP TABLE "` + table + `"`); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`CREATE TABLE schema_migrations (version INTEGER NOT NULL, dirty BOOLEAN NOT NULL)`)
+		return err
+	})
+}
+
+func (m *migrationDriver) exec(fn func(tx *sql.Tx) error) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,304 @@
+// Code generated by go-bindata.
+// sources:
+// dao/sqlite/schemas/1_initial_schema.down.sql
+// dao/sqlite/schemas/1_initial_schema.up.sql
+// dao/sqlite/schemas/2_release_dependency_trees.down.sql
+// dao/sqlite/schemas/2_release_dependency_trees.up.sql
+// DO NOT EDIT!
+
+package sqlite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func bindataRead(data []byte, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("Read %q: %v", name, err)
+	}
+
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, gz)
+	clErr := gz.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("Read %q: %v", name, err)
+	}
+	if clErr != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+type asset struct {
+	bytes []byte
+	info  os.FileInfo
+}
+
+type bindataFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi bindataFileInfo) Name() string {
+	return fi.name
+}
+func (fi bindataFileInfo) Size() int64 {
+	return fi.size
+}
+func (fi bindataFileInfo) Mode() os.FileMode {
+	return fi.mode
+}
+func (fi bindataFileInfo) ModTime() time.Time {
+	return fi.modTime
+}
+func (fi bindataFileInfo) IsDir() bool {
+	return false
+}
+func (fi bindataFileInfo) Sys() interface{} {
+	return nil
+}
+
+var __1_initial_schemaDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x6c\x8d\x41\x0a\x02\x31\x0c\x45\xf7\x73\x8a\xb9\xc7\xac\x14\xdd\x09\x8a\xb8\x97\x98\x7e\x4b\xb4\xb6\x21\x8d\x82\xb7\x17\x77\x13\xe8\x32\xef\xbf\x47\x76\xe7\xe3\x69\xbe\x6c\xb6\x87\xfd\xfc\x82\x9b\x70\x5f\xa6\x15\x23\x2e\xe1\x56\x6b\x1f\x49\xb0\x68\x19\x0a\xa8\xe3\x4a\xe6\x72\x27\xf6\x98\x10\x3f\x29\x63\x18\x24\x28\x6a\x42\xe5\xef\x70\x76\xca\xc3\x47\x81\xf5\xf7\xad\xb3\x89\xba\xb4\x1a\x6d\x52\x2d\xc2\xf4\x1f\x02\x57\x6b\x0f\xb0\x2f\xd3\x6f\x00\x17\x2b\xcd\xd1\xfd\x00\x00\x00")
+
+func _1_initial_schemaDownSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__1_initial_schemaDownSql,
+		"1_initial_schema.down.sql",
+	)
+}
+
+func _1_initial_schemaDownSql() (*asset, error) {
+	bytes, err := _1_initial_schemaDownSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "1_initial_schema.down.sql", size: 253, mode: os.FileMode(420), modTime: time.Unix(1792305821, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __1_initial_schemaUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xac\x56\xdf\x6f\xd3\x30\x10\x7e\xef\x5f\xe1\xb7\xb5\x52\x90\x58\xd9\x2a\xa4\x3d\x65\x23\xc0\x44\xe9\x50\x94\x21\x26\x84\x22\xd7\xbe\x66\x66\x6e\x6c\xd9\xce\x60\x20\xfe\x77\x94\xce\xf1\xd2\xc6\x4e\xba\x1f\xaf\xbe\xbb\xcf\xf7\x7d\xfe\xee\x92\xb3\x34\x89\xb3\x04\x65\xf1\xe9\x3c\x41\x52\x89\x9f\x40\x0c\x1a\x8f\x10\x42\xa8\xc4\x6b\x40\x5f\xe3\xf4\xec\x63\x9c\x8e\xdf\x4c\x27\xd1\xe6\x94\x82\x26\x8a\x49\xc3\x44\x89\xb2\xe4\x5b\x86\xde\x25\xef\xe3\xcb\x79\x86\x0e\x0e\xee\x13\x84\x2a\x2e\xd3\xb9\x2b\x9c\x1e\xcf\x26\x9d\x1c\x2e\x0a\xe1\xaf\xbe\x16\xe2\x46\xef\x84\xfe\xfe\xb3\x41\xa6\x73\x59\x2d\x39\x23\xe8\xf4\xe2\x62\x9e\xc4\x0b\x97\xb3\xc2\x5c\xc3\x7d\xd2\x97\xf4\xfc\x73\x9c\x5e\xa1\x4f\xc9\xd5\xb8\xa6\x30\x19\x4d\x4e\x46\xa3\x2d\x9e\x58\x4a\xce\x08\xde\x70\xf0\x70\x3d\x9c\xbe\xb5\x64\x1b\x41\x1e\xaf\x02\xc7\x06\xb4\xc9\x6f\x41\xe9\xfa\x96\x27\xaa\x51\x49\x2e\x30\x05\x9a\x2f\xef\x1c\xc4\xec\x68\x12\xce\xc3\x06\x9d\x2f\xb2\xe4\x43\x92\xba\x9c\xd7\x7b\x08\xbb\xab\x59\xd4\x58\xc1\x23\x9e\xae\x96\x8e\xbb\x46\xe3\x7e\x9d\x02\xba\xb6\x31\xf2\x60\xf1\x56\x56\x00\xa9\xdd\xb9\x05\x8a\x36\xce\x8d\xbc\x97\xec\x9c\x06\xfc\xa1\x80\x03\xd6\x80\xc6\x7d\x1c\x6c\x52\xce\xa8\x0b\xd6\xaf\x7b\x1f\xdc\x7d\x77\xc7\x69\x0d\x06\x53\x6c\xf0\xc6\x35\x03\x26\x93\x4a\x10\xd0\x1a\x68\x4e\x41\x42\x49\xa1\x24\x0c\x74\x9f\xf7\xa9\xf8\x55\xd6\x4e\xd0\x21\x17\xbc\xa0\xa1\x24\x26\x37\xb8\x80\x5c\x5f\xe3\xe9\xf1\x6c\x0b\x6d\x71\x91\xa1\xc5\xe5\x7c\xde\x81\x75\x35\xec\x0f\x38\xdc\x4e\xb6\xbd\x80\x2a\xbc\x32\x8e\x6d\x27\xab\x67\xe4\xa3\x46\xff\x3e\x1f\x37\xef\x67\x70\x31\x68\xe3\xf6\xc2\xe8\x3a\xc1\xe0\xc2\x9d\xce\x8e\x86\x1c\xe0\x75\x6c\xeb\x82\x08\x19\x5c\xf4\xf4\xeb\xbc\x70\x37\xd4\x75\xc0\xb8\xc1\xce\x28\xc8\xf0\x30\xd6\xc1\x00\x60\x1d\x0a\x82\x2e\x2b\xc6\x69\xae\x89\x90\xd0\xbc\xa5\xab\xe2\xe2\xce\x17\x61\x3a\x87\xdf\x06\xca\x8d\x7e\x36\x32\xf4\xec\x3b\xb3\x6f\xdb\x89\xda\x9c\x22\xc7\x21\x6a\xb7\xec\x91\xda\xda\x74\x48\xdf\xde\x0d\x50\x29\xe6\x3b\x7d\xb9\xf9\x5b\x31\x0e\x5b\x73\xd4\xc4\x5f\x1d\x76\xe5\x79\x68\x35\x42\x95\x62\xfb\xcc\x05\x56\x86\xad\x30\x31\xcf\x52\xc1\x81\x74\x5d\x23\x39\x36\x2b\xa1\xd6\xfb\x6d\x0e\xac\xc8\xf5\x7e\x99\x8f\xd9\x47\x5b\xfa\x85\xf6\x50\xa5\x98\xfd\x70\x76\x71\xbe\xff\x38\xe8\x8a\x6d\xa5\x8a\x5a\xd2\x44\x4e\x09\x9f\xdd\x94\xb8\x65\x14\xd4\x33\xd7\x90\xf5\xf3\x13\x7e\x56\x9a\x06\xba\xa5\xc3\xcb\xaa\xa9\xf5\xf0\xc2\x84\x0f\x31\x2a\x94\xa8\x76\xf6\xca\x83\x79\x24\xa8\x35\xd3\x9b\x2d\x60\xdf\xa8\xa7\xa9\x07\x24\x4f\x27\x6b\x30\x8a\x91\x46\xdf\x4a\x83\x6a\xdb\xb5\xfe\x00\xb6\x30\x9d\x26\x75\xcb\x39\x11\x55\xe9\x99\xc1\xd1\xe4\x64\xf4\x7f\x00\x7c\x48\x6b\x99\x3c\x0b\x00\x00")
+
+func _1_initial_schemaUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__1_initial_schemaUpSql,
+		"1_initial_schema.up.sql",
+	)
+}
+
+func _1_initial_schemaUpSql() (*asset, error) {
+	bytes, err := _1_initial_schemaUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "1_initial_schema.up.sql", size: 2876, mode: os.FileMode(420), modTime: time.Unix(1792305821, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __2_release_dependency_treesDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x24\x00\xdb\xff\x44\x52\x4f\x50\x20\x54\x41\x42\x4c\x45\x20\x72\x65\x6c\x65\x61\x73\x65\x5f\x64\x65\x70\x65\x6e\x64\x65\x6e\x63\x79\x5f\x74\x72\x65\x65\x3b\x0a\x03\x00\xb5\x1e\x84\x84\x24\x00\x00\x00")
+
+func _2_release_dependency_treesDownSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__2_release_dependency_treesDownSql,
+		"2_release_dependency_trees.down.sql",
+	)
+}
+
+func _2_release_dependency_treesDownSql() (*asset, error) {
+	bytes, err := _2_release_dependency_treesDownSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "2_release_dependency_trees.down.sql", size: 36, mode: os.FileMode(420), modTime: time.Unix(1792306298, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __2_release_dependency_treesUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x64\x8f\x41\x4b\x85\x40\x14\x85\xf7\xf3\x2b\xce\x4e\x05\x37\xd9\x26\x90\x16\x93\x4e\x14\x4d\x26\xd3\x35\x92\x08\x11\xbd\x81\x61\xa3\xcc\x48\xd0\xbf\x8f\xe7\xf3\xf9\x16\x6f\x7b\xee\xe1\x7c\xdf\xcd\x8c\x92\xa4\x40\xf2\x4e\x2b\x38\x1e\xb9\xf5\xdc\xf4\x3c\xb3\xed\xd9\x76\x7f\xcd\xe2\x98\x11\x0a\x00\x98\xdd\xf4\xcd\xdd\x82\x37\x69\xb2\x07\x69\xc2\xeb\x24\x8a\xd7\x83\x6d\x7f\x78\x4f\xaf\x92\x9b\x2d\xfe\x65\xe7\x87\xc9\x5e\xf6\xd7\x4d\x52\xef\x84\xe2\x85\x50\x54\x5a\x23\x57\xf7\xb2\xd2\x84\xe0\xe3\x33\x38\x96\x4a\xf3\xf8\x2c\x4d\x8d\x27\x55\x87\x1b\x39\x5e\x49\xf1\x69\x38\x12\x51\x2a\x44\x55\xe6\x92\x76\x75\xbc\x2a\x3a\x88\x76\xec\x3d\xf7\xe7\x47\x06\xf6\xb8\xc5\x57\x3b\x7a\x4e\xc5\xff\x00\xf4\x14\x75\x84\xf4\x00\x00\x00")
+
+func _2_release_dependency_treesUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__2_release_dependency_treesUpSql,
+		"2_release_dependency_trees.up.sql",
+	)
+}
+
+func _2_release_dependency_treesUpSql() (*asset, error) {
+	bytes, err := _2_release_dependency_treesUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "2_release_dependency_trees.up.sql", size: 244, mode: os.FileMode(420), modTime: time.Unix(1792306376, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+// Asset loads and returns the asset for the given name.
+// It returns an error if the asset could not be found or
+// could not be loaded.
+func Asset(name string) ([]byte, error) {
+	cannonicalName := strings.Replace(name, "\\", "/", -1)
+	if f, ok := _bindata[cannonicalName]; ok {
+		a, err := f()
+		if err != nil {
+			return nil, fmt.Errorf("Asset %s can't read by error: %v", name, err)
+		}
+		return a.bytes, nil
+	}
+	return nil, fmt.Errorf("Asset %s not found", name)
+}
+
+// MustAsset is like Asset but panics when Asset would return an error.
+// It simplifies safe initialization of global variables.
+func MustAsset(name string) []byte {
+	a, err := Asset(name)
+	if err != nil {
+		panic("asset: Asset(" + name + "): " + err.Error())
+	}
+
+	return a
+}
+
+// AssetInfo loads and returns the asset info for the given name.
+// It returns an error if the asset could not be found or
+// could not be loaded.
+func AssetInfo(name string) (os.FileInfo, error) {
+	cannonicalName := strings.Replace(name, "\\", "/", -1)
+	if f, ok := _bindata[cannonicalName]; ok {
+		a, err := f()
+		if err != nil {
+			return nil, fmt.Errorf("AssetInfo %s can't read by error: %v", name, err)
+		}
+		return a.info, nil
+	}
+	return nil, fmt.Errorf("AssetInfo %s not found", name)
+}
+
+// AssetNames returns the names of the assets.
+func AssetNames() []string {
+	names := make([]string, 0, len(_bindata))
+	for name := range _bindata {
+		names = append(names, name)
+	}
+	return names
+}
+
+// _bindata is a table, holding each asset generator, mapped to its name.
+var _bindata = map[string]func() (*asset, error){
+	"1_initial_schema.down.sql": _1_initial_schemaDownSql,
+	"1_initial_schema.up.sql": _1_initial_schemaUpSql,
+	"2_release_dependency_trees.down.sql": _2_release_dependency_treesDownSql,
+	"2_release_dependency_trees.up.sql": _2_release_dependency_treesUpSql,
+}
+
+// AssetDir returns the file names below a certain
+// directory embedded in the file by go-bindata.
+// For example if you run go-bindata on data/... and data contains the
+// following hierarchy:
+//     data/
+//       foo.txt
+//       img/
+//         a.png
+//         b.png
+// then AssetDir("data") would return []string{"foo.txt", "img"}
+// AssetDir("data/img") would return []string{"a.png", "b.png"}
+// AssetDir("foo.txt") and AssetDir("notexist") would return an error
+// AssetDir("") will return []string{"data"}.
+func AssetDir(name string) ([]string, error) {
+	node := _bintree
+	if len(name) != 0 {
+		cannonicalName := strings.Replace(name, "\\", "/", -1)
+		pathList := strings.Split(cannonicalName, "/")
+		for _, p := range pathList {
+			node = node.Children[p]
+			if node == nil {
+				return nil, fmt.Errorf("Asset %s not found", name)
+			}
+		}
+	}
+	if node.Func != nil {
+		return nil, fmt.Errorf("Asset %s not found", name)
+	}
+	rv := make([]string, 0, len(node.Children))
+	for childName := range node.Children {
+		rv = append(rv, childName)
+	}
+	return rv, nil
+}
+
+type bintree struct {
+	Func     func() (*asset, error)
+	Children map[string]*bintree
+}
+var _bintree = &bintree{nil, map[string]*bintree{
+	"1_initial_schema.down.sql": &bintree{_1_initial_schemaDownSql, map[string]*bintree{}},
+	"1_initial_schema.up.sql": &bintree{_1_initial_schemaUpSql, map[string]*bintree{}},
+	"2_release_dependency_trees.down.sql": &bintree{_2_release_dependency_treesDownSql, map[string]*bintree{}},
+	"2_release_dependency_trees.up.sql": &bintree{_2_release_dependency_treesUpSql, map[string]*bintree{}},
+}}
+
+// RestoreAsset restores an asset under the given directory
+func RestoreAsset(dir, name string) error {
+	data, err := Asset(name)
+	if err != nil {
+		return err
+	}
+	info, err := AssetInfo(name)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(_filePath(dir, filepath.Dir(name)), os.FileMode(0755))
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(_filePath(dir, name), data, info.Mode())
+	if err != nil {
+		return err
+	}
+	err = os.Chtimes(_filePath(dir, name), info.ModTime(), info.ModTime())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RestoreAssets restores an asset under the given directory recursively
+func RestoreAssets(dir, name string) error {
+	children, err := AssetDir(name)
+	// File
+	if err != nil {
+		return RestoreAsset(dir, name)
+	}
+	// Dir
+	for _, child := range children {
+		err = RestoreAssets(dir, filepath.Join(name, child))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func _filePath(dir, name string) string {
+	cannonicalName := strings.Replace(name, "\\", "/", -1)
+	return filepath.Join(append([]string{dir}, strings.Split(cannonicalName, "/")...)...)
+}
+
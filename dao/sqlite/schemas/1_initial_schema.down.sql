@@ -0,0 +1,11 @@
+DROP TABLE metrics;
+DROP TABLE acl;
+DROP TABLE providers;
+DROP TABLE release_artifact;
+DROP TABLE package;
+DROP TABLE release_dependency;
+DROP TABLE release_tags;
+DROP TABLE release;
+DROP TABLE subscriptions;
+DROP TABLE application;
+DROP TABLE project;
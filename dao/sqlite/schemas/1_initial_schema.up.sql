@@ -0,0 +1,109 @@
+CREATE TABLE project (
+    name VARCHAR(32),
+    description TEXT DEFAULT '',
+    orgURL VARCHAR(256) DEFAULT '',
+    logo TEXT DEFAULT '',
+    hooks TEXT DEFAULT '{}',
+    is_public BOOLEAN DEFAULT false,
+    PRIMARY KEY(name)
+);
+
+CREATE TABLE application (
+    name VARCHAR(128),
+    project VARCHAR(32),
+    description TEXT DEFAULT '',
+    latest_version VARCHAR(256) DEFAULT '',
+    logo TEXT DEFAULT '',
+    uploaded_by VARCHAR(64) DEFAULT '',
+    uploaded_at INTEGER DEFAULT 0,
+    hooks TEXT DEFAULT '{}',
+    PRIMARY KEY(name, project)
+);
+
+CREATE TABLE subscriptions (
+    project VARCHAR(32),
+    name VARCHAR(128),
+    subscription_project VARCHAR(32),
+    subscription_name VARCHAR(128),
+    PRIMARY KEY(project, name, subscription_project, subscription_name)
+);
+
+CREATE TABLE release (
+    name VARCHAR(128),
+    release_id VARCHAR(256),
+    version VARCHAR(32),
+    metadata TEXT,
+    project VARCHAR(32),
+    processed_dependencies BOOLEAN DEFAULT false,
+    downloads INTEGER DEFAULT 0,
+    uploaded_by VARCHAR(64) DEFAULT '',
+    uploaded_at INTEGER DEFAULT 0,
+    package_sha256 VARCHAR(64) NOT NULL DEFAULT '',
+    package_size INTEGER NOT NULL DEFAULT 0,
+    draft BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY(name, version, project)
+);
+
+CREATE TABLE release_tags (
+    project VARCHAR(32),
+    application VARCHAR(128),
+    tag VARCHAR(64),
+    version VARCHAR(32),
+    PRIMARY KEY(project, application, tag)
+);
+
+CREATE TABLE release_dependency (
+    project VARCHAR(32),
+    name VARCHAR(128),
+    version VARCHAR(32),
+    dep_project VARCHAR(32),
+    dep_name VARCHAR(128),
+    dep_version VARCHAR(32),
+    build_scope BOOLEAN,
+    deploy_scope BOOLEAN,
+    is_extension BOOLEAN DEFAULT false,
+    PRIMARY KEY(project, name, version, dep_project, dep_name, dep_version)
+);
+
+CREATE TABLE package (
+    project VARCHAR(32),
+    release_id VARCHAR(256),
+    uri VARCHAR(256),
+    uploaded_by VARCHAR(64) DEFAULT '',
+    uploaded_at INTEGER DEFAULT 0,
+    filesize INTEGER DEFAULT -1,
+    PRIMARY KEY(release_id, uri, project)
+);
+
+CREATE TABLE release_artifact (
+    project VARCHAR(32),
+    release_id VARCHAR(256),
+    artifact VARCHAR(128),
+    platform VARCHAR(64) NOT NULL DEFAULT '',
+    arch VARCHAR(64) NOT NULL DEFAULT '',
+    sha256 VARCHAR(64) NOT NULL DEFAULT '',
+    size INTEGER NOT NULL DEFAULT 0,
+    uris TEXT NOT NULL DEFAULT '[]',
+    PRIMARY KEY(project, release_id, artifact)
+);
+
+CREATE TABLE providers (
+    project VARCHAR(32),
+    application VARCHAR(128),
+    version VARCHAR(32),
+    description TEXT DEFAULT '',
+    provider VARCHAR(32),
+    PRIMARY KEY(project, application, provider)
+);
+
+CREATE TABLE acl (
+    project VARCHAR(32),
+    group_name VARCHAR(256),
+    permission INTEGER,
+    PRIMARY KEY(project, group_name)
+);
+
+CREATE TABLE metrics (
+    user_id VARCHAR(64) PRIMARY KEY,
+    project_count INTEGER DEFAULT 0
+);
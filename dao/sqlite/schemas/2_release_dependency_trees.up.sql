@@ -0,0 +1,9 @@
+CREATE TABLE release_dependency_tree (
+    project VARCHAR(32),
+    name VARCHAR(128),
+    version VARCHAR(32),
+    tree TEXT NOT NULL DEFAULT '[]',
+    PRIMARY KEY(project, name, version)
+);
+
+UPDATE release SET processed_dependencies = false;
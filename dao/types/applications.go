@@ -22,8 +22,10 @@ type ApplicationsDAO interface {
 	GetApplication(namespace, name string) (*Application, error)
 	AddApplication(app *Application) error
 	UpdateApplication(app *Application) error
+	DeleteApplication(app *Application) error
 	GetApplications(namespace string) (map[string]*Application, error)
 	FindAllVersions(application *Application) ([]string, error)
+	FindAllDraftVersions(application *Application) ([]string, error)
 	GetApplicationHooks(*Application) (Hooks, error)
 	SetApplicationHooks(*Application, Hooks) error
 	GetDownstreamHooks(*Application) ([]*Hooks, error)
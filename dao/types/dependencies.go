@@ -53,9 +53,12 @@ func NewDownstreamDependenciesFilter(namespaces []string) *DownstreamDependencie
 	}
 }
 
+// Truncated is set on nodes whose upstream dependencies were left out because
+// the tree grew too large.
 type DependencyTree struct {
 	Dependency *Dependency       `json:"dependency"`
 	Children   []*DependencyTree `json:"children"`
+	Truncated  bool              `json:"truncated,omitempty"`
 }
 
 func NewDependencyTree(d *Dependency) *DependencyTree {
@@ -26,11 +26,20 @@ type ReleasesDAO interface {
 	GetRelease(namespace, name, releaseId string) (*Release, error)
 	GetReleaseByTag(namespace, name, tag string) (*Release, error)
 	TagRelease(release *Release, tag string) error
+	GetReleaseTags(app *Application) (map[string]string, error)
 	AddRelease(*Release) error
+	// Doesn't change the download counter, which is only ever incremented
+	// by IncrementDownloads, so that concurrent downloads are all counted.
 	UpdateRelease(*Release) error
+	IncrementDownloads(*Release) error
 	GetAllReleases() ([]*Release, error)
 	GetPackageURIs(release *Release) ([]string, error)
 	AddPackageURI(release *Release, uri string) error
+	RemovePackageURI(release *Release, uri string) error
+	GetArtifacts(release *Release) ([]*Artifact, error)
+	AddArtifact(release *Release, artifact *Artifact) error
+	UpdateArtifactURIs(release *Release, artifact *Artifact) error
+	DeleteRelease(release *Release) error
 	GetProviders(providerName string) (map[string]*MinimalReleaseMetadata, error)
 	GetProvidersFilteredBy(providerName string, q *ProvidersFilter) (map[string]*MinimalReleaseMetadata, error)
 	RegisterProviders(release *core.ReleaseMetadata) error
@@ -45,6 +54,9 @@ type Release struct {
 	Downloads             int
 	UploadedBy            string
 	UploadedAt            time.Time
+	PackageSHA256         string
+	PackageSize           int64
+	Draft                 bool
 }
 
 func NewRelease(app *Application, metadata *core.ReleaseMetadata) *Release {
@@ -77,3 +89,15 @@ func NewProvidersFilter(namespaces []string) *ProvidersFilter {
 		Namespaces: namespaces,
 	}
 }
+
+// An artifact is a file that's stored next to the release's package, like a
+// build for a specific platform or the release's documentation. Artifacts are
+// identified by their name within the release.
+type Artifact struct {
+	Name     string
+	Platform string
+	Arch     string
+	SHA256   string
+	Size     int64
+	URIs     []string
+}
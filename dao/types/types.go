@@ -33,6 +33,11 @@ type DAO interface {
 	DependenciesDAO
 	MetricsDAO
 
+	// Runs f with a DAO that makes all its changes in one transaction. The
+	// changes are committed when f returns nil and rolled back when it
+	// returns an error. Calling RunInTransaction on the DAO that is passed
+	// to f runs in the same transaction.
+	RunInTransaction(f func(DAO) error) error
 	WipeDatabase() error
 }
 
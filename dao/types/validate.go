@@ -17,6 +17,7 @@ limitations under the License.
 package types
 
 import (
+	"fmt"
 	"math/rand"
 	"time"
 
@@ -43,14 +44,26 @@ func ValidateDAO(dao func() DAO, c *C) {
 	Validate_FindAllVersions_Empty(dao(), c)
 	Validate_GetPackageURIs(dao(), c)
 	Validate_AddPackageURI_Unique(dao(), c)
+	Validate_RemovePackageURI(dao(), c)
+	Validate_DeleteRelease(dao(), c)
+	Validate_DeleteApplication(dao(), c)
+	Validate_PackageChecksum(dao(), c)
+	Validate_DraftReleases(dao(), c)
+	Validate_Artifacts(dao(), c)
 	Validate_GetAllReleases(dao(), c)
 	Validate_GetReleasesWithoutProcessedDependencies(dao(), c)
+	Validate_IncrementDownloads(dao(), c)
 	Validate_Dependencies(dao(), c)
+	Validate_DependencyTree(dao(), c)
 	Validate_Metrics(dao(), c)
 	Validate_Providers(dao(), c)
 	Validate_ProvidersFilteredBy(dao(), c)
 	Validate_HardDeleteNamespace(dao(), c)
 	Validate_PublicNamespace(dao(), c)
+	Validate_Transaction_Commit(dao(), c)
+	Validate_Transaction_Rollback(dao(), c)
+	Validate_Transaction_Continues_After_Failed_Statement(dao(), c)
+	Validate_Transaction_Nested(dao(), c)
 	Validate_WipeDatabase(dao(), c)
 }
 
@@ -161,6 +174,18 @@ func Validate_TagRelease(dao DAO, c *C) {
 	updated, err := dao.GetReleaseByTag("_", "my-application", "latest")
 	c.Assert(err, IsNil)
 	c.Assert(updated, DeepEquals, r2)
+
+	tags, err := dao.GetReleaseTags(r1.Application)
+	c.Assert(err, IsNil)
+	c.Assert(tags, DeepEquals, map[string]string{
+		"production":  "1.0",
+		"latest":      "1.1",
+		"ci":          "1.1",
+		"updated-tag": "1.1",
+	})
+	tags, err = dao.GetReleaseTags(NewApplication("_", "not_found"))
+	c.Assert(err, IsNil)
+	c.Assert(tags, HasLen, 0)
 }
 
 func Validate_GetNamespaces(dao DAO, c *C) {
@@ -669,6 +694,198 @@ func Validate_AddPackageURI_Unique(dao DAO, c *C) {
 	c.Assert(dao.AddPackageURI(release, "file:///test.txt"), Equals, AlreadyExists)
 }
 
+func Validate_RemovePackageURI(dao DAO, c *C) {
+	release := addRelease(dao, c, "dao-val", "1")
+	c.Assert(dao.AddPackageURI(release, "file:///test.txt"), IsNil)
+	c.Assert(dao.AddPackageURI(release, "gcs:///test.txt"), IsNil)
+	c.Assert(dao.RemovePackageURI(release, "file:///test.txt"), IsNil)
+	c.Assert(dao.RemovePackageURI(release, "file:///test.txt"), Equals, NotFound)
+
+	release, err := dao.GetRelease("_", "dao-val", "dao-val-v1")
+	c.Assert(err, IsNil)
+	uris, err := dao.GetPackageURIs(release)
+	c.Assert(err, IsNil)
+	c.Assert(uris, DeepEquals, []string{"gcs:///test.txt"})
+
+	c.Assert(dao.AddPackageURI(release, "file:///test.txt"), IsNil)
+}
+
+func Validate_DeleteRelease(dao DAO, c *C) {
+	release := addRelease(dao, c, "dao-val", "1")
+	other := addRelease(dao, c, "dao-val", "2")
+	c.Assert(dao.AddPackageURI(release, "file:///test.txt"), IsNil)
+	c.Assert(dao.AddPackageURI(other, "file:///other.txt"), IsNil)
+	c.Assert(dao.SetDependencies(release, []*Dependency{NewDependency("_", "dep", "1.0")}), IsNil)
+	c.Assert(dao.TagRelease(release, "stable"), IsNil)
+	release.Metadata.AddProvides("provider")
+	c.Assert(dao.RegisterProviders(release.Metadata), IsNil)
+
+	c.Assert(dao.DeleteRelease(release), IsNil)
+	c.Assert(dao.DeleteRelease(release), Equals, NotFound)
+
+	_, err := dao.GetRelease("_", "dao-val", "dao-val-v1")
+	c.Assert(err, Equals, NotFound)
+	_, err = dao.GetReleaseByTag("_", "dao-val", "stable")
+	c.Assert(err, Equals, NotFound)
+	versions, err := dao.FindAllVersions(release.Application)
+	c.Assert(err, IsNil)
+	c.Assert(versions, DeepEquals, []string{"2"})
+	releases, err := dao.GetAllReleases()
+	c.Assert(err, IsNil)
+	c.Assert(releases, HasLen, 1)
+	uris, err := dao.GetPackageURIs(release)
+	c.Assert(err, IsNil)
+	c.Assert(uris, HasLen, 0)
+	uris, err = dao.GetPackageURIs(other)
+	c.Assert(err, IsNil)
+	c.Assert(uris, DeepEquals, []string{"file:///other.txt"})
+	deps, err := dao.GetDependencies(release)
+	c.Assert(err, IsNil)
+	c.Assert(deps, HasLen, 0)
+	providers, _ := dao.GetProviders("provider")
+	c.Assert(providers, HasLen, 0)
+
+	// The release can be added again
+	addRelease(dao, c, "dao-val", "1")
+}
+
+func Validate_DeleteApplication(dao DAO, c *C) {
+	c.Assert(dao.AddNamespace(NewProject("_")), IsNil)
+	app := NewApplication("_", "dao-val")
+	upstream := NewApplication("_", "upstream")
+	c.Assert(dao.AddApplication(app), IsNil)
+	c.Assert(dao.AddApplication(upstream), IsNil)
+	c.Assert(dao.SetApplicationSubscribesToUpdatesFrom(app, []*Application{upstream}), IsNil)
+
+	c.Assert(dao.DeleteApplication(app), IsNil)
+	c.Assert(dao.DeleteApplication(app), Equals, NotFound)
+
+	_, err := dao.GetApplication("_", "dao-val")
+	c.Assert(err, Equals, NotFound)
+	apps, err := dao.GetApplications("_")
+	c.Assert(err, IsNil)
+	c.Assert(apps, HasLen, 1)
+	hooks, err := dao.GetDownstreamHooks(upstream)
+	c.Assert(err, IsNil)
+	c.Assert(hooks, HasLen, 0)
+
+	// The application can be added again
+	c.Assert(dao.AddApplication(app), IsNil)
+}
+
+func Validate_PackageChecksum(dao DAO, c *C) {
+	release := addRelease(dao, c, "dao-val", "1")
+	release, err := dao.GetRelease("_", "dao-val", "dao-val-v1")
+	c.Assert(err, IsNil)
+	c.Assert(release.PackageSHA256, Equals, "")
+	c.Assert(release.PackageSize, Equals, int64(0))
+
+	release.PackageSHA256 = "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a"
+	release.PackageSize = 12
+	c.Assert(dao.UpdateRelease(release), IsNil)
+
+	release, err = dao.GetRelease("_", "dao-val", "dao-val-v1")
+	c.Assert(err, IsNil)
+	c.Assert(release.PackageSHA256, Equals, "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a")
+	c.Assert(release.PackageSize, Equals, int64(12))
+
+	releases, err := dao.GetAllReleases()
+	c.Assert(err, IsNil)
+	c.Assert(releases, HasLen, 1)
+	c.Assert(releases[0].PackageSHA256, Equals, "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a")
+	c.Assert(releases[0].PackageSize, Equals, int64(12))
+
+	c.Assert(dao.TagRelease(release, "stable"), IsNil)
+	release, err = dao.GetReleaseByTag("_", "dao-val", "stable")
+	c.Assert(err, IsNil)
+	c.Assert(release.PackageSHA256, Equals, "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a")
+	c.Assert(release.PackageSize, Equals, int64(12))
+}
+
+func Validate_DraftReleases(dao DAO, c *C) {
+	app := addRelease(dao, c, "dao-val", "1").Application
+	draft := addRelease(dao, c, "dao-val", "2")
+	draft.Draft = true
+	c.Assert(dao.UpdateRelease(draft), IsNil)
+
+	release, err := dao.GetRelease("_", "dao-val", "dao-val-v2")
+	c.Assert(err, IsNil)
+	c.Assert(release.Draft, Equals, true)
+	versions, err := dao.FindAllVersions(app)
+	c.Assert(err, IsNil)
+	c.Assert(versions, DeepEquals, []string{"1"})
+	versions, err = dao.FindAllDraftVersions(app)
+	c.Assert(err, IsNil)
+	c.Assert(versions, DeepEquals, []string{"2"})
+
+	release.Draft = false
+	c.Assert(dao.UpdateRelease(release), IsNil)
+	release, err = dao.GetRelease("_", "dao-val", "dao-val-v2")
+	c.Assert(err, IsNil)
+	c.Assert(release.Draft, Equals, false)
+	versions, err = dao.FindAllVersions(app)
+	c.Assert(err, IsNil)
+	c.Assert(versions, HasLen, 2)
+	versions, err = dao.FindAllDraftVersions(app)
+	c.Assert(err, IsNil)
+	c.Assert(versions, HasLen, 0)
+}
+
+func Validate_Artifacts(dao DAO, c *C) {
+	release := addRelease(dao, c, "dao-val", "1")
+	other := addReleaseToProject(dao, c, "dao-val", "1", "other-project")
+	artifacts, err := dao.GetArtifacts(release)
+	c.Assert(err, IsNil)
+	c.Assert(artifacts, HasLen, 0)
+
+	linux := &Artifact{
+		Name:     "linux-amd64",
+		Platform: "linux",
+		Arch:     "amd64",
+		SHA256:   "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a",
+		Size:     12,
+		URIs:     []string{"file:///linux.tgz", "gcs://linux.tgz"},
+	}
+	docs := &Artifact{
+		Name: "docs",
+		URIs: []string{"file:///docs.tgz"},
+	}
+	c.Assert(dao.AddArtifact(release, linux), IsNil)
+	c.Assert(dao.AddArtifact(release, docs), IsNil)
+	c.Assert(dao.AddArtifact(release, docs), Equals, AlreadyExists)
+
+	artifacts, err = dao.GetArtifacts(release)
+	c.Assert(err, IsNil)
+	c.Assert(artifacts, HasLen, 2)
+	found := map[string]*Artifact{}
+	for _, artifact := range artifacts {
+		found[artifact.Name] = artifact
+	}
+	c.Assert(found["linux-amd64"], DeepEquals, linux)
+	c.Assert(found["docs"].URIs, DeepEquals, []string{"file:///docs.tgz"})
+	c.Assert(found["docs"].Platform, Equals, "")
+
+	docs.URIs = []string{"gcs://docs.tgz"}
+	c.Assert(dao.UpdateArtifactURIs(release, docs), IsNil)
+	artifacts, err = dao.GetArtifacts(release)
+	c.Assert(err, IsNil)
+	for _, artifact := range artifacts {
+		found[artifact.Name] = artifact
+	}
+	c.Assert(found["docs"].URIs, DeepEquals, []string{"gcs://docs.tgz"})
+	c.Assert(found["linux-amd64"].URIs, DeepEquals, linux.URIs)
+	c.Assert(dao.UpdateArtifactURIs(release, &Artifact{Name: "unknown"}), Equals, NotFound)
+
+	artifacts, err = dao.GetArtifacts(other)
+	c.Assert(err, IsNil)
+	c.Assert(artifacts, HasLen, 0)
+
+	c.Assert(dao.DeleteRelease(release), IsNil)
+	artifacts, err = dao.GetArtifacts(release)
+	c.Assert(err, IsNil)
+	c.Assert(artifacts, HasLen, 0)
+}
+
 func Validate_GetAllReleases(dao DAO, c *C) {
 	addRelease(dao, c, "dao-val", "0.1")
 	addRelease(dao, c, "dao-val", "0.2")
@@ -687,7 +904,6 @@ func Validate_GetReleasesWithoutProcessedDependencies(dao DAO, c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(releases, HasLen, 1)
 	release.ProcessedDependencies = true
-	release.Downloads = 14
 	c.Assert(dao.UpdateRelease(release), IsNil)
 	releases, err = dao.GetAllReleasesWithoutProcessedDependencies()
 	c.Assert(err, IsNil)
@@ -695,11 +911,26 @@ func Validate_GetReleasesWithoutProcessedDependencies(dao DAO, c *C) {
 	release, err = dao.GetRelease("_", "dao-val", "dao-val-v1")
 	c.Assert(err, IsNil)
 	c.Assert(release.ProcessedDependencies, Equals, true)
-	c.Assert(release.Downloads, Equals, 14)
 	c.Assert(release.UploadedBy, Equals, "123-123")
 	c.Assert(release.UploadedAt, Equals, time.Unix(123, 0))
 }
 
+func Validate_IncrementDownloads(dao DAO, c *C) {
+	release := addRelease(dao, c, "dao-val", "1")
+	c.Assert(dao.IncrementDownloads(release), IsNil)
+	c.Assert(dao.IncrementDownloads(release), IsNil)
+	release.Downloads = 14
+	release.ProcessedDependencies = true
+	c.Assert(dao.UpdateRelease(release), IsNil)
+	release, err := dao.GetRelease("_", "dao-val", "dao-val-v1")
+	c.Assert(err, IsNil)
+	c.Assert(release.Downloads, Equals, 2)
+	c.Assert(release.ProcessedDependencies, Equals, true)
+
+	unknown := NewRelease(NewApplication("_", "unknown"), &core.ReleaseMetadata{Name: "unknown", Version: "1"})
+	c.Assert(dao.IncrementDownloads(unknown), Equals, NotFound)
+}
+
 func Validate_Dependencies(dao DAO, c *C) {
 	release := addRelease(dao, c, "dao-val", "1")
 	deps, err := dao.GetDependencies(release)
@@ -755,6 +986,38 @@ func Validate_Dependencies(dao DAO, c *C) {
 	c.Assert(ds[0], DeepEquals, downstream[0])
 }
 
+func Validate_DependencyTree(dao DAO, c *C) {
+	release := addRelease(dao, c, "dao-val", "1")
+	tree, err := dao.GetDependencyTree(release)
+	c.Assert(err, IsNil)
+	c.Assert(tree, HasLen, 0)
+
+	child := NewDependencyTree(NewDependency("_", "dao-child", "2"))
+	child.Dependency.DeployScope = true
+	parent := NewDependencyTree(NewDependency("_", "dao-parent", "1"))
+	parent.Dependency.BuildScope = true
+	parent.Children = append(parent.Children, child)
+	extension := NewDependencyTree(NewDependency("other", "dao-extension", "0.1.0"))
+	extension.Dependency.IsExtension = true
+	expected := []*DependencyTree{parent, extension}
+	c.Assert(dao.SetDependencyTree(release, expected), IsNil)
+	tree, err = dao.GetDependencyTree(release)
+	c.Assert(err, IsNil)
+	c.Assert(tree, DeepEquals, expected)
+
+	expected = []*DependencyTree{extension}
+	c.Assert(dao.SetDependencyTree(release, expected), IsNil)
+	tree, err = dao.GetDependencyTree(release)
+	c.Assert(err, IsNil)
+	c.Assert(tree, DeepEquals, expected)
+
+	c.Assert(dao.DeleteRelease(release), IsNil)
+	release = addRelease(dao, c, "dao-val", "1")
+	tree, err = dao.GetDependencyTree(release)
+	c.Assert(err, IsNil)
+	c.Assert(tree, HasLen, 0)
+}
+
 func Validate_Metrics(dao DAO, c *C) {
 	metrics, err := dao.GetUserMetrics("test-user")
 	c.Assert(err, IsNil)
@@ -867,6 +1130,93 @@ func Validate_PublicNamespace(dao DAO, c *C) {
 	c.Assert(daoNamespace.IsPublic, Equals, false)
 }
 
+func Validate_Transaction_Commit(dao DAO, c *C) {
+	err := dao.RunInTransaction(func(tx DAO) error {
+		release := addReleaseToProject(tx, c, "tx-app", "1.0.0", "tx-project")
+		found, err := tx.GetRelease("tx-project", "tx-app", "tx-app-v1.0.0")
+		c.Assert(err, IsNil)
+		c.Assert(found.Version, Equals, "1.0.0")
+		return tx.TagRelease(release, "stable")
+	})
+	c.Assert(err, IsNil)
+
+	_, err = dao.GetNamespace("tx-project")
+	c.Assert(err, IsNil)
+	release, err := dao.GetReleaseByTag("tx-project", "tx-app", "stable")
+	c.Assert(err, IsNil)
+	c.Assert(release.Version, Equals, "1.0.0")
+}
+
+func Validate_Transaction_Rollback(dao DAO, c *C) {
+	release := addReleaseToProject(dao, c, "tx-app", "1.0.0", "tx-project")
+	app, err := dao.GetApplication("tx-project", "tx-app")
+	c.Assert(err, IsNil)
+	app.Description = "before"
+	c.Assert(dao.UpdateApplication(app), IsNil)
+
+	failure := fmt.Errorf("Registration failed")
+	err = dao.RunInTransaction(func(tx DAO) error {
+		addReleaseToProject(tx, c, "tx-other-app", "1.0.0", "tx-other-project")
+		addReleaseToProject(tx, c, "tx-app", "1.0.1", "tx-project")
+		app, err := tx.GetApplication("tx-project", "tx-app")
+		c.Assert(err, IsNil)
+		app.Description = "after"
+		c.Assert(tx.UpdateApplication(app), IsNil)
+		c.Assert(tx.TagRelease(release, "stable"), IsNil)
+		release.PackageSHA256 = "sha"
+		c.Assert(tx.UpdateRelease(release), IsNil)
+		c.Assert(tx.AddPackageURI(release, "file:///package.tgz"), IsNil)
+		return failure
+	})
+	c.Assert(err, Equals, failure)
+
+	_, err = dao.GetNamespace("tx-other-project")
+	c.Assert(err, Equals, NotFound)
+	_, err = dao.GetRelease("tx-project", "tx-app", "tx-app-v1.0.1")
+	c.Assert(err, Equals, NotFound)
+	_, err = dao.GetReleaseByTag("tx-project", "tx-app", "stable")
+	c.Assert(err, Equals, NotFound)
+	app, err = dao.GetApplication("tx-project", "tx-app")
+	c.Assert(err, IsNil)
+	c.Assert(app.Description, Equals, "before")
+	release, err = dao.GetRelease("tx-project", "tx-app", "tx-app-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(release.PackageSHA256, Equals, "")
+	uris, err := dao.GetPackageURIs(release)
+	c.Assert(err, IsNil)
+	c.Assert(uris, HasLen, 0)
+}
+
+func Validate_Transaction_Continues_After_Failed_Statement(dao DAO, c *C) {
+	err := dao.RunInTransaction(func(tx DAO) error {
+		c.Assert(tx.AddNamespace(NewProject("tx-project")), IsNil)
+		c.Assert(tx.AddNamespace(NewProject("tx-project")), Equals, AlreadyExists)
+		c.Assert(tx.AddApplication(NewApplication("tx-project", "tx-app")), IsNil)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	_, err = dao.GetApplication("tx-project", "tx-app")
+	c.Assert(err, IsNil)
+}
+
+func Validate_Transaction_Nested(dao DAO, c *C) {
+	failure := fmt.Errorf("Nested transaction failed")
+	err := dao.RunInTransaction(func(tx DAO) error {
+		c.Assert(tx.AddNamespace(NewProject("tx-project")), IsNil)
+		return tx.RunInTransaction(func(nested DAO) error {
+			c.Assert(nested.AddApplication(NewApplication("tx-project", "tx-app")), IsNil)
+			_, err := nested.GetNamespace("tx-project")
+			c.Assert(err, IsNil)
+			return failure
+		})
+	})
+	c.Assert(err, Equals, failure)
+	_, err = dao.GetNamespace("tx-project")
+	c.Assert(err, Equals, NotFound)
+	_, err = dao.GetApplication("tx-project", "tx-app")
+	c.Assert(err, Equals, NotFound)
+}
+
 func Validate_WipeDatabase(dao DAO, c *C) {
 	addReleaseToProject(dao, c, "test", "1.0.0", "test-project")
 	dao.WipeDatabase()
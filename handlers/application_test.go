@@ -283,6 +283,7 @@ func (s *suite) Test_UpdateApplicationHooksHandler_fails_if_invalid_json(c *C) {
 	body, err := ioutil.ReadAll(resp.Body)
 	c.Assert(err, IsNil)
 	c.Assert(string(body), Equals, "Invalid JSON")
+	c.Assert(serviceCalled, Equals, false)
 }
 
 func (s *suite) Test_UpdateApplicationHooksHandler_fails_if_UpdateApplicationHooks_fails(c *C) {
@@ -0,0 +1,103 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/ankyra/escape-inventory/model"
+	"github.com/gorilla/mux"
+)
+
+type artifactHandlerProvider struct {
+	UploadArtifact        func(namespace, releaseId, artifact, platform, arch string, pkg io.Reader) error
+	GetArtifacts          func(namespace, name, version string) ([]*model.ArtifactPayload, error)
+	GetArtifactReadSeeker func(namespace, name, version, artifact string) (*model.PackageReader, error)
+}
+
+func newArtifactHandlerProvider() *artifactHandlerProvider {
+	return &artifactHandlerProvider{
+		UploadArtifact:        model.UploadArtifact,
+		GetArtifacts:          model.GetArtifacts,
+		GetArtifactReadSeeker: model.GetArtifactReadSeeker,
+	}
+}
+
+func ListArtifactsHandler(w http.ResponseWriter, r *http.Request) {
+	newArtifactHandlerProvider().ListArtifactsHandler(w, r)
+}
+
+func UploadArtifactHandler(w http.ResponseWriter, r *http.Request) {
+	newArtifactHandlerProvider().UploadArtifactHandler(w, r)
+}
+
+func UploadArtifactStreamHandler(w http.ResponseWriter, r *http.Request) {
+	newArtifactHandlerProvider().UploadArtifactStreamHandler(w, r)
+}
+
+func DownloadArtifactHandler(w http.ResponseWriter, r *http.Request) {
+	newArtifactHandlerProvider().DownloadArtifactHandler(w, r)
+}
+
+func (h *artifactHandlerProvider) ListArtifactsHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := mux.Vars(r)["namespace"]
+	name := mux.Vars(r)["name"]
+	version := mux.Vars(r)["version"]
+	artifacts, err := h.GetArtifacts(namespace, name, version)
+	ErrorOrJsonSuccess(w, r, artifacts, err)
+}
+
+// Takes the artifact as the `file` form field. The `platform` and `arch`
+// query parameters record what the artifact was built for.
+func (h *artifactHandlerProvider) UploadArtifactHandler(w http.ResponseWriter, r *http.Request) {
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		HandleError(w, r, model.NewUserError(err))
+		return
+	}
+	defer f.Close()
+	h.uploadArtifact(w, r, f)
+}
+
+// Takes the artifact as the raw request body.
+func (h *artifactHandlerProvider) UploadArtifactStreamHandler(w http.ResponseWriter, r *http.Request) {
+	h.uploadArtifact(w, r, r.Body)
+}
+
+func (h *artifactHandlerProvider) uploadArtifact(w http.ResponseWriter, r *http.Request, pkg io.Reader) {
+	namespace := mux.Vars(r)["namespace"]
+	releaseId := mux.Vars(r)["name"] + "-" + mux.Vars(r)["version"]
+	artifact := mux.Vars(r)["artifact"]
+	platform := r.URL.Query().Get("platform")
+	arch := r.URL.Query().Get("arch")
+	err := h.UploadArtifact(namespace, releaseId, artifact, platform, arch, pkg)
+	ErrorOrSuccess(w, r, err)
+}
+
+func (h *artifactHandlerProvider) DownloadArtifactHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := mux.Vars(r)["namespace"]
+	name := mux.Vars(r)["name"]
+	version := mux.Vars(r)["version"]
+	artifact := mux.Vars(r)["artifact"]
+	reader, err := h.GetArtifactReadSeeker(namespace, name, version, artifact)
+	if err != nil {
+		HandleError(w, r, err)
+		return
+	}
+	servePackage(w, r, namespace, name+"-"+version+"-"+artifact, "application/octet-stream", reader)
+}
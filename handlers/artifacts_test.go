@@ -0,0 +1,161 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/model"
+	"github.com/gorilla/mux"
+	. "gopkg.in/check.v1"
+)
+
+const (
+	artifactsURL             = "/api/v1/inventory/{namespace}/units/{name}/versions/{version}/artifacts/"
+	artifactsTestURL         = "/api/v1/inventory/namespace/units/name/versions/v1.0.0/artifacts/"
+	artifactURL              = "/api/v1/inventory/{namespace}/units/{name}/versions/{version}/artifacts/{artifact}"
+	artifactTestURL          = "/api/v1/inventory/namespace/units/name/versions/v1.0.0/artifacts/linux-amd64"
+	artifactDownloadURL      = "/api/v1/inventory/{namespace}/units/{name}/versions/{version}/artifacts/{artifact}/download"
+	artifactDownloadTestURL  = "/api/v1/inventory/namespace/units/name/versions/v1.0.0/artifacts/docs/download"
+	artifactPlatformTestArgs = "?platform=linux&arch=amd64"
+)
+
+func (s *suite) artifactMuxWithProvider(provider *artifactHandlerProvider) *mux.Router {
+	r := mux.NewRouter()
+	getRouter := r.Methods("GET").Subrouter()
+	getRouter.Handle(artifactsURL, http.HandlerFunc(provider.ListArtifactsHandler))
+	getRouter.Handle(artifactDownloadURL, http.HandlerFunc(provider.DownloadArtifactHandler))
+	postRouter := r.Methods("POST").Subrouter()
+	postRouter.Handle(artifactURL, http.HandlerFunc(provider.UploadArtifactHandler))
+	putRouter := r.Methods("PUT").Subrouter()
+	putRouter.Handle(artifactURL, http.HandlerFunc(provider.UploadArtifactStreamHandler))
+	return r
+}
+
+func (s *suite) Test_ListArtifactsHandler(c *C) {
+	provider := &artifactHandlerProvider{
+		GetArtifacts: func(namespace, name, version string) ([]*model.ArtifactPayload, error) {
+			c.Assert(namespace, Equals, "namespace")
+			c.Assert(name, Equals, "name")
+			c.Assert(version, Equals, "v1.0.0")
+			return []*model.ArtifactPayload{
+				{Name: "linux-amd64", Platform: "linux", Arch: "amd64", SHA256: packageDataSHA256, Size: 12},
+			}, nil
+		},
+	}
+	resp := s.testGET(c, s.artifactMuxWithProvider(provider), artifactsTestURL)
+	c.Assert(resp.StatusCode, Equals, 200)
+	result := []map[string]interface{}{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(&result), IsNil)
+	c.Assert(result, HasLen, 1)
+	c.Assert(result[0]["name"], Equals, "linux-amd64")
+	c.Assert(result[0]["platform"], Equals, "linux")
+	c.Assert(result[0]["arch"], Equals, "amd64")
+	c.Assert(result[0]["sha256"], Equals, packageDataSHA256)
+	c.Assert(result[0]["size"], Equals, 12.0)
+}
+
+func (s *suite) Test_ListArtifactsHandler_fails_if_release_not_found(c *C) {
+	provider := &artifactHandlerProvider{
+		GetArtifacts: func(namespace, name, version string) ([]*model.ArtifactPayload, error) {
+			return nil, types.NotFound
+		},
+	}
+	resp := s.testGET(c, s.artifactMuxWithProvider(provider), artifactsTestURL)
+	c.Assert(resp.StatusCode, Equals, 404)
+}
+
+func (s *suite) Test_UploadArtifactHandler(c *C) {
+	file := "my-artifact.tgz"
+	c.Assert(ioutil.WriteFile(file, []byte("linux build"), 0644), IsNil)
+	defer os.RemoveAll(file)
+
+	var called bool
+	provider := &artifactHandlerProvider{
+		UploadArtifact: func(namespace, releaseId, artifact, platform, arch string, pkg io.Reader) error {
+			called = true
+			c.Assert(namespace, Equals, "namespace")
+			c.Assert(releaseId, Equals, "name-v1.0.0")
+			c.Assert(artifact, Equals, "linux-amd64")
+			c.Assert(platform, Equals, "linux")
+			c.Assert(arch, Equals, "amd64")
+			data, err := ioutil.ReadAll(pkg)
+			c.Assert(err, IsNil)
+			c.Assert(string(data), Equals, "linux build")
+			return nil
+		},
+	}
+	resp := s.testPOST_file(c, s.artifactMuxWithProvider(provider), artifactTestURL+artifactPlatformTestArgs, file)
+	c.Assert(resp.StatusCode, Equals, 200)
+	c.Assert(called, Equals, true)
+}
+
+func (s *suite) Test_UploadArtifactHandler_fails_if_file_form_field_missing(c *C) {
+	resp := s.testPOST_file(c, s.artifactMuxWithProvider(&artifactHandlerProvider{}), artifactTestURL, "")
+	c.Assert(resp.StatusCode, Equals, 400)
+}
+
+func (s *suite) Test_UploadArtifactStreamHandler(c *C) {
+	provider := &artifactHandlerProvider{
+		UploadArtifact: func(namespace, releaseId, artifact, platform, arch string, pkg io.Reader) error {
+			c.Assert(platform, Equals, "linux")
+			data, err := ioutil.ReadAll(pkg)
+			c.Assert(err, IsNil)
+			c.Assert(string(data), Equals, "linux build")
+			return model.NewUserError(errors.New("An artifact 'linux-amd64' with a different checksum has already been uploaded"))
+		},
+	}
+	req := httptest.NewRequest("PUT", artifactTestURL+artifactPlatformTestArgs, bytes.NewReader([]byte("linux build")))
+	w := httptest.NewRecorder()
+	s.artifactMuxWithProvider(provider).ServeHTTP(w, req)
+	c.Assert(w.Code, Equals, 400)
+}
+
+func (s *suite) Test_DownloadArtifactHandler(c *C) {
+	provider := &artifactHandlerProvider{
+		GetArtifactReadSeeker: func(namespace, name, version, artifact string) (*model.PackageReader, error) {
+			c.Assert(artifact, Equals, "docs")
+			return model.NewPackageReader(bytes.NewReader([]byte("package data")), packageDataSHA256, 12), nil
+		},
+	}
+	resp := s.testGET(c, s.artifactMuxWithProvider(provider), artifactDownloadTestURL)
+	c.Assert(resp.StatusCode, Equals, 200)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "package data")
+	c.Assert(resp.Header.Get("Content-Type"), Equals, "application/octet-stream")
+	c.Assert(resp.Header.Get("Content-Disposition"), Equals, `attachment; filename="name-v1.0.0-docs"`)
+	c.Assert(resp.Header.Get("ETag"), Equals, `"`+packageDataSHA256+`"`)
+}
+
+func (s *suite) Test_DownloadArtifactHandler_fails_if_artifact_not_found(c *C) {
+	provider := &artifactHandlerProvider{
+		GetArtifactReadSeeker: func(namespace, name, version, artifact string) (*model.PackageReader, error) {
+			return nil, types.NotFound
+		},
+	}
+	resp := s.testGET(c, s.artifactMuxWithProvider(provider), artifactDownloadTestURL)
+	c.Assert(resp.StatusCode, Equals, 404)
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/ankyra/escape-inventory/model"
+)
+
+type bundleHandlerProvider struct {
+	ExportNamespace func(export *model.NamespaceExport, bundle io.Writer) error
+	ImportBundle    func(bundle io.Reader, progress io.Writer) error
+}
+
+func newBundleHandlerProvider() *bundleHandlerProvider {
+	return &bundleHandlerProvider{
+		ExportNamespace: model.ExportNamespace,
+		ImportBundle:    model.ImportBundle,
+	}
+}
+
+func ExportNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	newBundleHandlerProvider().ExportNamespaceHandler(w, r)
+}
+
+func ImportBundleHandler(w http.ResponseWriter, r *http.Request) {
+	newBundleHandlerProvider().ImportBundleHandler(w, r)
+}
+
+// The bundle is streamed to the client. Errors that happen after streaming
+// has started can only be logged; the client ends up with a truncated bundle,
+// which fails to import.
+func (h *bundleHandlerProvider) ExportNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	export := model.NamespaceExport{}
+	if err := json.NewDecoder(r.Body).Decode(&export); err != nil {
+		HandleError(w, r, model.NewUserError(fmt.Errorf("Invalid JSON")))
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+export.Namespace+`.tgz"`)
+	bundle := &progressWriter{w: w, contentType: "application/gzip"}
+	err := h.ExportNamespace(&export, bundle)
+	if !bundle.started {
+		w.Header().Del("Content-Disposition")
+		ErrorOrSuccess(w, r, err)
+	} else if err != nil {
+		log.Printf("Error: Failed to export namespace '%s': %s\n", export.Namespace, err.Error())
+	}
+}
+
+// The request body is the bundle. Progress is streamed to the client, like
+// for storage migrations.
+func (h *bundleHandlerProvider) ImportBundleHandler(w http.ResponseWriter, r *http.Request) {
+	progress := &progressWriter{w: w}
+	err := h.ImportBundle(r.Body, progress)
+	if !progress.started {
+		ErrorOrSuccess(w, r, err)
+	} else if err != nil {
+		fmt.Fprintf(progress, "Error: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/model"
+	"github.com/gorilla/mux"
+	. "gopkg.in/check.v1"
+)
+
+const (
+	exportNamespaceURL = "/api/v1/internal/export"
+	importBundleURL    = "/api/v1/internal/import"
+)
+
+func (s *suite) bundleMuxWithProvider(provider *bundleHandlerProvider) *mux.Router {
+	r := mux.NewRouter()
+	postRouter := r.Methods("POST").Subrouter()
+	postRouter.Handle(exportNamespaceURL, http.HandlerFunc(provider.ExportNamespaceHandler))
+	postRouter.Handle(importBundleURL, http.HandlerFunc(provider.ImportBundleHandler))
+	return r
+}
+
+func (s *suite) Test_ExportNamespaceHandler_happy_path(c *C) {
+	var captured *model.NamespaceExport
+	provider := &bundleHandlerProvider{
+		ExportNamespace: func(export *model.NamespaceExport, bundle io.Writer) error {
+			captured = export
+			fmt.Fprintf(bundle, "bundle data")
+			return nil
+		},
+	}
+	resp := s.testPOST(c, s.bundleMuxWithProvider(provider), exportNamespaceURL, map[string]interface{}{"namespace": "my-prj"})
+	c.Assert(resp.StatusCode, Equals, 200)
+	c.Assert(resp.Header.Get("Content-Type"), Equals, "application/gzip")
+	c.Assert(resp.Header.Get("Content-Disposition"), Equals, `attachment; filename="my-prj.tgz"`)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "bundle data")
+	c.Assert(captured.Namespace, Equals, "my-prj")
+}
+
+func (s *suite) Test_ExportNamespaceHandler_returns_errors_before_streaming(c *C) {
+	provider := &bundleHandlerProvider{
+		ExportNamespace: func(export *model.NamespaceExport, bundle io.Writer) error {
+			return types.NotFound
+		},
+	}
+	resp := s.testPOST(c, s.bundleMuxWithProvider(provider), exportNamespaceURL, map[string]interface{}{"namespace": "my-prj"})
+	c.Assert(resp.StatusCode, Equals, 404)
+	c.Assert(resp.Header.Get("Content-Disposition"), Equals, "")
+}
+
+func (s *suite) Test_ExportNamespaceHandler_fails_if_invalid_json(c *C) {
+	provider := &bundleHandlerProvider{}
+	resp := s.testPOST(c, s.bundleMuxWithProvider(provider), exportNamespaceURL, nil)
+	s.ExpectErrorResponse(c, resp, 400, "Invalid JSON")
+}
+
+func (s *suite) Test_ImportBundleHandler_happy_path(c *C) {
+	var captured string
+	provider := &bundleHandlerProvider{
+		ImportBundle: func(bundle io.Reader, progress io.Writer) error {
+			data, err := ioutil.ReadAll(bundle)
+			c.Assert(err, IsNil)
+			captured = string(data)
+			fmt.Fprintf(progress, "my-prj/my-app-v1.0.0: imported release\n")
+			return nil
+		},
+	}
+	req := httptest.NewRequest("POST", importBundleURL, strings.NewReader("bundle data"))
+	w := httptest.NewRecorder()
+	s.bundleMuxWithProvider(provider).ServeHTTP(w, req)
+	s.ExpectSuccessResponse(c, w.Result(), "my-prj/my-app-v1.0.0: imported release\n")
+	c.Assert(captured, Equals, "bundle data")
+}
+
+func (s *suite) Test_ImportBundleHandler_returns_user_errors(c *C) {
+	provider := &bundleHandlerProvider{
+		ImportBundle: func(bundle io.Reader, progress io.Writer) error {
+			return model.NewUserError(errors.New("Invalid bundle: unexpected EOF"))
+		},
+	}
+	resp := s.testPOST(c, s.bundleMuxWithProvider(provider), importBundleURL, nil)
+	s.ExpectErrorResponse(c, resp, 400, "Invalid bundle: unexpected EOF")
+}
+
+func (s *suite) Test_ImportBundleHandler_reports_errors_after_progress(c *C) {
+	provider := &bundleHandlerProvider{
+		ImportBundle: func(bundle io.Reader, progress io.Writer) error {
+			fmt.Fprintf(progress, "my-prj/my-app-v1.0.0: imported release\n")
+			return errors.New("Package checksum mismatch")
+		},
+	}
+	resp := s.testPOST(c, s.bundleMuxWithProvider(provider), importBundleURL, nil)
+	s.ExpectSuccessResponse(c, resp, "my-prj/my-app-v1.0.0: imported release\nError: Package checksum mismatch\n")
+}
@@ -27,12 +27,14 @@ import (
 type dependencyHandlerProvider struct {
 	GetDownstreamDependencies func(namespace, name, version string) ([]*types.Dependency, error)
 	GetDependencyGraph        func(namespace, name, version string, downstreamFunc model.DownstreamDependenciesResolver) (*model.DependencyGraph, error)
+	GetDependencyTree         func(namespace, name, version string) ([]*types.DependencyTree, error)
 }
 
 func newDependencyHandlerProvider() *dependencyHandlerProvider {
 	return &dependencyHandlerProvider{
 		GetDownstreamDependencies: model.GetDownstreamDependencies,
 		GetDependencyGraph:        model.GetDependencyGraph,
+		GetDependencyTree:         model.GetDependencyTree,
 	}
 }
 
@@ -42,6 +44,9 @@ func DownstreamHandler(w http.ResponseWriter, r *http.Request) {
 func DependencyGraphHandler(w http.ResponseWriter, r *http.Request) {
 	newDependencyHandlerProvider().DependencyGraphHandler(w, r)
 }
+func DependencyTreeHandler(w http.ResponseWriter, r *http.Request) {
+	newDependencyHandlerProvider().DependencyTreeHandler(w, r)
+}
 
 func (h *dependencyHandlerProvider) DownstreamHandler(w http.ResponseWriter, r *http.Request) {
 	namespace := mux.Vars(r)["namespace"]
@@ -58,3 +63,11 @@ func (h *dependencyHandlerProvider) DependencyGraphHandler(w http.ResponseWriter
 	graph, err := h.GetDependencyGraph(namespace, name, version, nil)
 	ErrorOrJsonSuccess(w, r, graph, err)
 }
+
+func (h *dependencyHandlerProvider) DependencyTreeHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := mux.Vars(r)["namespace"]
+	name := mux.Vars(r)["name"]
+	version := mux.Vars(r)["version"]
+	tree, err := h.GetDependencyTree(namespace, name, version)
+	ErrorOrJsonSuccess(w, r, tree, err)
+}
@@ -32,6 +32,8 @@ const (
 	downstreamTestURL      = "/api/v1/inventory/namespace/units/name/versions/v1.0.0/downstream"
 	DependencyGraphURL     = "/api/v1/inventory/{namespace}/units/{name}/versions/{version}/dependency-graph"
 	dependencyGraphTestURL = "/api/v1/inventory/namespace/units/name/versions/v1.0.0/dependency-graph"
+	DependencyTreeURL      = "/api/v1/inventory/{namespace}/units/{name}/versions/{version}/dependency-tree"
+	dependencyTreeTestURL  = "/api/v1/inventory/namespace/units/name/versions/v1.0.0/dependency-tree"
 )
 
 /*
@@ -112,3 +114,53 @@ func (s *suite) Test_DependencyGraphHandler_fails_if_GetDependencyGraph_fails(c
 	c.Assert(err, IsNil)
 	c.Assert(string(body), Equals, "")
 }
+
+/*
+	DependencyTreeHandler
+*/
+
+func (s *suite) dependencyTreeMuxWithProvider(provider *dependencyHandlerProvider) *mux.Router {
+	r := mux.NewRouter()
+	router := r.Methods("GET").Subrouter()
+	router.Handle(DependencyTreeURL, http.HandlerFunc(provider.DependencyTreeHandler))
+	return r
+}
+
+func (s *suite) Test_DependencyTreeHandler_happy_path(c *C) {
+	var capturedNamespace, capturedName, capturedVersion string
+	provider := &dependencyHandlerProvider{
+		GetDependencyTree: func(namespace, name, version string) ([]*types.DependencyTree, error) {
+			capturedNamespace = namespace
+			capturedName = name
+			capturedVersion = version
+			tree := types.NewDependencyTree(types.NewDependency("prj", "dep", "1.0"))
+			tree.Children = append(tree.Children, types.NewDependencyTree(types.NewDependency("prj", "base", "0.1")))
+			return []*types.DependencyTree{tree}, nil
+		},
+	}
+	resp := s.testGET(c, s.dependencyTreeMuxWithProvider(provider), dependencyTreeTestURL)
+	c.Assert(resp.StatusCode, Equals, 200)
+	c.Assert(capturedNamespace, Equals, "namespace")
+	c.Assert(capturedName, Equals, "name")
+	c.Assert(capturedVersion, Equals, "v1.0.0")
+	result := []*types.DependencyTree{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(&result), IsNil)
+	c.Assert(result, HasLen, 1)
+	c.Assert(result[0].Dependency, DeepEquals, types.NewDependency("prj", "dep", "1.0"))
+	c.Assert(result[0].Children, HasLen, 1)
+	c.Assert(result[0].Children[0].Dependency, DeepEquals, types.NewDependency("prj", "base", "0.1"))
+	c.Assert(resp.Header.Get("Content-Type"), Equals, "application/json")
+}
+
+func (s *suite) Test_DependencyTreeHandler_fails_if_GetDependencyTree_fails(c *C) {
+	provider := &dependencyHandlerProvider{
+		GetDependencyTree: func(namespace, name, version string) ([]*types.DependencyTree, error) {
+			return nil, types.NotFound
+		},
+	}
+	resp := s.testGET(c, s.dependencyTreeMuxWithProvider(provider), dependencyTreeTestURL)
+	c.Assert(resp.StatusCode, Equals, 404)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "")
+}
@@ -17,8 +17,12 @@ limitations under the License.
 package handlers
 
 import (
-	"io"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/ankyra/escape-inventory/metrics"
 	"github.com/ankyra/escape-inventory/model"
@@ -26,12 +30,18 @@ import (
 )
 
 type downloadHandlerProvider struct {
-	GetDownloadReadSeeker func(namespace, name, version string) (io.Reader, error)
+	GetDownloadReadSeeker         func(namespace, name, version string) (*model.PackageReader, error)
+	GetPlatformDownloadReadSeeker func(namespace, name, version, platform, arch string) (*model.PackageReader, error)
+	VerifyDownloadSignature       func(namespace, name, version, expires, signature string) error
+	GetSignedDownloadRedirect     func(namespace, name, version string, expires time.Time) (string, error)
 }
 
 func newDownloadHandlerProvider() *downloadHandlerProvider {
 	return &downloadHandlerProvider{
-		GetDownloadReadSeeker: model.GetDownloadReadSeeker,
+		GetDownloadReadSeeker:         model.GetDownloadReadSeeker,
+		GetPlatformDownloadReadSeeker: model.GetPlatformDownloadReadSeeker,
+		VerifyDownloadSignature:       model.VerifyDownloadSignature,
+		GetSignedDownloadRedirect:     model.GetSignedDownloadRedirect,
 	}
 }
 
@@ -39,19 +49,102 @@ func DownloadHandler(w http.ResponseWriter, r *http.Request) {
 	newDownloadHandlerProvider().DownloadHandler(w, r)
 }
 
+func SignedDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	newDownloadHandlerProvider().SignedDownloadHandler(w, r)
+}
+
+// Range, If-None-Match and If-Modified-Since requests are supported, so that
+// clients can resume interrupted downloads and skip unchanged packages. Only
+// complete downloads are counted.
+//
+// When the `platform` query parameter is set, and optionally `arch`, the
+// artifact uploaded for that platform is served instead of the package.
 func (h *downloadHandlerProvider) DownloadHandler(w http.ResponseWriter, r *http.Request) {
 	namespace := mux.Vars(r)["namespace"]
 	name := mux.Vars(r)["name"]
 	version := mux.Vars(r)["version"]
-	filename := name + "-" + version + ".tgz"
+	platform := r.URL.Query().Get("platform")
+	if platform == "" {
+		h.serveDownload(w, r, namespace, name, version)
+		return
+	}
+	arch := r.URL.Query().Get("arch")
+	filename := name + "-" + version + "-" + platform
+	if arch != "" {
+		filename += "-" + arch
+	}
+	reader, err := h.GetPlatformDownloadReadSeeker(namespace, name, version, platform, arch)
+	if err != nil {
+		HandleError(w, r, err)
+		return
+	}
+	servePackage(w, r, namespace, filename+".tgz", "application/gzip", reader)
+}
+
+// Serves downloads for links created by SignDownloadURLHandler, which don't
+// need any other credentials. When the storage backend can sign URLs itself
+// the client is redirected to the backend instead.
+func (h *downloadHandlerProvider) SignedDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := mux.Vars(r)["namespace"]
+	name := mux.Vars(r)["name"]
+	version := mux.Vars(r)["version"]
+	expires := r.URL.Query().Get("expires")
+	if err := h.VerifyDownloadSignature(namespace, name, version, expires, r.URL.Query().Get("signature")); err != nil {
+		HandleError(w, r, err)
+		return
+	}
+	expiresAt, _ := strconv.ParseInt(expires, 10, 64)
+	redirect, err := h.GetSignedDownloadRedirect(namespace, name, version, time.Unix(expiresAt, 0))
+	if err != nil {
+		HandleError(w, r, err)
+		return
+	}
+	if redirect != "" {
+		metrics.DownloadCounter.Inc()
+		http.Redirect(w, r, redirect, http.StatusFound)
+		return
+	}
+	h.serveDownload(w, r, namespace, name, version)
+}
+
+func (h *downloadHandlerProvider) serveDownload(w http.ResponseWriter, r *http.Request, namespace, name, version string) {
 	reader, err := h.GetDownloadReadSeeker(namespace, name, version)
 	if err != nil {
 		HandleError(w, r, err)
 		return
 	}
-	metrics.DownloadCounter.Inc()
-	w.Header().Set("Content-Type", "application/gzip")
+	servePackage(w, r, namespace, name+"-"+version+".tgz", "application/gzip", reader)
+}
+
+func servePackage(w http.ResponseWriter, r *http.Request, namespace, filename, contentType string, reader *model.PackageReader) {
+	defer reader.Close()
+	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
-	w.WriteHeader(200)
-	io.Copy(w, reader)
+	if reader.SHA256 != "" {
+		if digest, err := hex.DecodeString(reader.SHA256); err == nil {
+			w.Header().Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(digest))
+		}
+		w.Header().Set("ETag", `"`+reader.SHA256+`"`)
+	}
+	recorder := &statusRecorder{ResponseWriter: w}
+	http.ServeContent(recorder, r, filename, reader.ModTime, reader)
+	if err := reader.Err(); err != nil {
+		log.Printf("Error: Failed to stream package '%s/%s': %s\n", namespace, filename, err.Error())
+	}
+	if recorder.status == http.StatusOK {
+		metrics.DownloadCounter.Inc()
+		if err := reader.CountDownload(); err != nil {
+			log.Printf("Error: Failed to count download of '%s/%s': %s\n", namespace, filename, err.Error())
+		}
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
 }
@@ -18,16 +18,20 @@ package handlers
 
 import (
 	"bytes"
-	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"time"
 
 	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/model"
 	"github.com/gorilla/mux"
 	. "gopkg.in/check.v1"
 )
 
 const (
+	packageDataSHA256 = "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a"
+
 	DownloadURL     = "/api/v1/inventory/{namespace}/units/{name}/versions/{version}/download"
 	downloadTestURL = "/api/v1/inventory/namespace/units/name/versions/v1.0.0/download"
 )
@@ -46,8 +50,8 @@ func (s *suite) downloadMuxWithProvider(provider *downloadHandlerProvider) *mux.
 func (s *suite) Test_DownloadHandler_happy_path(c *C) {
 
 	provider := &downloadHandlerProvider{
-		GetDownloadReadSeeker: func(namespace, name, version string) (io.Reader, error) {
-			return bytes.NewReader([]byte("package data")), nil
+		GetDownloadReadSeeker: func(namespace, name, version string) (*model.PackageReader, error) {
+			return model.NewPackageReader(bytes.NewReader([]byte("package data")), "", 0), nil
 		},
 	}
 	resp := s.testGET(c, s.downloadMuxWithProvider(provider), downloadTestURL)
@@ -57,11 +61,78 @@ func (s *suite) Test_DownloadHandler_happy_path(c *C) {
 	c.Assert(string(body), Equals, "package data")
 	c.Assert(resp.Header.Get("Content-Type"), Equals, "application/gzip")
 	c.Assert(resp.Header.Get("Content-Disposition"), Equals, `attachment; filename="name-v1.0.0.tgz"`)
+	c.Assert(resp.Header.Get("Digest"), Equals, "")
+}
+
+func (s *suite) Test_DownloadHandler_serves_platform_artifact(c *C) {
+	var capturedPlatform, capturedArch string
+	provider := &downloadHandlerProvider{
+		GetPlatformDownloadReadSeeker: func(namespace, name, version, platform, arch string) (*model.PackageReader, error) {
+			c.Assert(namespace, Equals, "namespace")
+			c.Assert(name, Equals, "name")
+			c.Assert(version, Equals, "v1.0.0")
+			capturedPlatform = platform
+			capturedArch = arch
+			return model.NewPackageReader(bytes.NewReader([]byte("linux build")), "", 0), nil
+		},
+	}
+	resp := s.testGET(c, s.downloadMuxWithProvider(provider), downloadTestURL+"?platform=linux&arch=amd64")
+	c.Assert(resp.StatusCode, Equals, 200)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "linux build")
+	c.Assert(resp.Header.Get("Content-Disposition"), Equals, `attachment; filename="name-v1.0.0-linux-amd64.tgz"`)
+	c.Assert(capturedPlatform, Equals, "linux")
+	c.Assert(capturedArch, Equals, "amd64")
+
+	resp = s.testGET(c, s.downloadMuxWithProvider(provider), downloadTestURL+"?platform=linux")
+	c.Assert(resp.StatusCode, Equals, 200)
+	c.Assert(resp.Header.Get("Content-Disposition"), Equals, `attachment; filename="name-v1.0.0-linux.tgz"`)
+	c.Assert(capturedArch, Equals, "")
+}
+
+func (s *suite) Test_DownloadHandler_returns_404_if_platform_has_no_artifact(c *C) {
+	provider := &downloadHandlerProvider{
+		GetPlatformDownloadReadSeeker: func(namespace, name, version, platform, arch string) (*model.PackageReader, error) {
+			return nil, types.NotFound
+		},
+	}
+	resp := s.testGET(c, s.downloadMuxWithProvider(provider), downloadTestURL+"?platform=windows")
+	c.Assert(resp.StatusCode, Equals, 404)
+}
+
+func (s *suite) Test_DownloadHandler_sets_digest_headers(c *C) {
+	provider := &downloadHandlerProvider{
+		GetDownloadReadSeeker: func(namespace, name, version string) (*model.PackageReader, error) {
+			return model.NewPackageReader(bytes.NewReader([]byte("package data")), packageDataSHA256, 12), nil
+		},
+	}
+	resp := s.testGET(c, s.downloadMuxWithProvider(provider), downloadTestURL)
+	c.Assert(resp.StatusCode, Equals, 200)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "package data")
+	c.Assert(resp.Header.Get("Digest"), Equals, "SHA-256=nj2144XYmh0QF6VPmAO40t1B4sF8WytlCy1dQPP5foo=")
+	c.Assert(resp.Header.Get("Content-Length"), Equals, "12")
+}
+
+func (s *suite) Test_DownloadHandler_fails_download_on_checksum_mismatch(c *C) {
+	provider := &downloadHandlerProvider{
+		GetDownloadReadSeeker: func(namespace, name, version string) (*model.PackageReader, error) {
+			return model.NewPackageReader(bytes.NewReader([]byte("corrupt data")), packageDataSHA256, 12), nil
+		},
+	}
+	resp := s.testGET(c, s.downloadMuxWithProvider(provider), downloadTestURL)
+	c.Assert(resp.StatusCode, Equals, 200)
+	c.Assert(resp.Header.Get("Content-Length"), Equals, "12")
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "")
 }
 
 func (s *suite) Test_DownloadHandler_fails_if_download_fails(c *C) {
 	provider := &downloadHandlerProvider{
-		GetDownloadReadSeeker: func(namespace, name, version string) (io.Reader, error) {
+		GetDownloadReadSeeker: func(namespace, name, version string) (*model.PackageReader, error) {
 			return nil, types.NotFound
 		},
 	}
@@ -71,3 +142,132 @@ func (s *suite) Test_DownloadHandler_fails_if_download_fails(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(string(body), Equals, "")
 }
+
+func (s *suite) testGET_with_headers(c *C, r *mux.Router, url string, headers map[string]string) *http.Response {
+	req := httptest.NewRequest("GET", url, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Result()
+}
+
+func (s *suite) Test_DownloadHandler_serves_ranges(c *C) {
+	provider := &downloadHandlerProvider{
+		GetDownloadReadSeeker: func(namespace, name, version string) (*model.PackageReader, error) {
+			return model.NewPackageReader(bytes.NewReader([]byte("package data")), packageDataSHA256, 12), nil
+		},
+	}
+	resp := s.testGET_with_headers(c, s.downloadMuxWithProvider(provider), downloadTestURL, map[string]string{
+		"Range": "bytes=8-",
+	})
+	c.Assert(resp.StatusCode, Equals, 206)
+	c.Assert(resp.Header.Get("Content-Range"), Equals, "bytes 8-11/12")
+	c.Assert(resp.Header.Get("Accept-Ranges"), Equals, "bytes")
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "data")
+}
+
+func (s *suite) Test_DownloadHandler_honours_If_None_Match(c *C) {
+	provider := &downloadHandlerProvider{
+		GetDownloadReadSeeker: func(namespace, name, version string) (*model.PackageReader, error) {
+			return model.NewPackageReader(bytes.NewReader([]byte("package data")), packageDataSHA256, 12), nil
+		},
+	}
+	resp := s.testGET(c, s.downloadMuxWithProvider(provider), downloadTestURL)
+	c.Assert(resp.Header.Get("ETag"), Equals, `"`+packageDataSHA256+`"`)
+
+	resp = s.testGET_with_headers(c, s.downloadMuxWithProvider(provider), downloadTestURL, map[string]string{
+		"If-None-Match": `"` + packageDataSHA256 + `"`,
+	})
+	c.Assert(resp.StatusCode, Equals, 304)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "")
+}
+
+func (s *suite) Test_DownloadHandler_honours_If_Modified_Since(c *C) {
+	modTime := time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+	provider := &downloadHandlerProvider{
+		GetDownloadReadSeeker: func(namespace, name, version string) (*model.PackageReader, error) {
+			reader := model.NewPackageReader(bytes.NewReader([]byte("package data")), "", 0)
+			reader.ModTime = modTime
+			return reader, nil
+		},
+	}
+	resp := s.testGET(c, s.downloadMuxWithProvider(provider), downloadTestURL)
+	c.Assert(resp.StatusCode, Equals, 200)
+	c.Assert(resp.Header.Get("Last-Modified"), Equals, "Thu, 01 Mar 2018 12:00:00 GMT")
+
+	resp = s.testGET_with_headers(c, s.downloadMuxWithProvider(provider), downloadTestURL, map[string]string{
+		"If-Modified-Since": "Thu, 01 Mar 2018 12:00:00 GMT",
+	})
+	c.Assert(resp.StatusCode, Equals, 304)
+}
+
+/*
+	SignedDownloadHandler
+*/
+
+const (
+	SignedDownloadURL     = "/api/v1/signed/{namespace}/{name}/{version}/download"
+	signedDownloadTestURL = "/api/v1/signed/namespace/name/v1.0.0/download?expires=1520000000&signature=abc"
+)
+
+func (s *suite) signedDownloadMuxWithProvider(provider *downloadHandlerProvider) *mux.Router {
+	r := mux.NewRouter()
+	router := r.Methods("GET").Subrouter()
+	router.Handle(SignedDownloadURL, http.HandlerFunc(provider.SignedDownloadHandler))
+	return r
+}
+
+func (s *suite) Test_SignedDownloadHandler_serves_package(c *C) {
+	provider := &downloadHandlerProvider{
+		VerifyDownloadSignature: func(namespace, name, version, expires, signature string) error {
+			c.Assert(namespace, Equals, "namespace")
+			c.Assert(name, Equals, "name")
+			c.Assert(version, Equals, "v1.0.0")
+			c.Assert(expires, Equals, "1520000000")
+			c.Assert(signature, Equals, "abc")
+			return nil
+		},
+		GetSignedDownloadRedirect: func(namespace, name, version string, expires time.Time) (string, error) {
+			c.Assert(expires.Unix(), Equals, int64(1520000000))
+			return "", nil
+		},
+		GetDownloadReadSeeker: func(namespace, name, version string) (*model.PackageReader, error) {
+			return model.NewPackageReader(bytes.NewReader([]byte("package data")), packageDataSHA256, 12), nil
+		},
+	}
+	resp := s.testGET(c, s.signedDownloadMuxWithProvider(provider), signedDownloadTestURL)
+	c.Assert(resp.StatusCode, Equals, 200)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "package data")
+}
+
+func (s *suite) Test_SignedDownloadHandler_redirects_to_backend(c *C) {
+	provider := &downloadHandlerProvider{
+		VerifyDownloadSignature: func(namespace, name, version, expires, signature string) error {
+			return nil
+		},
+		GetSignedDownloadRedirect: func(namespace, name, version string, expires time.Time) (string, error) {
+			return "https://storage.googleapis.com/bucket/name-v1.0.0.tgz?Signature=abc", nil
+		},
+	}
+	resp := s.testGET(c, s.signedDownloadMuxWithProvider(provider), signedDownloadTestURL)
+	c.Assert(resp.StatusCode, Equals, 302)
+	c.Assert(resp.Header.Get("Location"), Equals, "https://storage.googleapis.com/bucket/name-v1.0.0.tgz?Signature=abc")
+}
+
+func (s *suite) Test_SignedDownloadHandler_fails_on_invalid_signature(c *C) {
+	provider := &downloadHandlerProvider{
+		VerifyDownloadSignature: func(namespace, name, version, expires, signature string) error {
+			return types.Unauthorized
+		},
+	}
+	resp := s.testGET(c, s.signedDownloadMuxWithProvider(provider), signedDownloadTestURL)
+	c.Assert(resp.StatusCode, Equals, 401)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/ankyra/escape-inventory/model"
+	"github.com/gorilla/mux"
+	. "gopkg.in/check.v1"
+)
+
+const (
+	syncMirrorsURL = "/api/v1/internal/sync-mirrors"
+)
+
+func (s *suite) syncMirrorsMuxWithProvider(provider *mirrorHandlerProvider) *mux.Router {
+	r := mux.NewRouter()
+	postRouter := r.Methods("POST").Subrouter()
+	postRouter.Handle(syncMirrorsURL, http.HandlerFunc(provider.SyncMirrorsHandler))
+	return r
+}
+
+func (s *suite) Test_SyncMirrorsHandler_happy_path(c *C) {
+	var captured *model.MirrorSync
+	provider := &mirrorHandlerProvider{
+		SyncMirrors: func(mirrorSync *model.MirrorSync, progress io.Writer) error {
+			captured = mirrorSync
+			fmt.Fprintf(progress, "escape/my-app: imported 2 releases\n")
+			return nil
+		},
+	}
+	resp := s.testPOST(c, s.syncMirrorsMuxWithProvider(provider), syncMirrorsURL, map[string]interface{}{"namespace": "escape"})
+	c.Assert(resp.StatusCode, Equals, 200)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "escape/my-app: imported 2 releases\n")
+	c.Assert(captured.Namespace, Equals, "escape")
+}
+
+func (s *suite) Test_SyncMirrorsHandler_fails_if_invalid_json(c *C) {
+	provider := &mirrorHandlerProvider{}
+	resp := s.testPOST(c, s.syncMirrorsMuxWithProvider(provider), syncMirrorsURL, nil)
+	c.Assert(resp.StatusCode, Equals, 400)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "Invalid JSON")
+}
+
+func (s *suite) Test_SyncMirrorsHandler_returns_user_errors(c *C) {
+	provider := &mirrorHandlerProvider{
+		SyncMirrors: func(mirrorSync *model.MirrorSync, progress io.Writer) error {
+			return model.NewUserError(errors.New("Namespace 'escape' is not mirrored"))
+		},
+	}
+	resp := s.testPOST(c, s.syncMirrorsMuxWithProvider(provider), syncMirrorsURL, map[string]interface{}{})
+	c.Assert(resp.StatusCode, Equals, 400)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "Namespace 'escape' is not mirrored")
+}
+
+func (s *suite) Test_SyncMirrorsHandler_reports_errors_after_progress(c *C) {
+	provider := &mirrorHandlerProvider{
+		SyncMirrors: func(mirrorSync *model.MirrorSync, progress io.Writer) error {
+			fmt.Fprintf(progress, "Imported 0 releases from 1 namespaces, 1 errors.\n")
+			return errors.New("Mirror sync failed with 1 errors")
+		},
+	}
+	resp := s.testPOST(c, s.syncMirrorsMuxWithProvider(provider), syncMirrorsURL, map[string]interface{}{})
+	c.Assert(resp.StatusCode, Equals, 200)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "Imported 0 releases from 1 namespaces, 1 errors.\nError: Mirror sync failed with 1 errors\n")
+}
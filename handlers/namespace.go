@@ -47,7 +47,7 @@ func newNamespaceHandlerProvider() *namespaceHandlerProvider {
 		UpdateNamespace:      model.UpdateNamespace,
 		GetNamespaceHooks:    model.GetNamespaceHooks,
 		UpdateNamespaceHooks: model.UpdateNamespaceHooks,
-		HardDeleteNamespace:  dao.HardDeleteNamespace,
+		HardDeleteNamespace:  model.HardDeleteNamespace,
 	}
 }
 
@@ -0,0 +1,83 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/ankyra/escape-inventory/model"
+	"github.com/gorilla/mux"
+)
+
+type packageFilesHandlerProvider struct {
+	ListPackageFiles func(namespace, name, version string) ([]*model.PackageFile, error)
+	GetPackageFile   func(namespace, name, version, path string) (*model.PackageFileReader, error)
+}
+
+func newPackageFilesHandlerProvider() *packageFilesHandlerProvider {
+	return &packageFilesHandlerProvider{
+		ListPackageFiles: model.ListPackageFiles,
+		GetPackageFile:   model.GetPackageFile,
+	}
+}
+
+func ListPackageFilesHandler(w http.ResponseWriter, r *http.Request) {
+	newPackageFilesHandlerProvider().ListPackageFilesHandler(w, r)
+}
+
+func GetPackageFileHandler(w http.ResponseWriter, r *http.Request) {
+	newPackageFilesHandlerProvider().GetPackageFileHandler(w, r)
+}
+
+func (h *packageFilesHandlerProvider) ListPackageFilesHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := mux.Vars(r)["namespace"]
+	name := mux.Vars(r)["name"]
+	version := mux.Vars(r)["version"]
+	files, err := h.ListPackageFiles(namespace, name, version)
+	ErrorOrJsonSuccess(w, r, files, err)
+}
+
+// The file is verified while it's streamed. When verification fails the
+// response is cut short, so the client sees less than Content-Length bytes.
+func (h *packageFilesHandlerProvider) GetPackageFileHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := mux.Vars(r)["namespace"]
+	name := mux.Vars(r)["name"]
+	version := mux.Vars(r)["version"]
+	file, err := h.GetPackageFile(namespace, name, version, mux.Vars(r)["path"])
+	if err != nil {
+		HandleError(w, r, err)
+		return
+	}
+	defer file.Close()
+	contentType := mime.TypeByExtension(path.Ext(file.Path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	if file.SHA256 != "" {
+		w.Header().Set("ETag", `"`+file.SHA256+`"`)
+	}
+	if _, err := io.Copy(w, file); err != nil {
+		log.Printf("Error: Failed to stream file from '%s/%s-%s': %s\n", namespace, name, version, err.Error())
+	}
+}
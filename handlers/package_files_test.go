@@ -0,0 +1,122 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/model"
+	"github.com/gorilla/mux"
+	. "gopkg.in/check.v1"
+)
+
+const (
+	packageFilesURL = "/api/v1/inventory/{namespace}/units/{name}/versions/{version}/files/"
+	packageFileURL  = "/api/v1/inventory/{namespace}/units/{name}/versions/{version}/files/{path:.+}"
+)
+
+type nopPackageCloser struct {
+	closed bool
+}
+
+func (n *nopPackageCloser) Close() error {
+	n.closed = true
+	return nil
+}
+
+func (s *suite) packageFilesMuxWithProvider(provider *packageFilesHandlerProvider) *mux.Router {
+	r := mux.NewRouter()
+	getRouter := r.Methods("GET").Subrouter()
+	getRouter.Handle(packageFilesURL, http.HandlerFunc(provider.ListPackageFilesHandler))
+	getRouter.Handle(packageFileURL, http.HandlerFunc(provider.GetPackageFileHandler))
+	return r
+}
+
+func (s *suite) Test_ListPackageFilesHandler(c *C) {
+	provider := &packageFilesHandlerProvider{
+		ListPackageFiles: func(namespace, name, version string) ([]*model.PackageFile, error) {
+			c.Assert(namespace, Equals, "_")
+			c.Assert(name, Equals, "name")
+			c.Assert(version, Equals, "v1.0.0")
+			return []*model.PackageFile{{Path: "deploy.sh", Size: 11, SHA256: "abc"}}, nil
+		},
+	}
+	resp := s.testGET(c, s.packageFilesMuxWithProvider(provider), "/api/v1/inventory/_/units/name/versions/v1.0.0/files/")
+	c.Assert(resp.StatusCode, Equals, 200)
+	result := []map[string]interface{}{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(&result), IsNil)
+	c.Assert(result, DeepEquals, []map[string]interface{}{{"path": "deploy.sh", "size": 11.0, "sha256": "abc"}})
+}
+
+func (s *suite) Test_ListPackageFilesHandler_fails_if_not_found(c *C) {
+	provider := &packageFilesHandlerProvider{
+		ListPackageFiles: func(namespace, name, version string) ([]*model.PackageFile, error) {
+			return nil, types.NotFound
+		},
+	}
+	resp := s.testGET(c, s.packageFilesMuxWithProvider(provider), "/api/v1/inventory/_/units/name/versions/v1.0.0/files/")
+	c.Assert(resp.StatusCode, Equals, 404)
+}
+
+func (s *suite) Test_GetPackageFileHandler(c *C) {
+	digest := sha256.Sum256([]byte("name: test"))
+	checksum := hex.EncodeToString(digest[:])
+	pkg := &nopPackageCloser{}
+	provider := &packageFilesHandlerProvider{
+		GetPackageFile: func(namespace, name, version, path string) (*model.PackageFileReader, error) {
+			c.Assert(path, Equals, "templates/config.yml")
+			return model.NewPackageFileReader(path, bytes.NewReader([]byte("name: test")), checksum, 10, pkg), nil
+		},
+	}
+	resp := s.testGET(c, s.packageFilesMuxWithProvider(provider), "/api/v1/inventory/_/units/name/versions/v1.0.0/files/templates/config.yml")
+	c.Assert(resp.StatusCode, Equals, 200)
+	c.Assert(resp.Header.Get("Content-Length"), Equals, "10")
+	c.Assert(resp.Header.Get("ETag"), Equals, `"`+checksum+`"`)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "name: test")
+	c.Assert(pkg.closed, Equals, true)
+}
+
+func (s *suite) Test_GetPackageFileHandler_cuts_response_short_on_checksum_mismatch(c *C) {
+	provider := &packageFilesHandlerProvider{
+		GetPackageFile: func(namespace, name, version, path string) (*model.PackageFileReader, error) {
+			return model.NewPackageFileReader(path, bytes.NewReader([]byte("echo deploy")), "abc", 11, &nopPackageCloser{}), nil
+		},
+	}
+	resp := s.testGET(c, s.packageFilesMuxWithProvider(provider), "/api/v1/inventory/_/units/name/versions/v1.0.0/files/deploy.sh")
+	c.Assert(resp.StatusCode, Equals, 200)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(len(body) < 11, Equals, true)
+}
+
+func (s *suite) Test_GetPackageFileHandler_fails_if_not_found(c *C) {
+	provider := &packageFilesHandlerProvider{
+		GetPackageFile: func(namespace, name, version, path string) (*model.PackageFileReader, error) {
+			return nil, types.NotFound
+		},
+	}
+	resp := s.testGET(c, s.packageFilesMuxWithProvider(provider), "/api/v1/inventory/_/units/name/versions/v1.0.0/files/deploy.sh")
+	c.Assert(resp.StatusCode, Equals, 404)
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	core "github.com/ankyra/escape-core"
+	"github.com/ankyra/escape-inventory/model"
+	"github.com/gorilla/mux"
+)
+
+type publishHandlerProvider struct {
+	PublishPackage func(namespace string, pkg io.ReadSeeker, username string) (*core.ReleaseMetadata, error)
+	PublishRelease func(namespace, releaseId string) (*core.ReleaseMetadata, error)
+}
+
+func newPublishHandlerProvider() *publishHandlerProvider {
+	return &publishHandlerProvider{
+		PublishPackage: model.PublishPackage,
+		PublishRelease: model.PublishRelease,
+	}
+}
+
+func PublishHandler(w http.ResponseWriter, r *http.Request) {
+	newPublishHandlerProvider().PublishHandler(w, r)
+}
+
+// Registers and uploads a release in one go, using the release.json in the
+// package that's uploaded as the `file` form field. Returns the registered
+// release metadata.
+func (h *publishHandlerProvider) PublishHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := mux.Vars(r)["namespace"]
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		HandleError(w, r, model.NewUserError(err))
+		return
+	}
+	defer f.Close()
+	metadata, err := h.PublishPackage(namespace, f, ReadUsernameFromContext(r))
+	if err != nil {
+		HandleError(w, r, err)
+		return
+	}
+	notifyUpload(r, namespace, metadata.Name, metadata.Version)
+	JsonSuccess(w, metadata)
+}
+
+func PublishReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	newPublishHandlerProvider().PublishReleaseHandler(w, r)
+}
+
+// Publishes a draft release after its package has been uploaded.
+func (h *publishHandlerProvider) PublishReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := mux.Vars(r)["namespace"]
+	name := mux.Vars(r)["name"]
+	version := mux.Vars(r)["version"]
+	metadata, err := h.PublishRelease(namespace, name+"-"+version)
+	if err != nil {
+		HandleError(w, r, err)
+		return
+	}
+	JsonSuccess(w, metadata)
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	core "github.com/ankyra/escape-core"
+	"github.com/ankyra/escape-inventory/model"
+	"github.com/gorilla/mux"
+	. "gopkg.in/check.v1"
+)
+
+const (
+	publishURL            = "/api/v1/inventory/{namespace}/publish"
+	publishTestURL        = "/api/v1/inventory/namespace/publish"
+	publishReleaseURL     = "/api/v1/inventory/{namespace}/units/{name}/versions/{version}/publish"
+	publishReleaseTestURL = "/api/v1/inventory/namespace/units/name/versions/v1.0.0/publish"
+)
+
+func (s *suite) publishMuxWithProvider(provider *publishHandlerProvider) *mux.Router {
+	r := mux.NewRouter()
+	postRouter := r.Methods("POST").Subrouter()
+	postRouter.Handle(publishURL, http.HandlerFunc(provider.PublishHandler))
+	postRouter.Handle(publishReleaseURL, http.HandlerFunc(provider.PublishReleaseHandler))
+	return r
+}
+
+func (s *suite) Test_PublishHandler(c *C) {
+	file := "my-package.tgz"
+	c.Assert(ioutil.WriteFile(file, []byte("package content"), 0644), IsNil)
+	defer os.RemoveAll(file)
+
+	provider := &publishHandlerProvider{
+		PublishPackage: func(namespace string, pkg io.ReadSeeker, username string) (*core.ReleaseMetadata, error) {
+			c.Assert(namespace, Equals, "namespace")
+			data, err := ioutil.ReadAll(pkg)
+			c.Assert(err, IsNil)
+			c.Assert(string(data), Equals, "package content")
+			return core.NewReleaseMetadata("name", "1.0.0"), nil
+		},
+	}
+	resp := s.testPOST_file(c, s.publishMuxWithProvider(provider), publishTestURL, file)
+	c.Assert(resp.StatusCode, Equals, 200)
+	result := map[string]interface{}{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(&result), IsNil)
+	c.Assert(result["name"], Equals, "name")
+	c.Assert(result["version"], Equals, "1.0.0")
+}
+
+func (s *suite) Test_PublishHandler_fails_if_publish_fails(c *C) {
+	file := "my-package.tgz"
+	c.Assert(ioutil.WriteFile(file, []byte("package content"), 0644), IsNil)
+	defer os.RemoveAll(file)
+
+	provider := &publishHandlerProvider{
+		PublishPackage: func(namespace string, pkg io.ReadSeeker, username string) (*core.ReleaseMetadata, error) {
+			return nil, model.NewUserError(errors.New("Package doesn't contain a release.json"))
+		},
+	}
+	resp := s.testPOST_file(c, s.publishMuxWithProvider(provider), publishTestURL, file)
+	c.Assert(resp.StatusCode, Equals, 400)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "Package doesn't contain a release.json")
+}
+
+func (s *suite) Test_PublishHandler_fails_if_file_form_field_missing(c *C) {
+	resp := s.testPOST_file(c, s.publishMuxWithProvider(&publishHandlerProvider{}), publishTestURL, "")
+	c.Assert(resp.StatusCode, Equals, 400)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "http: no such file")
+}
+
+func (s *suite) Test_PublishReleaseHandler(c *C) {
+	provider := &publishHandlerProvider{
+		PublishRelease: func(namespace, releaseId string) (*core.ReleaseMetadata, error) {
+			c.Assert(namespace, Equals, "namespace")
+			c.Assert(releaseId, Equals, "name-v1.0.0")
+			return core.NewReleaseMetadata("name", "1.0.0"), nil
+		},
+	}
+	resp := s.testPOST(c, s.publishMuxWithProvider(provider), publishReleaseTestURL, nil)
+	c.Assert(resp.StatusCode, Equals, 200)
+	result := map[string]interface{}{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(&result), IsNil)
+	c.Assert(result["version"], Equals, "1.0.0")
+}
+
+func (s *suite) Test_PublishReleaseHandler_fails_if_publish_fails(c *C) {
+	provider := &publishHandlerProvider{
+		PublishRelease: func(namespace, releaseId string) (*core.ReleaseMetadata, error) {
+			return nil, model.NewUserError(errors.New("Can't publish release 'name-v1.0.0' without a package"))
+		},
+	}
+	resp := s.testPOST(c, s.publishMuxWithProvider(provider), publishReleaseTestURL, nil)
+	c.Assert(resp.StatusCode, Equals, 400)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "Can't publish release 'name-v1.0.0' without a package")
+}
@@ -29,16 +29,18 @@ import (
 )
 
 type registerHandlerProvider struct {
-	AddReleaseByUser func(namespace, metadata, username string) (*core.ReleaseMetadata, error)
-	ReadRequestBody  func(body io.Reader) ([]byte, error)
-	TagRelease       func(namespace, application, releaseId, tag string) error
+	AddReleaseByUser      func(namespace, metadata, username string) (*core.ReleaseMetadata, error)
+	AddDraftReleaseByUser func(namespace, metadata, username string) (*core.ReleaseMetadata, error)
+	ReadRequestBody       func(body io.Reader) ([]byte, error)
+	TagRelease            func(namespace, application, releaseId, tag string) error
 }
 
 func newRegisterHandlerProvider() *registerHandlerProvider {
 	return &registerHandlerProvider{
-		AddReleaseByUser: model.AddReleaseByUser,
-		ReadRequestBody:  ioutil.ReadAll,
-		TagRelease:       model.TagRelease,
+		AddReleaseByUser:      model.AddReleaseByUser,
+		AddDraftReleaseByUser: model.AddDraftReleaseByUser,
+		ReadRequestBody:       ioutil.ReadAll,
+		TagRelease:            model.TagRelease,
 	}
 }
 
@@ -57,7 +59,11 @@ func (h *registerHandlerProvider) RegisterHandler(w http.ResponseWriter, r *http
 		return
 	}
 	username := ReadUsernameFromContext(r)
-	if _, err := h.AddReleaseByUser(namespace, string(metadata), username); err != nil {
+	addRelease := h.AddReleaseByUser
+	if r.URL.Query().Get("draft") == "true" {
+		addRelease = h.AddDraftReleaseByUser
+	}
+	if _, err := addRelease(namespace, string(metadata), username); err != nil {
 		HandleError(w, r, err)
 		return
 	}
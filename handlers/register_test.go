@@ -67,6 +67,24 @@ func (s *suite) Test_RegisterHandler_happy_path(c *C) {
 	c.Assert(capturedUsername, Equals, "")
 }
 
+func (s *suite) Test_RegisterHandler_registers_draft(c *C) {
+	var capturedNamespace, capturedMetadata string
+	provider := &registerHandlerProvider{
+		AddDraftReleaseByUser: func(namespace, metadata, username string) (*core.ReleaseMetadata, error) {
+			capturedNamespace = namespace
+			capturedMetadata = metadata
+			return core.NewReleaseMetadata("name", "1.0"), nil
+		},
+		ReadRequestBody: func(body io.Reader) ([]byte, error) {
+			return []byte("metadata"), nil
+		},
+	}
+	resp := s.testPOST(c, s.registerMuxWithProvider(provider), registerTestURL+"?draft=true", nil)
+	c.Assert(resp.StatusCode, Equals, 200)
+	c.Assert(capturedNamespace, Equals, "namespace")
+	c.Assert(capturedMetadata, Equals, "metadata")
+}
+
 func (s *suite) Test_RegisterHandler_fails_if_add_release_fails(c *C) {
 	provider := &registerHandlerProvider{
 		AddReleaseByUser: func(namespace, metadata, username string) (*core.ReleaseMetadata, error) {
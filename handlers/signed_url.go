@@ -0,0 +1,83 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ankyra/escape-inventory/model"
+	"github.com/gorilla/mux"
+)
+
+type signedURLHandlerProvider struct {
+	SignDownloadURL func(namespace, name, version string, expiresIn time.Duration) (*model.SignedURL, error)
+}
+
+func newSignedURLHandlerProvider() *signedURLHandlerProvider {
+	return &signedURLHandlerProvider{
+		SignDownloadURL: model.SignDownloadURL,
+	}
+}
+
+func SignDownloadURLHandler(w http.ResponseWriter, r *http.Request) {
+	newSignedURLHandlerProvider().SignDownloadURLHandler(w, r)
+}
+
+// Issues a download link that's valid without credentials until it expires.
+// The optional "expires_in" field in the body sets the lifetime in seconds.
+func (h *signedURLHandlerProvider) SignDownloadURLHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := mux.Vars(r)["namespace"]
+	name := mux.Vars(r)["name"]
+	version := mux.Vars(r)["version"]
+	request := struct {
+		ExpiresIn int64 `json:"expires_in"`
+	}{}
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+			HandleError(w, r, model.NewUserError(fmt.Errorf("Invalid JSON")))
+			return
+		}
+	}
+	if request.ExpiresIn < 0 {
+		HandleError(w, r, model.NewUserError(fmt.Errorf("Invalid 'expires_in' value %d", request.ExpiresIn)))
+		return
+	}
+	signed, err := h.SignDownloadURL(namespace, name, version, time.Duration(request.ExpiresIn)*time.Second)
+	if err != nil {
+		HandleError(w, r, err)
+		return
+	}
+	signed.URL = baseURL(r) + signed.URL
+	JsonSuccess(w, signed)
+}
+
+// Returns the scheme and host the client used to reach the Inventory, taking
+// reverse proxies into account.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/model"
+	"github.com/gorilla/mux"
+	. "gopkg.in/check.v1"
+)
+
+const (
+	SignURL              = "/api/v1/inventory/{namespace}/units/{name}/versions/{version}/signed-url"
+	signDownloadTestURL  = "/api/v1/inventory/namespace/units/name/versions/latest/signed-url"
+	signedDownloadResult = "/api/v1/signed/namespace/name/v1.0.0/download?expires=1520000000&signature=abc"
+)
+
+func (s *suite) signedURLMuxWithProvider(provider *signedURLHandlerProvider) *mux.Router {
+	r := mux.NewRouter()
+	postRouter := r.Methods("POST").Subrouter()
+	postRouter.Handle(SignURL, http.HandlerFunc(provider.SignDownloadURLHandler))
+	return r
+}
+
+func (s *suite) Test_SignDownloadURLHandler(c *C) {
+	expiresAt := time.Unix(1520000000, 0).UTC()
+	provider := &signedURLHandlerProvider{
+		SignDownloadURL: func(namespace, name, version string, expiresIn time.Duration) (*model.SignedURL, error) {
+			c.Assert(namespace, Equals, "namespace")
+			c.Assert(name, Equals, "name")
+			c.Assert(version, Equals, "latest")
+			c.Assert(expiresIn, Equals, 10*time.Minute)
+			return &model.SignedURL{URL: signedDownloadResult, ExpiresAt: expiresAt}, nil
+		},
+	}
+	data := map[string]interface{}{"expires_in": 600}
+	resp := s.testPOST(c, s.signedURLMuxWithProvider(provider), signDownloadTestURL, data)
+	s.ExpectSuccessResponse_with_JSON(c, resp, &model.SignedURL{
+		URL:       "http://example.com" + signedDownloadResult,
+		ExpiresAt: expiresAt,
+	})
+}
+
+func (s *suite) Test_SignDownloadURLHandler_uses_default_expiry(c *C) {
+	provider := &signedURLHandlerProvider{
+		SignDownloadURL: func(namespace, name, version string, expiresIn time.Duration) (*model.SignedURL, error) {
+			c.Assert(expiresIn, Equals, time.Duration(0))
+			return &model.SignedURL{URL: signedDownloadResult}, nil
+		},
+	}
+	resp := s.testPOST(c, s.signedURLMuxWithProvider(provider), signDownloadTestURL, nil)
+	c.Assert(resp.StatusCode, Equals, 200)
+}
+
+func (s *suite) Test_SignDownloadURLHandler_fails_on_negative_expiry(c *C) {
+	provider := &signedURLHandlerProvider{}
+	data := map[string]interface{}{"expires_in": -1}
+	resp := s.testPOST(c, s.signedURLMuxWithProvider(provider), signDownloadTestURL, data)
+	c.Assert(resp.StatusCode, Equals, 400)
+}
+
+func (s *suite) Test_SignDownloadURLHandler_fails_if_release_not_found(c *C) {
+	provider := &signedURLHandlerProvider{
+		SignDownloadURL: func(namespace, name, version string, expiresIn time.Duration) (*model.SignedURL, error) {
+			return nil, types.NotFound
+		},
+	}
+	resp := s.testPOST(c, s.signedURLMuxWithProvider(provider), signDownloadTestURL, nil)
+	c.Assert(resp.StatusCode, Equals, 404)
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/ankyra/escape-inventory/model"
+)
+
+type storageCheckHandlerProvider struct {
+	CheckStorage func(check *model.StorageCheck, progress io.Writer) error
+}
+
+func newStorageCheckHandlerProvider() *storageCheckHandlerProvider {
+	return &storageCheckHandlerProvider{
+		CheckStorage: model.CheckStorage,
+	}
+}
+
+func CheckStorageHandler(w http.ResponseWriter, r *http.Request) {
+	newStorageCheckHandlerProvider().CheckStorageHandler(w, r)
+}
+
+// The check's findings are streamed to the client as they're found. Without a
+// body the check is a dry run.
+func (h *storageCheckHandlerProvider) CheckStorageHandler(w http.ResponseWriter, r *http.Request) {
+	check := model.StorageCheck{}
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&check); err != nil && err != io.EOF {
+			HandleError(w, r, model.NewUserError(fmt.Errorf("Invalid JSON")))
+			return
+		}
+	}
+	progress := &progressWriter{w: w}
+	err := h.CheckStorage(&check, progress)
+	if !progress.started {
+		ErrorOrSuccess(w, r, err)
+	} else if err != nil {
+		fmt.Fprintf(progress, "Error: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/ankyra/escape-inventory/model"
+	"github.com/gorilla/mux"
+	. "gopkg.in/check.v1"
+)
+
+const (
+	checkStorageURL = "/api/v1/internal/check-storage"
+)
+
+func (s *suite) checkStorageMuxWithProvider(provider *storageCheckHandlerProvider) *mux.Router {
+	r := mux.NewRouter()
+	postRouter := r.Methods("POST").Subrouter()
+	postRouter.Handle(checkStorageURL, http.HandlerFunc(provider.CheckStorageHandler))
+	return r
+}
+
+func (s *suite) Test_CheckStorageHandler_defaults_to_dry_run(c *C) {
+	var captured *model.StorageCheck
+	provider := &storageCheckHandlerProvider{
+		CheckStorage: func(check *model.StorageCheck, progress io.Writer) error {
+			captured = check
+			fmt.Fprintf(progress, "orphaned package gcs://bucket/_/name/name-v1.tgz\n")
+			return nil
+		},
+	}
+	resp := s.testPOST(c, s.checkStorageMuxWithProvider(provider), checkStorageURL, nil)
+	c.Assert(resp.StatusCode, Equals, 200)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "orphaned package gcs://bucket/_/name/name-v1.tgz\n")
+	c.Assert(captured.DeleteOrphans, Equals, false)
+}
+
+func (s *suite) Test_CheckStorageHandler_delete_orphans(c *C) {
+	var captured *model.StorageCheck
+	provider := &storageCheckHandlerProvider{
+		CheckStorage: func(check *model.StorageCheck, progress io.Writer) error {
+			captured = check
+			return nil
+		},
+	}
+	data := map[string]interface{}{"delete_orphans": true}
+	resp := s.testPOST(c, s.checkStorageMuxWithProvider(provider), checkStorageURL, data)
+	c.Assert(resp.StatusCode, Equals, 200)
+	c.Assert(captured.DeleteOrphans, Equals, true)
+}
+
+func (s *suite) Test_CheckStorageHandler_fails_if_invalid_json(c *C) {
+	provider := &storageCheckHandlerProvider{}
+	resp := s.testPOST(c, s.checkStorageMuxWithProvider(provider), checkStorageURL, "not an object")
+	c.Assert(resp.StatusCode, Equals, 400)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "Invalid JSON")
+}
+
+func (s *suite) Test_CheckStorageHandler_reports_errors_after_progress(c *C) {
+	provider := &storageCheckHandlerProvider{
+		CheckStorage: func(check *model.StorageCheck, progress io.Writer) error {
+			fmt.Fprintf(progress, "_/name-v1: failed to check gcs://bucket/_/name/name-v1.tgz: timeout\n")
+			return errors.New("Storage check failed with 1 errors")
+		},
+	}
+	resp := s.testPOST(c, s.checkStorageMuxWithProvider(provider), checkStorageURL, nil)
+	c.Assert(resp.StatusCode, Equals, 200)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "_/name-v1: failed to check gcs://bucket/_/name/name-v1.tgz: timeout\nError: Storage check failed with 1 errors\n")
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/ankyra/escape-inventory/model"
+)
+
+type storageEncryptionHandlerProvider struct {
+	ReencryptStorage func(reencryption *model.StorageReencryption, progress io.Writer) error
+}
+
+func newStorageEncryptionHandlerProvider() *storageEncryptionHandlerProvider {
+	return &storageEncryptionHandlerProvider{
+		ReencryptStorage: model.ReencryptStorage,
+	}
+}
+
+func ReencryptStorageHandler(w http.ResponseWriter, r *http.Request) {
+	newStorageEncryptionHandlerProvider().ReencryptStorageHandler(w, r)
+}
+
+// Progress is streamed to the client, like for storage migrations.
+func (h *storageEncryptionHandlerProvider) ReencryptStorageHandler(w http.ResponseWriter, r *http.Request) {
+	reencryption := model.StorageReencryption{}
+	if err := json.NewDecoder(r.Body).Decode(&reencryption); err != nil {
+		HandleError(w, r, model.NewUserError(fmt.Errorf("Invalid JSON")))
+		return
+	}
+	progress := &progressWriter{w: w}
+	err := h.ReencryptStorage(&reencryption, progress)
+	if !progress.started {
+		ErrorOrSuccess(w, r, err)
+	} else if err != nil {
+		fmt.Fprintf(progress, "Error: %s\n", err.Error())
+	}
+}
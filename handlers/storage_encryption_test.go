@@ -0,0 +1,93 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/ankyra/escape-inventory/model"
+	"github.com/gorilla/mux"
+	. "gopkg.in/check.v1"
+)
+
+const (
+	reencryptStorageURL = "/api/v1/internal/reencrypt-storage"
+)
+
+func (s *suite) reencryptStorageMuxWithProvider(provider *storageEncryptionHandlerProvider) *mux.Router {
+	r := mux.NewRouter()
+	postRouter := r.Methods("POST").Subrouter()
+	postRouter.Handle(reencryptStorageURL, http.HandlerFunc(provider.ReencryptStorageHandler))
+	return r
+}
+
+func (s *suite) Test_ReencryptStorageHandler_happy_path(c *C) {
+	var captured *model.StorageReencryption
+	provider := &storageEncryptionHandlerProvider{
+		ReencryptStorage: func(reencryption *model.StorageReencryption, progress io.Writer) error {
+			captured = reencryption
+			fmt.Fprintf(progress, "[1/1] _/name-v1: re-encrypted file:///releases/_/name/name-v1.tgz\n")
+			return nil
+		},
+	}
+	resp := s.testPOST(c, s.reencryptStorageMuxWithProvider(provider), reencryptStorageURL, map[string]interface{}{"dry_run": true})
+	c.Assert(resp.StatusCode, Equals, 200)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "[1/1] _/name-v1: re-encrypted file:///releases/_/name/name-v1.tgz\n")
+	c.Assert(captured.DryRun, Equals, true)
+}
+
+func (s *suite) Test_ReencryptStorageHandler_fails_if_invalid_json(c *C) {
+	provider := &storageEncryptionHandlerProvider{}
+	resp := s.testPOST(c, s.reencryptStorageMuxWithProvider(provider), reencryptStorageURL, nil)
+	c.Assert(resp.StatusCode, Equals, 400)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "Invalid JSON")
+}
+
+func (s *suite) Test_ReencryptStorageHandler_returns_user_errors(c *C) {
+	provider := &storageEncryptionHandlerProvider{
+		ReencryptStorage: func(reencryption *model.StorageReencryption, progress io.Writer) error {
+			return model.NewUserError(errors.New("Encryption at rest is not configured"))
+		},
+	}
+	resp := s.testPOST(c, s.reencryptStorageMuxWithProvider(provider), reencryptStorageURL, map[string]interface{}{})
+	c.Assert(resp.StatusCode, Equals, 400)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "Encryption at rest is not configured")
+}
+
+func (s *suite) Test_ReencryptStorageHandler_reports_errors_after_progress(c *C) {
+	provider := &storageEncryptionHandlerProvider{
+		ReencryptStorage: func(reencryption *model.StorageReencryption, progress io.Writer) error {
+			fmt.Fprintf(progress, "Re-encrypted 0 packages, 0 were up to date, 1 errors.\n")
+			return errors.New("Re-encryption failed with 1 errors")
+		},
+	}
+	resp := s.testPOST(c, s.reencryptStorageMuxWithProvider(provider), reencryptStorageURL, map[string]interface{}{})
+	c.Assert(resp.StatusCode, Equals, 200)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "Re-encrypted 0 packages, 0 were up to date, 1 errors.\nError: Re-encryption failed with 1 errors\n")
+}
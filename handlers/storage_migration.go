@@ -0,0 +1,82 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/ankyra/escape-inventory/model"
+)
+
+type storageMigrationHandlerProvider struct {
+	MigrateStorage func(migration *model.StorageMigration, progress io.Writer) error
+}
+
+func newStorageMigrationHandlerProvider() *storageMigrationHandlerProvider {
+	return &storageMigrationHandlerProvider{
+		MigrateStorage: model.MigrateStorage,
+	}
+}
+
+func MigrateStorageHandler(w http.ResponseWriter, r *http.Request) {
+	newStorageMigrationHandlerProvider().MigrateStorageHandler(w, r)
+}
+
+// Progress is streamed to the client while the migration runs. Errors that
+// happen before any progress is reported are handled as usual.
+func (h *storageMigrationHandlerProvider) MigrateStorageHandler(w http.ResponseWriter, r *http.Request) {
+	migration := model.StorageMigration{}
+	if err := json.NewDecoder(r.Body).Decode(&migration); err != nil {
+		HandleError(w, r, model.NewUserError(fmt.Errorf("Invalid JSON")))
+		return
+	}
+	progress := &progressWriter{w: w}
+	err := h.MigrateStorage(&migration, progress)
+	if !progress.started {
+		ErrorOrSuccess(w, r, err)
+	} else if err != nil {
+		fmt.Fprintf(progress, "Error: %s\n", err.Error())
+	}
+}
+
+// Only sends the headers once there's output, so that errors that happen
+// before that can still be returned with the right status code. The content
+// type defaults to plain text.
+type progressWriter struct {
+	w           http.ResponseWriter
+	started     bool
+	contentType string
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	if !p.started {
+		p.started = true
+		if p.contentType == "" {
+			p.contentType = "text/plain; charset=utf-8"
+		}
+		p.w.Header().Set("Content-Type", p.contentType)
+		p.w.WriteHeader(200)
+	}
+	n, err := p.w.Write(b)
+	if flusher, ok := p.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
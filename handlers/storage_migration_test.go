@@ -0,0 +1,96 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/ankyra/escape-inventory/model"
+	"github.com/gorilla/mux"
+	. "gopkg.in/check.v1"
+)
+
+const (
+	migrateStorageURL = "/api/v1/internal/migrate-storage"
+)
+
+func (s *suite) migrateStorageMuxWithProvider(provider *storageMigrationHandlerProvider) *mux.Router {
+	r := mux.NewRouter()
+	postRouter := r.Methods("POST").Subrouter()
+	postRouter.Handle(migrateStorageURL, http.HandlerFunc(provider.MigrateStorageHandler))
+	return r
+}
+
+func (s *suite) Test_MigrateStorageHandler_happy_path(c *C) {
+	var captured *model.StorageMigration
+	provider := &storageMigrationHandlerProvider{
+		MigrateStorage: func(migration *model.StorageMigration, progress io.Writer) error {
+			captured = migration
+			fmt.Fprintf(progress, "[1/1] _/name-v1: copied to gcs://bucket/_/name/name-v1.tgz\n")
+			return nil
+		},
+	}
+	data := map[string]interface{}{"target": "gcs", "source": "local", "retire": true}
+	resp := s.testPOST(c, s.migrateStorageMuxWithProvider(provider), migrateStorageURL, data)
+	c.Assert(resp.StatusCode, Equals, 200)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "[1/1] _/name-v1: copied to gcs://bucket/_/name/name-v1.tgz\n")
+	c.Assert(captured.Target, Equals, "gcs")
+	c.Assert(captured.Source, Equals, "local")
+	c.Assert(captured.Retire, Equals, true)
+}
+
+func (s *suite) Test_MigrateStorageHandler_fails_if_invalid_json(c *C) {
+	provider := &storageMigrationHandlerProvider{}
+	resp := s.testPOST(c, s.migrateStorageMuxWithProvider(provider), migrateStorageURL, nil)
+	c.Assert(resp.StatusCode, Equals, 400)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "Invalid JSON")
+}
+
+func (s *suite) Test_MigrateStorageHandler_returns_user_errors(c *C) {
+	provider := &storageMigrationHandlerProvider{
+		MigrateStorage: func(migration *model.StorageMigration, progress io.Writer) error {
+			return model.NewUserError(errors.New("Missing target storage backend"))
+		},
+	}
+	resp := s.testPOST(c, s.migrateStorageMuxWithProvider(provider), migrateStorageURL, map[string]interface{}{})
+	c.Assert(resp.StatusCode, Equals, 400)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "Missing target storage backend")
+}
+
+func (s *suite) Test_MigrateStorageHandler_reports_errors_after_progress(c *C) {
+	provider := &storageMigrationHandlerProvider{
+		MigrateStorage: func(migration *model.StorageMigration, progress io.Writer) error {
+			fmt.Fprintf(progress, "[1/1] _/name-v1: failed: Not found\n")
+			return errors.New("Failed to migrate 1 out of 1 releases")
+		},
+	}
+	resp := s.testPOST(c, s.migrateStorageMuxWithProvider(provider), migrateStorageURL, map[string]interface{}{"target": "gcs"})
+	c.Assert(resp.StatusCode, Equals, 200)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "[1/1] _/name-v1: failed: Not found\nError: Failed to migrate 1 out of 1 releases\n")
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/ankyra/escape-inventory/model"
+	"github.com/gorilla/mux"
+	. "gopkg.in/check.v1"
+)
+
+const (
+	recoverStorageURL = "/api/v1/internal/recover-storage"
+)
+
+func (s *suite) recoverStorageMuxWithProvider(provider *storageRecoveryHandlerProvider) *mux.Router {
+	r := mux.NewRouter()
+	postRouter := r.Methods("POST").Subrouter()
+	postRouter.Handle(recoverStorageURL, http.HandlerFunc(provider.RecoverFromStorageHandler))
+	return r
+}
+
+func (s *suite) Test_RecoverFromStorageHandler(c *C) {
+	var captured *model.StorageRecovery
+	provider := &storageRecoveryHandlerProvider{
+		RecoverFromStorage: func(recovery *model.StorageRecovery, progress io.Writer) error {
+			captured = recovery
+			fmt.Fprintf(progress, "_/name-v1: recovered from gcs://bucket/_/name/name-v1.tgz\n")
+			return nil
+		},
+	}
+	data := map[string]interface{}{"backend": "gcs", "dry_run": true}
+	resp := s.testPOST(c, s.recoverStorageMuxWithProvider(provider), recoverStorageURL, data)
+	c.Assert(resp.StatusCode, Equals, 200)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "_/name-v1: recovered from gcs://bucket/_/name/name-v1.tgz\n")
+	c.Assert(captured.Backend, Equals, "gcs")
+	c.Assert(captured.DryRun, Equals, true)
+}
+
+func (s *suite) Test_RecoverFromStorageHandler_defaults_to_primary_backend(c *C) {
+	var captured *model.StorageRecovery
+	provider := &storageRecoveryHandlerProvider{
+		RecoverFromStorage: func(recovery *model.StorageRecovery, progress io.Writer) error {
+			captured = recovery
+			return nil
+		},
+	}
+	resp := s.testPOST(c, s.recoverStorageMuxWithProvider(provider), recoverStorageURL, nil)
+	c.Assert(resp.StatusCode, Equals, 200)
+	c.Assert(captured.Backend, Equals, "")
+	c.Assert(captured.DryRun, Equals, false)
+}
+
+func (s *suite) Test_RecoverFromStorageHandler_fails_if_invalid_json(c *C) {
+	provider := &storageRecoveryHandlerProvider{}
+	resp := s.testPOST(c, s.recoverStorageMuxWithProvider(provider), recoverStorageURL, "not an object")
+	c.Assert(resp.StatusCode, Equals, 400)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "Invalid JSON")
+}
+
+func (s *suite) Test_RecoverFromStorageHandler_returns_user_errors(c *C) {
+	provider := &storageRecoveryHandlerProvider{
+		RecoverFromStorage: func(recovery *model.StorageRecovery, progress io.Writer) error {
+			return model.NewUserError(errors.New("Storage backend 's3' is not configured"))
+		},
+	}
+	resp := s.testPOST(c, s.recoverStorageMuxWithProvider(provider), recoverStorageURL, nil)
+	c.Assert(resp.StatusCode, Equals, 400)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "Storage backend 's3' is not configured")
+}
+
+func (s *suite) Test_RecoverFromStorageHandler_reports_errors_after_progress(c *C) {
+	provider := &storageRecoveryHandlerProvider{
+		RecoverFromStorage: func(recovery *model.StorageRecovery, progress io.Writer) error {
+			fmt.Fprintf(progress, "gcs://bucket/_/name/name-v1.tgz: failed to read: timeout\n")
+			return errors.New("Recovery failed with 1 errors")
+		},
+	}
+	resp := s.testPOST(c, s.recoverStorageMuxWithProvider(provider), recoverStorageURL, nil)
+	c.Assert(resp.StatusCode, Equals, 200)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "gcs://bucket/_/name/name-v1.tgz: failed to read: timeout\nError: Recovery failed with 1 errors\n")
+}
@@ -27,7 +27,7 @@ import (
 )
 
 type uploadHandlerProvider struct {
-	UploadPackage func(namespace, releaseId string, pkg io.ReadSeeker) error
+	UploadPackage func(namespace, releaseId string, pkg io.Reader) error
 }
 
 func newUploadHandlerProvider() *uploadHandlerProvider {
@@ -54,12 +54,38 @@ func (h *uploadHandlerProvider) UploadHandler(w http.ResponseWriter, r *http.Req
 		HandleError(w, r, err)
 		return
 	}
+	uploadSucceeded(w, r, namespace, name, version)
+}
+
+func UploadStreamHandler(w http.ResponseWriter, r *http.Request) {
+	newUploadHandlerProvider().UploadStreamHandler(w, r)
+}
+
+// Takes the package as the raw request body, which is streamed to the storage
+// backends without being buffered first.
+func (h *uploadHandlerProvider) UploadStreamHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := mux.Vars(r)["namespace"]
+	name := mux.Vars(r)["name"]
+	version := mux.Vars(r)["version"]
+	releaseId := name + "-" + version
+	if err := h.UploadPackage(namespace, releaseId, r.Body); err != nil {
+		HandleError(w, r, err)
+		return
+	}
+	uploadSucceeded(w, r, namespace, name, version)
+}
+
+func uploadSucceeded(w http.ResponseWriter, r *http.Request, namespace, name, version string) {
+	notifyUpload(r, namespace, name, version)
+	w.WriteHeader(200)
+}
+
+func notifyUpload(r *http.Request, namespace, name, version string) {
 	metrics.UploadCounter.Inc()
 	username := ReadUsernameFromContext(r)
 	var url string
 	if cmd.Config != nil && cmd.Config.WebHook != "" {
 		url = cmd.Config.WebHook
 	}
-	go model.CallWebHook(namespace, name, version, releaseId, username, url)
-	w.WriteHeader(200)
+	go model.CallWebHook(namespace, name, version, name+"-"+version, username, url)
 }
@@ -0,0 +1,124 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/ankyra/escape-inventory/model"
+	"github.com/ankyra/escape-inventory/storage"
+	"github.com/gorilla/mux"
+)
+
+type uploadSessionHandlerProvider struct {
+	CreateUploadSession   func(namespace, releaseId string) (*storage.UploadSession, error)
+	GetUploadSession      func(namespace, releaseId, id string) (*storage.UploadSession, error)
+	AppendToUploadSession func(namespace, releaseId, id string, offset int64, data io.Reader) (*storage.UploadSession, error)
+	FinalizeUploadSession func(namespace, releaseId, id, expectedChecksum string) error
+	AbortUploadSession    func(namespace, releaseId, id string) error
+}
+
+func newUploadSessionHandlerProvider() *uploadSessionHandlerProvider {
+	return &uploadSessionHandlerProvider{
+		CreateUploadSession:   model.CreateUploadSession,
+		GetUploadSession:      model.GetUploadSession,
+		AppendToUploadSession: model.AppendToUploadSession,
+		FinalizeUploadSession: model.FinalizeUploadSession,
+		AbortUploadSession:    model.AbortUploadSession,
+	}
+}
+
+func CreateUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	newUploadSessionHandlerProvider().CreateUploadSessionHandler(w, r)
+}
+
+func GetUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	newUploadSessionHandlerProvider().GetUploadSessionHandler(w, r)
+}
+
+func AppendToUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	newUploadSessionHandlerProvider().AppendToUploadSessionHandler(w, r)
+}
+
+func FinalizeUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	newUploadSessionHandlerProvider().FinalizeUploadSessionHandler(w, r)
+}
+
+func AbortUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	newUploadSessionHandlerProvider().AbortUploadSessionHandler(w, r)
+}
+
+func (h *uploadSessionHandlerProvider) CreateUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := mux.Vars(r)["namespace"]
+	releaseId := mux.Vars(r)["name"] + "-" + mux.Vars(r)["version"]
+	session, err := h.CreateUploadSession(namespace, releaseId)
+	ErrorOrJsonSuccess(w, r, session, err)
+}
+
+func (h *uploadSessionHandlerProvider) GetUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := mux.Vars(r)["namespace"]
+	releaseId := mux.Vars(r)["name"] + "-" + mux.Vars(r)["version"]
+	session, err := h.GetUploadSession(namespace, releaseId, mux.Vars(r)["id"])
+	ErrorOrJsonSuccess(w, r, session, err)
+}
+
+// Appends the request body to the session. The offset query parameter must
+// match the session's current offset, so that chunks can't be applied twice
+// or out of order.
+func (h *uploadSessionHandlerProvider) AppendToUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := mux.Vars(r)["namespace"]
+	releaseId := mux.Vars(r)["name"] + "-" + mux.Vars(r)["version"]
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		HandleError(w, r, model.NewUserError(fmt.Errorf("Missing or invalid 'offset' query parameter")))
+		return
+	}
+	session, err := h.AppendToUploadSession(namespace, releaseId, mux.Vars(r)["id"], offset, r.Body)
+	ErrorOrJsonSuccess(w, r, session, err)
+}
+
+func (h *uploadSessionHandlerProvider) FinalizeUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := mux.Vars(r)["namespace"]
+	name := mux.Vars(r)["name"]
+	version := mux.Vars(r)["version"]
+	releaseId := name + "-" + version
+	request := struct {
+		SHA256 string `json:"sha256"`
+	}{}
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+			HandleError(w, r, model.NewUserError(fmt.Errorf("Invalid JSON")))
+			return
+		}
+	}
+	if err := h.FinalizeUploadSession(namespace, releaseId, mux.Vars(r)["id"], request.SHA256); err != nil {
+		HandleError(w, r, err)
+		return
+	}
+	uploadSucceeded(w, r, namespace, name, version)
+}
+
+func (h *uploadSessionHandlerProvider) AbortUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	namespace := mux.Vars(r)["namespace"]
+	releaseId := mux.Vars(r)["name"] + "-" + mux.Vars(r)["version"]
+	err := h.AbortUploadSession(namespace, releaseId, mux.Vars(r)["id"])
+	ErrorOrSuccess(w, r, err)
+}
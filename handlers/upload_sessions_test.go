@@ -0,0 +1,155 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/model"
+	"github.com/ankyra/escape-inventory/storage"
+	"github.com/gorilla/mux"
+	. "gopkg.in/check.v1"
+)
+
+const (
+	uploadSessionsURL     = "/api/v1/inventory/{namespace}/units/{name}/versions/{version}/uploads/"
+	uploadSessionURL      = "/api/v1/inventory/{namespace}/units/{name}/versions/{version}/uploads/{id}"
+	finalizeSessionURL    = "/api/v1/inventory/{namespace}/units/{name}/versions/{version}/uploads/{id}/finalize"
+	uploadSessionsTestURL = "/api/v1/inventory/namespace/units/name/versions/v1.0.0/uploads/"
+	uploadSessionTestURL  = "/api/v1/inventory/namespace/units/name/versions/v1.0.0/uploads/abc"
+)
+
+func (s *suite) uploadSessionMuxWithProvider(provider *uploadSessionHandlerProvider) *mux.Router {
+	r := mux.NewRouter()
+	r.Methods("POST").Subrouter().Handle(uploadSessionsURL, http.HandlerFunc(provider.CreateUploadSessionHandler))
+	r.Methods("POST").Subrouter().Handle(finalizeSessionURL, http.HandlerFunc(provider.FinalizeUploadSessionHandler))
+	r.Methods("GET").Subrouter().Handle(uploadSessionURL, http.HandlerFunc(provider.GetUploadSessionHandler))
+	r.Methods("PUT").Subrouter().Handle(uploadSessionURL, http.HandlerFunc(provider.AppendToUploadSessionHandler))
+	r.Methods("DELETE").Subrouter().Handle(uploadSessionURL, http.HandlerFunc(provider.AbortUploadSessionHandler))
+	return r
+}
+
+func (s *suite) Test_CreateUploadSessionHandler(c *C) {
+	provider := &uploadSessionHandlerProvider{
+		CreateUploadSession: func(namespace, releaseId string) (*storage.UploadSession, error) {
+			c.Assert(namespace, Equals, "namespace")
+			c.Assert(releaseId, Equals, "name-v1.0.0")
+			return &storage.UploadSession{ID: "abc", Namespace: namespace, ReleaseId: releaseId}, nil
+		},
+	}
+	resp := s.testPOST(c, s.uploadSessionMuxWithProvider(provider), uploadSessionsTestURL, nil)
+	s.ExpectSuccessResponse_with_JSON(c, resp, &storage.UploadSession{ID: "abc", Namespace: "namespace", ReleaseId: "name-v1.0.0"})
+}
+
+func (s *suite) Test_CreateUploadSessionHandler_fails_if_release_not_found(c *C) {
+	provider := &uploadSessionHandlerProvider{
+		CreateUploadSession: func(namespace, releaseId string) (*storage.UploadSession, error) {
+			return nil, types.NotFound
+		},
+	}
+	resp := s.testPOST(c, s.uploadSessionMuxWithProvider(provider), uploadSessionsTestURL, nil)
+	c.Assert(resp.StatusCode, Equals, 404)
+}
+
+func (s *suite) Test_GetUploadSessionHandler(c *C) {
+	provider := &uploadSessionHandlerProvider{
+		GetUploadSession: func(namespace, releaseId, id string) (*storage.UploadSession, error) {
+			c.Assert(id, Equals, "abc")
+			return &storage.UploadSession{ID: id, Offset: 12}, nil
+		},
+	}
+	resp := s.testGET(c, s.uploadSessionMuxWithProvider(provider), uploadSessionTestURL)
+	s.ExpectSuccessResponse_with_JSON(c, resp, &storage.UploadSession{ID: "abc", Offset: 12})
+}
+
+func (s *suite) Test_AppendToUploadSessionHandler(c *C) {
+	var appended string
+	provider := &uploadSessionHandlerProvider{
+		AppendToUploadSession: func(namespace, releaseId, id string, offset int64, data io.Reader) (*storage.UploadSession, error) {
+			c.Assert(offset, Equals, int64(8))
+			payload, err := ioutil.ReadAll(data)
+			appended = string(payload)
+			return &storage.UploadSession{ID: id, Offset: offset + int64(len(payload))}, err
+		},
+	}
+	req := httptest.NewRequest("PUT", uploadSessionTestURL+"?offset=8", strings.NewReader("data"))
+	w := httptest.NewRecorder()
+	s.uploadSessionMuxWithProvider(provider).ServeHTTP(w, req)
+	s.ExpectSuccessResponse_with_JSON(c, w.Result(), &storage.UploadSession{ID: "abc", Offset: 12})
+	c.Assert(appended, Equals, "data")
+}
+
+func (s *suite) Test_AppendToUploadSessionHandler_fails_without_offset(c *C) {
+	provider := &uploadSessionHandlerProvider{}
+	resp := s.testPUT(c, s.uploadSessionMuxWithProvider(provider), uploadSessionTestURL, nil)
+	c.Assert(resp.StatusCode, Equals, 400)
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "Missing or invalid 'offset' query parameter")
+}
+
+func (s *suite) Test_FinalizeUploadSessionHandler(c *C) {
+	var checksum string
+	provider := &uploadSessionHandlerProvider{
+		FinalizeUploadSession: func(namespace, releaseId, id, expectedChecksum string) error {
+			checksum = expectedChecksum
+			return nil
+		},
+	}
+	data := map[string]string{"sha256": "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a"}
+	resp := s.testPOST(c, s.uploadSessionMuxWithProvider(provider), uploadSessionTestURL+"/finalize", data)
+	c.Assert(resp.StatusCode, Equals, 200)
+	c.Assert(checksum, Equals, "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a")
+}
+
+func (s *suite) Test_FinalizeUploadSessionHandler_without_body(c *C) {
+	provider := &uploadSessionHandlerProvider{
+		FinalizeUploadSession: func(namespace, releaseId, id, expectedChecksum string) error {
+			c.Assert(expectedChecksum, Equals, "")
+			return nil
+		},
+	}
+	resp := s.testPOST(c, s.uploadSessionMuxWithProvider(provider), uploadSessionTestURL+"/finalize", nil)
+	c.Assert(resp.StatusCode, Equals, 200)
+}
+
+func (s *suite) Test_FinalizeUploadSessionHandler_fails_on_checksum_mismatch(c *C) {
+	provider := &uploadSessionHandlerProvider{
+		FinalizeUploadSession: func(namespace, releaseId, id, expectedChecksum string) error {
+			return model.NewUserError(errors.New("Package checksum mismatch"))
+		},
+	}
+	resp := s.testPOST(c, s.uploadSessionMuxWithProvider(provider), uploadSessionTestURL+"/finalize", nil)
+	c.Assert(resp.StatusCode, Equals, 400)
+}
+
+func (s *suite) Test_AbortUploadSessionHandler(c *C) {
+	provider := &uploadSessionHandlerProvider{
+		AbortUploadSession: func(namespace, releaseId, id string) error {
+			c.Assert(id, Equals, "abc")
+			return nil
+		},
+	}
+	resp := s.testDELETE(c, s.uploadSessionMuxWithProvider(provider), uploadSessionTestURL)
+	c.Assert(resp.StatusCode, Equals, 200)
+}
@@ -20,7 +20,9 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 
 	"github.com/ankyra/escape-inventory/dao/types"
 	"github.com/gorilla/mux"
@@ -40,6 +42,8 @@ func (s *suite) uploadMuxWithProvider(provider *uploadHandlerProvider) *mux.Rout
 	r := mux.NewRouter()
 	postRouter := r.Methods("POST").Subrouter()
 	postRouter.Handle(UploadURL, http.HandlerFunc(provider.UploadHandler))
+	putRouter := r.Methods("PUT").Subrouter()
+	putRouter.Handle(UploadURL, http.HandlerFunc(provider.UploadStreamHandler))
 	return r
 }
 
@@ -55,7 +59,7 @@ func (s *suite) Test_UploadHandler(c *C) {
 	c.Assert(err, IsNil)
 
 	provider := &uploadHandlerProvider{
-		UploadPackage: func(namespace, releaseId string, pkg io.ReadSeeker) error {
+		UploadPackage: func(namespace, releaseId string, pkg io.Reader) error {
 			return nil
 		},
 	}
@@ -77,7 +81,7 @@ func (s *suite) Test_UploadHandler_fails_if_upload_fails(c *C) {
 	c.Assert(err, IsNil)
 
 	provider := &uploadHandlerProvider{
-		UploadPackage: func(namespace, releaseId string, pkg io.ReadSeeker) error {
+		UploadPackage: func(namespace, releaseId string, pkg io.Reader) error {
 			return types.AlreadyExists
 		},
 	}
@@ -122,3 +126,38 @@ func (s *suite) Test_UploadHandler_fails_if_file_form_field_missing(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(string(body), Equals, "http: no such file")
 }
+
+/*
+	UploadStreamHandler
+*/
+
+func (s *suite) Test_UploadStreamHandler(c *C) {
+	var uploaded string
+	provider := &uploadHandlerProvider{
+		UploadPackage: func(namespace, releaseId string, pkg io.Reader) error {
+			c.Assert(namespace, Equals, "namespace")
+			c.Assert(releaseId, Equals, "name-v1.0.0")
+			data, err := ioutil.ReadAll(pkg)
+			uploaded = string(data)
+			return err
+		},
+	}
+	req := httptest.NewRequest("PUT", uploadTestURL, strings.NewReader("package content"))
+	w := httptest.NewRecorder()
+	s.uploadMuxWithProvider(provider).ServeHTTP(w, req)
+	c.Assert(w.Code, Equals, 200)
+	c.Assert(uploaded, Equals, "package content")
+}
+
+func (s *suite) Test_UploadStreamHandler_fails_if_upload_fails(c *C) {
+	provider := &uploadHandlerProvider{
+		UploadPackage: func(namespace, releaseId string, pkg io.Reader) error {
+			return types.AlreadyExists
+		},
+	}
+	req := httptest.NewRequest("PUT", uploadTestURL, strings.NewReader("package content"))
+	w := httptest.NewRecorder()
+	s.uploadMuxWithProvider(provider).ServeHTTP(w, req)
+	c.Assert(w.Code, Equals, 409)
+	c.Assert(w.Body.String(), Equals, "Resource already exists")
+}
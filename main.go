@@ -19,6 +19,7 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/ankyra/escape-inventory/cmd"
 	"github.com/ankyra/escape-inventory/config"
@@ -31,39 +32,68 @@ var ReadRoutes = map[string]http.HandlerFunc{
 	"/":       HomeHandler,
 	"/health": handlers.HealthCheckHandler,
 
-	"/api/v1/inventory/":                                                             handlers.GetNamespacesHandler,
-	"/api/v1/inventory/{namespace}/":                                                 handlers.GetNamespaceHandler,
-	"/api/v1/inventory/{namespace}/hooks/":                                           handlers.GetNamespaceHooksHandler,
-	"/api/v1/inventory/{namespace}/units/":                                           handlers.GetApplicationsHandler,
-	"/api/v1/inventory/{namespace}/units/{name}/":                                    handlers.GetApplicationHandler,
-	"/api/v1/inventory/{namespace}/units/{name}/hooks/":                              handlers.GetApplicationHooksHandler,
-	"/api/v1/inventory/{namespace}/units/{name}/versions/":                           handlers.GetApplicationVersionsHandler,
-	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/":                 handlers.GetVersionHandler,
-	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/downstream":       handlers.DownstreamHandler,
-	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/dependency-graph": handlers.DependencyGraphHandler,
-	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/diff/":            handlers.DiffHandler,
-	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/diff/{diffWith}/": handlers.DiffHandler,
-	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/download":         handlers.DownloadHandler,
-	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/previous/":        handlers.PreviousVersionHandler,
-	"/api/v1/inventory/{namespace}/units/{name}/next-version":                        handlers.NextVersionHandler,
-	"/api/v1/inventory/__providers":                                                  handlers.ProviderHandler,
+	"/api/v1/inventory/":                                                                          handlers.GetNamespacesHandler,
+	"/api/v1/inventory/{namespace}/":                                                              handlers.GetNamespaceHandler,
+	"/api/v1/inventory/{namespace}/hooks/":                                                        handlers.GetNamespaceHooksHandler,
+	"/api/v1/inventory/{namespace}/units/":                                                        handlers.GetApplicationsHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/":                                                 handlers.GetApplicationHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/hooks/":                                           handlers.GetApplicationHooksHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/":                                        handlers.GetApplicationVersionsHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/":                              handlers.GetVersionHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/downstream":                    handlers.DownstreamHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/dependency-graph":              handlers.DependencyGraphHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/dependency-tree":               handlers.DependencyTreeHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/diff/":                         handlers.DiffHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/diff/{diffWith}/":              handlers.DiffHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/download":                      handlers.DownloadHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/artifacts/":                    handlers.ListArtifactsHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/artifacts/{artifact}/download": handlers.DownloadArtifactHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/files/":                        handlers.ListPackageFilesHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/files/{path:.+}":               handlers.GetPackageFileHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/previous/":                     handlers.PreviousVersionHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/next-version":                                     handlers.NextVersionHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/uploads/{id}":                  handlers.GetUploadSessionHandler,
+	"/api/v1/inventory/__providers":                                                               handlers.ProviderHandler,
+	"/api/v1/signed/{namespace}/{name}/{version}/download":                                        handlers.SignedDownloadHandler,
 }
 
 var DeleteRoutes = map[string]http.HandlerFunc{
-	"/api/v1/inventory/{namespace}/hard-delete": handlers.HardDeleteNamespaceHandler,
+	"/api/v1/inventory/{namespace}/hard-delete":                                  handlers.HardDeleteNamespaceHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/uploads/{id}": handlers.AbortUploadSessionHandler,
 }
 
 var WriteRoutes = map[string]http.HandlerFunc{
-	"/api/v1/inventory/{namespace}/add-namespace":                          handlers.AddNamespaceHandler,
-	"/api/v1/inventory/{namespace}/register":                               handlers.RegisterHandler,
-	"/api/v1/inventory/{namespace}/units/{name}/tags/":                     handlers.TagReleaseHandler,
-	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/upload": handlers.UploadHandler,
+	"/api/v1/inventory/{namespace}/add-namespace":                                         handlers.AddNamespaceHandler,
+	"/api/v1/inventory/{namespace}/register":                                              handlers.RegisterHandler,
+	"/api/v1/inventory/{namespace}/publish":                                               handlers.PublishHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/tags/":                                    handlers.TagReleaseHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/upload":                handlers.UploadHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/publish":               handlers.PublishReleaseHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/artifacts/{artifact}":  handlers.UploadArtifactHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/uploads/":              handlers.CreateUploadSessionHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/uploads/{id}/finalize": handlers.FinalizeUploadSessionHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/signed-url":            handlers.SignDownloadURLHandler,
+}
+
+// Storage maintenance and bulk import/export. These are only registered when
+// admin_endpoints is set, because they can change or expose every namespace.
+var AdminRoutes = map[string]http.HandlerFunc{
+	"/api/v1/internal/migrate-storage":   handlers.MigrateStorageHandler,
+	"/api/v1/internal/check-storage":     handlers.CheckStorageHandler,
+	"/api/v1/internal/reencrypt-storage": handlers.ReencryptStorageHandler,
+	"/api/v1/internal/recover-storage":   handlers.RecoverFromStorageHandler,
+	"/api/v1/internal/sync-mirrors":      handlers.SyncMirrorsHandler,
+	"/api/v1/internal/export":            handlers.ExportNamespaceHandler,
+	"/api/v1/internal/import":            handlers.ImportBundleHandler,
 }
 
 var UpdateRoutes = map[string]http.HandlerFunc{
-	"/api/v1/inventory/{namespace}/":                    handlers.UpdateNamespaceHandler,
-	"/api/v1/inventory/{namespace}/hooks/":              handlers.UpdateNamespaceHooksHandler,
-	"/api/v1/inventory/{namespace}/units/{name}/hooks/": handlers.UpdateApplicationHooksHandler,
+	"/api/v1/inventory/{namespace}/":                                                     handlers.UpdateNamespaceHandler,
+	"/api/v1/inventory/{namespace}/hooks/":                                               handlers.UpdateNamespaceHooksHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/hooks/":                                  handlers.UpdateApplicationHooksHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/upload":               handlers.UploadStreamHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/artifacts/{artifact}": handlers.UploadArtifactStreamHandler,
+	"/api/v1/inventory/{namespace}/units/{name}/versions/{version}/uploads/{id}":         handlers.AppendToUploadSessionHandler,
 }
 
 var DevRoutes = map[string]map[string]http.HandlerFunc{
@@ -95,6 +125,12 @@ func getMux(cfg *config.Config) *mux.Router {
 		deleteRouter.Handle(url, handler)
 	}
 
+	if cfg.AdminEndpoints {
+		for url, handler := range AdminRoutes {
+			postRouter.Handle(url, handler)
+		}
+	}
+
 	if cfg.Dev {
 		for url, methodHandlers := range DevRoutes {
 			for method, handler := range methodHandlers {
@@ -108,9 +144,13 @@ func getMux(cfg *config.Config) *mux.Router {
 }
 
 func main() {
+	cmd.RunCommand(os.Args)
 	cfg := cmd.LoadConfig()
 	if cfg.Dev {
 		log.Println("INFO: Starting in Dev mode.")
 	}
+	if cfg.AdminEndpoints {
+		log.Println("INFO: Enabling admin endpoints.")
+	}
 	cmd.StartInventory(getMux(cfg))
 }
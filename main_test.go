@@ -17,18 +17,24 @@ limitations under the License.
 package main
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/ankyra/escape-inventory/cmd"
 	"github.com/ankyra/escape-inventory/config"
 	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/mem"
 	"github.com/ankyra/escape-inventory/dao/types"
 	"github.com/ankyra/escape-inventory/model"
+	"github.com/ankyra/escape-inventory/storage"
 	. "gopkg.in/check.v1"
 )
 
@@ -43,11 +49,20 @@ var rr *httptest.ResponseRecorder
 
 func (s *suite) SetUpTest(c *C) {
 	dao.TestSetup()
-	config, _ := config.NewConfig([]string{})
+	config, _ := config.NewConfig([]string{"ADMIN_ENDPOINTS=true"})
 	handler = cmd.GetHandler(getMux(config))
 	rr = httptest.NewRecorder()
 }
 
+func (s *suite) Test_Admin_endpoints_are_disabled_by_default(c *C) {
+	config, _ := config.NewConfig([]string{})
+	handler = cmd.GetHandler(getMux(config))
+	for url := range AdminRoutes {
+		req, _ := http.NewRequest("POST", url, bytes.NewReader([]byte(`{}`)))
+		testRequest(c, req, 404)
+	}
+}
+
 const (
 	registerEndpoint = "/api/v1/inventory/my-project/register"
 
@@ -101,6 +116,29 @@ func (s *suite) addRelease(c *C, project, version string) {
 	testRequest(c, req, 200)
 }
 
+// Registers a release and uploads its package, so that it can be resolved as
+// the latest version.
+func (s *suite) addUploadedRelease(c *C, project, version string) {
+	s.addRelease(c, project, version)
+	pkg := s.releasePackage(c, project, version)
+	req, _ := http.NewRequest("PUT", "/api/v1/inventory/"+project+"/units/my-app/versions/v"+version+"/upload", bytes.NewReader(pkg))
+	testRequest(c, req, 200)
+}
+
+// Builds a package for a release registered with addRelease.
+func (s *suite) releasePackage(c *C, project, version string) []byte {
+	metadata := []byte(`{"name": "my-app", "version": "` + version + `", "project": "` + project + `"}`)
+	buf := bytes.NewBuffer(nil)
+	gz := gzip.NewWriter(buf)
+	archive := tar.NewWriter(gz)
+	c.Assert(archive.WriteHeader(&tar.Header{Name: "my-app-v" + version + "/release.json", Mode: 0644, Size: int64(len(metadata))}), IsNil)
+	_, err := archive.Write(metadata)
+	c.Assert(err, IsNil)
+	c.Assert(archive.Close(), IsNil)
+	c.Assert(gz.Close(), IsNil)
+	return buf.Bytes()
+}
+
 func (s *suite) Test_Register_fails_with_invalid_json(c *C) {
 	body := bytes.NewReader([]byte("hello"))
 	req, _ := http.NewRequest("POST", registerEndpoint, body)
@@ -336,8 +374,8 @@ func (s *suite) Test_GetVersion(c *C) {
 }
 
 func (s *suite) Test_GetVersion_Resolves_latest(c *C) {
-	s.addRelease(c, getVersionProject, "0.0.1")
-	s.addRelease(c, getVersionProject, "0.0.2")
+	s.addUploadedRelease(c, getVersionProject, "0.0.1")
+	s.addUploadedRelease(c, getVersionProject, "0.0.2")
 	req, _ := http.NewRequest("GET", getLatestVersionEndpoint, nil)
 	testRequest(c, req, http.StatusOK)
 	result := map[string]interface{}{}
@@ -347,9 +385,20 @@ func (s *suite) Test_GetVersion_Resolves_latest(c *C) {
 	c.Assert(result["version"], Equals, "0.0.2")
 }
 
-func (s *suite) Test_GetVersion_Resolves_auto_version(c *C) {
-	s.addRelease(c, getVersionProject, "0.0.1")
+func (s *suite) Test_GetVersion_Resolves_latest_to_last_uploaded_release(c *C) {
+	s.addUploadedRelease(c, getVersionProject, "0.0.1")
 	s.addRelease(c, getVersionProject, "0.0.2")
+	req, _ := http.NewRequest("GET", getLatestVersionEndpoint, nil)
+	testRequest(c, req, http.StatusOK)
+	result := map[string]interface{}{}
+	err := json.Unmarshal([]byte(rr.Body.String()), &result)
+	c.Assert(err, IsNil)
+	c.Assert(result["version"], Equals, "0.0.1")
+}
+
+func (s *suite) Test_GetVersion_Resolves_auto_version(c *C) {
+	s.addUploadedRelease(c, getVersionProject, "0.0.1")
+	s.addUploadedRelease(c, getVersionProject, "0.0.2")
 	req, _ := http.NewRequest("GET", getAutoVersionEndpoint, nil)
 	testRequest(c, req, http.StatusOK)
 	result := map[string]interface{}{}
@@ -360,8 +409,8 @@ func (s *suite) Test_GetVersion_Resolves_auto_version(c *C) {
 }
 
 func (s *suite) Test_GetPreviousVersion(c *C) {
-	s.addRelease(c, getVersionProject, "0.0.1")
-	s.addRelease(c, getVersionProject, "0.0.2")
+	s.addUploadedRelease(c, getVersionProject, "0.0.1")
+	s.addUploadedRelease(c, getVersionProject, "0.0.2")
 	req, _ := http.NewRequest("GET", getPreviousEndpoint, nil)
 	testRequest(c, req, http.StatusOK)
 	result := map[string]interface{}{}
@@ -424,6 +473,30 @@ func (s *suite) Test_GetVersion_fails_if_version_doesnt_exist(c *C) {
 	}
 }
 
+func (s *suite) Test_Export_and_import_namespace(c *C) {
+	storage.TestSetup()
+	s.addRelease(c, exportProject, "1")
+	pkg := s.releasePackage(c, exportProject, "1")
+	req, _ := http.NewRequest("PUT", "/api/v1/inventory/"+exportProject+"/units/my-app/versions/v1/upload", bytes.NewReader(pkg))
+	testRequest(c, req, 200)
+
+	req, _ = http.NewRequest("POST", exportEndpoint, bytes.NewReader([]byte(`{"namespace": "`+exportProject+`"}`)))
+	testRequest(c, req, 200)
+	bundle := rr.Body.Bytes()
+
+	dao.TestSetup()
+	req, _ = http.NewRequest("GET", "/api/v1/inventory/"+exportProject+"/units/my-app/versions/v1/", nil)
+	testRequest(c, req, 404)
+
+	req, _ = http.NewRequest("POST", importEndpoint, bytes.NewReader(bundle))
+	testRequest(c, req, 200)
+	c.Assert(rr.Body.String(), Matches, `(?s).*Imported 1 releases into namespace 'export-prj', 0 already existed.*`)
+
+	req, _ = http.NewRequest("GET", "/api/v1/inventory/"+exportProject+"/units/my-app/versions/v1/download", nil)
+	testRequest(c, req, 200)
+	c.Assert(rr.Body.Bytes(), DeepEquals, pkg)
+}
+
 func (s *suite) Test_Metrics(c *C) {
 	req, _ := http.NewRequest("GET", metricsEndpoint, nil)
 	testRequest(c, req, 200)
@@ -454,3 +527,222 @@ func (s *suite) Test_HardDeleteProject(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(result, HasLen, 1)
 }
+
+func (s *suite) Test_SignedDownloadURL_bypasses_basic_auth(c *C) {
+	storage.TestSetup()
+	model.InitDownloadSigning("secret")
+	s.addRelease(c, "signed-prj", "1.0.0")
+	previousConfig := cmd.Config
+	defer func() { cmd.Config = previousConfig }()
+	cmd.Config, _ = config.NewConfig([]string{"BASIC_AUTH_PASSWORD=password"})
+	handler = cmd.GetHandler(getMux(cmd.Config))
+
+	pkg := s.releasePackage(c, "signed-prj", "1.0.0")
+	req, _ := http.NewRequest("PUT", "/api/v1/inventory/signed-prj/units/my-app/versions/v1.0.0/upload", bytes.NewReader(pkg))
+	req.SetBasicAuth("escape", "password")
+	testRequest(c, req, 200)
+
+	req, _ = http.NewRequest("POST", "/api/v1/inventory/signed-prj/units/my-app/versions/latest/signed-url", nil)
+	testRequest(c, req, 401)
+	req.SetBasicAuth("escape", "password")
+	testRequest(c, req, 200)
+	signed := model.SignedURL{}
+	c.Assert(json.Unmarshal(rr.Body.Bytes(), &signed), IsNil)
+	u, err := url.Parse(signed.URL)
+	c.Assert(err, IsNil)
+	c.Assert(u.Path, Equals, "/api/v1/signed/signed-prj/my-app/v1.0.0/download")
+
+	req, _ = http.NewRequest("GET", u.RequestURI(), nil)
+	testRequest(c, req, 200)
+	c.Assert(rr.Body.Bytes(), DeepEquals, pkg)
+
+	query := u.Query()
+	query.Set("expires", "4102444800")
+	req, _ = http.NewRequest("GET", u.Path+"?"+query.Encode(), nil)
+	testRequest(c, req, 401)
+
+	req, _ = http.NewRequest("GET", "/api/v1/inventory/signed-prj/units/my-app/versions/v1.0.0/download", nil)
+	testRequest(c, req, 401)
+}
+
+// Runs a second inventory with its own database, so that namespaces can be
+// mirrored from it. The databases are swapped while the upstream handles a
+// request; the mirror is always waiting for the response at that point. The
+// upstream doesn't mirror anything itself.
+type upstreamInventory struct {
+	*httptest.Server
+	DAO       types.DAO
+	Mirrors   map[string]string
+	Downloads int
+}
+
+func (s *suite) startUpstreamInventory(c *C) *upstreamInventory {
+	previousConfig := cmd.Config
+	defer func() { cmd.Config = previousConfig }()
+	cmd.Config, _ = config.NewConfig([]string{"BASIC_AUTH_PASSWORD=upstream-password"})
+	upstreamHandler := cmd.GetHandler(getMux(cmd.Config))
+
+	upstream := &upstreamInventory{DAO: mem.NewInMemoryDAO()}
+	upstream.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/download") {
+			upstream.Downloads += 1
+		}
+		upstream.Use(func() {
+			upstreamHandler.ServeHTTP(w, r)
+		})
+	}))
+	return upstream
+}
+
+func (u *upstreamInventory) Use(f func()) {
+	local := dao.GlobalDAO
+	dao.GlobalDAO = u.DAO
+	model.InitMirrors(nil)
+	defer func() {
+		dao.GlobalDAO = local
+		model.InitMirrors(u.Mirrors)
+	}()
+	f()
+}
+
+func (u *upstreamInventory) Mirror(c *C, namespace string) {
+	u.Mirrors = map[string]string{namespace: u.MirrorURL(c)}
+	c.Assert(model.InitMirrors(u.Mirrors), IsNil)
+}
+
+func (u *upstreamInventory) MirrorURL(c *C) string {
+	parsed, err := url.Parse(u.URL)
+	c.Assert(err, IsNil)
+	parsed.User = url.UserPassword("escape", "upstream-password")
+	return parsed.String()
+}
+
+func (s *suite) addUpstreamRelease(c *C, upstream *upstreamInventory, project, version string) {
+	upstream.Use(func() {
+		if err := dao.AddNamespace(&types.Project{Name: project, Description: "Upstream namespace"}); err != types.AlreadyExists {
+			c.Assert(err, IsNil)
+		}
+		_, err := model.AddReleaseByUser(project, `{"name": "my-app", "version": "`+version+`", "project": "`+project+`"}`, "upstream-user")
+		c.Assert(err, IsNil)
+		c.Assert(model.UploadPackage(project, "my-app-v"+version, bytes.NewReader(s.releasePackage(c, project, version))), IsNil)
+	})
+}
+
+func (s *suite) Test_Mirror_fetches_namespace_from_upstream(c *C) {
+	storage.TestSetup()
+	upstream := s.startUpstreamInventory(c)
+	defer upstream.Close()
+	s.addUpstreamRelease(c, upstream, "mirrored-prj", "1.0")
+	upstream.Mirror(c, "mirrored-prj")
+	defer model.InitMirrors(nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/inventory/mirrored-prj/", nil)
+	testRequest(c, req, 200)
+	result := map[string]interface{}{}
+	c.Assert(json.Unmarshal(rr.Body.Bytes(), &result), IsNil)
+	c.Assert(result["name"], Equals, "mirrored-prj")
+	c.Assert(result["description"], Equals, "Upstream namespace")
+	c.Assert(result["units"].(map[string]interface{})["my-app"], NotNil)
+
+	req, _ = http.NewRequest("GET", "/api/v1/inventory/not-mirrored-prj/", nil)
+	testRequest(c, req, 404)
+}
+
+func (s *suite) Test_Mirror_fetches_versions_and_releases_from_upstream(c *C) {
+	storage.TestSetup()
+	upstream := s.startUpstreamInventory(c)
+	defer upstream.Close()
+	s.addUpstreamRelease(c, upstream, "mirrored-prj", "1.0")
+	s.addUpstreamRelease(c, upstream, "mirrored-prj", "1.1")
+	upstream.Mirror(c, "mirrored-prj")
+	defer model.InitMirrors(nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/inventory/mirrored-prj/units/my-app/versions/", nil)
+	testRequest(c, req, 200)
+	versions := []string{}
+	c.Assert(json.Unmarshal(rr.Body.Bytes(), &versions), IsNil)
+	c.Assert(versions, HasLen, 2)
+	c.Assert(versions, HasItem, "1.0")
+	c.Assert(versions, HasItem, "1.1")
+
+	req, _ = http.NewRequest("GET", "/api/v1/inventory/mirrored-prj/units/my-app/versions/latest/?full=true", nil)
+	testRequest(c, req, 200)
+	release := model.ReleasePayload{}
+	c.Assert(json.Unmarshal(rr.Body.Bytes(), &release), IsNil)
+	c.Assert(release.Release.Version, Equals, "1.1")
+	c.Assert(release.IsLatest, Equals, true)
+	c.Assert(release.UploadedBy, Equals, "upstream-user")
+	c.Assert(release.PackageSHA256, Not(Equals), "")
+
+	app, err := dao.GetApplication("mirrored-prj", "my-app")
+	c.Assert(err, IsNil)
+	c.Assert(app.LatestVersion, Equals, "1.1")
+
+	req, _ = http.NewRequest("GET", "/api/v1/inventory/mirrored-prj/units/my-app/versions/v2.0/", nil)
+	testRequest(c, req, 404)
+	req, _ = http.NewRequest("GET", "/api/v1/inventory/mirrored-prj/units/other-app/versions/", nil)
+	testRequest(c, req, 404)
+}
+
+func (s *suite) Test_Mirror_caches_packages_from_upstream(c *C) {
+	storage.TestSetup()
+	upstream := s.startUpstreamInventory(c)
+	defer upstream.Close()
+	s.addUpstreamRelease(c, upstream, "mirrored-prj", "1.0")
+	upstream.Mirror(c, "mirrored-prj")
+	defer model.InitMirrors(nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/inventory/mirrored-prj/units/my-app/versions/v1.0/download", nil)
+	testRequest(c, req, 200)
+	c.Assert(rr.Body.Bytes(), DeepEquals, s.releasePackage(c, "mirrored-prj", "1.0"))
+	c.Assert(upstream.Downloads, Equals, 1)
+
+	release, err := dao.GetRelease("mirrored-prj", "my-app", "my-app-v1.0")
+	c.Assert(err, IsNil)
+	uris, err := dao.GetPackageURIs(release)
+	c.Assert(err, IsNil)
+	c.Assert(uris, HasLen, 1)
+
+	upstream.Close()
+	testRequest(c, req, 200)
+	c.Assert(rr.Body.Bytes(), DeepEquals, s.releasePackage(c, "mirrored-prj", "1.0"))
+	c.Assert(upstream.Downloads, Equals, 1)
+}
+
+func (s *suite) Test_Mirror_sync_imports_new_upstream_releases(c *C) {
+	storage.TestSetup()
+	upstream := s.startUpstreamInventory(c)
+	defer upstream.Close()
+	s.addUpstreamRelease(c, upstream, "mirrored-prj", "1.0")
+	upstream.Mirror(c, "mirrored-prj")
+	defer model.InitMirrors(nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/inventory/mirrored-prj/units/my-app/versions/latest/", nil)
+	testRequest(c, req, 200)
+	s.addUpstreamRelease(c, upstream, "mirrored-prj", "1.1")
+	testRequest(c, req, 200)
+	c.Assert(rr.Body.String(), Matches, `(?s).*"version": ?"1.0".*`)
+
+	req, _ = http.NewRequest("POST", "/api/v1/internal/sync-mirrors", bytes.NewReader([]byte(`{}`)))
+	testRequest(c, req, 200)
+	c.Assert(rr.Body.String(), Equals, "mirrored-prj/my-app: imported 1 releases\nImported 1 releases from 1 namespaces, 0 errors.\n")
+
+	upstream.Close()
+	req, _ = http.NewRequest("GET", "/api/v1/inventory/mirrored-prj/units/my-app/versions/latest/", nil)
+	testRequest(c, req, 200)
+	c.Assert(rr.Body.String(), Matches, `(?s).*"version": ?"1.1".*`)
+}
+
+func (s *suite) Test_Mirror_fails_if_upstream_credentials_are_wrong(c *C) {
+	storage.TestSetup()
+	upstream := s.startUpstreamInventory(c)
+	defer upstream.Close()
+	s.addUpstreamRelease(c, upstream, "mirrored-prj", "1.0")
+	upstream.Mirrors = map[string]string{"mirrored-prj": upstream.URL}
+	c.Assert(model.InitMirrors(upstream.Mirrors), IsNil)
+	defer model.InitMirrors(nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/inventory/mirrored-prj/", nil)
+	testRequest(c, req, 500)
+	c.Assert(rr.Body.String(), Not(Matches), `.*upstream-password.*`)
+}
@@ -25,7 +25,7 @@ import (
 
 type ApplicationPayload struct {
 	*types.Application
-	Versions []string `json:"versions",omitempty`
+	Versions []string `json:"versions"`
 }
 
 func GetApplication(namespace, name string) (*ApplicationPayload, error) {
@@ -56,6 +56,17 @@ func GetApplications(namespace string) (map[string]*types.Application, error) {
 }
 
 func GetApplicationVersions(namespace, name string) ([]string, error) {
+	result, err := findAllVersions(namespace, name)
+	if isMirrorMiss(namespace, err) {
+		if err := mirrorApplication(namespace, name); err != nil {
+			return nil, err
+		}
+		result, err = findAllVersions(namespace, name)
+	}
+	return result, err
+}
+
+func findAllVersions(namespace, name string) ([]string, error) {
 	app, err := dao.GetApplication(namespace, name)
 	if err != nil {
 		return nil, err
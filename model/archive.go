@@ -0,0 +1,64 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+var errStopWalk = errors.New("stop walk")
+
+// Calls fn for every regular file in a package archive, until fn returns an
+// error. Returning errStopWalk stops the walk without failing it.
+//
+// Packages keep their files in a directory named after the release id. That
+// directory is stripped from the paths passed to fn, so that they match the
+// paths in the release metadata.
+func walkPackage(pkg io.Reader, releaseId string, fn func(path string, header *tar.Header, entry io.Reader) error) error {
+	gz, err := gzip.NewReader(pkg)
+	if err != nil {
+		return fmt.Errorf("Package is not a valid gzip archive: %s", err.Error())
+	}
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("Package is not a valid tar archive: %s", err.Error())
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if err := fn(packagePath(releaseId, header.Name), header, archive); err == errStopWalk {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func packagePath(releaseId, name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	return strings.TrimPrefix(name, releaseId+"/")
+}
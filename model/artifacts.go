@@ -0,0 +1,179 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/ankyra/escape-core/parsers"
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+)
+
+type ArtifactPayload struct {
+	Name     string `json:"name"`
+	Platform string `json:"platform,omitempty"`
+	Arch     string `json:"arch,omitempty"`
+	SHA256   string `json:"sha256"`
+	Size     int64  `json:"size"`
+}
+
+var artifactNameRegex = regexp.MustCompile("^[a-z0-9][a-z0-9._]*(-[a-z0-9._]+)*$")
+
+// Uploads an artifact for the release. Artifacts are named either after the
+// platform and architecture they're built for, like "linux-amd64", or after
+// what they contain, like "docs" or "sbom". Every platform and architecture
+// combination can only have one artifact.
+func UploadArtifact(namespace, releaseId, artifact, platform, arch string, pkg io.Reader) error {
+	return newStorageProvider().UploadArtifact(namespace, releaseId, artifact, platform, arch, pkg)
+}
+
+func GetArtifacts(namespace, application, versionQuery string) ([]*ArtifactPayload, error) {
+	release, err := ResolveReleaseId(namespace, application, versionQuery)
+	if err != nil {
+		return nil, err
+	}
+	artifacts, err := dao.GetArtifacts(release)
+	if err != nil {
+		return nil, err
+	}
+	result := []*ArtifactPayload{}
+	for _, artifact := range artifacts {
+		result = append(result, &ArtifactPayload{
+			Name:     artifact.Name,
+			Platform: artifact.Platform,
+			Arch:     artifact.Arch,
+			SHA256:   artifact.SHA256,
+			Size:     artifact.Size,
+		})
+	}
+	return result, nil
+}
+
+func GetArtifactReadSeeker(namespace, application, versionQuery, artifact string) (*PackageReader, error) {
+	return newStorageProvider().GetArtifactReadSeeker(namespace, application, versionQuery, artifact)
+}
+
+// Returns the artifact that was uploaded for the platform and architecture.
+// An empty architecture matches artifacts for any architecture.
+func GetPlatformDownloadReadSeeker(namespace, application, versionQuery, platform, arch string) (*PackageReader, error) {
+	return newStorageProvider().GetPlatformDownloadReadSeeker(namespace, application, versionQuery, platform, arch)
+}
+
+func (s *storageProvider) UploadArtifact(namespace, releaseId, artifact, platform, arch string, pkg io.Reader) error {
+	if !artifactNameRegex.MatchString(artifact) {
+		return NewUserError(fmt.Errorf("Invalid artifact name '%s'", artifact))
+	}
+	parsed, err := parsers.ParseReleaseId(releaseId)
+	if err != nil {
+		return NewUserError(err)
+	}
+	if parsed.NeedsResolving() {
+		return NewUserError(fmt.Errorf("Can't upload artifact against unresolved version '%s/%s'", namespace, releaseId))
+	}
+	lock := releaseLock(namespace, releaseId)
+	lock.Lock()
+	defer lock.Unlock()
+
+	release, err := dao.GetRelease(namespace, parsed.Name, releaseId)
+	if err != nil {
+		return NewUserError(err)
+	}
+	artifacts, err := dao.GetArtifacts(release)
+	if err != nil {
+		return err
+	}
+	var existing *types.Artifact
+	for _, a := range artifacts {
+		if a.Name == artifact {
+			existing = a
+		} else if platform != "" && a.Platform == platform && a.Arch == arch {
+			return NewUserError(fmt.Errorf("Release '%s' already has an artifact for platform '%s' and architecture '%s': '%s'", releaseId, platform, arch, a.Name))
+		}
+	}
+	// Artifacts that have already been uploaded are only read to compare
+	// their checksum; streamed artifacts are hashed while they're stored.
+	hasher := newPackageHasher()
+	if seeker, ok := pkg.(io.ReadSeeker); ok {
+		if err := hasher.ReadFrom(seeker); err != nil {
+			return err
+		}
+	} else if existing != nil {
+		if _, err := io.Copy(hasher, pkg); err != nil {
+			return err
+		}
+	} else {
+		pkg = io.TeeReader(pkg, hasher)
+	}
+	if existing != nil {
+		if existing.SHA256 != hasher.SHA256() {
+			return NewUserError(fmt.Errorf("An artifact '%s' with a different checksum has already been uploaded for '%s/%s'", artifact, namespace, releaseId))
+		}
+		return types.AlreadyExists
+	}
+	uris, err := s.StoreArtifact(namespace, releaseId, artifact, pkg)
+	if err != nil {
+		// Copies that replace a registered artifact are still in use.
+		if artifacts, getErr := dao.GetArtifacts(release); getErr == nil {
+			registered := []string{}
+			for _, a := range artifacts {
+				registered = append(registered, a.URIs...)
+			}
+			s.deleteUploads(namespace, unregisteredURIs(uris, registered))
+		}
+		return err
+	}
+	return dao.AddArtifact(release, &types.Artifact{
+		Name:     artifact,
+		Platform: platform,
+		Arch:     arch,
+		SHA256:   hasher.SHA256(),
+		Size:     hasher.Size,
+		URIs:     uris,
+	})
+}
+
+func (s *storageProvider) GetArtifactReadSeeker(namespace, application, versionQuery, artifact string) (*PackageReader, error) {
+	return s.getArtifactReadSeeker(namespace, application, versionQuery, func(a *types.Artifact) bool {
+		return a.Name == artifact
+	})
+}
+
+func (s *storageProvider) GetPlatformDownloadReadSeeker(namespace, application, versionQuery, platform, arch string) (*PackageReader, error) {
+	return s.getArtifactReadSeeker(namespace, application, versionQuery, func(a *types.Artifact) bool {
+		return a.Platform == platform && (arch == "" || a.Arch == arch)
+	})
+}
+
+func (s *storageProvider) getArtifactReadSeeker(namespace, application, versionQuery string, matches func(*types.Artifact) bool) (*PackageReader, error) {
+	release, err := ResolveReleaseId(namespace, application, versionQuery)
+	if err != nil {
+		return nil, err
+	}
+	artifacts, err := dao.GetArtifacts(release)
+	if err != nil {
+		return nil, err
+	}
+	for _, artifact := range artifacts {
+		if matches(artifact) {
+			return s.openPackage(namespace, release, artifact.URIs, artifact.SHA256, artifact.Size)
+		}
+	}
+	return nil, types.NotFound
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+
+	. "gopkg.in/check.v1"
+)
+
+func artifactStorage() (*storageProvider, map[string]string) {
+	stored := map[string]string{}
+	return &storageProvider{
+		StoreArtifact: func(namespace, releaseId, artifact string, pkg io.Reader) ([]string, error) {
+			data, err := ioutil.ReadAll(pkg)
+			if err != nil {
+				return nil, err
+			}
+			uri := "mem://" + releaseId + "-" + artifact + ".tgz"
+			stored[uri] = string(data)
+			return []string{uri}, nil
+		},
+		Download: func(namespace, uri string) (io.ReadSeekCloser, error) {
+			data, ok := stored[uri]
+			if !ok {
+				return nil, types.NotFound
+			}
+			return nopCloser{bytes.NewReader([]byte(data))}, nil
+		},
+	}, stored
+}
+
+func (s *appSuite) Test_UploadArtifact(c *C) {
+	dao.TestSetup()
+	provider, stored := artifactStorage()
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	c.Assert(provider.UploadArtifact("namespace", "name-v1.0.0", "linux-amd64", "linux", "amd64", bytes.NewReader([]byte("linux build"))), IsNil)
+	c.Assert(provider.UploadArtifact("namespace", "name-v1.0.0", "docs", "", "", bytes.NewReader([]byte("docs"))), IsNil)
+	c.Assert(stored["mem://name-v1.0.0-linux-amd64.tgz"], Equals, "linux build")
+
+	artifacts, err := GetArtifacts("namespace", "name", "v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(artifacts, DeepEquals, []*ArtifactPayload{
+		{Name: "linux-amd64", Platform: "linux", Arch: "amd64", SHA256: fileDigest("linux build"), Size: 11},
+		{Name: "docs", SHA256: fileDigest("docs"), Size: 4},
+	})
+
+	// The release's own package is unaffected
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(release.PackageSHA256, Equals, "")
+	uris, err := dao.GetPackageURIs(release)
+	c.Assert(err, IsNil)
+	c.Assert(uris, HasLen, 0)
+}
+
+func (s *appSuite) Test_UploadArtifact_is_only_stored_once(c *C) {
+	dao.TestSetup()
+	provider, _ := artifactStorage()
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	c.Assert(provider.UploadArtifact("namespace", "name-v1.0.0", "docs", "", "", bytes.NewReader([]byte("docs"))), IsNil)
+
+	err = provider.UploadArtifact("namespace", "name-v1.0.0", "docs", "", "", bytes.NewReader([]byte("docs")))
+	c.Assert(err, Equals, types.AlreadyExists)
+
+	err = provider.UploadArtifact("namespace", "name-v1.0.0", "docs", "", "", bytes.NewReader([]byte("other docs")))
+	c.Assert(err, Not(IsNil))
+	c.Assert(IsUserError(err), Equals, true)
+	c.Assert(err.Error(), Equals, "An artifact 'docs' with a different checksum has already been uploaded for 'namespace/name-v1.0.0'")
+
+	err = provider.UploadArtifact("namespace", "name-v1.0.0", "docs", "", "", ioutil.NopCloser(bytes.NewReader([]byte("docs"))))
+	c.Assert(err, Equals, types.AlreadyExists)
+
+	err = provider.UploadArtifact("namespace", "name-v1.0.0", "docs", "", "", ioutil.NopCloser(bytes.NewReader([]byte("other docs"))))
+	c.Assert(err, Not(IsNil))
+	c.Assert(IsUserError(err), Equals, true)
+	c.Assert(err.Error(), Equals, "An artifact 'docs' with a different checksum has already been uploaded for 'namespace/name-v1.0.0'")
+}
+
+func (s *appSuite) Test_UploadArtifact_serialises_concurrent_uploads_for_a_release(c *C) {
+	dao.TestSetup()
+	provider, stored := artifactStorage()
+	store := provider.StoreArtifact
+	uploads := 0
+	uploading := make(chan bool)
+	proceed := make(chan bool)
+	provider.StoreArtifact = func(namespace, releaseId, artifact string, pkg io.Reader) ([]string, error) {
+		uploads += 1
+		if uploads == 1 {
+			uploading <- true
+			<-proceed
+		}
+		return store(namespace, releaseId, artifact, pkg)
+	}
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+
+	first := make(chan error)
+	go func() {
+		first <- provider.UploadArtifact("namespace", "name-v1.0.0", "docs", "", "", ioutil.NopCloser(bytes.NewReader([]byte("docs"))))
+	}()
+	<-uploading
+	second := make(chan error)
+	go func() {
+		second <- provider.UploadArtifact("namespace", "name-v1.0.0", "docs", "", "", ioutil.NopCloser(bytes.NewReader([]byte("other docs"))))
+	}()
+	select {
+	case err := <-second:
+		c.Fatalf("Second upload didn't wait for the first one: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	proceed <- true
+	c.Assert(<-first, IsNil)
+	err = <-second
+	c.Assert(err, Not(IsNil))
+	c.Assert(IsUserError(err), Equals, true)
+	c.Assert(stored["mem://name-v1.0.0-docs.tgz"], Equals, "docs")
+}
+
+func (s *appSuite) Test_UploadArtifact_fails_if_platform_already_has_artifact(c *C) {
+	dao.TestSetup()
+	provider, _ := artifactStorage()
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	c.Assert(provider.UploadArtifact("namespace", "name-v1.0.0", "linux-amd64", "linux", "amd64", bytes.NewReader([]byte("linux build"))), IsNil)
+	err = provider.UploadArtifact("namespace", "name-v1.0.0", "linux-x64", "linux", "amd64", bytes.NewReader([]byte("linux build")))
+	c.Assert(err, Not(IsNil))
+	c.Assert(IsUserError(err), Equals, true)
+	c.Assert(err.Error(), Equals, "Release 'name-v1.0.0' already has an artifact for platform 'linux' and architecture 'amd64': 'linux-amd64'")
+}
+
+func (s *appSuite) Test_UploadArtifact_fails_on_invalid_input(c *C) {
+	dao.TestSetup()
+	provider, _ := artifactStorage()
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	for _, name := range []string{"", "Docs", "-docs", "docs-", "docs/sbom", ".."} {
+		err := provider.UploadArtifact("namespace", "name-v1.0.0", name, "", "", bytes.NewReader([]byte("docs")))
+		c.Assert(err, Not(IsNil))
+		c.Assert(IsUserError(err), Equals, true)
+		c.Assert(err.Error(), Equals, "Invalid artifact name '"+name+"'")
+	}
+	err = provider.UploadArtifact("namespace", "name-v1.0.@", "docs", "", "", bytes.NewReader([]byte("docs")))
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Can't upload artifact against unresolved version 'namespace/name-v1.0.@'")
+	err = provider.UploadArtifact("namespace", "name-v1.0.1", "docs", "", "", bytes.NewReader([]byte("docs")))
+	c.Assert(err, Equals, types.NotFound)
+}
+
+func (s *appSuite) Test_UploadArtifact_fails_if_storage_fails(c *C) {
+	dao.TestSetup()
+	provider := &storageProvider{
+		StoreArtifact: func(namespace, releaseId, artifact string, pkg io.Reader) ([]string, error) {
+			return nil, errors.New("error uploading")
+		},
+	}
+	metadata := `{"name": "name", "version": "1.0.0"}`
+	_, err := AddRelease("namespace", metadata)
+	c.Assert(err, IsNil)
+	c.Assert(UploadPackage("namespace", "name-v1.0.0", bytes.NewReader(releasePackage(c, "name-v1.0.0", metadata))), IsNil)
+	err = provider.UploadArtifact("namespace", "name-v1.0.0", "docs", "", "", bytes.NewReader([]byte("docs")))
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "error uploading")
+	artifacts, err := GetArtifacts("namespace", "name", "latest")
+	c.Assert(err, IsNil)
+	c.Assert(artifacts, HasLen, 0)
+}
+
+func (s *appSuite) Test_GetArtifactReadSeeker(c *C) {
+	dao.TestSetup()
+	provider, _ := artifactStorage()
+	metadata := `{"name": "name", "version": "1.0.0"}`
+	_, err := AddRelease("namespace", metadata)
+	c.Assert(err, IsNil)
+	c.Assert(UploadPackage("namespace", "name-v1.0.0", bytes.NewReader(releasePackage(c, "name-v1.0.0", metadata))), IsNil)
+	c.Assert(provider.UploadArtifact("namespace", "name-v1.0.0", "sbom", "", "", bytes.NewReader([]byte("sbom"))), IsNil)
+
+	reader, err := provider.GetArtifactReadSeeker("namespace", "name", "latest", "sbom")
+	c.Assert(err, IsNil)
+	c.Assert(reader.SHA256, Equals, fileDigest("sbom"))
+	c.Assert(reader.Size, Equals, int64(4))
+	data, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "sbom")
+
+	_, err = provider.GetArtifactReadSeeker("namespace", "name", "latest", "docs")
+	c.Assert(err, Equals, types.NotFound)
+}
+
+func (s *appSuite) Test_GetPlatformDownloadReadSeeker(c *C) {
+	dao.TestSetup()
+	provider, _ := artifactStorage()
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	c.Assert(provider.UploadArtifact("namespace", "name-v1.0.0", "linux-amd64", "linux", "amd64", bytes.NewReader([]byte("linux build"))), IsNil)
+	c.Assert(provider.UploadArtifact("namespace", "name-v1.0.0", "darwin-arm64", "darwin", "arm64", bytes.NewReader([]byte("darwin build"))), IsNil)
+
+	cases := map[[2]string]string{
+		{"linux", "amd64"}:  "linux build",
+		{"linux", ""}:       "linux build",
+		{"darwin", "arm64"}: "darwin build",
+	}
+	for platform, expected := range cases {
+		reader, err := provider.GetPlatformDownloadReadSeeker("namespace", "name", "v1.0.0", platform[0], platform[1])
+		c.Assert(err, IsNil)
+		data, err := ioutil.ReadAll(reader)
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, expected)
+	}
+	_, err = provider.GetPlatformDownloadReadSeeker("namespace", "name", "v1.0.0", "windows", "amd64")
+	c.Assert(err, Equals, types.NotFound)
+	_, err = provider.GetPlatformDownloadReadSeeker("namespace", "name", "v1.0.0", "linux", "arm64")
+	c.Assert(err, Equals, types.NotFound)
+}
@@ -0,0 +1,521 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	core "github.com/ankyra/escape-core"
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+)
+
+// Bundles are gzipped tarballs that carry a namespace to another Inventory.
+// The first entry is the manifest, which holds all the metadata. It's followed
+// by the packages and artifacts of the releases in the manifest:
+//
+//	manifest.json
+//	packages/<unit>/<release id>.tgz
+//	artifacts/<unit>/<release id>/<artifact>
+const bundleFormatVersion = 1
+const bundleManifestPath = "manifest.json"
+
+type bundleManifest struct {
+	FormatVersion int            `json:"format_version"`
+	ExportedAt    time.Time      `json:"exported_at"`
+	Namespace     *types.Project `json:"namespace"`
+	Units         []*bundleUnit  `json:"units"`
+}
+
+type bundleUnit struct {
+	*types.Application
+	Tags     map[string]string `json:"tags"`
+	Releases []*bundleRelease  `json:"releases"`
+}
+
+type bundleRelease struct {
+	Metadata   json.RawMessage   `json:"metadata"`
+	UploadedBy string            `json:"uploaded_by"`
+	UploadedAt time.Time         `json:"uploaded_at"`
+	Draft      bool              `json:"draft"`
+	Package    *bundleFile       `json:"package,omitempty"`
+	Artifacts  []*bundleArtifact `json:"artifacts,omitempty"`
+}
+
+type bundleFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+
+	uris []string
+}
+
+type bundleArtifact struct {
+	bundleFile
+	Name     string `json:"name"`
+	Platform string `json:"platform"`
+	Arch     string `json:"arch"`
+}
+
+// Exports a namespace, including its draft releases, to a bundle that can be
+// imported with ImportBundle.
+type NamespaceExport struct {
+	Namespace string `json:"namespace"`
+}
+
+func ExportNamespace(export *NamespaceExport, bundle io.Writer) error {
+	return newStorageProvider().ExportNamespace(export, bundle)
+}
+
+// Nothing is written to the bundle until all the metadata has been read, so
+// that errors can still be reported to the client.
+func (s *storageProvider) ExportNamespace(export *NamespaceExport, bundle io.Writer) error {
+	if export.Namespace == "" {
+		return NewUserError(fmt.Errorf("Missing namespace"))
+	}
+	manifest, err := s.bundleManifest(export.Namespace)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(bundle)
+	archive := tar.NewWriter(gz)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := archive.WriteHeader(bundleHeader(bundleManifestPath, int64(len(data)), manifest.ExportedAt)); err != nil {
+		return err
+	}
+	if _, err := archive.Write(data); err != nil {
+		return err
+	}
+	for _, unit := range manifest.Units {
+		for _, release := range unit.Releases {
+			if release.Package != nil {
+				if err := s.writeBundleFile(archive, export.Namespace, release.Package, release.UploadedAt); err != nil {
+					return err
+				}
+			}
+			for _, artifact := range release.Artifacts {
+				if err := s.writeBundleFile(archive, export.Namespace, &artifact.bundleFile, release.UploadedAt); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func (s *storageProvider) bundleManifest(namespace string) (*bundleManifest, error) {
+	prj, err := dao.GetNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	hooks, err := dao.GetNamespaceHooks(prj)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &bundleManifest{
+		FormatVersion: bundleFormatVersion,
+		ExportedAt:    time.Now().UTC(),
+		Namespace: &types.Project{
+			Name:        prj.Name,
+			Description: prj.Description,
+			OrgURL:      prj.OrgURL,
+			Logo:        prj.Logo,
+			Hooks:       hooks,
+			IsPublic:    prj.IsPublic,
+		},
+		Units: []*bundleUnit{},
+	}
+	apps, err := dao.GetApplications(namespace)
+	if err != nil && !dao.IsNotFound(err) {
+		return nil, err
+	}
+	names := []string{}
+	for name := range apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		unit, err := s.bundleUnit(namespace, apps[name])
+		if err != nil {
+			return nil, err
+		}
+		manifest.Units = append(manifest.Units, unit)
+	}
+	return manifest, nil
+}
+
+func (s *storageProvider) bundleUnit(namespace string, app *types.Application) (*bundleUnit, error) {
+	hooks, err := dao.GetApplicationHooks(app)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := dao.GetReleaseTags(app)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := dao.FindAllVersions(app)
+	if err != nil {
+		return nil, err
+	}
+	drafts, err := dao.FindAllDraftVersions(app)
+	if err != nil {
+		return nil, err
+	}
+	versions = append(versions, drafts...)
+	sortVersions(versions)
+	unitApp := *app
+	unitApp.Hooks = hooks
+	unit := &bundleUnit{
+		Application: &unitApp,
+		Tags:        tags,
+		Releases:    []*bundleRelease{},
+	}
+	for _, version := range versions {
+		release, err := dao.GetRelease(namespace, app.Name, app.Name+"-v"+version)
+		if err != nil {
+			return nil, err
+		}
+		bundled, err := s.bundleRelease(namespace, release)
+		if err != nil {
+			return nil, err
+		}
+		unit.Releases = append(unit.Releases, bundled)
+	}
+	return unit, nil
+}
+
+func (s *storageProvider) bundleRelease(namespace string, release *types.Release) (*bundleRelease, error) {
+	metadata, err := json.Marshal(release.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	result := &bundleRelease{
+		Metadata:   metadata,
+		UploadedBy: release.UploadedBy,
+		UploadedAt: release.UploadedAt,
+		Draft:      release.Draft,
+	}
+	uris, err := dao.GetPackageURIs(release)
+	if err != nil {
+		return nil, err
+	}
+	if len(uris) > 0 {
+		result.Package, err = s.bundleFile(namespace, "packages/"+release.Application.Name+"/"+release.ReleaseId+".tgz", uris, release.PackageSHA256, release.PackageSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	artifacts, err := dao.GetArtifacts(release)
+	if err != nil {
+		return nil, err
+	}
+	for _, artifact := range artifacts {
+		file, err := s.bundleFile(namespace, "artifacts/"+release.Application.Name+"/"+release.ReleaseId+"/"+artifact.Name, artifact.URIs, artifact.SHA256, artifact.Size)
+		if err != nil {
+			return nil, err
+		}
+		result.Artifacts = append(result.Artifacts, &bundleArtifact{
+			bundleFile: *file,
+			Name:       artifact.Name,
+			Platform:   artifact.Platform,
+			Arch:       artifact.Arch,
+		})
+	}
+	return result, nil
+}
+
+// Packages that were uploaded before their checksums were recorded don't have
+// a known size, which the tar header needs, so it's looked up in the storage
+// backend instead.
+func (s *storageProvider) bundleFile(namespace, path string, uris []string, checksum string, size int64) (*bundleFile, error) {
+	file := &bundleFile{
+		Path:   path,
+		SHA256: checksum,
+		Size:   size,
+		uris:   uris,
+	}
+	if checksum != "" {
+		return file, nil
+	}
+	var lastError error = types.NotFound
+	for _, uri := range uris {
+		size, _, err := s.Stat(namespace, uri)
+		if err == nil {
+			file.Size = size
+			return file, nil
+		}
+		lastError = err
+	}
+	return nil, fmt.Errorf("Couldn't determine the size of '%s': %s", path, lastError.Error())
+}
+
+func (s *storageProvider) writeBundleFile(archive *tar.Writer, namespace string, file *bundleFile, modTime time.Time) error {
+	reader, err := s.openPackage(namespace, nil, file.uris, file.SHA256, file.Size)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if err := archive.WriteHeader(bundleHeader(file.Path, file.Size, modTime)); err != nil {
+		return err
+	}
+	if _, err := io.Copy(archive, reader); err != nil {
+		return fmt.Errorf("Failed to export '%s': %s", file.Path, err.Error())
+	}
+	return nil
+}
+
+func bundleHeader(path string, size int64, modTime time.Time) *tar.Header {
+	return &tar.Header{
+		Name:    path,
+		Mode:    0644,
+		Size:    size,
+		ModTime: modTime,
+	}
+}
+
+// Imports a bundle created by ExportNamespace. The namespace, units and
+// releases are created if they don't exist yet, keeping the upload details
+// they had in the exporting Inventory. Releases that already exist are left
+// alone, but their packages and artifacts are still added if they're missing,
+// so that an interrupted import can be retried.
+func ImportBundle(bundle io.Reader, progress io.Writer) error {
+	return newStorageProvider().ImportBundle(bundle, progress)
+}
+
+func (s *storageProvider) ImportBundle(bundle io.Reader, progress io.Writer) error {
+	gz, err := gzip.NewReader(bundle)
+	if err != nil {
+		return NewUserError(fmt.Errorf("Invalid bundle: %s", err.Error()))
+	}
+	archive := tar.NewReader(gz)
+	manifest, err := readBundleManifest(archive)
+	if err != nil {
+		return err
+	}
+	namespace := manifest.Namespace.Name
+	if err := importBundleNamespace(manifest.Namespace); err != nil {
+		return err
+	}
+	files := map[string]func(io.Reader) error{}
+	imported, existing := 0, 0
+	for _, unit := range manifest.Units {
+		for _, bundled := range unit.Releases {
+			release, created, err := importBundleRelease(namespace, unit, bundled)
+			if err != nil {
+				return err
+			}
+			if created {
+				imported += 1
+				fmt.Fprintf(progress, "%s/%s: imported release\n", namespace, release.ReleaseId)
+			} else {
+				existing += 1
+			}
+			if bundled.Package != nil {
+				files[bundled.Package.Path] = s.bundlePackageImporter(namespace, release, bundled.Package, progress)
+			}
+			for _, artifact := range bundled.Artifacts {
+				files[artifact.Path] = s.bundleArtifactImporter(namespace, release, artifact, progress)
+			}
+		}
+		if err := importBundleUnit(namespace, unit); err != nil {
+			return err
+		}
+	}
+	packages := 0
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return NewUserError(fmt.Errorf("Invalid bundle: %s", err.Error()))
+		}
+		importFile, ok := files[header.Name]
+		if !ok {
+			return NewUserError(fmt.Errorf("Invalid bundle: unexpected entry '%s'", header.Name))
+		}
+		delete(files, header.Name)
+		if err := importFile(archive); err != nil {
+			return err
+		}
+		packages += 1
+	}
+	if len(files) > 0 {
+		missing := []string{}
+		for path := range files {
+			missing = append(missing, path)
+		}
+		sort.Strings(missing)
+		return NewUserError(fmt.Errorf("Invalid bundle: missing entry '%s'", missing[0]))
+	}
+	fmt.Fprintf(progress, "Imported %d releases into namespace '%s', %d already existed. Processed %d packages and artifacts.\n", imported, namespace, existing, packages)
+	return nil
+}
+
+func readBundleManifest(archive *tar.Reader) (*bundleManifest, error) {
+	header, err := archive.Next()
+	if err != nil {
+		return nil, NewUserError(fmt.Errorf("Invalid bundle: %s", err.Error()))
+	}
+	if header.Name != bundleManifestPath {
+		return nil, NewUserError(fmt.Errorf("Invalid bundle: expecting '%s' as the first entry, got '%s'", bundleManifestPath, header.Name))
+	}
+	manifest := &bundleManifest{}
+	if err := json.NewDecoder(archive).Decode(manifest); err != nil {
+		return nil, NewUserError(fmt.Errorf("Invalid bundle manifest: %s", err.Error()))
+	}
+	if manifest.FormatVersion != bundleFormatVersion {
+		return nil, NewUserError(fmt.Errorf("Bundle format version %d is not supported (this Inventory supports version %d)", manifest.FormatVersion, bundleFormatVersion))
+	}
+	if manifest.Namespace == nil || manifest.Namespace.Name == "" {
+		return nil, NewUserError(fmt.Errorf("Invalid bundle manifest: missing namespace"))
+	}
+	return manifest, nil
+}
+
+// Hooks in the bundle replace the existing hooks.
+func importBundleNamespace(bundled *types.Project) error {
+	if err := core.ValidateProjectName(bundled.Name); err != nil {
+		return NewUserError(err)
+	}
+	prj, err := dao.GetNamespace(bundled.Name)
+	if dao.IsNotFound(err) {
+		prj = &types.Project{
+			Name:        bundled.Name,
+			Description: bundled.Description,
+			OrgURL:      bundled.OrgURL,
+			Logo:        bundled.Logo,
+			IsPublic:    bundled.IsPublic,
+		}
+		err = dao.AddNamespace(prj)
+	}
+	if err != nil {
+		return err
+	}
+	if len(bundled.Hooks) == 0 {
+		return nil
+	}
+	return dao.SetNamespaceHooks(prj, bundled.Hooks)
+}
+
+func importBundleRelease(namespace string, unit *bundleUnit, bundled *bundleRelease) (*types.Release, bool, error) {
+	metadata, err := core.NewReleaseMetadataFromJsonString(string(bundled.Metadata))
+	if err != nil {
+		return nil, false, NewUserError(fmt.Errorf("Invalid release metadata in bundle: %s", err.Error()))
+	}
+	if metadata.Name != unit.Name {
+		return nil, false, NewUserError(fmt.Errorf("Invalid bundle: release '%s' is listed under unit '%s'", metadata.GetReleaseId(), unit.Name))
+	}
+	release, err := dao.GetRelease(namespace, metadata.Name, metadata.GetReleaseId())
+	if err == nil {
+		return release, false, nil
+	} else if !dao.IsNotFound(err) {
+		return nil, false, err
+	}
+	release = types.NewRelease(types.NewApplication(namespace, metadata.Name), metadata)
+	release.UploadedBy = bundled.UploadedBy
+	release.UploadedAt = bundled.UploadedAt
+	release.Draft = bundled.Draft
+	err = dao.RunInTransaction(func(tx types.DAO) error {
+		return registerImportedRelease(tx, namespace, release)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return release, true, nil
+}
+
+// Restores the unit's details, which were updated while its releases were
+// registered, and its hooks and tags.
+func importBundleUnit(namespace string, unit *bundleUnit) error {
+	app, err := dao.GetApplication(namespace, unit.Name)
+	if dao.IsNotFound(err) {
+		app = types.NewApplication(namespace, unit.Name)
+		err = dao.AddApplication(app)
+	}
+	if err != nil {
+		return err
+	}
+	app.Description = unit.Description
+	app.Logo = unit.Logo
+	app.LatestVersion = unit.LatestVersion
+	app.UploadedBy = unit.UploadedBy
+	app.UploadedAt = unit.UploadedAt
+	if err := dao.UpdateApplication(app); err != nil {
+		return err
+	}
+	if len(unit.Hooks) > 0 {
+		if err := dao.SetApplicationHooks(app, unit.Hooks); err != nil {
+			return err
+		}
+	}
+	for tag, version := range unit.Tags {
+		release, err := dao.GetRelease(namespace, unit.Name, unit.Name+"-v"+version)
+		if err != nil {
+			return fmt.Errorf("Couldn't find release '%s-v%s' tagged '%s': %s", unit.Name, version, tag, err.Error())
+		}
+		if err := dao.TagRelease(release, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The entries are streamed into the storage backends; the package reader
+// makes sure the upload fails if they don't match the manifest. Hiding
+// the Seek method keeps the uploads from trying to rewind the tarball.
+func (s *storageProvider) bundlePackageImporter(namespace string, release *types.Release, file *bundleFile, progress io.Writer) func(io.Reader) error {
+	return func(entry io.Reader) error {
+		pkg := struct{ io.Reader }{NewPackageReader(entry, file.SHA256, file.Size)}
+		err := s.uploadPackage(namespace, release.ReleaseId, pkg, file.SHA256)
+		if dao.IsAlreadyExists(err) {
+			return nil
+		} else if err != nil {
+			log.Printf("Error: Failed to import package '%s/%s': %s\n", namespace, release.ReleaseId, err.Error())
+			return err
+		}
+		fmt.Fprintf(progress, "%s/%s: imported package\n", namespace, release.ReleaseId)
+		return nil
+	}
+}
+
+func (s *storageProvider) bundleArtifactImporter(namespace string, release *types.Release, artifact *bundleArtifact, progress io.Writer) func(io.Reader) error {
+	return func(entry io.Reader) error {
+		pkg := struct{ io.Reader }{NewPackageReader(entry, artifact.SHA256, artifact.Size)}
+		err := s.UploadArtifact(namespace, release.ReleaseId, artifact.Name, artifact.Platform, artifact.Arch, pkg)
+		if dao.IsAlreadyExists(err) {
+			return nil
+		} else if err != nil {
+			log.Printf("Error: Failed to import artifact '%s' of '%s/%s': %s\n", artifact.Name, namespace, release.ReleaseId, err.Error())
+			return err
+		}
+		fmt.Fprintf(progress, "%s/%s: imported artifact %s\n", namespace, release.ReleaseId, artifact.Name)
+		return nil
+	}
+}
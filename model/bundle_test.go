@@ -0,0 +1,232 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+	. "gopkg.in/check.v1"
+)
+
+func bundleStorage() (*storageProvider, map[string]string) {
+	stored := map[string]string{}
+	store := func(uri string, pkg io.Reader) ([]string, error) {
+		data, err := ioutil.ReadAll(pkg)
+		if err != nil {
+			return nil, err
+		}
+		stored[uri] = string(data)
+		return []string{uri}, nil
+	}
+	return &storageProvider{
+		Upload: func(namespace, releaseId string, pkg io.Reader) ([]string, error) {
+			return store("mem://"+namespace+"/"+releaseId+".tgz", pkg)
+		},
+		StoreArtifact: func(namespace, releaseId, artifact string, pkg io.Reader) ([]string, error) {
+			return store("mem://"+namespace+"/"+releaseId+"-"+artifact, pkg)
+		},
+		Download: func(namespace, uri string) (io.ReadSeekCloser, error) {
+			data, ok := stored[uri]
+			if !ok {
+				return nil, types.NotFound
+			}
+			return nopCloser{bytes.NewReader([]byte(data))}, nil
+		},
+	}, stored
+}
+
+// Exports a namespace with two releases, a draft, a tag, hooks and an
+// artifact, and starts over with an empty database.
+func (s *suite) exportBundle(c *C, storage *storageProvider) []byte {
+	c.Assert(dao.AddNamespace(&types.Project{Name: "bundle-prj", Description: "Bundled", IsPublic: true}), IsNil)
+	c.Assert(UpdateNamespaceHooks("bundle-prj", types.Hooks{"slack": {"url": "https://hooks.example.com"}}), IsNil)
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		metadata := `{"name": "my-app", "version": "` + version + `", "description": "v` + version + `"}`
+		_, err := AddReleaseByUser("bundle-prj", metadata, "user-"+version)
+		c.Assert(err, IsNil)
+		c.Assert(storage.UploadPackage("bundle-prj", "my-app-v"+version, bytes.NewReader(releasePackage(c, "my-app-v"+version, metadata))), IsNil)
+	}
+	_, err := AddDraftReleaseByUser("bundle-prj", `{"name": "my-app", "version": "1.2.0"}`, "drafter")
+	c.Assert(err, IsNil)
+	c.Assert(TagRelease("bundle-prj", "my-app", "bundle-prj/my-app-v1.0.0", "stable"), IsNil)
+	c.Assert(UpdateApplicationHooks("bundle-prj", "my-app", types.Hooks{"build": {"url": "https://ci.example.com"}}), IsNil)
+	c.Assert(storage.UploadArtifact("bundle-prj", "my-app-v1.1.0", "my-app-linux", "linux", "amd64", bytes.NewReader([]byte("binary"))), IsNil)
+
+	bundle := bytes.NewBuffer(nil)
+	c.Assert(storage.ExportNamespace(&NamespaceExport{Namespace: "bundle-prj"}, bundle), IsNil)
+	dao.TestSetup()
+	return bundle.Bytes()
+}
+
+// Rewrites the entries of the bundle with the result of the change function.
+func rewriteBundle(c *C, bundle []byte, change func(name string, data []byte) []byte) []byte {
+	gz, err := gzip.NewReader(bytes.NewReader(bundle))
+	c.Assert(err, IsNil)
+	archive := tar.NewReader(gz)
+	result := bytes.NewBuffer(nil)
+	gzOut := gzip.NewWriter(result)
+	out := tar.NewWriter(gzOut)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+		data, err := ioutil.ReadAll(archive)
+		c.Assert(err, IsNil)
+		data = change(header.Name, data)
+		if data == nil {
+			continue
+		}
+		header.Size = int64(len(data))
+		c.Assert(out.WriteHeader(header), IsNil)
+		_, err = out.Write(data)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(out.Close(), IsNil)
+	c.Assert(gzOut.Close(), IsNil)
+	return result.Bytes()
+}
+
+func (s *suite) Test_ImportBundle_restores_exported_namespace(c *C) {
+	storage, _ := bundleStorage()
+	before := time.Now()
+	bundle := s.exportBundle(c, storage)
+	progress := bytes.NewBuffer(nil)
+
+	c.Assert(storage.ImportBundle(bytes.NewReader(bundle), progress), IsNil)
+	c.Assert(progress.String(), Equals, `bundle-prj/my-app-v1.0.0: imported release
+bundle-prj/my-app-v1.1.0: imported release
+bundle-prj/my-app-v1.2.0: imported release
+bundle-prj/my-app-v1.0.0: imported package
+bundle-prj/my-app-v1.1.0: imported package
+bundle-prj/my-app-v1.1.0: imported artifact my-app-linux
+Imported 3 releases into namespace 'bundle-prj', 0 already existed. Processed 3 packages and artifacts.
+`)
+
+	prj, err := dao.GetNamespace("bundle-prj")
+	c.Assert(err, IsNil)
+	c.Assert(prj.Description, Equals, "Bundled")
+	c.Assert(prj.IsPublic, Equals, true)
+	hooks, err := dao.GetNamespaceHooks(prj)
+	c.Assert(err, IsNil)
+	c.Assert(hooks["slack"]["url"], Equals, "https://hooks.example.com")
+
+	app, err := dao.GetApplication("bundle-prj", "my-app")
+	c.Assert(err, IsNil)
+	c.Assert(app.LatestVersion, Equals, "1.1.0")
+	c.Assert(app.Description, Equals, "v1.1.0")
+	appHooks, err := dao.GetApplicationHooks(app)
+	c.Assert(err, IsNil)
+	c.Assert(appHooks["build"]["url"], Equals, "https://ci.example.com")
+
+	release, err := dao.GetRelease("bundle-prj", "my-app", "my-app-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(release.UploadedBy, Equals, "user-1.0.0")
+	c.Assert(release.UploadedAt.After(before), Equals, true)
+	c.Assert(release.UploadedAt.Before(time.Now()), Equals, true)
+	c.Assert(release.PackageSHA256, Equals, fileDigest(string(releasePackage(c, "my-app-v1.0.0", `{"name": "my-app", "version": "1.0.0", "description": "v1.0.0"}`))))
+	tagged, err := ResolveReleaseId("bundle-prj", "my-app", "stable")
+	c.Assert(err, IsNil)
+	c.Assert(tagged.Version, Equals, "1.0.0")
+
+	draft, err := dao.GetRelease("bundle-prj", "my-app", "my-app-v1.2.0")
+	c.Assert(err, IsNil)
+	c.Assert(draft.Draft, Equals, true)
+	c.Assert(draft.UploadedBy, Equals, "drafter")
+
+	reader, err := storage.GetPlatformDownloadReadSeeker("bundle-prj", "my-app", "v1.1.0", "linux", "amd64")
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "binary")
+}
+
+func (s *suite) Test_ImportBundle_can_be_repeated(c *C) {
+	storage, _ := bundleStorage()
+	bundle := s.exportBundle(c, storage)
+	c.Assert(storage.ImportBundle(bytes.NewReader(bundle), ioutil.Discard), IsNil)
+	progress := bytes.NewBuffer(nil)
+
+	c.Assert(storage.ImportBundle(bytes.NewReader(bundle), progress), IsNil)
+	c.Assert(progress.String(), Equals, "Imported 0 releases into namespace 'bundle-prj', 3 already existed. Processed 3 packages and artifacts.\n")
+}
+
+func (s *suite) Test_ImportBundle_fails_on_checksum_mismatch(c *C) {
+	storage, _ := bundleStorage()
+	bundle := rewriteBundle(c, s.exportBundle(c, storage), func(name string, data []byte) []byte {
+		if name == "artifacts/my-app/my-app-v1.1.0/my-app-linux" {
+			return []byte("BINARY")
+		}
+		return data
+	})
+	err := storage.ImportBundle(bytes.NewReader(bundle), ioutil.Discard)
+	c.Assert(err, ErrorMatches, "Package checksum mismatch.*")
+	release, err := dao.GetRelease("bundle-prj", "my-app", "my-app-v1.1.0")
+	c.Assert(err, IsNil)
+	artifacts, err := dao.GetArtifacts(release)
+	c.Assert(err, IsNil)
+	c.Assert(artifacts, HasLen, 0)
+}
+
+func (s *suite) Test_ImportBundle_fails_on_invalid_bundles(c *C) {
+	storage, _ := bundleStorage()
+	bundle := s.exportBundle(c, storage)
+	cases := map[string][]byte{
+		"Invalid bundle: gzip: invalid header": []byte("not a bundle"),
+		"Invalid bundle: expecting 'manifest.json' as the first entry, got 'packages/my-app/my-app-v1.0.0.tgz'": rewriteBundle(c, bundle, func(name string, data []byte) []byte {
+			if name == "manifest.json" {
+				return nil
+			}
+			return data
+		}),
+		"Bundle format version 2 is not supported \\(this Inventory supports version 1\\)": rewriteBundle(c, bundle, func(name string, data []byte) []byte {
+			if name == "manifest.json" {
+				return bytes.Replace(data, []byte(`"format_version": 1`), []byte(`"format_version": 2`), 1)
+			}
+			return data
+		}),
+		"Invalid bundle: missing entry 'packages/my-app/my-app-v1.1.0.tgz'": rewriteBundle(c, bundle, func(name string, data []byte) []byte {
+			if name == "packages/my-app/my-app-v1.1.0.tgz" {
+				return nil
+			}
+			return data
+		}),
+	}
+	for expected, invalid := range cases {
+		dao.TestSetup()
+		err := storage.ImportBundle(bytes.NewReader(invalid), ioutil.Discard)
+		c.Assert(IsUserError(err), Equals, true, Commentf(expected))
+		c.Assert(err, ErrorMatches, expected)
+	}
+}
+
+func (s *suite) Test_ExportNamespace_fails_if_namespace_doesnt_exist(c *C) {
+	storage, _ := bundleStorage()
+	bundle := bytes.NewBuffer(nil)
+	c.Assert(storage.ExportNamespace(&NamespaceExport{Namespace: "doesnt-exist"}, bundle), Equals, types.NotFound)
+	c.Assert(bundle.Len(), Equals, 0)
+	err := storage.ExportNamespace(&NamespaceExport{}, bundle)
+	c.Assert(err, ErrorMatches, "Missing namespace")
+}
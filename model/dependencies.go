@@ -13,6 +13,14 @@ func GetDownstreamDependencies(namespace, name, version string) ([]*types.Depend
 	return dao.GetDownstreamDependencies(release)
 }
 
+func GetDependencyTree(namespace, name, version string) ([]*types.DependencyTree, error) {
+	release, err := ResolveReleaseId(namespace, name, version)
+	if err != nil {
+		return nil, err
+	}
+	return dao.GetDependencyTree(release)
+}
+
 func GetDownstreamDependenciesFilteredBy(namespace, name, version string, f *types.DownstreamDependenciesFilter) ([]*types.Dependency, error) {
 	release, err := ResolveReleaseId(namespace, name, version)
 	if err != nil {
@@ -112,3 +120,157 @@ func GetDependencyGraph(namespace, name, version string, downstreamFunc Downstre
 	}
 	return result, nil
 }
+
+func dependencyId(dep *types.Dependency) string {
+	return dep.Project + "/" + dep.Application + "-v" + dep.Version
+}
+
+// Builds the transitive upstream trees of releases. The dependencies of every
+// upstream release are looked up once per builder, however often the release
+// shows up in the trees, and its subtree is only built once as well. Shared
+// subtrees still appear in full wherever they're used, so the number of nodes
+// in a tree is capped at maxDependencyTreeSize; the nodes past the cap are
+// marked as truncated instead of being expanded.
+type dependencyTreeBuilder struct {
+	tx           types.DAO
+	dependencies map[string][]*types.Dependency
+	subtrees     map[string]*dependencySubtree
+	size         int
+}
+
+type dependencySubtree struct {
+	children []*types.DependencyTree
+	size     int
+}
+
+const maxDependencyTreeSize = 10000
+
+func newDependencyTreeBuilder(tx types.DAO) *dependencyTreeBuilder {
+	return &dependencyTreeBuilder{
+		tx:           tx,
+		dependencies: map[string][]*types.Dependency{},
+		subtrees:     map[string]*dependencySubtree{},
+	}
+}
+
+func (b *dependencyTreeBuilder) Build(release *types.Release, deps []*types.Dependency) ([]*types.DependencyTree, error) {
+	id := release.Application.Project + "/" + release.ReleaseId
+	b.size = len(deps)
+	tree, _, err := b.build(deps, map[string]bool{id: true})
+	return tree, err
+}
+
+// Dependencies that lead back to one of their ancestors aren't expanded again,
+// so a cycle shows up as a leaf instead of recursing forever. Subtrees without
+// such leaves, and that weren't truncated, look the same wherever they appear,
+// so they are reused. Returns whether the trees are complete in that sense.
+//
+// The deps have already been counted towards the size of the tree; a node is
+// only expanded if there's room for all of its children.
+func (b *dependencyTreeBuilder) build(deps []*types.Dependency, ancestors map[string]bool) ([]*types.DependencyTree, bool, error) {
+	result := []*types.DependencyTree{}
+	complete := true
+	for _, dep := range deps {
+		node := types.NewDependencyTree(dep)
+		result = append(result, node)
+		id := dependencyId(dep)
+		if ancestors[id] {
+			complete = false
+			continue
+		}
+		if subtree, ok := b.subtrees[id]; ok && b.size+subtree.size <= maxDependencyTreeSize {
+			node.Children = subtree.children
+			b.size += subtree.size
+			continue
+		}
+		upstream, err := b.upstreamDependencies(dep)
+		if err != nil {
+			return nil, false, err
+		}
+		if b.size+len(upstream) > maxDependencyTreeSize {
+			node.Truncated = true
+			complete = false
+			continue
+		}
+		start := b.size
+		b.size += len(upstream)
+		ancestors[id] = true
+		children, childrenComplete, err := b.build(upstream, ancestors)
+		delete(ancestors, id)
+		if err != nil {
+			return nil, false, err
+		}
+		node.Children = children
+		if childrenComplete {
+			b.subtrees[id] = &dependencySubtree{children: children, size: b.size - start}
+		} else {
+			complete = false
+		}
+	}
+	return result, complete, nil
+}
+
+// Upstream releases that haven't been registered yet, or are still drafts,
+// end up as leaves. Their downstream trees are updated when they're published.
+func (b *dependencyTreeBuilder) upstreamDependencies(dep *types.Dependency) ([]*types.Dependency, error) {
+	id := dependencyId(dep)
+	if deps, ok := b.dependencies[id]; ok {
+		return deps, nil
+	}
+	deps := []*types.Dependency{}
+	release, err := b.tx.GetRelease(dep.Project, dep.Application, dep.Application+"-v"+dep.Version)
+	if err != nil && err != types.NotFound {
+		return nil, err
+	}
+	if err == nil && !release.Draft {
+		deps, err = parseDependencies(release.Metadata)
+		if err != nil {
+			return nil, err
+		}
+	}
+	b.dependencies[id] = deps
+	return deps, nil
+}
+
+// The trees of releases further downstream include this release, possibly as
+// a leaf if it wasn't registered when they were built, so they are rebuilt.
+func updateDownstreamDependencyTrees(tx types.DAO, release *types.Release) error {
+	builder := newDependencyTreeBuilder(tx)
+	seen := map[string]bool{
+		release.Application.Project + "/" + release.ReleaseId: true,
+	}
+	queue := []*types.Release{release}
+	for len(queue) > 0 {
+		downstream, err := tx.GetDownstreamDependencies(queue[0])
+		if err != nil {
+			return err
+		}
+		queue = queue[1:]
+		for _, dep := range downstream {
+			id := dependencyId(dep)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			rel, err := tx.GetRelease(dep.Project, dep.Application, dep.Application+"-v"+dep.Version)
+			if err == types.NotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			deps, err := parseDependencies(rel.Metadata)
+			if err != nil {
+				return err
+			}
+			tree, err := builder.Build(rel, deps)
+			if err != nil {
+				return err
+			}
+			if err := tx.SetDependencyTree(rel, tree); err != nil {
+				return err
+			}
+			queue = append(queue, rel)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+	. "gopkg.in/check.v1"
+)
+
+type dependencySuite struct{}
+
+var _ = Suite(&dependencySuite{})
+
+func (s *dependencySuite) SetUpTest(c *C) {
+	dao.TestSetup()
+}
+
+func (s *dependencySuite) addRelease(c *C, name, version, depends string) {
+	_, err := AddRelease("test", `{"name": "`+name+`", "version": "`+version+`", "project": "test", "depends": [`+depends+`]}`)
+	c.Assert(err, IsNil)
+}
+
+func (s *dependencySuite) assertTreeNode(c *C, node *types.DependencyTree, id string, children int) {
+	c.Assert(dependencyId(node.Dependency), Equals, id)
+	c.Assert(node.Children, HasLen, children)
+}
+
+func (s *dependencySuite) Test_GetDependencyTree_contains_transitive_dependencies(c *C) {
+	s.addRelease(c, "base", "1", ``)
+	s.addRelease(c, "lib", "1", `{"release_id": "test/base-v1", "scopes": ["build"]}`)
+	_, err := AddRelease("test", `{"name": "app", "version": "1", "project": "test",
+								   "depends": [{"release_id": "test/lib-v1"}, {"release_id": "test/base-v1"}],
+								   "extends": [{"release_id": "other/ext-v2"}]}`)
+	c.Assert(err, IsNil)
+
+	tree, err := GetDependencyTree("test", "app", "v1")
+	c.Assert(err, IsNil)
+	c.Assert(tree, HasLen, 3)
+	s.assertTreeNode(c, tree[0], "test/lib-v1", 1)
+	s.assertTreeNode(c, tree[0].Children[0], "test/base-v1", 0)
+	c.Assert(tree[0].Children[0].Dependency.BuildScope, Equals, true)
+	c.Assert(tree[0].Children[0].Dependency.DeployScope, Equals, false)
+	s.assertTreeNode(c, tree[1], "test/base-v1", 0)
+	s.assertTreeNode(c, tree[2], "other/ext-v2", 0)
+	c.Assert(tree[2].Dependency.IsExtension, Equals, true)
+}
+
+func (s *dependencySuite) Test_GetDependencyTree_is_empty_without_dependencies(c *C) {
+	s.addRelease(c, "base", "1", ``)
+	tree, err := GetDependencyTree("test", "base", "v1")
+	c.Assert(err, IsNil)
+	c.Assert(tree, HasLen, 0)
+}
+
+func (s *dependencySuite) Test_GetDependencyTree_fails_if_release_doesnt_exist(c *C) {
+	_, err := GetDependencyTree("test", "app", "v1")
+	c.Assert(dao.IsNotFound(err), Equals, true)
+}
+
+func (s *dependencySuite) Test_Registering_missing_upstream_updates_downstream_trees(c *C) {
+	s.addRelease(c, "base", "1", ``)
+	s.addRelease(c, "app", "1", `{"release_id": "test/lib-v1"}`)
+	s.addRelease(c, "site", "1", `{"release_id": "test/app-v1"}`)
+
+	tree, err := GetDependencyTree("test", "site", "v1")
+	c.Assert(err, IsNil)
+	c.Assert(tree, HasLen, 1)
+	s.assertTreeNode(c, tree[0], "test/app-v1", 1)
+	s.assertTreeNode(c, tree[0].Children[0], "test/lib-v1", 0)
+
+	s.addRelease(c, "lib", "1", `{"release_id": "test/base-v1"}`)
+
+	tree, err = GetDependencyTree("test", "app", "v1")
+	c.Assert(err, IsNil)
+	c.Assert(tree, HasLen, 1)
+	s.assertTreeNode(c, tree[0], "test/lib-v1", 1)
+	s.assertTreeNode(c, tree[0].Children[0], "test/base-v1", 0)
+
+	tree, err = GetDependencyTree("test", "site", "v1")
+	c.Assert(err, IsNil)
+	c.Assert(tree, HasLen, 1)
+	s.assertTreeNode(c, tree[0], "test/app-v1", 1)
+	s.assertTreeNode(c, tree[0].Children[0], "test/lib-v1", 1)
+	s.assertTreeNode(c, tree[0].Children[0].Children[0], "test/base-v1", 0)
+}
+
+func (s *dependencySuite) Test_GetDependencyTree_stops_at_cycles(c *C) {
+	s.addRelease(c, "app", "1", `{"release_id": "test/lib-v1"}`)
+	s.addRelease(c, "lib", "1", `{"release_id": "test/app-v1"}`)
+
+	tree, err := GetDependencyTree("test", "app", "v1")
+	c.Assert(err, IsNil)
+	c.Assert(tree, HasLen, 1)
+	s.assertTreeNode(c, tree[0], "test/lib-v1", 1)
+	s.assertTreeNode(c, tree[0].Children[0], "test/app-v1", 0)
+
+	tree, err = GetDependencyTree("test", "lib", "v1")
+	c.Assert(err, IsNil)
+	c.Assert(tree, HasLen, 1)
+	s.assertTreeNode(c, tree[0], "test/app-v1", 1)
+	s.assertTreeNode(c, tree[0].Children[0], "test/lib-v1", 0)
+}
+
+// Every layer depends on both releases in the layer below it, so the full tree
+// doubles in size with every layer.
+func (s *dependencySuite) addDiamonds(c *C, layers int) {
+	s.addRelease(c, "layer0-a", "1", ``)
+	s.addRelease(c, "layer0-b", "1", ``)
+	for i := 1; i < layers; i++ {
+		depends := fmt.Sprintf(`{"release_id": "test/layer%d-a-v1"}, {"release_id": "test/layer%d-b-v1"}`, i-1, i-1)
+		s.addRelease(c, fmt.Sprintf("layer%d-a", i), "1", depends)
+		s.addRelease(c, fmt.Sprintf("layer%d-b", i), "1", depends)
+	}
+}
+
+func countTreeNodes(trees []*types.DependencyTree) (int, int) {
+	nodes, truncated := 0, 0
+	for _, tree := range trees {
+		nodes += 1
+		if tree.Truncated {
+			truncated += 1
+		}
+		n, t := countTreeNodes(tree.Children)
+		nodes += n
+		truncated += t
+	}
+	return nodes, truncated
+}
+
+func (s *dependencySuite) Test_GetDependencyTree_expands_shared_subtrees(c *C) {
+	s.addDiamonds(c, 4)
+	tree, err := GetDependencyTree("test", "layer3-a", "v1")
+	c.Assert(err, IsNil)
+	nodes, truncated := countTreeNodes(tree)
+	c.Assert(nodes, Equals, 2+4+8)
+	c.Assert(truncated, Equals, 0)
+	c.Assert(tree[0].Children, DeepEquals, tree[1].Children)
+}
+
+func (s *dependencySuite) Test_GetDependencyTree_is_truncated_if_too_large(c *C) {
+	s.addDiamonds(c, 20)
+	tree, err := GetDependencyTree("test", "layer19-a", "v1")
+	c.Assert(err, IsNil)
+	nodes, truncated := countTreeNodes(tree)
+	c.Assert(nodes <= maxDependencyTreeSize, Equals, true)
+	c.Assert(truncated > 0, Equals, true)
+	c.Assert(tree, HasLen, 2)
+	s.assertTreeNode(c, tree[0], "test/layer18-a-v1", 2)
+}
+
+func (s *dependencySuite) Test_Draft_upstream_releases_are_leaves(c *C) {
+	_, err := AddDraftReleaseByUser("test", `{"name": "lib", "version": "1", "project": "test", "depends": [{"release_id": "test/base-v1"}]}`, "")
+	c.Assert(err, IsNil)
+	s.addRelease(c, "app", "1", `{"release_id": "test/lib-v1"}`)
+
+	tree, err := GetDependencyTree("test", "app", "v1")
+	c.Assert(err, IsNil)
+	c.Assert(tree, HasLen, 1)
+	s.assertTreeNode(c, tree[0], "test/lib-v1", 0)
+}
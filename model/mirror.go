@@ -0,0 +1,405 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	core "github.com/ankyra/escape-core"
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+)
+
+// Namespaces that are mirrored from an upstream Escape Inventory. Metadata
+// and packages that can't be found locally are fetched from the upstream
+// inventory and cached, so that they're still available when the upstream
+// can't be reached.
+var mirrors = map[string]*upstreamInventory{}
+
+// Requests to an upstream inventory, including package downloads, are given
+// up on after this time, so that an unresponsive upstream doesn't hold up
+// requests forever.
+const upstreamTimeout = 10 * time.Minute
+
+type upstreamInventory struct {
+	URL    *url.URL
+	Client *http.Client
+
+	// Serialises metadata fetches, so that concurrent misses don't import the
+	// same releases twice.
+	lock sync.Mutex
+
+	// Serialises package fetches per release, so that a package is only
+	// downloaded once without holding up other releases.
+	packageLocks      map[string]*sync.Mutex
+	packageLocksMutex sync.Mutex
+}
+
+// Configures the mirrored namespaces. The upstream URL can contain basic
+// authentication credentials.
+func InitMirrors(upstreams map[string]string) error {
+	result := map[string]*upstreamInventory{}
+	for namespace, upstreamURL := range upstreams {
+		if err := core.ValidateProjectName(namespace); err != nil {
+			return fmt.Errorf("Invalid mirrored namespace '%s': %s", namespace, err.Error())
+		}
+		u, err := url.Parse(upstreamURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Invalid upstream inventory URL for mirrored namespace '%s'", namespace)
+		}
+		result[namespace] = &upstreamInventory{
+			URL:    u,
+			Client: &http.Client{Timeout: upstreamTimeout},
+		}
+	}
+	mirrors = result
+	return nil
+}
+
+func isMirrored(namespace string) bool {
+	_, ok := mirrors[namespace]
+	return ok
+}
+
+func isMirrorMiss(namespace string, err error) bool {
+	return dao.IsNotFound(err) && isMirrored(namespace)
+}
+
+// Fetches the namespace and its units from upstream.
+func mirrorNamespace(namespace string) (*types.Project, error) {
+	upstream := mirrors[namespace]
+	upstream.lock.Lock()
+	defer upstream.lock.Unlock()
+	if _, err := upstream.importNamespace(namespace); err != nil {
+		return nil, err
+	}
+	return dao.GetNamespace(namespace)
+}
+
+// Fetches the releases of the application that aren't available locally yet.
+func mirrorApplication(namespace, name string) error {
+	upstream := mirrors[namespace]
+	upstream.lock.Lock()
+	defer upstream.lock.Unlock()
+	_, err := upstream.importApplication(namespace, name)
+	return err
+}
+
+// Fetches the release's package from upstream and stores it in the configured
+// storage backends. Returns the package's URIs.
+func (s *storageProvider) mirrorPackage(namespace string, release *types.Release) ([]string, error) {
+	upstream := mirrors[namespace]
+	lock := upstream.packageLock(release.ReleaseId)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Another request could've fetched the package while we were waiting.
+	uris, err := dao.GetPackageURIs(release)
+	if err != nil || len(uris) > 0 {
+		return uris, err
+	}
+	tmp, err := ioutil.TempFile("", "escape-inventory-mirror")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	resp, err := upstream.get(upstream.releasePath(namespace, release.Application.Name, release.Version) + "download")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(tmp, NewPackageReader(resp.Body, release.PackageSHA256, release.PackageSize)); err != nil {
+		return nil, fmt.Errorf("Failed to download '%s/%s' from upstream: %s", namespace, release.ReleaseId, err.Error())
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := s.UploadPackage(namespace, release.ReleaseId, tmp); err != nil {
+		return nil, err
+	}
+	return dao.GetPackageURIs(release)
+}
+
+func (u *upstreamInventory) packageLock(releaseId string) *sync.Mutex {
+	u.packageLocksMutex.Lock()
+	defer u.packageLocksMutex.Unlock()
+	if u.packageLocks == nil {
+		u.packageLocks = map[string]*sync.Mutex{}
+	}
+	lock, ok := u.packageLocks[releaseId]
+	if !ok {
+		lock = &sync.Mutex{}
+		u.packageLocks[releaseId] = lock
+	}
+	return lock
+}
+
+// Synchronises the mirrored namespaces with their upstream inventories.
+// Releases that were added upstream are imported; their packages are still
+// fetched on first download. With Namespace set only that namespace is
+// synchronised.
+type MirrorSync struct {
+	Namespace string `json:"namespace"`
+}
+
+func SyncMirrors(mirrorSync *MirrorSync, progress io.Writer) error {
+	namespaces := []string{}
+	if mirrorSync.Namespace != "" {
+		if !isMirrored(mirrorSync.Namespace) {
+			return NewUserError(fmt.Errorf("Namespace '%s' is not mirrored", mirrorSync.Namespace))
+		}
+		namespaces = append(namespaces, mirrorSync.Namespace)
+	} else {
+		for namespace := range mirrors {
+			namespaces = append(namespaces, namespace)
+		}
+		sort.Strings(namespaces)
+	}
+	imported, failed := 0, 0
+	for _, namespace := range namespaces {
+		n, err := syncNamespace(namespace, progress)
+		imported += n
+		if err != nil {
+			failed += 1
+			log.Printf("Error: Failed to synchronise mirrored namespace '%s': %s\n", namespace, err.Error())
+			fmt.Fprintf(progress, "%s: failed to synchronise: %s\n", namespace, err.Error())
+		}
+	}
+	fmt.Fprintf(progress, "Imported %d releases from %d namespaces, %d errors.\n", imported, len(namespaces), failed)
+	if failed > 0 {
+		return fmt.Errorf("Mirror sync failed with %d errors", failed)
+	}
+	return nil
+}
+
+// Runs SyncMirrors in the background every interval.
+func StartMirrorSync(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := SyncMirrors(&MirrorSync{}, ioutil.Discard); err != nil {
+				log.Printf("Error: %s\n", err.Error())
+			}
+		}
+	}()
+}
+
+func syncNamespace(namespace string, progress io.Writer) (int, error) {
+	upstream := mirrors[namespace]
+	upstream.lock.Lock()
+	defer upstream.lock.Unlock()
+	units, err := upstream.importNamespace(namespace)
+	if err != nil {
+		return 0, err
+	}
+	imported := 0
+	for _, name := range units {
+		n, err := upstream.importApplication(namespace, name)
+		imported += n
+		if err != nil {
+			return imported, err
+		}
+		if n > 0 {
+			fmt.Fprintf(progress, "%s/%s: imported %d releases\n", namespace, name, n)
+		}
+	}
+	return imported, nil
+}
+
+// Adds the namespace and any missing units. Units that already exist locally
+// are left alone, because they're updated when their releases are imported.
+// Returns the names of the upstream units.
+func (u *upstreamInventory) importNamespace(namespace string) ([]string, error) {
+	payload := NamespacePayload{}
+	if err := u.getJSON("/api/v1/inventory/"+url.PathEscape(namespace)+"/", &payload); err != nil {
+		return nil, err
+	}
+	if payload.Project == nil {
+		return nil, fmt.Errorf("Upstream inventory returned an invalid namespace '%s'", namespace)
+	}
+	prj := &types.Project{
+		Name:        namespace,
+		Description: payload.Description,
+		OrgURL:      payload.OrgURL,
+		Logo:        payload.Logo,
+		IsPublic:    payload.IsPublic,
+	}
+	if err := dao.AddNamespace(prj); err != nil && !dao.IsAlreadyExists(err) {
+		return nil, err
+	}
+	names := []string{}
+	for name, unit := range payload.Units {
+		names = append(names, name)
+		if _, err := dao.GetApplication(namespace, name); err == nil {
+			continue
+		} else if !dao.IsNotFound(err) {
+			return nil, err
+		}
+		app := types.NewApplication(namespace, name)
+		app.Description = unit.Description
+		app.Logo = unit.Logo
+		if err := dao.AddApplication(app); err != nil && !dao.IsAlreadyExists(err) {
+			return nil, err
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Imports the application's releases that aren't available locally, oldest
+// first so that the application ends up with the right latest version.
+// Returns the number of imported releases.
+func (u *upstreamInventory) importApplication(namespace, name string) (int, error) {
+	if _, err := dao.GetNamespace(namespace); dao.IsNotFound(err) {
+		if _, err := u.importNamespace(namespace); err != nil {
+			return 0, err
+		}
+	} else if err != nil {
+		return 0, err
+	}
+	versions := []string{}
+	if err := u.getJSON("/api/v1/inventory/"+url.PathEscape(namespace)+"/units/"+url.PathEscape(name)+"/versions/", &versions); err != nil {
+		return 0, err
+	}
+	local, err := localVersions(namespace, name)
+	if err != nil {
+		return 0, err
+	}
+	sortVersions(versions)
+	imported := 0
+	for _, version := range versions {
+		if local[version] {
+			continue
+		}
+		if err := u.importRelease(namespace, name, version); err != nil {
+			return imported, err
+		}
+		imported += 1
+	}
+	return imported, nil
+}
+
+// Drafts are included, because they can't be overwritten by an import.
+func localVersions(namespace, name string) (map[string]bool, error) {
+	result := map[string]bool{}
+	app, err := dao.GetApplication(namespace, name)
+	if dao.IsNotFound(err) {
+		return result, nil
+	} else if err != nil {
+		return nil, err
+	}
+	versions, err := dao.FindAllVersions(app)
+	if err != nil {
+		return nil, err
+	}
+	drafts, err := dao.FindAllDraftVersions(app)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range append(versions, drafts...) {
+		result[version] = true
+	}
+	return result, nil
+}
+
+type upstreamRelease struct {
+	Release       json.RawMessage `json:"release"`
+	UploadedBy    string          `json:"uploaded_by"`
+	UploadedAt    time.Time       `json:"uploaded_at"`
+	PackageSHA256 string          `json:"package_sha256"`
+	PackageSize   int64           `json:"package_size"`
+}
+
+// Keeps the package checksum of the upstream release, so that the package can
+// be verified when it's fetched.
+func (u *upstreamInventory) importRelease(namespace, name, version string) error {
+	payload := upstreamRelease{}
+	if err := u.getJSON(u.releasePath(namespace, name, version)+"?full=true", &payload); err != nil {
+		return err
+	}
+	metadata, err := core.NewReleaseMetadataFromJsonString(string(payload.Release))
+	if err != nil {
+		return fmt.Errorf("Upstream inventory returned invalid metadata for '%s/%s-v%s': %s", namespace, name, version, err.Error())
+	}
+	if metadata.Name != name || metadata.Version != version {
+		return fmt.Errorf("Upstream inventory returned release '%s' instead of '%s-v%s'", metadata.GetReleaseId(), name, version)
+	}
+	release := types.NewRelease(types.NewApplication(namespace, name), metadata)
+	release.UploadedBy = payload.UploadedBy
+	release.UploadedAt = payload.UploadedAt
+	release.PackageSHA256 = payload.PackageSHA256
+	release.PackageSize = payload.PackageSize
+	return dao.RunInTransaction(func(tx types.DAO) error {
+		return registerImportedRelease(tx, namespace, release)
+	})
+}
+
+func (u *upstreamInventory) releasePath(namespace, name, version string) string {
+	return "/api/v1/inventory/" + url.PathEscape(namespace) + "/units/" + url.PathEscape(name) + "/versions/v" + url.PathEscape(version) + "/"
+}
+
+func (u *upstreamInventory) getJSON(path string, result interface{}) error {
+	resp, err := u.get(path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("Upstream inventory returned invalid JSON for '%s': %s", path, err.Error())
+	}
+	return nil
+}
+
+// Returns NotFound if the upstream inventory doesn't have the resource
+// either. The credentials in the upstream URL are never included in errors.
+func (u *upstreamInventory) get(path string) (*http.Response, error) {
+	target := *u.URL
+	target.User = nil
+	req, err := http.NewRequest("GET", strings.TrimRight(target.String(), "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if u.URL.User != nil {
+		password, _ := u.URL.User.Password()
+		req.SetBasicAuth(u.URL.User.Username(), password)
+	}
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't reach upstream inventory: %s", err.Error())
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, types.NotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Upstream inventory '%s' returned status code %d for '%s'", target.Host, resp.StatusCode, path)
+	}
+	return resp, nil
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/ankyra/escape-inventory/dao"
+	. "gopkg.in/check.v1"
+)
+
+func (s *suite) Test_InitMirrors_validates_configuration(c *C) {
+	defer InitMirrors(nil)
+	c.Assert(InitMirrors(map[string]string{"escape": "https://inventory.example.com"}), IsNil)
+	c.Assert(isMirrored("escape"), Equals, true)
+	c.Assert(isMirrored("other"), Equals, false)
+	c.Assert(mirrors["escape"].Client.Timeout, Equals, upstreamTimeout)
+
+	err := InitMirrors(map[string]string{"escape": "ftp://secret@inventory.example.com"})
+	c.Assert(err, ErrorMatches, "Invalid upstream inventory URL for mirrored namespace 'escape'")
+	err = InitMirrors(map[string]string{"Not Valid": "https://inventory.example.com"})
+	c.Assert(err, ErrorMatches, "Invalid mirrored namespace 'Not Valid'.*")
+}
+
+func (s *suite) Test_upstreamInventory_locks_packages_per_release(c *C) {
+	upstream := &upstreamInventory{}
+	c.Assert(upstream.packageLock("name-v1"), Equals, upstream.packageLock("name-v1"))
+	c.Assert(upstream.packageLock("name-v1"), Not(Equals), upstream.packageLock("name-v2"))
+
+	// Fetching one package doesn't hold up metadata fetches or other packages.
+	lock := upstream.packageLock("name-v1")
+	lock.Lock()
+	defer lock.Unlock()
+	upstream.lock.Lock()
+	upstream.lock.Unlock()
+	other := upstream.packageLock("name-v2")
+	other.Lock()
+	other.Unlock()
+}
+
+func (s *suite) Test_GetNamespace_doesnt_fetch_unmirrored_namespaces(c *C) {
+	defer InitMirrors(nil)
+	c.Assert(InitMirrors(map[string]string{"escape": "http://localhost:1"}), IsNil)
+	_, err := GetNamespace("other")
+	c.Assert(dao.IsNotFound(err), Equals, true)
+}
+
+func (s *suite) Test_GetNamespace_doesnt_leak_upstream_credentials(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ := r.BasicAuth()
+		c.Assert(username, Equals, "escape")
+		c.Assert(password, Equals, "secret")
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	defer InitMirrors(nil)
+	c.Assert(InitMirrors(map[string]string{"escape": "http://escape:secret@" + server.Listener.Addr().String() + "/"}), IsNil)
+	_, err := GetNamespace("escape")
+	c.Assert(err, ErrorMatches, "Upstream inventory '.*' returned status code 401 for '/api/v1/inventory/escape/'")
+	c.Assert(err, Not(ErrorMatches), ".*secret.*")
+}
+
+func (s *suite) Test_SyncMirrors_fails_if_namespace_is_not_mirrored(c *C) {
+	progress := bytes.NewBuffer(nil)
+	err := SyncMirrors(&MirrorSync{Namespace: "escape"}, progress)
+	c.Assert(IsUserError(err), Equals, true)
+	c.Assert(err, ErrorMatches, "Namespace 'escape' is not mirrored")
+}
@@ -31,6 +31,9 @@ type NamespacePayload struct {
 
 func GetNamespace(namespace string) (*NamespacePayload, error) {
 	prj, err := dao.GetNamespace(namespace)
+	if isMirrorMiss(namespace, err) {
+		prj, err = mirrorNamespace(namespace)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -62,6 +65,14 @@ func AddNamespace(p *types.Project, username string) error {
 	return dao.AddNamespace(p)
 }
 
+// Everything in the namespace is removed in one transaction, so that a failure
+// doesn't leave a partially deleted namespace behind.
+func HardDeleteNamespace(namespace string) error {
+	return dao.RunInTransaction(func(tx types.DAO) error {
+		return tx.HardDeleteNamespace(namespace)
+	})
+}
+
 func UpdateNamespace(p *types.Project) error {
 	if p.Name == "" {
 		return NewUserError(fmt.Errorf("Missing name"))
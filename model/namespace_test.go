@@ -53,3 +53,17 @@ func (s *suite) Test_AddNamespace_fails_with_invalid_namespace_name(c *C) {
 		c.Assert(AddNamespace(p, "username"), DeepEquals, NewUserError(fmt.Errorf("Invalid name '%s'", name)))
 	}
 }
+
+func (s *suite) Test_HardDeleteNamespace(c *C) {
+	_, err := AddRelease("delete-me", `{"name": "app", "version": "1", "project": "delete-me"}`)
+	c.Assert(err, IsNil)
+	c.Assert(HardDeleteNamespace("delete-me"), IsNil)
+	_, err = dao.GetNamespace("delete-me")
+	c.Assert(dao.IsNotFound(err), Equals, true)
+	_, err = dao.GetApplication("delete-me", "app")
+	c.Assert(dao.IsNotFound(err), Equals, true)
+}
+
+func (s *suite) Test_HardDeleteNamespace_fails_if_namespace_doesnt_exist(c *C) {
+	c.Assert(dao.IsNotFound(HardDeleteNamespace("delete-me")), Equals, true)
+}
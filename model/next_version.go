@@ -17,6 +17,7 @@ limitations under the License.
 package model
 
 import (
+	"sort"
 	"strings"
 
 	core "github.com/ankyra/escape-core"
@@ -24,7 +25,9 @@ import (
 )
 
 func GetNextVersion(namespace, app, prefix string) (string, error) {
-	latest, err := getLastVersionForPrefix(namespace, app, prefix)
+	// Drafts are included so that the next version doesn't clash with a
+	// release that's still waiting to be published.
+	latest, err := getLastVersionForPrefixIncludingDrafts(namespace, app, prefix)
 	if err != nil {
 		if dao.IsNotFound(err) {
 			return prefix + "0", nil
@@ -40,6 +43,14 @@ func GetNextVersion(namespace, app, prefix string) (string, error) {
 }
 
 func getLastVersionForPrefix(namespace, appName, prefix string) (*core.SemanticVersion, error) {
+	return getLastVersion(namespace, appName, prefix, false)
+}
+
+func getLastVersionForPrefixIncludingDrafts(namespace, appName, prefix string) (*core.SemanticVersion, error) {
+	return getLastVersion(namespace, appName, prefix, true)
+}
+
+func getLastVersion(namespace, appName, prefix string, includeDrafts bool) (*core.SemanticVersion, error) {
 	app, err := dao.GetApplication(namespace, appName)
 	if err != nil {
 		return nil, NewUserError(err)
@@ -48,9 +59,62 @@ func getLastVersionForPrefix(namespace, appName, prefix string) (*core.SemanticV
 	if err != nil {
 		return nil, err
 	}
+	if includeDrafts {
+		drafts, err := dao.FindAllDraftVersions(app)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, drafts...)
+	}
 	return getMaxFromVersions(versions, prefix), nil
 }
 
+// Like getLastVersionForPrefix, but skips releases that don't have a package
+// yet, so that "latest" never resolves to a release that can't be downloaded.
+// The packages of mirrored namespaces are fetched from upstream on demand, so
+// all their releases count.
+func getLastDownloadableVersionForPrefix(namespace, appName, prefix string) (*core.SemanticVersion, error) {
+	if isMirrored(namespace) {
+		return getLastVersionForPrefix(namespace, appName, prefix)
+	}
+	app, err := dao.GetApplication(namespace, appName)
+	if err != nil {
+		return nil, NewUserError(err)
+	}
+	versions, err := dao.FindAllVersions(app)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []string{}
+	for _, v := range versions {
+		if strings.HasPrefix(v, prefix) {
+			candidates = append(candidates, v)
+		}
+	}
+	sortVersions(candidates)
+	for i := len(candidates) - 1; i >= 0; i-- {
+		release, err := dao.GetRelease(namespace, appName, appName+"-v"+candidates[i])
+		if err != nil {
+			return nil, err
+		}
+		uris, err := dao.GetPackageURIs(release)
+		if err != nil {
+			return nil, err
+		}
+		if len(uris) > 0 {
+			return getMaxFromVersions(candidates[i:i+1], prefix), nil
+		}
+	}
+	return getMaxFromVersions(nil, prefix), nil
+}
+
+// Sorts the versions from oldest to newest.
+func sortVersions(versions []string) {
+	sort.Slice(versions, func(i, j int) bool {
+		return !core.NewSemanticVersion(versions[j]).LessOrEqual(core.NewSemanticVersion(versions[i]))
+	})
+}
+
 func getMaxFromVersions(versions []string, prefix string) *core.SemanticVersion {
 	current := core.NewSemanticVersion("-1")
 	for _, v := range versions {
@@ -19,12 +19,18 @@ package model
 import (
 	"testing"
 
+	"github.com/ankyra/escape-inventory/storage"
 	. "gopkg.in/check.v1"
 )
 
 type appSuite struct{}
 
-func Test(t *testing.T) { TestingT(t) }
+// Packages are stored in memory, so that the tests don't write them into the
+// source tree.
+func Test(t *testing.T) {
+	storage.TestSetup()
+	TestingT(t)
+}
 
 var _ = Suite(&appSuite{})
 
@@ -17,9 +17,14 @@ limitations under the License.
 package model
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/ankyra/escape-core/parsers"
 	"github.com/ankyra/escape-inventory/dao"
@@ -28,26 +33,54 @@ import (
 )
 
 type storageProvider struct {
-	Upload   func(namespace, releaseId string, pkg io.ReadSeeker) (string, error)
-	Download func(namespace, uri string) (io.Reader, error)
+	Upload             func(namespace, releaseId string, pkg io.Reader) ([]string, error)
+	StoreArtifact      func(namespace, releaseId, artifact string, pkg io.Reader) ([]string, error)
+	UploadTo           func(backend, namespace, releaseId string, pkg io.Reader) (string, error)
+	StoreArtifactTo    func(backend, namespace, releaseId, artifact string, pkg io.Reader) (string, error)
+	Download           func(namespace, uri string) (io.ReadSeekCloser, error)
+	Stat               func(namespace, uri string) (int64, time.Time, error)
+	ListPackages       func(backend string) ([]string, error)
+	DeletePackage      func(namespace, uri string) error
+	IsConfigured       func(backend string) bool
+	ConfiguredBackends func() []string
+	EncryptionEnabled  func() bool
+	NeedsReencryption  func(namespace, uri string) (bool, error)
 }
 
 func newStorageProvider() *storageProvider {
 	return &storageProvider{
-		Upload:   storage.Upload,
-		Download: storage.Download,
+		Upload:             storage.Upload,
+		StoreArtifact:      storage.UploadArtifact,
+		UploadTo:           storage.UploadTo,
+		StoreArtifactTo:    storage.UploadArtifactTo,
+		Download:           storage.Download,
+		Stat:               storage.Stat,
+		ListPackages:       storage.ListPackages,
+		DeletePackage:      storage.DeletePackage,
+		IsConfigured:       storage.IsConfigured,
+		ConfiguredBackends: storage.ConfiguredBackends,
+		EncryptionEnabled:  storage.EncryptionEnabled,
+		NeedsReencryption:  storage.NeedsReencryption,
 	}
 }
 
-func UploadPackage(namespace, releaseId string, pkg io.ReadSeeker) error {
+// Uploads the package to the configured storage backends. Packages that can
+// be seeked are checked against previous uploads before they're stored; other
+// packages are streamed to the backends straight away, which is only allowed
+// if the release doesn't have a package yet.
+func UploadPackage(namespace, releaseId string, pkg io.Reader) error {
 	return newStorageProvider().UploadPackage(namespace, releaseId, pkg)
 }
 
-func GetDownloadReadSeeker(namespace, application, versionQuery string) (io.Reader, error) {
+func GetDownloadReadSeeker(namespace, application, versionQuery string) (*PackageReader, error) {
 	return newStorageProvider().GetDownloadReadSeeker(namespace, application, versionQuery)
 }
 
-func (s *storageProvider) UploadPackage(namespace, releaseId string, pkg io.ReadSeeker) error {
+func (s *storageProvider) UploadPackage(namespace, releaseId string, pkg io.Reader) error {
+	return s.uploadPackage(namespace, releaseId, pkg, "")
+}
+
+func (s *storageProvider) uploadPackage(namespace, releaseId string, pkg io.Reader, expectedChecksum string) error {
 	parsed, err := parsers.ParseReleaseId(releaseId)
 	if err != nil {
 		return NewUserError(err)
@@ -55,35 +88,316 @@ func (s *storageProvider) UploadPackage(namespace, releaseId string, pkg io.Read
 	if parsed.NeedsResolving() {
 		return NewUserError(fmt.Errorf("Can't upload package against unresolved version '%s/%s'", namespace, releaseId))
 	}
-	release, err := dao.GetRelease(namespace, parsed.Name, releaseId)
+	lock := releaseLock(namespace, releaseId)
+	lock.Lock()
+	defer lock.Unlock()
+	return s.storePackage(namespace, parsed.Name, releaseId, pkg, expectedChecksum)
+}
+
+// Checks, stores and registers the package. The caller holds the release
+// lock.
+func (s *storageProvider) storePackage(namespace, name, releaseId string, pkg io.Reader, expectedChecksum string) error {
+	release, err := dao.GetRelease(namespace, name, releaseId)
 	if err != nil {
 		return NewUserError(err)
 	}
-	uri, err := s.Upload(namespace, releaseId, pkg)
+	hasher := newPackageHasher()
+	var verifier *packageStreamVerifier
+	if seeker, ok := pkg.(io.ReadSeeker); ok {
+		if err := verifyPackage(seeker, release); err != nil {
+			return err
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := hasher.ReadFrom(seeker); err != nil {
+			return err
+		}
+		if err := hasher.Verify(expectedChecksum); err != nil {
+			return err
+		}
+		if release.PackageSHA256 != "" && release.PackageSHA256 != hasher.SHA256() {
+			return NewUserError(fmt.Errorf("A package with a different checksum has already been uploaded for '%s/%s'", namespace, releaseId))
+		}
+	} else if release.PackageSHA256 != "" {
+		return types.AlreadyExists
+	} else {
+		verifier = newPackageStreamVerifier(release)
+		pkg = io.TeeReader(pkg, io.MultiWriter(hasher, verifier))
+	}
+	uris, err := s.Upload(namespace, releaseId, pkg)
+	if verifier != nil {
+		verifyErr := verifier.Wait()
+		if err == nil && verifyErr != nil {
+			s.deleteUploads(namespace, uris)
+			return verifyErr
+		}
+	}
 	if err != nil {
+		// Copies that replace a registered package are still in use.
+		if registered, getErr := dao.GetPackageURIs(release); getErr == nil {
+			s.deleteUploads(namespace, unregisteredURIs(uris, registered))
+		}
 		return err
 	}
-	return dao.AddPackageURI(release, uri)
+	if err := hasher.Verify(expectedChecksum); err != nil {
+		return err
+	}
+	return dao.RunInTransaction(func(tx types.DAO) error {
+		release, err := tx.GetRelease(namespace, name, releaseId)
+		if err != nil {
+			return err
+		}
+		registered, err := tx.GetPackageURIs(release)
+		if err != nil {
+			return err
+		}
+		added := unregisteredURIs(uris, registered)
+		if len(added) == 0 {
+			return types.AlreadyExists
+		}
+		for _, uri := range added {
+			if err := tx.AddPackageURI(release, uri); err != nil {
+				return err
+			}
+		}
+		release.PackageSHA256 = hasher.SHA256()
+		release.PackageSize = hasher.Size
+		return tx.UpdateRelease(release)
+	})
+}
+
+var releaseLocks = map[string]*sync.Mutex{}
+var releaseLocksMutex sync.Mutex
+
+// Packages are stored under a key that's derived from the release, so
+// concurrent uploads for the same release would overwrite each other's files
+// before either of them is registered. Checking, storing and registering a
+// package therefore happens under this lock.
+func releaseLock(namespace, releaseId string) *sync.Mutex {
+	releaseLocksMutex.Lock()
+	defer releaseLocksMutex.Unlock()
+	key := namespace + "/" + releaseId
+	lock, ok := releaseLocks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		releaseLocks[key] = lock
+	}
+	return lock
 }
 
-func (s *storageProvider) GetDownloadReadSeeker(namespace, application, versionQuery string) (io.Reader, error) {
+// Removes packages that were stored but turned out to be invalid, or whose
+// release couldn't be registered. They haven't been registered yet, so
+// failures are only logged; the storage check picks up whatever is left
+// behind.
+func (s *storageProvider) deleteUploads(namespace string, uris []string) {
+	if s.DeletePackage == nil {
+		return
+	}
+	for _, uri := range uris {
+		if err := s.DeletePackage(namespace, uri); err != nil {
+			log.Printf("Warn: Failed to delete invalid package '%s': %s\n", uri, err.Error())
+		}
+	}
+}
+
+func unregisteredURIs(uris, registered []string) []string {
+	isRegistered := map[string]bool{}
+	for _, uri := range registered {
+		isRegistered[uri] = true
+	}
+	result := []string{}
+	for _, uri := range uris {
+		if !isRegistered[uri] {
+			result = append(result, uri)
+		}
+	}
+	return result
+}
+
+func (s *storageProvider) GetDownloadReadSeeker(namespace, application, versionQuery string) (*PackageReader, error) {
 	release, err := ResolveReleaseId(namespace, application, versionQuery)
 	if err != nil {
 		return nil, err
 	}
 	uris, err := dao.GetPackageURIs(release)
+	if err == nil && len(uris) == 0 && isMirrored(namespace) {
+		uris, err = s.mirrorPackage(namespace, release)
+	}
 	if err != nil {
 		return nil, err
 	}
+	return s.openPackage(namespace, release, uris, release.PackageSHA256, release.PackageSize)
+}
+
+// Opens the first of the URIs that can be downloaded, trying the preferred
+// storage backends first.
+func (s *storageProvider) openPackage(namespace string, release *types.Release, uris []string, checksum string, size int64) (*PackageReader, error) {
+	uris = storage.SortURIsByPreference(uris)
 	lastError := types.NotFound
 	for _, uri := range uris {
 		reader, err := s.Download(namespace, uri)
-		if err == nil {
-			release.Downloads += 1
-			return reader, dao.UpdateRelease(release)
+		if err != nil {
+			lastError = err
+			log.Printf("Warn: %s\n", err.Error())
+			continue
+		}
+		pkg := NewPackageReader(reader, checksum, size)
+		pkg.release = release
+		if s.Stat != nil {
+			if _, modTime, err := s.Stat(namespace, uri); err == nil {
+				pkg.ModTime = modTime
+			} else {
+				log.Printf("Warn: %s\n", err.Error())
+			}
 		}
-		lastError = err
-		log.Printf("Warn: %s\n", err.Error())
+		return pkg, nil
 	}
 	return nil, lastError
 }
+
+type packageHasher struct {
+	hash hash.Hash
+	Size int64
+}
+
+func newPackageHasher() *packageHasher {
+	return &packageHasher{
+		hash: sha256.New(),
+	}
+}
+
+func (p *packageHasher) Write(b []byte) (int, error) {
+	p.Size += int64(len(b))
+	return p.hash.Write(b)
+}
+
+// Hashes the whole package and seeks back to the start.
+func (p *packageHasher) ReadFrom(pkg io.ReadSeeker) error {
+	if _, err := io.Copy(p, pkg); err != nil {
+		return err
+	}
+	_, err := pkg.Seek(0, io.SeekStart)
+	return err
+}
+
+func (p *packageHasher) SHA256() string {
+	return hex.EncodeToString(p.hash.Sum(nil))
+}
+
+func (p *packageHasher) Verify(expectedChecksum string) error {
+	if expectedChecksum != "" && expectedChecksum != p.SHA256() {
+		return NewUserError(fmt.Errorf("Package checksum mismatch: expecting sha256 %s, got %s", expectedChecksum, p.SHA256()))
+	}
+	return nil
+}
+
+// PackageReader streams a package from a storage backend and verifies it
+// against the checksum and size that were recorded when it was uploaded.
+// The bytes that complete the package are only returned after they've been
+// verified, so a corrupted package never reaches the client in full.
+//
+// Only packages that are read from start to end can be verified. Seeking
+// anywhere else, to serve a Range request for instance, turns verification
+// off until the reader is seeked back to the start.
+//
+// Packages uploaded before checksums were recorded have an empty SHA256 and
+// are passed through as is.
+type PackageReader struct {
+	SHA256   string
+	Size     int64
+	ModTime  time.Time
+	reader   io.Reader
+	release  *types.Release
+	hash     hash.Hash
+	read     int64
+	partial  bool
+	verified bool
+	err      error
+}
+
+func NewPackageReader(reader io.Reader, checksum string, size int64) *PackageReader {
+	return &PackageReader{
+		SHA256: checksum,
+		Size:   size,
+		reader: reader,
+		hash:   sha256.New(),
+	}
+}
+
+func (p *PackageReader) Read(b []byte) (int, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+	n, err := p.reader.Read(b)
+	if p.SHA256 == "" || p.partial {
+		return n, err
+	}
+	p.hash.Write(b[:n])
+	p.read += int64(n)
+	if p.read > p.Size {
+		p.err = fmt.Errorf("Package size mismatch: expecting %d bytes, got more", p.Size)
+		return 0, p.err
+	}
+	if p.read == p.Size && !p.verified {
+		p.verified = true
+		if checksum := hex.EncodeToString(p.hash.Sum(nil)); checksum != p.SHA256 {
+			p.err = fmt.Errorf("Package checksum mismatch: expecting sha256 %s, got %s", p.SHA256, checksum)
+			return 0, p.err
+		}
+	}
+	if err == io.EOF && p.read < p.Size {
+		p.err = fmt.Errorf("Package size mismatch: expecting %d bytes, got %d", p.Size, p.read)
+		return n, p.err
+	}
+	return n, err
+}
+
+// Seeking relative to the end uses the recorded size, so that a truncated
+// package is still reported with its expected length.
+func (p *PackageReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := p.reader.(io.Seeker)
+	if !ok {
+		return 0, fmt.Errorf("Package reader doesn't support seeking")
+	}
+	if whence == io.SeekEnd && p.SHA256 != "" {
+		offset += p.Size
+		whence = io.SeekStart
+	}
+	pos, err := seeker.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	p.hash.Reset()
+	p.read = pos
+	p.partial = pos != 0
+	p.verified = false
+	p.err = nil
+	return pos, nil
+}
+
+func (p *PackageReader) Close() error {
+	if closer, ok := p.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Returns the error that aborted the stream, if any.
+func (p *PackageReader) Err() error {
+	return p.err
+}
+
+// Increments the download counter of the release the package belongs to.
+func (p *PackageReader) CountDownload() error {
+	if p.release == nil {
+		return nil
+	}
+	return countDownload(p.release)
+}
+
+// The counter is incremented by the DAO, rather than on the caller's copy,
+// so that concurrent downloads are all counted.
+func countDownload(release *types.Release) error {
+	return dao.IncrementDownloads(release)
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ankyra/escape-inventory/dao/types"
+)
+
+type PackageFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Lists the files in a release's package. Files that are listed in the
+// release metadata include their recorded checksum.
+func ListPackageFiles(namespace, application, versionQuery string) ([]*PackageFile, error) {
+	return newStorageProvider().ListPackageFiles(namespace, application, versionQuery)
+}
+
+// Opens a single file from a release's package. Files that are listed in the
+// release metadata are verified against their recorded checksum while they're
+// read.
+func GetPackageFile(namespace, application, versionQuery, path string) (*PackageFileReader, error) {
+	return newStorageProvider().GetPackageFile(namespace, application, versionQuery, path)
+}
+
+func (s *storageProvider) ListPackageFiles(namespace, application, versionQuery string) ([]*PackageFile, error) {
+	pkg, err := s.GetDownloadReadSeeker(namespace, application, versionQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer pkg.Close()
+	files := []*PackageFile{}
+	err = walkPackage(pkg, pkg.release.ReleaseId, func(path string, header *tar.Header, entry io.Reader) error {
+		files = append(files, &PackageFile{
+			Path:   path,
+			Size:   header.Size,
+			SHA256: pkg.release.Metadata.Files[path],
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read package for '%s/%s': %s", namespace, pkg.release.ReleaseId, err.Error())
+	}
+	return files, nil
+}
+
+func (s *storageProvider) GetPackageFile(namespace, application, versionQuery, path string) (*PackageFileReader, error) {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil, NewUserError(fmt.Errorf("Missing file path"))
+	}
+	pkg, err := s.GetDownloadReadSeeker(namespace, application, versionQuery)
+	if err != nil {
+		return nil, err
+	}
+	var result *PackageFileReader
+	err = walkPackage(pkg, pkg.release.ReleaseId, func(entryPath string, header *tar.Header, entry io.Reader) error {
+		if entryPath != path {
+			return nil
+		}
+		result = NewPackageFileReader(path, entry, pkg.release.Metadata.Files[path], header.Size, pkg)
+		return errStopWalk
+	})
+	if err != nil {
+		pkg.Close()
+		return nil, fmt.Errorf("Failed to read package for '%s/%s': %s", namespace, pkg.release.ReleaseId, err.Error())
+	}
+	if result == nil {
+		pkg.Close()
+		return nil, types.NotFound
+	}
+	return result, nil
+}
+
+// PackageFileReader streams a single file out of a package. Closing it closes
+// the package.
+type PackageFileReader struct {
+	Path   string
+	Size   int64
+	SHA256 string
+	reader *PackageReader
+	pkg    io.Closer
+}
+
+func NewPackageFileReader(path string, entry io.Reader, checksum string, size int64, pkg io.Closer) *PackageFileReader {
+	return &PackageFileReader{
+		Path:   path,
+		Size:   size,
+		SHA256: checksum,
+		reader: NewPackageReader(entry, checksum, size),
+		pkg:    pkg,
+	}
+}
+
+func (p *PackageFileReader) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("Failed to read '%s' from package: %s", p.Path, err.Error())
+	}
+	return n, err
+}
+
+func (p *PackageFileReader) Close() error {
+	return p.pkg.Close()
+}
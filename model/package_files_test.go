@@ -0,0 +1,146 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+
+	. "gopkg.in/check.v1"
+)
+
+func buildPackage(c *C, releaseId string, files map[string]string) []byte {
+	buf := bytes.NewBuffer(nil)
+	gz := gzip.NewWriter(buf)
+	archive := tar.NewWriter(gz)
+	paths := []string{}
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		content := files[path]
+		header := &tar.Header{
+			Name: releaseId + "/" + path,
+			Mode: 0644,
+			Size: int64(len(content)),
+		}
+		c.Assert(archive.WriteHeader(header), IsNil)
+		_, err := archive.Write([]byte(content))
+		c.Assert(err, IsNil)
+	}
+	c.Assert(archive.Close(), IsNil)
+	c.Assert(gz.Close(), IsNil)
+	return buf.Bytes()
+}
+
+// Builds the package for a release with the given metadata, which only
+// contains its release.json.
+func releasePackage(c *C, releaseId, metadata string) []byte {
+	return buildPackage(c, releaseId, map[string]string{"release.json": metadata})
+}
+
+func fileDigest(content string) string {
+	digest := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(digest[:])
+}
+
+func (s *appSuite) setUpPackageFiles(c *C, deployDigest string) *storageProvider {
+	dao.TestSetup()
+	pkg := buildPackage(c, "name-v1.0.0", map[string]string{
+		"release.json": `{"name": "name", "version": "1.0.0"}`,
+		"deploy.sh":    "echo deploy",
+	})
+	metadata := `{"name": "name", "version": "1.0.0", "files": {"deploy.sh": "` + deployDigest + `"}}`
+	_, err := AddRelease("namespace", metadata)
+	c.Assert(err, IsNil)
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(dao.AddPackageURI(release, "mem://namespace/name-v1.0.0.tgz"), IsNil)
+	return &storageProvider{
+		Download: func(namespace, uri string) (io.ReadSeekCloser, error) {
+			return nopCloser{bytes.NewReader(pkg)}, nil
+		},
+	}
+}
+
+func (s *appSuite) Test_ListPackageFiles(c *C) {
+	storage := s.setUpPackageFiles(c, fileDigest("echo deploy"))
+	files, err := storage.ListPackageFiles("namespace", "name", "latest")
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 2)
+	byPath := map[string]*PackageFile{}
+	for _, file := range files {
+		byPath[file.Path] = file
+	}
+	c.Assert(byPath["deploy.sh"], DeepEquals, &PackageFile{Path: "deploy.sh", Size: 11, SHA256: fileDigest("echo deploy")})
+	c.Assert(byPath["release.json"].SHA256, Equals, "")
+}
+
+func (s *appSuite) Test_ListPackageFiles_fails_if_package_is_not_an_archive(c *C) {
+	storage := s.setUpPackageFiles(c, fileDigest("echo deploy"))
+	storage.Download = func(namespace, uri string) (io.ReadSeekCloser, error) {
+		return nopCloser{bytes.NewReader([]byte("package data"))}, nil
+	}
+	_, err := storage.ListPackageFiles("namespace", "name", "latest")
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Matches, "Failed to read package for 'namespace/name-v1.0.0': Package is not a valid gzip archive: .*")
+}
+
+func (s *appSuite) Test_GetPackageFile(c *C) {
+	storage := s.setUpPackageFiles(c, fileDigest("echo deploy"))
+	file, err := storage.GetPackageFile("namespace", "name", "v1.0.0", "deploy.sh")
+	c.Assert(err, IsNil)
+	defer file.Close()
+	c.Assert(file.Size, Equals, int64(11))
+	c.Assert(file.SHA256, Equals, fileDigest("echo deploy"))
+	data, err := ioutil.ReadAll(file)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "echo deploy")
+}
+
+func (s *appSuite) Test_GetPackageFile_fails_on_checksum_mismatch(c *C) {
+	storage := s.setUpPackageFiles(c, fileDigest("echo something else"))
+	file, err := storage.GetPackageFile("namespace", "name", "v1.0.0", "deploy.sh")
+	c.Assert(err, IsNil)
+	defer file.Close()
+	_, err = ioutil.ReadAll(file)
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Failed to read 'deploy.sh' from package: Package checksum mismatch: expecting sha256 "+fileDigest("echo something else")+", got "+fileDigest("echo deploy"))
+}
+
+func (s *appSuite) Test_GetPackageFile_fails_if_file_not_found(c *C) {
+	storage := s.setUpPackageFiles(c, fileDigest("echo deploy"))
+	_, err := storage.GetPackageFile("namespace", "name", "v1.0.0", "undeploy.sh")
+	c.Assert(err, Equals, types.NotFound)
+}
+
+func (s *appSuite) Test_GetPackageFile_fails_if_path_is_missing(c *C) {
+	storage := s.setUpPackageFiles(c, fileDigest("echo deploy"))
+	_, err := storage.GetPackageFile("namespace", "name", "v1.0.0", "/")
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Missing file path")
+}
@@ -22,8 +22,13 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/mem"
+	"github.com/ankyra/escape-inventory/dao/types"
 
 	. "gopkg.in/check.v1"
 )
@@ -31,15 +36,15 @@ import (
 func (s *appSuite) Test_UploadPackage_happy_path(c *C) {
 	dao.TestSetup()
 	storage := &storageProvider{
-		Upload: func(namespace, releaseId string, pkg io.ReadSeeker) (string, error) {
-			return "mem://" + namespace + "/" + releaseId + ".tgz", nil
+		Upload: func(namespace, releaseId string, pkg io.Reader) ([]string, error) {
+			return []string{"mem://" + namespace + "/" + releaseId + ".tgz"}, nil
 		},
 	}
 
 	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
 	c.Assert(err, IsNil)
-	pkg := bytes.NewReader([]byte("package data"))
-	err = storage.UploadPackage("namespace", "name-v1.0.0", pkg)
+	pkg := releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.0"}`)
+	err = storage.UploadPackage("namespace", "name-v1.0.0", bytes.NewReader(pkg))
 	c.Assert(err, IsNil)
 
 	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
@@ -48,6 +53,139 @@ func (s *appSuite) Test_UploadPackage_happy_path(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(uris, HasLen, 1)
 	c.Assert(uris[0], Equals, "mem://namespace/name-v1.0.0.tgz")
+	c.Assert(release.PackageSHA256, Equals, fileDigest(string(pkg)))
+	c.Assert(release.PackageSize, Equals, int64(len(pkg)))
+}
+
+func (s *appSuite) Test_UploadPackage_fails_if_checksum_differs_from_previous_upload(c *C) {
+	dao.TestSetup()
+	uploads := 0
+	storage := &storageProvider{
+		Upload: func(namespace, releaseId string, pkg io.Reader) ([]string, error) {
+			uploads += 1
+			return []string{"mem://" + namespace + "/" + releaseId + ".tgz"}, nil
+		},
+	}
+
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	c.Assert(storage.UploadPackage("namespace", "name-v1.0.0", bytes.NewReader(releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.0"}`))), IsNil)
+	other := buildPackage(c, "name-v1.0.0", map[string]string{
+		"release.json": `{"name": "name", "version": "1.0.0"}`,
+		"README.md":    "other data",
+	})
+	err = storage.UploadPackage("namespace", "name-v1.0.0", bytes.NewReader(other))
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "A package with a different checksum has already been uploaded for 'namespace/name-v1.0.0'")
+	c.Assert(uploads, Equals, 1)
+}
+
+func (s *appSuite) Test_UploadPackage_registers_every_replica(c *C) {
+	dao.TestSetup()
+	replicas := []string{"file:///releases/name-v1.0.0.tgz"}
+	storage := &storageProvider{
+		Upload: func(namespace, releaseId string, pkg io.Reader) ([]string, error) {
+			return replicas, nil
+		},
+	}
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	pkg := releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(storage.UploadPackage("namespace", "name-v1.0.0", bytes.NewReader(pkg)), IsNil)
+
+	// Uploading the same package again only fails if there are no new replicas.
+	err = storage.UploadPackage("namespace", "name-v1.0.0", bytes.NewReader(pkg))
+	c.Assert(err, Equals, types.AlreadyExists)
+	replicas = []string{"file:///releases/name-v1.0.0.tgz", "gcs://bucket/name-v1.0.0.tgz"}
+	c.Assert(storage.UploadPackage("namespace", "name-v1.0.0", bytes.NewReader(pkg)), IsNil)
+
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	uris, err := dao.GetPackageURIs(release)
+	c.Assert(err, IsNil)
+	c.Assert(uris, DeepEquals, []string{"file:///releases/name-v1.0.0.tgz", "gcs://bucket/name-v1.0.0.tgz"})
+}
+
+func (s *appSuite) Test_UploadPackage_deletes_unregistered_replicas_if_a_replica_fails(c *C) {
+	dao.TestSetup()
+	replicas := []string{"file:///releases/name-v1.0.0.tgz"}
+	uploadErr := error(nil)
+	deleted := []string{}
+	storage := &storageProvider{
+		Upload: func(namespace, releaseId string, pkg io.Reader) ([]string, error) {
+			return replicas, uploadErr
+		},
+		DeletePackage: func(namespace, uri string) error {
+			deleted = append(deleted, uri)
+			return nil
+		},
+	}
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	pkg := releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(storage.UploadPackage("namespace", "name-v1.0.0", bytes.NewReader(pkg)), IsNil)
+
+	replicas = []string{"file:///releases/name-v1.0.0.tgz", "gcs://bucket/name-v1.0.0.tgz"}
+	uploadErr = errors.New("Upload to 's3' storage backend failed")
+	err = storage.UploadPackage("namespace", "name-v1.0.0", bytes.NewReader(pkg))
+	c.Assert(err, Equals, uploadErr)
+	c.Assert(deleted, DeepEquals, []string{"gcs://bucket/name-v1.0.0.tgz"})
+}
+
+func (s *appSuite) Test_UploadPackage_serialises_concurrent_uploads_for_a_release(c *C) {
+	dao.TestSetup()
+	stored := map[string][]byte{}
+	uploads := 0
+	uploading := make(chan bool)
+	proceed := make(chan bool)
+	storage := &storageProvider{
+		Upload: func(namespace, releaseId string, pkg io.Reader) ([]string, error) {
+			data, err := ioutil.ReadAll(pkg)
+			if err != nil {
+				return nil, err
+			}
+			uploads += 1
+			if uploads == 1 {
+				uploading <- true
+				<-proceed
+			}
+			uri := "mem://" + namespace + "/" + releaseId + ".tgz"
+			stored[uri] = data
+			return []string{uri}, nil
+		},
+	}
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	pkg := releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.0"}`)
+	other := buildPackage(c, "name-v1.0.0", map[string]string{
+		"release.json": `{"name": "name", "version": "1.0.0"}`,
+		"README.md":    "other data",
+	})
+
+	first := make(chan error)
+	go func() {
+		first <- storage.UploadPackage("namespace", "name-v1.0.0", bytes.NewReader(pkg))
+	}()
+	<-uploading
+	second := make(chan error)
+	go func() {
+		second <- storage.UploadPackage("namespace", "name-v1.0.0", bytes.NewReader(other))
+	}()
+	select {
+	case err := <-second:
+		c.Fatalf("Second upload didn't wait for the first one: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	proceed <- true
+	c.Assert(<-first, IsNil)
+	err = <-second
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "A package with a different checksum has already been uploaded for 'namespace/name-v1.0.0'")
+
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(release.PackageSHA256, Equals, fileDigest(string(pkg)))
+	c.Assert(stored["mem://namespace/name-v1.0.0.tgz"], DeepEquals, pkg)
 }
 
 func (s *appSuite) Test_UploadPackage_fails_on_invalid_release_id(c *C) {
@@ -72,15 +210,15 @@ func (s *appSuite) Test_UploadPackage_fails_if_release_not_found(c *C) {
 func (s *appSuite) Test_UploadPackage_fails_if_upload_fails(c *C) {
 	dao.TestSetup()
 	storage := &storageProvider{
-		Upload: func(namespace, releaseId string, pkg io.ReadSeeker) (string, error) {
-			return "", errors.New("error uploading")
+		Upload: func(namespace, releaseId string, pkg io.Reader) ([]string, error) {
+			return nil, errors.New("error uploading")
 		},
 	}
 
 	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
 	c.Assert(err, IsNil)
-	pkg := bytes.NewReader([]byte("package data"))
-	err = storage.UploadPackage("namespace", "name-v1.0.0", pkg)
+	pkg := releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.0"}`)
+	err = storage.UploadPackage("namespace", "name-v1.0.0", bytes.NewReader(pkg))
 	c.Assert(err, Not(IsNil))
 	c.Assert(err.Error(), Equals, "error uploading")
 }
@@ -89,11 +227,19 @@ func (s *appSuite) Test_UploadPackage_fails_if_upload_fails(c *C) {
 	DOWNLOAD
 */
 
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (n nopCloser) Close() error {
+	return nil
+}
+
 func (s *appSuite) Test_DownloadPackage_happy_path(c *C) {
 	dao.TestSetup()
 	storage := &storageProvider{
-		Download: func(namespace, uri string) (io.Reader, error) {
-			return bytes.NewReader([]byte("package data")), nil
+		Download: func(namespace, uri string) (io.ReadSeekCloser, error) {
+			return nopCloser{bytes.NewReader([]byte("package data"))}, nil
 		},
 	}
 	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
@@ -128,7 +274,7 @@ func (s *appSuite) Test_DownloadPackage_fails_if_uri_not_found(c *C) {
 func (s *appSuite) Test_DownloadPackage_fails_if_download_fails(c *C) {
 	dao.TestSetup()
 	storage := &storageProvider{
-		Download: func(namespace, uri string) (io.Reader, error) {
+		Download: func(namespace, uri string) (io.ReadSeekCloser, error) {
 			return nil, fmt.Errorf("Download error")
 		},
 	}
@@ -142,3 +288,181 @@ func (s *appSuite) Test_DownloadPackage_fails_if_download_fails(c *C) {
 	c.Assert(err, Not(IsNil))
 	c.Assert(err.Error(), Equals, "Download error")
 }
+
+func (s *appSuite) Test_DownloadPackage_falls_back_to_next_replica(c *C) {
+	dao.TestSetup()
+	tried := []string{}
+	storage := &storageProvider{
+		Download: func(namespace, uri string) (io.ReadSeekCloser, error) {
+			tried = append(tried, uri)
+			if uri == "gcs://bucket/name-v1.0.0.tgz" {
+				return nil, fmt.Errorf("Download error")
+			}
+			return nopCloser{bytes.NewReader([]byte("package data"))}, nil
+		},
+	}
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(dao.AddPackageURI(release, "gcs://bucket/name-v1.0.0.tgz"), IsNil)
+	c.Assert(dao.AddPackageURI(release, "s3://bucket/name-v1.0.0.tgz"), IsNil)
+	reader, err := storage.GetDownloadReadSeeker("namespace", "name", "v1.0.0")
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "package data")
+	c.Assert(tried, DeepEquals, []string{"gcs://bucket/name-v1.0.0.tgz", "s3://bucket/name-v1.0.0.tgz"})
+}
+
+func (s *appSuite) Test_DownloadPackage_exposes_checksum(c *C) {
+	dao.TestSetup()
+	storage := &storageProvider{
+		Download: func(namespace, uri string) (io.ReadSeekCloser, error) {
+			return nopCloser{bytes.NewReader([]byte("package data"))}, nil
+		},
+	}
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(dao.AddPackageURI(release, "mem://namespace/name-v1.0.0.tar.gz"), IsNil)
+	release.PackageSHA256 = "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a"
+	release.PackageSize = 12
+	c.Assert(dao.UpdateRelease(release), IsNil)
+
+	reader, err := storage.GetDownloadReadSeeker("namespace", "name", "v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(reader.SHA256, Equals, "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a")
+	c.Assert(reader.Size, Equals, int64(12))
+	data, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "package data")
+}
+
+func (s *appSuite) Test_DownloadPackage_counts_download(c *C) {
+	dao.TestSetup()
+	storage := &storageProvider{
+		Download: func(namespace, uri string) (io.ReadSeekCloser, error) {
+			return nopCloser{bytes.NewReader([]byte("package data"))}, nil
+		},
+		Stat: func(namespace, uri string) (int64, time.Time, error) {
+			return 12, time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC), nil
+		},
+	}
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(dao.AddPackageURI(release, "mem://namespace/name-v1.0.0.tar.gz"), IsNil)
+
+	reader, err := storage.GetDownloadReadSeeker("namespace", "name", "v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(reader.ModTime, Equals, time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC))
+	release, err = dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(release.Downloads, Equals, 0)
+
+	c.Assert(reader.CountDownload(), IsNil)
+	release, err = dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(release.Downloads, Equals, 1)
+}
+
+// Counting downloads changes the release while snapshots read it, which is
+// checked when the tests are run with -race.
+func (s *appSuite) Test_DownloadPackage_counts_concurrent_downloads(c *C) {
+	dao.TestSetup()
+	storage := &storageProvider{
+		Download: func(namespace, uri string) (io.ReadSeekCloser, error) {
+			return nopCloser{bytes.NewReader([]byte("package data"))}, nil
+		},
+		Stat: func(namespace, uri string) (int64, time.Time, error) {
+			return 12, time.Now(), nil
+		},
+	}
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(dao.AddPackageURI(release, "mem://namespace/name-v1.0.0.tar.gz"), IsNil)
+	dir, err := ioutil.TempDir("", "escape-inventory-snapshot")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	errors := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		go func() {
+			for j := 0; j < 10; j++ {
+				reader, err := storage.GetDownloadReadSeeker("namespace", "name", "latest")
+				if err != nil {
+					errors <- err
+					return
+				}
+				if err := reader.CountDownload(); err != nil {
+					errors <- err
+					return
+				}
+			}
+			errors <- nil
+		}()
+		go func() {
+			errors <- mem.SaveSnapshot(dao.GlobalDAO, filepath.Join(dir, "snapshot.json"))
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		c.Assert(<-errors, IsNil)
+	}
+	release, err = dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(release.Downloads, Equals, 100)
+}
+
+func (s *appSuite) Test_PackageReader_verifies_after_seeking_back_to_start(c *C) {
+	reader := NewPackageReader(bytes.NewReader([]byte("corrupt data")), "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a", 12)
+	size, err := reader.Seek(0, io.SeekEnd)
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, int64(12))
+	_, err = reader.Seek(0, io.SeekStart)
+	c.Assert(err, IsNil)
+	_, err = ioutil.ReadAll(reader)
+	c.Assert(err, Not(IsNil))
+	c.Assert(reader.Err(), Equals, err)
+}
+
+func (s *appSuite) Test_PackageReader_doesnt_verify_partial_reads(c *C) {
+	reader := NewPackageReader(bytes.NewReader([]byte("package data")), "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a", 12)
+	_, err := reader.Seek(8, io.SeekStart)
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "data")
+}
+
+func (s *appSuite) Test_PackageReader_reports_recorded_size_when_seeking_to_end(c *C) {
+	reader := NewPackageReader(bytes.NewReader([]byte("package")), "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a", 12)
+	size, err := reader.Seek(0, io.SeekEnd)
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, int64(12))
+}
+
+func (s *appSuite) Test_PackageReader_fails_on_checksum_mismatch(c *C) {
+	reader := NewPackageReader(bytes.NewReader([]byte("corrupt data")), "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a", 12)
+	data, err := ioutil.ReadAll(reader)
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Package checksum mismatch: expecting sha256 9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a, got 287c99a97d79e7e9ebe154d283495a025d2fd469947192d93c99d0cf1883f595")
+	c.Assert(data, HasLen, 0)
+}
+
+func (s *appSuite) Test_PackageReader_fails_on_size_mismatch(c *C) {
+	reader := NewPackageReader(bytes.NewReader([]byte("package")), "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a", 12)
+	_, err := ioutil.ReadAll(reader)
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Package size mismatch: expecting 12 bytes, got 7")
+
+	reader = NewPackageReader(bytes.NewReader([]byte("package data and more")), "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a", 12)
+	data, err := ioutil.ReadAll(reader)
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Package size mismatch: expecting 12 bytes, got more")
+	c.Assert(data, HasLen, 0)
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	core "github.com/ankyra/escape-core"
+	"github.com/ankyra/escape-inventory/dao/types"
+)
+
+// Checks that a package is a gzipped tarball with a release.json that matches
+// the metadata the release was registered with, so that a package can't be
+// uploaded under the wrong release id.
+func verifyPackage(pkg io.Reader, release *types.Release) error {
+	var metadata *core.ReleaseMetadata
+	err := walkPackage(pkg, release.ReleaseId, func(path string, header *tar.Header, entry io.Reader) error {
+		if path != "release.json" {
+			return nil
+		}
+		data, err := ioutil.ReadAll(entry)
+		if err != nil {
+			return err
+		}
+		metadata, err = core.NewReleaseMetadataFromJsonString(string(data))
+		if err != nil {
+			return fmt.Errorf("Package contains an invalid release.json: %s", err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return NewUserError(err)
+	}
+	if metadata == nil {
+		return NewUserError(fmt.Errorf("Package doesn't contain a release.json"))
+	}
+	if metadata.GetReleaseId() != release.ReleaseId {
+		return NewUserError(fmt.Errorf("Package contains release '%s', expecting '%s'", metadata.GetReleaseId(), release.ReleaseId))
+	}
+	for path, digest := range release.Metadata.Files {
+		if metadata.Files[path] != digest {
+			return NewUserError(fmt.Errorf("Package doesn't match the registered release: file '%s' differs", path))
+		}
+	}
+	for path := range metadata.Files {
+		if _, ok := release.Metadata.Files[path]; !ok {
+			return NewUserError(fmt.Errorf("Package doesn't match the registered release: file '%s' differs", path))
+		}
+	}
+	return nil
+}
+
+// packageStreamVerifier runs verifyPackage on a package that's being
+// streamed to the storage backends. Everything written to it is passed on to
+// the verification, which runs in the background until Wait is called.
+type packageStreamVerifier struct {
+	writer *io.PipeWriter
+	result chan error
+}
+
+func newPackageStreamVerifier(release *types.Release) *packageStreamVerifier {
+	reader, writer := io.Pipe()
+	v := &packageStreamVerifier{
+		writer: writer,
+		result: make(chan error, 1),
+	}
+	go func() {
+		err := verifyPackage(reader, release)
+		// Keep reading after the verification has finished, so that writes
+		// never block the upload.
+		io.Copy(ioutil.Discard, reader)
+		v.result <- err
+	}()
+	return v
+}
+
+func (v *packageStreamVerifier) Write(b []byte) (int, error) {
+	return v.writer.Write(b)
+}
+
+func (v *packageStreamVerifier) Wait() error {
+	v.writer.Close()
+	return <-v.result
+}
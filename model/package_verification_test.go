@@ -0,0 +1,120 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/ankyra/escape-inventory/dao"
+
+	. "gopkg.in/check.v1"
+)
+
+const verifiedReleaseMetadata = `{"name": "name", "version": "1.0.0", "files": {"deploy.sh": "abc"}}`
+
+func (s *appSuite) setUpPackageVerification(c *C) (*storageProvider, *[]string) {
+	dao.TestSetup()
+	_, err := AddRelease("namespace", verifiedReleaseMetadata)
+	c.Assert(err, IsNil)
+	deleted := []string{}
+	return &storageProvider{
+		Upload: func(namespace, releaseId string, pkg io.Reader) ([]string, error) {
+			if _, err := io.Copy(ioutil.Discard, pkg); err != nil {
+				return nil, err
+			}
+			return []string{"mem://" + namespace + "/" + releaseId + ".tgz"}, nil
+		},
+		DeletePackage: func(namespace, uri string) error {
+			deleted = append(deleted, uri)
+			return nil
+		},
+	}, &deleted
+}
+
+func (s *appSuite) Test_UploadPackage_accepts_matching_package(c *C) {
+	storage, _ := s.setUpPackageVerification(c)
+	pkg := buildPackage(c, "name-v1.0.0", map[string]string{
+		"release.json": verifiedReleaseMetadata,
+		"deploy.sh":    "echo deploy",
+	})
+	c.Assert(storage.UploadPackage("namespace", "name-v1.0.0", bytes.NewReader(pkg)), IsNil)
+}
+
+func (s *appSuite) Test_UploadPackage_fails_if_package_is_not_a_gzip_archive(c *C) {
+	storage, _ := s.setUpPackageVerification(c)
+	err := storage.UploadPackage("namespace", "name-v1.0.0", bytes.NewReader([]byte("package data")))
+	c.Assert(err, Not(IsNil))
+	c.Assert(IsUserError(err), Equals, true)
+	c.Assert(err.Error(), Matches, "Package is not a valid gzip archive: .*")
+}
+
+func (s *appSuite) Test_UploadPackage_fails_if_release_json_is_missing(c *C) {
+	storage, _ := s.setUpPackageVerification(c)
+	pkg := buildPackage(c, "name-v1.0.0", map[string]string{"deploy.sh": "echo deploy"})
+	err := storage.UploadPackage("namespace", "name-v1.0.0", bytes.NewReader(pkg))
+	c.Assert(err, Not(IsNil))
+	c.Assert(IsUserError(err), Equals, true)
+	c.Assert(err.Error(), Equals, "Package doesn't contain a release.json")
+}
+
+func (s *appSuite) Test_UploadPackage_fails_if_release_id_differs(c *C) {
+	storage, _ := s.setUpPackageVerification(c)
+	pkg := releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.1", "files": {"deploy.sh": "abc"}}`)
+	err := storage.UploadPackage("namespace", "name-v1.0.0", bytes.NewReader(pkg))
+	c.Assert(err, Not(IsNil))
+	c.Assert(IsUserError(err), Equals, true)
+	c.Assert(err.Error(), Equals, "Package contains release 'name-v1.0.1', expecting 'name-v1.0.0'")
+}
+
+func (s *appSuite) Test_UploadPackage_fails_if_files_differ(c *C) {
+	storage, _ := s.setUpPackageVerification(c)
+	for _, metadata := range []string{
+		`{"name": "name", "version": "1.0.0", "files": {"deploy.sh": "def"}}`,
+		`{"name": "name", "version": "1.0.0"}`,
+		`{"name": "name", "version": "1.0.0", "files": {"deploy.sh": "abc", "undeploy.sh": "def"}}`,
+	} {
+		pkg := releasePackage(c, "name-v1.0.0", metadata)
+		err := storage.UploadPackage("namespace", "name-v1.0.0", bytes.NewReader(pkg))
+		c.Assert(err, Not(IsNil))
+		c.Assert(IsUserError(err), Equals, true)
+		c.Assert(err.Error(), Matches, "Package doesn't match the registered release: file '.*' differs")
+	}
+}
+
+func (s *appSuite) Test_UploadPackage_verifies_streamed_packages(c *C) {
+	storage, deleted := s.setUpPackageVerification(c)
+	pkg := releasePackage(c, "name-v1.0.0", verifiedReleaseMetadata)
+	c.Assert(storage.UploadPackage("namespace", "name-v1.0.0", struct{ io.Reader }{bytes.NewReader(pkg)}), IsNil)
+	c.Assert(*deleted, HasLen, 0)
+}
+
+func (s *appSuite) Test_UploadPackage_deletes_invalid_streamed_packages(c *C) {
+	storage, deleted := s.setUpPackageVerification(c)
+	err := storage.UploadPackage("namespace", "name-v1.0.0", struct{ io.Reader }{bytes.NewReader([]byte("package data"))})
+	c.Assert(err, Not(IsNil))
+	c.Assert(IsUserError(err), Equals, true)
+	c.Assert(*deleted, DeepEquals, []string{"mem://namespace/name-v1.0.0.tgz"})
+
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(release.PackageSHA256, Equals, "")
+	uris, err := dao.GetPackageURIs(release)
+	c.Assert(err, IsNil)
+	c.Assert(uris, HasLen, 0)
+}
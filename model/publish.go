@@ -0,0 +1,127 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	core "github.com/ankyra/escape-core"
+	"github.com/ankyra/escape-inventory/dao"
+	. "github.com/ankyra/escape-inventory/dao/types"
+)
+
+// Stores the package and registers the release described by its release.json
+// in a single transaction, so that a release is never left registered without
+// its package. If the registration fails the stored package is deleted again.
+func PublishPackage(namespace string, pkg io.ReadSeeker, uploadUser string) (*core.ReleaseMetadata, error) {
+	return newStorageProvider().PublishPackage(namespace, pkg, uploadUser)
+}
+
+func (s *storageProvider) PublishPackage(namespace string, pkg io.ReadSeeker, uploadUser string) (*core.ReleaseMetadata, error) {
+	metadataJson, err := readPackageMetadata(pkg)
+	if err != nil {
+		return nil, NewUserError(err)
+	}
+	release, err := newReleaseFromMetadata(namespace, metadataJson, uploadUser)
+	if err != nil {
+		return nil, err
+	}
+	releaseId := release.Metadata.GetReleaseId()
+	lock := releaseLock(namespace, releaseId)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if _, err := dao.GetRelease(namespace, release.Metadata.Name, releaseId); err == nil {
+		return nil, errReleaseExists(releaseId)
+	} else if !dao.IsNotFound(err) {
+		return nil, err
+	}
+	if _, err := pkg.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := verifyPackage(pkg, release); err != nil {
+		return nil, err
+	}
+	hasher := newPackageHasher()
+	if _, err := pkg.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := hasher.ReadFrom(pkg); err != nil {
+		return nil, err
+	}
+	uris, err := s.Upload(namespace, releaseId, pkg)
+	if err != nil {
+		s.deleteUnregisteredUploads(namespace, release, uris)
+		return nil, err
+	}
+	release.PackageSHA256 = hasher.SHA256()
+	release.PackageSize = hasher.Size
+	err = dao.RunInTransaction(func(tx DAO) error {
+		if err := registerRelease(tx, namespace, release); err != nil {
+			return err
+		}
+		for _, uri := range uris {
+			if err := tx.AddPackageURI(release, uri); err != nil && err != AlreadyExists {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.deleteUnregisteredUploads(namespace, release, uris)
+		return nil, err
+	}
+	return release.Metadata, nil
+}
+
+// If the release was registered concurrently the package that was just
+// stored is now its package, so it's left alone.
+func (s *storageProvider) deleteUnregisteredUploads(namespace string, release *Release, uris []string) {
+	_, err := dao.GetRelease(namespace, release.Metadata.Name, release.Metadata.GetReleaseId())
+	if dao.IsNotFound(err) {
+		s.deleteUploads(namespace, uris)
+	}
+}
+
+// Returns the contents of the release.json in a package, which is either at
+// the top of the archive or in the release's directory.
+func readPackageMetadata(pkg io.Reader) (string, error) {
+	var metadata []byte
+	err := walkPackage(pkg, "", func(p string, header *tar.Header, entry io.Reader) error {
+		if path.Base(p) != "release.json" || strings.Count(p, "/") > 1 {
+			return nil
+		}
+		data, err := ioutil.ReadAll(entry)
+		if err != nil {
+			return err
+		}
+		metadata = data
+		return errStopWalk
+	})
+	if err != nil {
+		return "", err
+	}
+	if metadata == nil {
+		return "", fmt.Errorf("Package doesn't contain a release.json")
+	}
+	return string(metadata), nil
+}
@@ -0,0 +1,285 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+
+	. "gopkg.in/check.v1"
+)
+
+func publishStorage(uploadErr error) *storageProvider {
+	return &storageProvider{
+		Upload: func(namespace, releaseId string, pkg io.Reader) ([]string, error) {
+			if uploadErr != nil {
+				return nil, uploadErr
+			}
+			if _, err := io.Copy(ioutil.Discard, pkg); err != nil {
+				return nil, err
+			}
+			return []string{"mem://" + namespace + "/" + releaseId + ".tgz"}, nil
+		},
+	}
+}
+
+func (s *appSuite) Test_PublishPackage_happy_path(c *C) {
+	dao.TestSetup()
+	pkg := releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.0", "description": "yo"}`)
+	metadata, err := publishStorage(nil).PublishPackage("namespace", bytes.NewReader(pkg), "user")
+	c.Assert(err, IsNil)
+	c.Assert(metadata.GetReleaseId(), Equals, "name-v1.0.0")
+
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(release.UploadedBy, Equals, "user")
+	c.Assert(release.Draft, Equals, false)
+	c.Assert(release.PackageSHA256, Equals, fileDigest(string(pkg)))
+	uris, err := dao.GetPackageURIs(release)
+	c.Assert(err, IsNil)
+	c.Assert(uris, DeepEquals, []string{"mem://namespace/name-v1.0.0.tgz"})
+	app, err := dao.GetApplication("namespace", "name")
+	c.Assert(err, IsNil)
+	c.Assert(app.Description, Equals, "yo")
+}
+
+func (s *appSuite) Test_PublishPackage_reads_release_json_from_top_of_archive(c *C) {
+	dao.TestSetup()
+	pkg := buildPackage(c, "", map[string]string{"release.json": `{"name": "name", "version": "1.0.0"}`})
+	_, err := publishStorage(nil).PublishPackage("namespace", bytes.NewReader(pkg), "")
+	c.Assert(err, IsNil)
+}
+
+func (s *appSuite) Test_PublishPackage_fails_if_package_is_invalid(c *C) {
+	dao.TestSetup()
+	_, err := publishStorage(nil).PublishPackage("namespace", bytes.NewReader([]byte("package data")), "")
+	c.Assert(err, Not(IsNil))
+	c.Assert(IsUserError(err), Equals, true)
+	c.Assert(err.Error(), Matches, "Package is not a valid gzip archive: .*")
+
+	pkg := buildPackage(c, "name-v1.0.0", map[string]string{"deploy.sh": "echo deploy"})
+	_, err = publishStorage(nil).PublishPackage("namespace", bytes.NewReader(pkg), "")
+	c.Assert(err, Not(IsNil))
+	c.Assert(IsUserError(err), Equals, true)
+	c.Assert(err.Error(), Equals, "Package doesn't contain a release.json")
+}
+
+func (s *appSuite) Test_PublishPackage_runs_release_checks(c *C) {
+	dao.TestSetup()
+	cases := map[string]string{
+		`{"name": "name", "version": "1.0.@"}`:                     "Can't add release with unresolved version",
+		`{"name": "name", "version": "1.0.0", "api_version": 100}`: "The release metadata is compiled with a version of Escape targetting API version v100.*",
+	}
+	for metadata, expected := range cases {
+		pkg := releasePackage(c, "name-v1.0.0", metadata)
+		_, err := publishStorage(nil).PublishPackage("namespace", bytes.NewReader(pkg), "")
+		c.Assert(err, Not(IsNil))
+		c.Assert(IsUserError(err), Equals, true)
+		c.Assert(err.Error(), Matches, expected)
+	}
+}
+
+func (s *appSuite) Test_PublishPackage_doesnt_touch_existing_release(c *C) {
+	dao.TestSetup()
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	pkg := releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.0"}`)
+	_, err = publishStorage(errors.New("should not upload")).PublishPackage("namespace", bytes.NewReader(pkg), "")
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Release name-v1.0.0 already exists")
+	_, err = dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+}
+
+func (s *appSuite) Test_PublishPackage_rolls_back_new_application_if_storage_fails(c *C) {
+	dao.TestSetup()
+	pkg := releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.0"}`)
+	_, err := publishStorage(errors.New("error uploading")).PublishPackage("namespace", bytes.NewReader(pkg), "")
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "error uploading")
+
+	_, err = dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, Equals, types.NotFound)
+	_, err = dao.GetApplication("namespace", "name")
+	c.Assert(err, Equals, types.NotFound)
+
+	// Publishing can be retried
+	_, err = publishStorage(nil).PublishPackage("namespace", bytes.NewReader(pkg), "")
+	c.Assert(err, IsNil)
+}
+
+func (s *appSuite) Test_PublishPackage_restores_application_if_storage_fails(c *C) {
+	dao.TestSetup()
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0", "description": "v1", "provides": [{"name": "provider"}]}`)
+	c.Assert(err, IsNil)
+	pkg := releasePackage(c, "name-v1.1.0", `{"name": "name", "version": "1.1.0", "description": "v1.1", "provides": [{"name": "provider"}]}`)
+	_, err = publishStorage(errors.New("error uploading")).PublishPackage("namespace", bytes.NewReader(pkg), "")
+	c.Assert(err, Not(IsNil))
+
+	_, err = dao.GetRelease("namespace", "name", "name-v1.1.0")
+	c.Assert(err, Equals, types.NotFound)
+	app, err := dao.GetApplication("namespace", "name")
+	c.Assert(err, IsNil)
+	c.Assert(app.Description, Equals, "v1")
+	c.Assert(app.LatestVersion, Equals, "1.0.0")
+	versions, err := dao.FindAllVersions(app)
+	c.Assert(err, IsNil)
+	c.Assert(versions, DeepEquals, []string{"1.0.0"})
+	providers, err := dao.GetProviders("provider")
+	c.Assert(err, IsNil)
+	c.Assert(providers, HasLen, 1)
+	c.Assert(providers, HasLen, 1)
+	c.Assert(providers["_/name-v1.0.0"], Not(IsNil))
+}
+
+func (s *appSuite) Test_PublishPackage_keeps_concurrent_changes_if_storage_fails(c *C) {
+	dao.TestSetup()
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0", "description": "v1"}`)
+	c.Assert(err, IsNil)
+	provider := &storageProvider{
+		Upload: func(namespace, releaseId string, pkg io.Reader) ([]string, error) {
+			_, err := AddRelease("namespace", `{"name": "name", "version": "1.2.0", "description": "v1.2"}`)
+			c.Assert(err, IsNil)
+			return nil, errors.New("error uploading")
+		},
+	}
+	pkg := releasePackage(c, "name-v1.1.0", `{"name": "name", "version": "1.1.0", "description": "v1.1"}`)
+	_, err = provider.PublishPackage("namespace", bytes.NewReader(pkg), "")
+	c.Assert(err, Not(IsNil))
+
+	app, err := dao.GetApplication("namespace", "name")
+	c.Assert(err, IsNil)
+	c.Assert(app.Description, Equals, "v1.2")
+	c.Assert(app.LatestVersion, Equals, "1.2.0")
+}
+
+func (s *appSuite) Test_PublishPackage_deletes_package_if_registration_fails(c *C) {
+	dao.TestSetup()
+	deleted := []string{}
+	provider := publishStorage(nil)
+	provider.DeletePackage = func(namespace, uri string) error {
+		deleted = append(deleted, uri)
+		return nil
+	}
+	pkg := releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.0"}`)
+	dao.GlobalDAO = &failingDependenciesDAO{dao.GlobalDAO}
+	_, err := provider.PublishPackage("namespace", bytes.NewReader(pkg), "")
+	dao.GlobalDAO = dao.GlobalDAO.(*failingDependenciesDAO).DAO
+	c.Assert(err, DeepEquals, fmt.Errorf("Database error"))
+	c.Assert(deleted, DeepEquals, []string{"mem://namespace/name-v1.0.0.tgz"})
+	_, err = dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, Equals, types.NotFound)
+}
+
+func (s *appSuite) Test_PublishPackage_doesnt_delete_package_of_concurrent_registration(c *C) {
+	dao.TestSetup()
+	deleted := []string{}
+	provider := publishStorage(nil)
+	upload := provider.Upload
+	provider.Upload = func(namespace, releaseId string, pkg io.Reader) ([]string, error) {
+		_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+		c.Assert(err, IsNil)
+		return upload(namespace, releaseId, pkg)
+	}
+	provider.DeletePackage = func(namespace, uri string) error {
+		deleted = append(deleted, uri)
+		return nil
+	}
+	pkg := releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.0"}`)
+	_, err := provider.PublishPackage("namespace", bytes.NewReader(pkg), "")
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Release name-v1.0.0 already exists")
+	c.Assert(deleted, HasLen, 0)
+}
+
+func (s *appSuite) Test_PublishPackage_serialises_concurrent_publishes_of_a_release(c *C) {
+	dao.TestSetup()
+	stored := map[string][]byte{}
+	uploads := 0
+	uploading := make(chan bool)
+	proceed := make(chan bool)
+	provider := &storageProvider{
+		Upload: func(namespace, releaseId string, pkg io.Reader) ([]string, error) {
+			data, err := ioutil.ReadAll(pkg)
+			if err != nil {
+				return nil, err
+			}
+			uploads += 1
+			if uploads == 1 {
+				uploading <- true
+				<-proceed
+			}
+			uri := "mem://" + namespace + "/" + releaseId + ".tgz"
+			stored[uri] = data
+			return []string{uri}, nil
+		},
+	}
+	pkg := releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.0"}`)
+	other := releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.0", "description": "other"}`)
+
+	first := make(chan error)
+	go func() {
+		_, err := provider.PublishPackage("namespace", bytes.NewReader(pkg), "")
+		first <- err
+	}()
+	<-uploading
+	second := make(chan error)
+	go func() {
+		_, err := provider.PublishPackage("namespace", bytes.NewReader(other), "")
+		second <- err
+	}()
+	select {
+	case err := <-second:
+		c.Fatalf("Second publish didn't wait for the first one: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	proceed <- true
+	c.Assert(<-first, IsNil)
+	err := <-second
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Release name-v1.0.0 already exists")
+
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(release.PackageSHA256, Equals, fileDigest(string(pkg)))
+	c.Assert(stored["mem://namespace/name-v1.0.0.tgz"], DeepEquals, pkg)
+}
+
+func (s *appSuite) Test_PublishPackage_deletes_written_replicas_if_a_replica_fails(c *C) {
+	dao.TestSetup()
+	deleted := []string{}
+	provider := &storageProvider{
+		Upload: func(namespace, releaseId string, pkg io.Reader) ([]string, error) {
+			return []string{"mem://namespace/name-v1.0.0.tgz"}, errors.New("Upload to 's3' storage backend failed")
+		},
+		DeletePackage: func(namespace, uri string) error {
+			deleted = append(deleted, uri)
+			return nil
+		},
+	}
+	pkg := releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.0"}`)
+	_, err := provider.PublishPackage("namespace", bytes.NewReader(pkg), "")
+	c.Assert(err, Not(IsNil))
+	c.Assert(deleted, DeepEquals, []string{"mem://namespace/name-v1.0.0.tgz"})
+}
@@ -26,8 +26,8 @@ import (
 	. "github.com/ankyra/escape-inventory/dao/types"
 )
 
-func ensureNamespaceExists(namespace, username string) error {
-	prj, err := dao.GetNamespace(namespace)
+func ensureNamespaceExists(tx DAO, namespace, username string) error {
+	prj, err := tx.GetNamespace(namespace)
 	if err == nil {
 		return nil
 	}
@@ -38,13 +38,21 @@ func ensureNamespaceExists(namespace, username string) error {
 		return NewUserError(err)
 	}
 	prj = NewProject(namespace)
-	return dao.AddNamespace(prj)
+	if err := tx.AddNamespace(prj); err != AlreadyExists {
+		return err
+	}
+	// Created by a concurrent registration.
+	return nil
 }
 
+// Releases can be registered or published out of order, so the latest version
+// is only ever moved forward.
 func updateApp(app *Application, metadata *core.ReleaseMetadata, byUser string, uploadedAt time.Time) {
 	app.Description = metadata.Description
 	app.Logo = metadata.Logo
-	app.LatestVersion = metadata.Version
+	if app.LatestVersion == "" || core.NewSemanticVersion(app.LatestVersion).LessOrEqual(core.NewSemanticVersion(metadata.Version)) {
+		app.LatestVersion = metadata.Version
+	}
 	if byUser != "" {
 		app.UploadedBy = byUser
 	}
@@ -53,18 +61,23 @@ func updateApp(app *Application, metadata *core.ReleaseMetadata, byUser string,
 	}
 }
 
-func ensureApplicationExists(namespace, byUser string, metadata *core.ReleaseMetadata, uploadAt time.Time) error {
+func ensureApplicationExists(tx DAO, namespace, byUser string, metadata *core.ReleaseMetadata, uploadAt time.Time) error {
 	name := metadata.Name
-	app, err := dao.GetApplication(namespace, name)
-	if err != nil && err != NotFound {
-		return err
-	} else if err == nil {
+	app, err := tx.GetApplication(namespace, name)
+	if err == NotFound {
+		app = NewApplication(namespace, name)
 		updateApp(app, metadata, byUser, uploadAt)
-		return dao.UpdateApplication(app)
+		if err := tx.AddApplication(app); err != AlreadyExists {
+			return err
+		}
+		// Created by a concurrent registration.
+		app, err = tx.GetApplication(namespace, name)
+	}
+	if err != nil {
+		return err
 	}
-	app = NewApplication(namespace, name)
 	updateApp(app, metadata, byUser, uploadAt)
-	return dao.AddApplication(app)
+	return tx.UpdateApplication(app)
 }
 
 func AddRelease(namespace, metadataJson string) (*core.ReleaseMetadata, error) {
@@ -72,12 +85,41 @@ func AddRelease(namespace, metadataJson string) (*core.ReleaseMetadata, error) {
 }
 
 func AddReleaseByUser(namespace, metadataJson, uploadUser string) (*core.ReleaseMetadata, error) {
+	return addRelease(namespace, metadataJson, uploadUser, false)
+}
+
+// Registers the release as a draft. Drafts are hidden from version
+// resolution, version listings, providers and downstream queries until they
+// are published using PublishRelease.
+func AddDraftReleaseByUser(namespace, metadataJson, uploadUser string) (*core.ReleaseMetadata, error) {
+	return addRelease(namespace, metadataJson, uploadUser, true)
+}
+
+// The release is registered in a single transaction, so that a failure
+// doesn't leave a partial registration behind, and so that only one of two
+// concurrent registrations of the same release succeeds.
+func addRelease(namespace, metadataJson, uploadUser string, draft bool) (*core.ReleaseMetadata, error) {
+	result, err := newReleaseFromMetadata(namespace, metadataJson, uploadUser)
+	if err != nil {
+		return nil, err
+	}
+	result.Draft = draft
+	err = dao.RunInTransaction(func(tx DAO) error {
+		return registerRelease(tx, namespace, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.Metadata, nil
+}
+
+// Parses and checks the metadata of a release that's about to be registered.
+func newReleaseFromMetadata(namespace, metadataJson, uploadUser string) (*Release, error) {
 	metadata, err := core.NewReleaseMetadataFromJsonString(metadataJson)
 	if err != nil {
 		return nil, NewUserError(err)
 	}
-	releaseId := metadata.GetReleaseId()
-	parsed, err := parsers.ParseReleaseId(releaseId)
+	parsed, err := parsers.ParseReleaseId(metadata.GetReleaseId())
 	if err != nil {
 		return nil, NewUserError(err)
 	}
@@ -87,38 +129,171 @@ func AddReleaseByUser(namespace, metadataJson, uploadUser string) (*core.Release
 	if metadata.ApiVersion > core.CurrentApiVersion {
 		return nil, NewUserError(fmt.Errorf("Release format version v%d is not supported (this Inventory supports up to v%d)", metadata.ApiVersion, core.CurrentApiVersion))
 	}
-	release, err := dao.GetRelease(namespace, parsed.Name, releaseId)
-	if err != nil && !dao.IsNotFound(err) {
-		return nil, err
-	}
-	if release != nil {
-		return nil, NewUserError(fmt.Errorf("Release %s already exists", releaseId))
-	}
-	if err := ensureNamespaceExists(namespace, uploadUser); err != nil {
-		return nil, err
-	}
 	result := NewRelease(NewApplication(namespace, metadata.Name), metadata)
 	result.UploadedBy = uploadUser
 	result.UploadedAt = time.Now()
-	if err := ensureApplicationExists(namespace, result.UploadedBy, metadata, result.UploadedAt); err != nil {
-		return nil, err
+	return result, nil
+}
+
+func registerRelease(tx DAO, namespace string, release *Release) error {
+	metadata := release.Metadata
+	releaseId := metadata.GetReleaseId()
+	_, err := tx.GetRelease(namespace, metadata.Name, releaseId)
+	if err == nil {
+		return errReleaseExists(releaseId)
+	} else if err != NotFound {
+		return err
 	}
-	if err := dao.AddRelease(result); err != nil {
-		return nil, err
+	if err := ensureNamespaceExists(tx, namespace, release.UploadedBy); err != nil {
+		return err
+	}
+	if release.Draft {
+		if err := ensureDraftApplicationExists(tx, namespace, metadata); err != nil {
+			return err
+		}
+	} else if err := ensureApplicationExists(tx, namespace, release.UploadedBy, metadata, release.UploadedAt); err != nil {
+		return err
+	}
+	if err := tx.AddRelease(release); err == AlreadyExists {
+		return errReleaseExists(releaseId)
+	} else if err != nil {
+		return err
+	}
+	if release.Draft {
+		return nil
+	}
+	if err := tx.RegisterProviders(metadata); err != nil {
+		return err
+	}
+	return processDependencies(tx, release)
+}
+
+func errReleaseExists(releaseId string) error {
+	return NewUserError(fmt.Errorf("Release %s already exists", releaseId))
+}
+
+// Registers a release that was uploaded to another Inventory, keeping its
+// upload details. Used for mirrored namespaces and imported bundles.
+func registerImportedRelease(tx DAO, namespace string, release *Release) error {
+	metadata := release.Metadata
+	if metadata.ApiVersion > core.CurrentApiVersion {
+		return NewUserError(fmt.Errorf("Release format version v%d of '%s/%s' is not supported (this Inventory supports up to v%d)", metadata.ApiVersion, namespace, metadata.GetReleaseId(), core.CurrentApiVersion))
+	}
+	if release.Draft {
+		if err := ensureDraftApplicationExists(tx, namespace, metadata); err != nil {
+			return err
+		}
+		return tx.AddRelease(release)
+	}
+	if err := ensureApplicationExists(tx, namespace, release.UploadedBy, metadata, release.UploadedAt); err != nil {
+		return err
+	}
+	if err := tx.AddRelease(release); err != nil {
+		return err
+	}
+	if err := tx.RegisterProviders(metadata); err != nil {
+		return err
+	}
+	return processDependencies(tx, release)
+}
+
+// Drafts need an application to be stored under, but shouldn't change an
+// existing application's latest version.
+func ensureDraftApplicationExists(tx DAO, namespace string, metadata *core.ReleaseMetadata) error {
+	_, err := tx.GetApplication(namespace, metadata.Name)
+	if err == nil || !dao.IsNotFound(err) {
+		return err
 	}
-	if err := dao.RegisterProviders(metadata); err != nil {
+	app := NewApplication(namespace, metadata.Name)
+	app.Description = metadata.Description
+	app.Logo = metadata.Logo
+	if err := tx.AddApplication(app); err != AlreadyExists {
+		return err
+	}
+	// Created by a concurrent registration.
+	return nil
+}
+
+// Makes a draft release visible. The release needs to have a package, so
+// that it can be downloaded as soon as it resolves.
+func PublishRelease(namespace, releaseId string) (*core.ReleaseMetadata, error) {
+	parsed, err := parsers.ParseReleaseId(releaseId)
+	if err != nil {
+		return nil, NewUserError(err)
+	}
+	var release *Release
+	err = dao.RunInTransaction(func(tx DAO) error {
+		r, err := tx.GetRelease(namespace, parsed.Name, releaseId)
+		if err != nil {
+			return err
+		}
+		release = r
+		if !release.Draft {
+			return NewUserError(fmt.Errorf("Release '%s' has already been published", releaseId))
+		}
+		uris, err := tx.GetPackageURIs(release)
+		if err != nil {
+			return err
+		}
+		if len(uris) == 0 || release.PackageSHA256 == "" {
+			return NewUserError(fmt.Errorf("Can't publish release '%s' without a package", releaseId))
+		}
+		if err := ensureApplicationExists(tx, namespace, release.UploadedBy, release.Metadata, release.UploadedAt); err != nil {
+			return err
+		}
+		if err := tx.RegisterProviders(release.Metadata); err != nil {
+			return err
+		}
+		release.Draft = false
+		return processDependencies(tx, release)
+	})
+	if err != nil {
 		return nil, err
 	}
-	return result.Metadata, ProcessDependencies(result)
+	return release.Metadata, nil
 }
 
 func ProcessDependencies(release *Release) error {
-	deps := []*Dependency{}
+	return dao.RunInTransaction(func(tx DAO) error {
+		return processDependencies(tx, release)
+	})
+}
+
+func processDependencies(tx DAO, release *Release) error {
+	deps, err := parseDependencies(release.Metadata)
+	if err != nil {
+		return err
+	}
 	apps := []*Application{}
-	for _, dep := range release.Metadata.Depends {
+	for _, dep := range deps {
+		apps = append(apps, NewApplication(dep.Project, dep.Application))
+	}
+	if err := tx.SetDependencies(release, deps); err != nil {
+		return err
+	}
+	if err := tx.SetApplicationSubscribesToUpdatesFrom(release.Application, apps); err != nil {
+		return err
+	}
+	tree, err := newDependencyTreeBuilder(tx).Build(release, deps)
+	if err != nil {
+		return err
+	}
+	if err := tx.SetDependencyTree(release, tree); err != nil {
+		return err
+	}
+	release.ProcessedDependencies = true
+	if err := tx.UpdateRelease(release); err != nil {
+		return err
+	}
+	return updateDownstreamDependencyTrees(tx, release)
+}
+
+func parseDependencies(metadata *core.ReleaseMetadata) ([]*Dependency, error) {
+	deps := []*Dependency{}
+	for _, dep := range metadata.Depends {
 		parsed, err := parsers.ParseQualifiedReleaseId(dep.ReleaseId)
 		if err != nil {
-			return fmt.Errorf("Couldn't parse dependency: %s", err.Error())
+			return nil, fmt.Errorf("Couldn't parse dependency: %s", err.Error())
 		}
 		d := Dependency{
 			Project:     parsed.Project,
@@ -129,12 +304,11 @@ func ProcessDependencies(release *Release) error {
 			IsExtension: false,
 		}
 		deps = append(deps, &d)
-		apps = append(apps, NewApplication(parsed.Project, parsed.Name))
 	}
-	for _, ext := range release.Metadata.Extends {
+	for _, ext := range metadata.Extends {
 		parsed, err := parsers.ParseQualifiedReleaseId(ext.ReleaseId)
 		if err != nil {
-			return fmt.Errorf("Couldn't parse dependency: %s", err.Error())
+			return nil, fmt.Errorf("Couldn't parse dependency: %s", err.Error())
 		}
 		d := Dependency{
 			Project:     parsed.Project,
@@ -145,16 +319,8 @@ func ProcessDependencies(release *Release) error {
 			IsExtension: true,
 		}
 		deps = append(deps, &d)
-		apps = append(apps, NewApplication(parsed.Project, parsed.Name))
-	}
-	if err := dao.SetDependencies(release, deps); err != nil {
-		return err
 	}
-	if err := dao.SetApplicationSubscribesToUpdatesFrom(release.Application, apps); err != nil {
-		return err
-	}
-	release.ProcessedDependencies = true
-	return dao.UpdateRelease(release)
+	return deps, nil
 }
 
 func ProcessUnprocessedReleases() error {
@@ -163,6 +329,9 @@ func ProcessUnprocessedReleases() error {
 		return err
 	}
 	for _, release := range releases {
+		if release.Draft {
+			continue
+		}
 		if err := ProcessDependencies(release); err != nil {
 			return err
 		}
@@ -177,6 +346,9 @@ type ReleasePayload struct {
 	Downloads  int                   `json:"downloads"`
 	UploadedBy string                `json:"uploaded_by"`
 	UploadedAt time.Time             `json:"uploaded_at"`
+
+	PackageSHA256 string `json:"package_sha256,omitempty"`
+	PackageSize   int64  `json:"package_size,omitempty"`
 }
 
 func GetRelease(namespace, name, version string) (*ReleasePayload, error) {
@@ -197,6 +369,9 @@ func GetRelease(namespace, name, version string) (*ReleasePayload, error) {
 		Downloads:  release.Downloads,
 		UploadedBy: release.UploadedBy,
 		UploadedAt: release.UploadedAt,
+
+		PackageSHA256: release.PackageSHA256,
+		PackageSize:   release.PackageSize,
 	}, nil
 }
 
@@ -208,19 +383,32 @@ func GetReleaseMetadata(namespace, name, version string) (*core.ReleaseMetadata,
 	return release.Metadata, nil
 }
 
+// Releases of mirrored namespaces that can't be resolved locally are fetched
+// from the upstream inventory.
 func ResolveReleaseId(namespace, application, versionQuery string) (*Release, error) {
+	release, err := resolveReleaseId(namespace, application, versionQuery)
+	if isMirrorMiss(namespace, err) {
+		if err := mirrorApplication(namespace, application); err != nil {
+			return nil, err
+		}
+		release, err = resolveReleaseId(namespace, application, versionQuery)
+	}
+	return release, err
+}
+
+func resolveReleaseId(namespace, application, versionQuery string) (*Release, error) {
 	vq, err := parsers.ParseVersionQuery(versionQuery)
 	if err != nil {
 		return nil, NewUserError(err)
 	}
 	if vq.LatestVersion {
-		version, err := getLastVersionForPrefix(namespace, application, "")
+		version, err := getLastDownloadableVersionForPrefix(namespace, application, "")
 		if err != nil {
 			return nil, NewUserError(err)
 		}
 		versionQuery = version.ToString()
 	} else if vq.VersionPrefix != "" {
-		version, err := getLastVersionForPrefix(namespace, application, vq.VersionPrefix)
+		version, err := getLastDownloadableVersionForPrefix(namespace, application, vq.VersionPrefix)
 		if err != nil {
 			return nil, NewUserError(err)
 		}
@@ -228,11 +416,21 @@ func ResolveReleaseId(namespace, application, versionQuery string) (*Release, er
 	} else if vq.SpecificVersion != "" {
 		versionQuery = vq.SpecificVersion
 	} else if vq.SpecificTag != "" {
-		return dao.GetReleaseByTag(namespace, application, vq.SpecificTag)
+		return publishedRelease(dao.GetReleaseByTag(namespace, application, vq.SpecificTag))
 	} else {
 		return nil, NewUserError(fmt.Errorf("Unsupported version query"))
 	}
-	return dao.GetRelease(namespace, application, application+"-v"+versionQuery)
+	return publishedRelease(dao.GetRelease(namespace, application, application+"-v"+versionQuery))
+}
+
+func publishedRelease(release *Release, err error) (*Release, error) {
+	if err != nil {
+		return nil, err
+	}
+	if release.Draft {
+		return nil, NotFound
+	}
+	return release, nil
 }
 
 func TagRelease(namespace, application, releaseId, tag string) error {
@@ -257,5 +455,7 @@ func TagRelease(namespace, application, releaseId, tag string) error {
 	if err != nil {
 		return err
 	}
-	return dao.TagRelease(release, tag)
+	return dao.RunInTransaction(func(tx DAO) error {
+		return tx.TagRelease(release, tag)
+	})
 }
@@ -17,7 +17,9 @@ limitations under the License.
 package model
 
 import (
+	"bytes"
 	"fmt"
+	"sync"
 
 	"github.com/ankyra/escape-inventory/dao"
 	"github.com/ankyra/escape-inventory/dao/types"
@@ -123,6 +125,124 @@ func (s *releaseSuite) Test_AddRelease_Updates_Application_Metadata(c *C) {
 	c.Assert(app.LatestVersion, Equals, "1")
 }
 
+func (s *releaseSuite) Test_AddRelease_fails_if_release_already_exists(c *C) {
+	_, err := AddRelease("test", `{"name": "up-test", "version": "1", "project": "test"}`)
+	c.Assert(err, IsNil)
+	_, err = AddRelease("test", `{"name": "up-test", "version": "1", "project": "test"}`)
+	c.Assert(err, DeepEquals, NewUserError(fmt.Errorf("Release up-test-v1 already exists")))
+}
+
+func (s *releaseSuite) Test_AddRelease_registers_concurrent_registrations_once(c *C) {
+	errors := make(chan error, 10)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := AddRelease("test", `{"name": "up-test", "version": "1", "project": "test"}`)
+			errors <- err
+		}()
+	}
+	wg.Wait()
+	close(errors)
+	registered := 0
+	for err := range errors {
+		if err == nil {
+			registered++
+		} else {
+			c.Assert(err, DeepEquals, NewUserError(fmt.Errorf("Release up-test-v1 already exists")))
+		}
+	}
+	c.Assert(registered, Equals, 1)
+}
+
+// Fails to store dependencies, which happens after everything else has been
+// registered.
+type failingDependenciesDAO struct {
+	types.DAO
+}
+
+func (f *failingDependenciesDAO) RunInTransaction(fn func(types.DAO) error) error {
+	return f.DAO.RunInTransaction(func(tx types.DAO) error {
+		return fn(&failingDependenciesDAO{tx})
+	})
+}
+
+func (f *failingDependenciesDAO) SetDependencies(*types.Release, []*types.Dependency) error {
+	return fmt.Errorf("Database error")
+}
+
+func (s *releaseSuite) Test_AddRelease_rolls_back_failed_registration(c *C) {
+	_, err := AddRelease("test", `{"name": "up-test", "version": "1", "project": "test"}`)
+	c.Assert(err, IsNil)
+	dao.GlobalDAO = &failingDependenciesDAO{dao.GlobalDAO}
+	_, err = AddRelease("test", `{"name": "up-test", "version": "2", "project": "test", "description": "failed"}`)
+	c.Assert(err, DeepEquals, fmt.Errorf("Database error"))
+	dao.GlobalDAO = dao.GlobalDAO.(*failingDependenciesDAO).DAO
+
+	_, err = dao.GetRelease("test", "up-test", "up-test-v2")
+	c.Assert(dao.IsNotFound(err), Equals, true)
+	app, err := dao.GetApplication("test", "up-test")
+	c.Assert(err, IsNil)
+	c.Assert(app.LatestVersion, Equals, "1")
+	c.Assert(app.Description, Equals, "")
+
+	_, err = AddRelease("test", `{"name": "up-test", "version": "2", "project": "test"}`)
+	c.Assert(err, IsNil)
+}
+
+// Creates the application right after registration found it missing, like a
+// concurrent registration would.
+type racingApplicationDAO struct {
+	types.DAO
+}
+
+func (r *racingApplicationDAO) RunInTransaction(fn func(types.DAO) error) error {
+	return r.DAO.RunInTransaction(func(tx types.DAO) error {
+		return fn(&racingApplicationDAO{tx})
+	})
+}
+
+func (r *racingApplicationDAO) GetApplication(namespace, name string) (*types.Application, error) {
+	app, err := r.DAO.GetApplication(namespace, name)
+	if err != types.NotFound {
+		return app, err
+	}
+	app = types.NewApplication(namespace, name)
+	app.Description = "concurrent"
+	if err := r.DAO.AddApplication(app); err != nil {
+		return nil, err
+	}
+	return nil, types.NotFound
+}
+
+func (s *releaseSuite) Test_AddRelease_updates_application_created_concurrently(c *C) {
+	dao.GlobalDAO = &racingApplicationDAO{dao.GlobalDAO}
+	_, err := AddReleaseByUser("test", `{"name": "up-test", "version": "1", "project": "test", "description": "yo"}`, "user")
+	dao.GlobalDAO = dao.GlobalDAO.(*racingApplicationDAO).DAO
+	c.Assert(err, IsNil)
+
+	app, err := dao.GetApplication("test", "up-test")
+	c.Assert(err, IsNil)
+	c.Assert(app.Description, Equals, "yo")
+	c.Assert(app.LatestVersion, Equals, "1")
+	c.Assert(app.UploadedBy, Equals, "user")
+	_, err = dao.GetRelease("test", "up-test", "up-test-v1")
+	c.Assert(err, IsNil)
+}
+
+func (s *releaseSuite) Test_AddRelease_doesnt_create_namespace_if_registration_fails(c *C) {
+	dao.GlobalDAO = &failingDependenciesDAO{dao.GlobalDAO}
+	_, err := AddRelease("new-namespace", `{"name": "up-test", "version": "1", "project": "new-namespace"}`)
+	c.Assert(err, DeepEquals, fmt.Errorf("Database error"))
+	dao.GlobalDAO = dao.GlobalDAO.(*failingDependenciesDAO).DAO
+
+	_, err = dao.GetNamespace("new-namespace")
+	c.Assert(dao.IsNotFound(err), Equals, true)
+	_, err = dao.GetApplication("new-namespace", "up-test")
+	c.Assert(dao.IsNotFound(err), Equals, true)
+}
+
 func (s *releaseSuite) Test_AddRelease_Processes_Dependencies(c *C) {
 	_, err := AddRelease("test", `{"name": "up-test", "version": "1", "project": "test"}`)
 	c.Assert(err, IsNil)
@@ -180,3 +300,152 @@ func (s *releaseSuite) Test_AddRelease_Registers_Providers(c *C) {
 	c.Assert(providers["test/up-test-v1"], Not(IsNil))
 	c.Assert(providers["test/up-test-v1"].Version, Equals, "1")
 }
+
+func (s *releaseSuite) Test_ResolveReleaseId_skips_releases_without_a_package(c *C) {
+	metadata := `{"name": "pkg-less", "version": "1.0"}`
+	_, err := AddRelease("_", metadata)
+	c.Assert(err, IsNil)
+	c.Assert(UploadPackage("_", "pkg-less-v1.0", bytes.NewReader(releasePackage(c, "pkg-less-v1.0", metadata))), IsNil)
+	_, err = AddRelease("_", `{"name": "pkg-less", "version": "1.1"}`)
+	c.Assert(err, IsNil)
+
+	release, err := ResolveReleaseId("_", "pkg-less", "latest")
+	c.Assert(err, IsNil)
+	c.Assert(release.Version, Equals, "1.0")
+	release, err = ResolveReleaseId("_", "pkg-less", "v1.@")
+	c.Assert(err, IsNil)
+	c.Assert(release.Version, Equals, "1.0")
+	release, err = ResolveReleaseId("_", "pkg-less", "v1.1")
+	c.Assert(err, IsNil)
+	c.Assert(release.Version, Equals, "1.1")
+
+	next, err := GetNextVersion("_", "pkg-less", "1.")
+	c.Assert(err, IsNil)
+	c.Assert(next, Equals, "1.2")
+}
+
+func (s *releaseSuite) Test_AddDraftRelease_is_hidden_until_published(c *C) {
+	metadata := `{"name": "draft", "version": "1", "provides": [{"name": "provider"}]}`
+	_, err := AddRelease("_", metadata)
+	c.Assert(err, IsNil)
+	c.Assert(UploadPackage("_", "draft-v1", bytes.NewReader(releasePackage(c, "draft-v1", metadata))), IsNil)
+	_, err = AddDraftReleaseByUser("_", `{"name": "draft", "version": "2", "provides": [{"name": "provider"}]}`, "user")
+	c.Assert(err, IsNil)
+
+	release, err := ResolveReleaseId("_", "draft", "latest")
+	c.Assert(err, IsNil)
+	c.Assert(release.Version, Equals, "1")
+	_, err = ResolveReleaseId("_", "draft", "v2")
+	c.Assert(err, Equals, types.NotFound)
+	versions, err := GetApplicationVersions("_", "draft")
+	c.Assert(err, IsNil)
+	c.Assert(versions, DeepEquals, []string{"1"})
+	app, err := dao.GetApplication("_", "draft")
+	c.Assert(err, IsNil)
+	c.Assert(app.LatestVersion, Equals, "1")
+	providers, err := dao.GetProviders("provider")
+	c.Assert(err, IsNil)
+	c.Assert(providers, HasLen, 1)
+	c.Assert(providers["_/draft-v1"], Not(IsNil))
+
+	next, err := GetNextVersion("_", "draft", "")
+	c.Assert(err, IsNil)
+	c.Assert(next, Equals, "3")
+}
+
+func (s *releaseSuite) Test_AddDraftRelease_creates_hidden_application(c *C) {
+	_, err := AddDraftReleaseByUser("_", `{"name": "draft", "version": "1"}`, "user")
+	c.Assert(err, IsNil)
+	_, err = ResolveReleaseId("_", "draft", "latest")
+	c.Assert(err, Not(IsNil))
+	_, err = GetApplicationVersions("_", "draft")
+	c.Assert(err, Equals, types.NotFound)
+}
+
+func (s *releaseSuite) Test_AddDraftRelease_is_hidden_from_tags(c *C) {
+	_, err := AddDraftReleaseByUser("_", `{"name": "draft", "version": "1"}`, "user")
+	c.Assert(err, IsNil)
+	release, err := dao.GetRelease("_", "draft", "draft-v1")
+	c.Assert(err, IsNil)
+	c.Assert(dao.TagRelease(release, "stable"), IsNil)
+	_, err = ResolveReleaseId("_", "draft", "@stable")
+	c.Assert(err, Equals, types.NotFound)
+}
+
+func (s *releaseSuite) Test_PublishRelease(c *C) {
+	_, err := AddRelease("_", `{"name": "dep", "version": "1"}`)
+	c.Assert(err, IsNil)
+	_, err = AddRelease("_", `{"name": "draft", "version": "1", "provides": [{"name": "provider"}]}`)
+	c.Assert(err, IsNil)
+	_, err = AddDraftReleaseByUser("_", `{"name": "draft", "version": "2", "description": "v2", "provides": [{"name": "provider"}], "depends": [{"release_id": "_/dep-v1"}]}`, "user")
+	c.Assert(err, IsNil)
+	downstream, err := GetDownstreamDependencies("_", "dep", "v1")
+	c.Assert(err, IsNil)
+	c.Assert(downstream, HasLen, 0)
+	pkg := releasePackage(c, "draft-v2", `{"name": "draft", "version": "2", "description": "v2", "provides": [{"name": "provider"}], "depends": [{"release_id": "_/dep-v1"}]}`)
+	c.Assert(publishStorage(nil).UploadPackage("_", "draft-v2", bytes.NewReader(pkg)), IsNil)
+
+	metadata, err := PublishRelease("_", "draft-v2")
+	c.Assert(err, IsNil)
+	c.Assert(metadata.Version, Equals, "2")
+
+	release, err := ResolveReleaseId("_", "draft", "latest")
+	c.Assert(err, IsNil)
+	c.Assert(release.Version, Equals, "2")
+	c.Assert(release.Draft, Equals, false)
+	c.Assert(release.ProcessedDependencies, Equals, true)
+	app, err := dao.GetApplication("_", "draft")
+	c.Assert(err, IsNil)
+	c.Assert(app.LatestVersion, Equals, "2")
+	c.Assert(app.Description, Equals, "v2")
+	c.Assert(app.UploadedBy, Equals, "user")
+	providers, err := dao.GetProviders("provider")
+	c.Assert(err, IsNil)
+	c.Assert(providers, HasLen, 1)
+	c.Assert(providers["_/draft-v2"], Not(IsNil))
+	downstream, err = GetDownstreamDependencies("_", "dep", "v1")
+	c.Assert(err, IsNil)
+	c.Assert(downstream, HasLen, 1)
+
+	_, err = PublishRelease("_", "draft-v2")
+	c.Assert(err, Not(IsNil))
+	c.Assert(IsUserError(err), Equals, true)
+	c.Assert(err.Error(), Equals, "Release 'draft-v2' has already been published")
+}
+
+func (s *releaseSuite) Test_PublishRelease_doesnt_lower_latest_version(c *C) {
+	_, err := AddDraftReleaseByUser("_", `{"name": "draft", "version": "1"}`, "user")
+	c.Assert(err, IsNil)
+	_, err = AddRelease("_", `{"name": "draft", "version": "2"}`)
+	c.Assert(err, IsNil)
+	pkg := releasePackage(c, "draft-v1", `{"name": "draft", "version": "1"}`)
+	c.Assert(publishStorage(nil).UploadPackage("_", "draft-v1", bytes.NewReader(pkg)), IsNil)
+
+	_, err = PublishRelease("_", "draft-v1")
+	c.Assert(err, IsNil)
+	app, err := dao.GetApplication("_", "draft")
+	c.Assert(err, IsNil)
+	c.Assert(app.LatestVersion, Equals, "2")
+
+	_, err = AddRelease("_", `{"name": "draft", "version": "1.5"}`)
+	c.Assert(err, IsNil)
+	app, err = dao.GetApplication("_", "draft")
+	c.Assert(err, IsNil)
+	c.Assert(app.LatestVersion, Equals, "2")
+}
+
+func (s *releaseSuite) Test_PublishRelease_fails_without_package(c *C) {
+	_, err := AddDraftReleaseByUser("_", `{"name": "draft", "version": "1"}`, "user")
+	c.Assert(err, IsNil)
+	_, err = PublishRelease("_", "draft-v1")
+	c.Assert(err, Not(IsNil))
+	c.Assert(IsUserError(err), Equals, true)
+	c.Assert(err.Error(), Equals, "Can't publish release 'draft-v1' without a package")
+	_, err = ResolveReleaseId("_", "draft", "v1")
+	c.Assert(err, Equals, types.NotFound)
+}
+
+func (s *releaseSuite) Test_PublishRelease_fails_if_release_doesnt_exist(c *C) {
+	_, err := PublishRelease("_", "draft-v1")
+	c.Assert(err, Equals, types.NotFound)
+}
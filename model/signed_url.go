@@ -0,0 +1,145 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/storage"
+)
+
+// Requests under this path are authenticated by their signature instead of
+// by the usual credentials.
+const SignedDownloadPathPrefix = "/api/v1/signed/"
+
+const (
+	DefaultSignedURLExpiry = time.Hour
+	MaxSignedURLExpiry     = 7 * 24 * time.Hour
+)
+
+var downloadSigningKey []byte
+
+type SignedURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Sets the key used to sign download URLs. Without a key a random one is
+// generated, which means that links stop working when the Inventory restarts
+// and that they're only valid on the instance that issued them.
+func InitDownloadSigning(key string) error {
+	if key != "" {
+		downloadSigningKey = []byte(key)
+		return nil
+	}
+	log.Printf("WARN: No download_signing_key configured. Signed download URLs won't survive a restart.\n")
+	randomKey := make([]byte, 32)
+	if _, err := rand.Read(randomKey); err != nil {
+		return err
+	}
+	downloadSigningKey = randomKey
+	return nil
+}
+
+// Returns a link that can be used to download the package without
+// credentials until it expires. Version queries are resolved first, so the
+// link always points at the same release.
+func SignDownloadURL(namespace, application, versionQuery string, expiresIn time.Duration) (*SignedURL, error) {
+	if expiresIn <= 0 {
+		expiresIn = DefaultSignedURLExpiry
+	}
+	if expiresIn > MaxSignedURLExpiry {
+		return nil, NewUserError(fmt.Errorf("Signed URLs can't be valid for longer than %s", MaxSignedURLExpiry))
+	}
+	release, err := ResolveReleaseId(namespace, application, versionQuery)
+	if err != nil {
+		return nil, err
+	}
+	uris, err := dao.GetPackageURIs(release)
+	if err != nil {
+		return nil, err
+	}
+	if len(uris) == 0 {
+		return nil, types.NotFound
+	}
+	version := "v" + release.Version
+	expires := time.Now().Add(expiresIn).Truncate(time.Second)
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", downloadSignature(namespace, application, version, expires.Unix()))
+	path := SignedDownloadPathPrefix + namespace + "/" + application + "/" + version + "/download"
+	return &SignedURL{
+		URL:       path + "?" + query.Encode(),
+		ExpiresAt: expires.UTC(),
+	}, nil
+}
+
+// Returns types.Unauthorized if the signature is invalid or has expired.
+func VerifyDownloadSignature(namespace, application, version, expires, signature string) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return types.Unauthorized
+	}
+	expected := downloadSignature(namespace, application, version, expiresAt)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return types.Unauthorized
+	}
+	return nil
+}
+
+// Returns the storage backend's own signed URL for the package, or an empty
+// string if the preferred backend can't sign URLs, in which case the package
+// should be served by the Inventory itself. The download is counted
+// when a URL is returned, because it's served by the backend.
+func GetSignedDownloadRedirect(namespace, application, version string, expires time.Time) (string, error) {
+	release, err := ResolveReleaseId(namespace, application, version)
+	if err != nil {
+		return "", err
+	}
+	uris, err := dao.GetPackageURIs(release)
+	if err != nil {
+		return "", err
+	}
+	uris = storage.SortURIsByPreference(uris)
+	if len(uris) == 0 {
+		return "", types.NotFound
+	}
+	signedURL, err := storage.SignedURL(namespace, uris[0], expires)
+	if err != nil {
+		log.Printf("Warn: Could not sign URL for '%s': %s\n", uris[0], err.Error())
+		return "", nil
+	} else if signedURL == "" {
+		return "", nil
+	}
+	return signedURL, countDownload(release)
+}
+
+func downloadSignature(namespace, application, version string, expires int64) string {
+	mac := hmac.New(sha256.New, downloadSigningKey)
+	fmt.Fprintf(mac, "%s/%s/%s\n%d", namespace, application, version, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *appSuite) addReleaseWithPackage(c *C) {
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(dao.AddPackageURI(release, "mem://name-v1.0.0.tgz"), IsNil)
+}
+
+func (s *appSuite) Test_SignDownloadURL(c *C) {
+	dao.TestSetup()
+	c.Assert(InitDownloadSigning("secret"), IsNil)
+	s.addReleaseWithPackage(c)
+
+	signed, err := SignDownloadURL("namespace", "name", "latest", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(strings.HasPrefix(signed.URL, "/api/v1/signed/namespace/name/v1.0.0/download?"), Equals, true)
+	c.Assert(signed.ExpiresAt.After(time.Now()), Equals, true)
+	c.Assert(signed.ExpiresAt.Before(time.Now().Add(time.Minute+time.Second)), Equals, true)
+
+	u, err := url.Parse(signed.URL)
+	c.Assert(err, IsNil)
+	expires, signature := u.Query().Get("expires"), u.Query().Get("signature")
+	c.Assert(VerifyDownloadSignature("namespace", "name", "v1.0.0", expires, signature), IsNil)
+	c.Assert(VerifyDownloadSignature("namespace", "name", "v1.0.1", expires, signature), Equals, types.Unauthorized)
+	c.Assert(VerifyDownloadSignature("other", "name", "v1.0.0", expires, signature), Equals, types.Unauthorized)
+	c.Assert(VerifyDownloadSignature("namespace", "name", "v1.0.0", expires+"0", signature), Equals, types.Unauthorized)
+
+	c.Assert(InitDownloadSigning("other-secret"), IsNil)
+	c.Assert(VerifyDownloadSignature("namespace", "name", "v1.0.0", expires, signature), Equals, types.Unauthorized)
+}
+
+func (s *appSuite) Test_VerifyDownloadSignature_fails_when_expired(c *C) {
+	c.Assert(InitDownloadSigning("secret"), IsNil)
+	expires := time.Now().Add(-time.Second).Unix()
+	signature := downloadSignature("namespace", "name", "v1.0.0", expires)
+	err := VerifyDownloadSignature("namespace", "name", "v1.0.0", strconv.FormatInt(expires, 10), signature)
+	c.Assert(err, Equals, types.Unauthorized)
+}
+
+func (s *appSuite) Test_SignDownloadURL_fails_without_package(c *C) {
+	dao.TestSetup()
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	_, err = SignDownloadURL("namespace", "name", "v1.0.0", time.Minute)
+	c.Assert(err, Equals, types.NotFound)
+}
+
+func (s *appSuite) Test_SignDownloadURL_fails_if_expiry_too_long(c *C) {
+	dao.TestSetup()
+	s.addReleaseWithPackage(c)
+	_, err := SignDownloadURL("namespace", "name", "v1.0.0", MaxSignedURLExpiry+time.Second)
+	c.Assert(err, Not(IsNil))
+	c.Assert(IsUserError(err), Equals, true)
+}
+
+func (s *appSuite) Test_GetSignedDownloadRedirect_is_empty_if_backend_cant_sign(c *C) {
+	dao.TestSetup()
+	s.addReleaseWithPackage(c)
+	redirect, err := GetSignedDownloadRedirect("namespace", "name", "v1.0.0", time.Now().Add(time.Minute))
+	c.Assert(err, IsNil)
+	c.Assert(redirect, Equals, "")
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/storage"
+)
+
+// Compares the registered package and artifact URIs with what's actually
+// stored. It reports dangling URIs, whose package is missing from storage,
+// releases without a package and orphaned packages, which are stored but not
+// registered to any release. Nothing is changed unless DeleteOrphans is set.
+// Stored and registered URIs are compared on their storage.PackageKey.
+//
+// Orphans aren't deleted from a backend in which none of the packages are
+// registered, unless Force is set. That's what a misconfigured backend looks
+// like, but also what's left after the only namespace was hard deleted.
+type StorageCheck struct {
+	DeleteOrphans bool `json:"delete_orphans"`
+	Force         bool `json:"force"`
+}
+
+// Orphans that were stored recently are never deleted, because they may
+// belong to an upload that hasn't been registered yet.
+const orphanGracePeriod = time.Hour
+
+func CheckStorage(check *StorageCheck, progress io.Writer) error {
+	return newStorageProvider().CheckStorage(check, progress)
+}
+
+func (s *storageProvider) CheckStorage(check *StorageCheck, progress io.Writer) error {
+	releases, err := dao.GetAllReleases()
+	if err != nil {
+		return err
+	}
+	sortReleases(releases)
+	registered := map[string]bool{}
+	dangling, withoutPackage, failed := 0, 0, 0
+	for _, release := range releases {
+		name := release.Application.Project + "/" + release.ReleaseId
+		uris, err := dao.GetPackageURIs(release)
+		if err != nil {
+			return err
+		}
+		if len(uris) == 0 {
+			withoutPackage += 1
+			fmt.Fprintf(progress, "%s: no package\n", name)
+		}
+		artifacts, err := dao.GetArtifacts(release)
+		if err != nil {
+			return err
+		}
+		for _, artifact := range artifacts {
+			uris = append(uris, artifact.URIs...)
+		}
+		for _, uri := range uris {
+			registered[storage.PackageKey(uri)] = true
+			_, _, err := s.Stat(release.Application.Project, uri)
+			if isMissingPackage(err) {
+				dangling += 1
+				fmt.Fprintf(progress, "%s: dangling URI %s\n", name, uri)
+			} else if err != nil {
+				failed += 1
+				log.Printf("Error: Failed to check '%s': %s\n", uri, err.Error())
+				fmt.Fprintf(progress, "%s: failed to check %s: %s\n", name, uri, err.Error())
+			}
+		}
+	}
+	orphans, deleted := 0, 0
+	for _, backend := range s.ConfiguredBackends() {
+		uris, err := s.ListPackages(backend)
+		if err == storage.ErrListingNotSupported {
+			fmt.Fprintf(progress, "Skipping orphan check for '%s' storage backend: listing is not supported\n", backend)
+			continue
+		} else if err != nil {
+			failed += 1
+			fmt.Fprintf(progress, "Failed to list '%s' storage backend: %s\n", backend, err.Error())
+			continue
+		}
+		sort.Strings(uris)
+		deleteOrphans := check.DeleteOrphans
+		if deleteOrphans && !check.Force && len(uris) > 0 && !anyRegistered(uris, registered) {
+			// Most likely the registered URIs point somewhere else, in which
+			// case deleting would wipe out every package in the backend.
+			deleteOrphans = false
+			failed += 1
+			fmt.Fprintf(progress, "Not deleting orphans from '%s' storage backend: none of its %d packages are registered; pass force to delete them anyway\n", backend, len(uris))
+		}
+		for _, uri := range uris {
+			if registered[storage.PackageKey(uri)] {
+				continue
+			}
+			orphans += 1
+			if !deleteOrphans {
+				fmt.Fprintf(progress, "orphaned package %s\n", uri)
+				continue
+			}
+			_, modTime, err := s.Stat("", uri)
+			if err == nil && time.Since(modTime) < orphanGracePeriod {
+				fmt.Fprintf(progress, "orphaned package %s: kept, stored less than %s ago\n", uri, orphanGracePeriod)
+				continue
+			}
+			if err == nil {
+				err = s.DeletePackage("", uri)
+			}
+			if err != nil {
+				failed += 1
+				fmt.Fprintf(progress, "orphaned package %s: failed to delete: %s\n", uri, err.Error())
+				continue
+			}
+			deleted += 1
+			fmt.Fprintf(progress, "orphaned package %s: deleted\n", uri)
+		}
+	}
+	fmt.Fprintf(progress, "Checked %d releases: %d dangling URIs, %d releases without a package, %d orphaned packages (%d deleted), %d errors.\n",
+		len(releases), dangling, withoutPackage, orphans, deleted, failed)
+	if failed > 0 {
+		return fmt.Errorf("Storage check failed with %d errors", failed)
+	}
+	return nil
+}
+
+func anyRegistered(uris []string, registered map[string]bool) bool {
+	for _, uri := range uris {
+		if registered[storage.PackageKey(uri)] {
+			return true
+		}
+	}
+	return false
+}
+
+func isMissingPackage(err error) bool {
+	return err == types.NotFound || os.IsNotExist(err)
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/storage"
+
+	. "gopkg.in/check.v1"
+)
+
+type checkedStorage struct {
+	Packages map[string]time.Time
+	Deleted  []string
+}
+
+func (f *checkedStorage) provider() *storageProvider {
+	return &storageProvider{
+		Stat: func(namespace, uri string) (int64, time.Time, error) {
+			modTime, ok := f.Packages[uri]
+			if !ok {
+				return 0, time.Time{}, types.NotFound
+			}
+			return 12, modTime, nil
+		},
+		ConfiguredBackends: func() []string {
+			return []string{"memory", "gcs"}
+		},
+		ListPackages: func(backend string) ([]string, error) {
+			if backend == "gcs" {
+				return nil, storage.ErrListingNotSupported
+			}
+			uris := []string{}
+			for uri := range f.Packages {
+				uris = append(uris, uri)
+			}
+			return uris, nil
+		},
+		DeletePackage: func(namespace, uri string) error {
+			f.Deleted = append(f.Deleted, uri)
+			delete(f.Packages, uri)
+			return nil
+		},
+	}
+}
+
+func (s *appSuite) setUpStorageCheck(c *C) *checkedStorage {
+	dao.TestSetup()
+	old := time.Now().Add(-2 * time.Hour)
+	fake := &checkedStorage{
+		Packages: map[string]time.Time{
+			"mem://name-v1.0.0.tgz":   old,
+			"mem://orphan-v1.0.0.tgz": old,
+			"mem://recent-v1.0.0.tgz": time.Now(),
+		},
+	}
+	for _, version := range []string{"1.0.0", "1.0.1", "1.0.2"} {
+		_, err := AddRelease("namespace", `{"name": "name", "version": "`+version+`"}`)
+		c.Assert(err, IsNil)
+	}
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(dao.AddPackageURI(release, "mem://name-v1.0.0.tgz"), IsNil)
+	release, err = dao.GetRelease("namespace", "name", "name-v1.0.1")
+	c.Assert(err, IsNil)
+	c.Assert(dao.AddPackageURI(release, "mem://name-v1.0.1.tgz"), IsNil)
+	return fake
+}
+
+func (s *appSuite) Test_CheckStorage_dry_run(c *C) {
+	fake := s.setUpStorageCheck(c)
+	progress := bytes.NewBuffer(nil)
+	err := fake.provider().CheckStorage(&StorageCheck{}, progress)
+	c.Assert(err, IsNil)
+	c.Assert(progress.String(), Equals, `namespace/name-v1.0.1: dangling URI mem://name-v1.0.1.tgz
+namespace/name-v1.0.2: no package
+orphaned package mem://orphan-v1.0.0.tgz
+orphaned package mem://recent-v1.0.0.tgz
+Skipping orphan check for 'gcs' storage backend: listing is not supported
+Checked 3 releases: 1 dangling URIs, 1 releases without a package, 2 orphaned packages (0 deleted), 0 errors.
+`)
+	c.Assert(fake.Deleted, HasLen, 0)
+}
+
+func (s *appSuite) Test_CheckStorage_deletes_orphans(c *C) {
+	fake := s.setUpStorageCheck(c)
+	progress := bytes.NewBuffer(nil)
+	err := fake.provider().CheckStorage(&StorageCheck{DeleteOrphans: true}, progress)
+	c.Assert(err, IsNil)
+	c.Assert(progress.String(), Equals, `namespace/name-v1.0.1: dangling URI mem://name-v1.0.1.tgz
+namespace/name-v1.0.2: no package
+orphaned package mem://orphan-v1.0.0.tgz: deleted
+orphaned package mem://recent-v1.0.0.tgz: kept, stored less than 1h0m0s ago
+Skipping orphan check for 'gcs' storage backend: listing is not supported
+Checked 3 releases: 1 dangling URIs, 1 releases without a package, 2 orphaned packages (1 deleted), 0 errors.
+`)
+	c.Assert(fake.Deleted, DeepEquals, []string{"mem://orphan-v1.0.0.tgz"})
+}
+
+func (s *appSuite) Test_CheckStorage_includes_artifacts(c *C) {
+	fake := s.setUpStorageCheck(c)
+	fake.Packages["mem://name-v1.0.0-docs.tgz"] = time.Now().Add(-2 * time.Hour)
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(dao.AddArtifact(release, &types.Artifact{Name: "docs", URIs: []string{"mem://name-v1.0.0-docs.tgz"}}), IsNil)
+	c.Assert(dao.AddArtifact(release, &types.Artifact{Name: "sbom", URIs: []string{"mem://name-v1.0.0-sbom.tgz"}}), IsNil)
+	progress := bytes.NewBuffer(nil)
+	err = fake.provider().CheckStorage(&StorageCheck{DeleteOrphans: true}, progress)
+	c.Assert(err, IsNil)
+	c.Assert(progress.String(), Equals, `namespace/name-v1.0.0: dangling URI mem://name-v1.0.0-sbom.tgz
+namespace/name-v1.0.1: dangling URI mem://name-v1.0.1.tgz
+namespace/name-v1.0.2: no package
+orphaned package mem://orphan-v1.0.0.tgz: deleted
+orphaned package mem://recent-v1.0.0.tgz: kept, stored less than 1h0m0s ago
+Skipping orphan check for 'gcs' storage backend: listing is not supported
+Checked 3 releases: 2 dangling URIs, 1 releases without a package, 2 orphaned packages (1 deleted), 0 errors.
+`)
+	c.Assert(fake.Deleted, DeepEquals, []string{"mem://orphan-v1.0.0.tgz"})
+}
+
+func (s *appSuite) Test_CheckStorage_matches_packages_in_moved_storage(c *C) {
+	fake := s.setUpStorageCheck(c)
+	old := time.Now().Add(-2 * time.Hour)
+	fake.Packages = map[string]time.Time{
+		"file:///mnt/releases/namespace/name/name-v1.0.2.tgz": old,
+		"file:///mnt/releases/namespace/name/orphan.tgz":      old,
+	}
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.2")
+	c.Assert(err, IsNil)
+	c.Assert(dao.AddPackageURI(release, "file:///var/lib/escape/releases/namespace/name/name-v1.0.2.tgz"), IsNil)
+	provider := fake.provider()
+	provider.Stat = func(namespace, uri string) (int64, time.Time, error) {
+		return 12, old, nil
+	}
+	progress := bytes.NewBuffer(nil)
+	err = provider.CheckStorage(&StorageCheck{DeleteOrphans: true}, progress)
+	c.Assert(err, IsNil)
+	c.Assert(fake.Deleted, DeepEquals, []string{"file:///mnt/releases/namespace/name/orphan.tgz"})
+}
+
+func (s *appSuite) Test_CheckStorage_doesnt_delete_if_no_packages_are_registered(c *C) {
+	fake := s.setUpStorageCheck(c)
+	delete(fake.Packages, "mem://name-v1.0.0.tgz")
+	progress := bytes.NewBuffer(nil)
+	err := fake.provider().CheckStorage(&StorageCheck{DeleteOrphans: true}, progress)
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Storage check failed with 1 errors")
+	c.Assert(progress.String(), Equals, `namespace/name-v1.0.0: dangling URI mem://name-v1.0.0.tgz
+namespace/name-v1.0.1: dangling URI mem://name-v1.0.1.tgz
+namespace/name-v1.0.2: no package
+Not deleting orphans from 'memory' storage backend: none of its 2 packages are registered; pass force to delete them anyway
+orphaned package mem://orphan-v1.0.0.tgz
+orphaned package mem://recent-v1.0.0.tgz
+Skipping orphan check for 'gcs' storage backend: listing is not supported
+Checked 3 releases: 2 dangling URIs, 1 releases without a package, 2 orphaned packages (0 deleted), 1 errors.
+`)
+	c.Assert(fake.Deleted, HasLen, 0)
+}
+
+func (s *appSuite) Test_CheckStorage_deletes_packages_of_hard_deleted_namespace_if_forced(c *C) {
+	fake := s.setUpStorageCheck(c)
+	c.Assert(HardDeleteNamespace("namespace"), IsNil)
+
+	progress := bytes.NewBuffer(nil)
+	err := fake.provider().CheckStorage(&StorageCheck{DeleteOrphans: true}, progress)
+	c.Assert(err, Not(IsNil))
+	c.Assert(fake.Deleted, HasLen, 0)
+
+	progress = bytes.NewBuffer(nil)
+	err = fake.provider().CheckStorage(&StorageCheck{DeleteOrphans: true, Force: true}, progress)
+	c.Assert(err, IsNil)
+	c.Assert(progress.String(), Equals, `orphaned package mem://name-v1.0.0.tgz: deleted
+orphaned package mem://orphan-v1.0.0.tgz: deleted
+orphaned package mem://recent-v1.0.0.tgz: kept, stored less than 1h0m0s ago
+Skipping orphan check for 'gcs' storage backend: listing is not supported
+Checked 0 releases: 0 dangling URIs, 0 releases without a package, 3 orphaned packages (2 deleted), 0 errors.
+`)
+	c.Assert(fake.Deleted, DeepEquals, []string{"mem://name-v1.0.0.tgz", "mem://orphan-v1.0.0.tgz"})
+}
+
+func (s *appSuite) Test_CheckStorage_reports_errors(c *C) {
+	fake := s.setUpStorageCheck(c)
+	provider := fake.provider()
+	provider.Stat = func(namespace, uri string) (int64, time.Time, error) {
+		if uri == "mem://name-v1.0.1.tgz" {
+			return 0, time.Time{}, &os.PathError{Op: "stat", Path: uri, Err: os.ErrNotExist}
+		}
+		return 0, time.Time{}, fmt.Errorf("Stat error")
+	}
+	progress := bytes.NewBuffer(nil)
+	err := provider.CheckStorage(&StorageCheck{}, progress)
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Storage check failed with 1 errors")
+	c.Assert(progress.String(), Matches, `(?s)namespace/name-v1.0.0: failed to check mem://name-v1.0.0.tgz: Stat error
+namespace/name-v1.0.1: dangling URI mem://name-v1.0.1.tgz
+.*`)
+}
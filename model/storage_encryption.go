@@ -0,0 +1,190 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/storage"
+)
+
+// Re-encrypts the stored packages and artifacts that aren't encrypted with
+// the current master key, because they were stored before encryption was
+// enabled or before the master key was rotated. Every package is read back,
+// verified against its checksum and stored again in the same backend. Once
+// this finishes without errors, old master keys can be removed from the key
+// file. With DryRun set the packages are only reported.
+type StorageReencryption struct {
+	DryRun bool `json:"dry_run"`
+}
+
+func ReencryptStorage(reencryption *StorageReencryption, progress io.Writer) error {
+	return newStorageProvider().ReencryptStorage(reencryption, progress)
+}
+
+func (s *storageProvider) ReencryptStorage(reencryption *StorageReencryption, progress io.Writer) error {
+	if !s.EncryptionEnabled() {
+		return NewUserError(fmt.Errorf("Encryption at rest is not configured"))
+	}
+	releases, err := dao.GetAllReleases()
+	if err != nil {
+		return err
+	}
+	sortReleases(releases)
+	reencrypted, upToDate, failed := 0, 0, 0
+	for i, release := range releases {
+		prefix := fmt.Sprintf("[%d/%d] %s/%s:", i+1, len(releases), release.Application.Project, release.ReleaseId)
+		packages, err := s.releasePackages(release)
+		if err != nil {
+			return err
+		}
+		for _, pkg := range packages {
+			needsReencryption, err := s.NeedsReencryption(release.Application.Project, pkg.URI)
+			if err == nil && !needsReencryption {
+				upToDate += 1
+				continue
+			}
+			if err == nil && reencryption.DryRun {
+				reencrypted += 1
+				fmt.Fprintf(progress, "%s needs re-encryption: %s\n", prefix, pkg.URI)
+				continue
+			}
+			if err == nil {
+				err = s.reencryptPackage(release, pkg)
+			}
+			if err != nil {
+				failed += 1
+				log.Printf("Error: Failed to re-encrypt '%s': %s\n", pkg.URI, err.Error())
+				fmt.Fprintf(progress, "%s failed to re-encrypt %s: %s\n", prefix, pkg.URI, err.Error())
+				continue
+			}
+			reencrypted += 1
+			fmt.Fprintf(progress, "%s re-encrypted %s\n", prefix, pkg.URI)
+		}
+	}
+	if reencryption.DryRun {
+		fmt.Fprintf(progress, "%d packages need re-encryption, %d are up to date, %d errors.\n", reencrypted, upToDate, failed)
+	} else {
+		fmt.Fprintf(progress, "Re-encrypted %d packages, %d were up to date, %d errors.\n", reencrypted, upToDate, failed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("Re-encryption failed with %d errors", failed)
+	}
+	return nil
+}
+
+// A package or artifact stored at a single URI.
+type storedPackage struct {
+	URI      string
+	Artifact string
+	SHA256   string
+	Size     int64
+}
+
+func (s *storageProvider) releasePackages(release *types.Release) ([]storedPackage, error) {
+	uris, err := dao.GetPackageURIs(release)
+	if err != nil {
+		return nil, err
+	}
+	packages := []storedPackage{}
+	for _, uri := range uris {
+		packages = append(packages, storedPackage{uri, "", release.PackageSHA256, release.PackageSize})
+	}
+	artifacts, err := dao.GetArtifacts(release)
+	if err != nil {
+		return nil, err
+	}
+	for _, artifact := range artifacts {
+		for _, uri := range artifact.URIs {
+			packages = append(packages, storedPackage{uri, artifact.Name, artifact.SHA256, artifact.Size})
+		}
+	}
+	return packages, nil
+}
+
+// Packages are read into a temporary file first, because they're written
+// back to the same location.
+func (s *storageProvider) reencryptPackage(release *types.Release, pkg storedPackage) error {
+	backend := s.backendForURI(pkg.URI)
+	if backend == "" {
+		return fmt.Errorf("The storage backend for '%s' is not configured", pkg.URI)
+	}
+	tmp, err := ioutil.TempFile("", "escape-inventory-reencryption")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	namespace := release.Application.Project
+	if err := s.downloadTo(tmp, namespace, pkg.URI, pkg.SHA256, pkg.Size); err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	var newURI string
+	if pkg.Artifact == "" {
+		newURI, err = s.UploadTo(backend, namespace, release.ReleaseId, tmp)
+	} else {
+		newURI, err = s.StoreArtifactTo(backend, namespace, release.ReleaseId, pkg.Artifact, tmp)
+	}
+	if err != nil {
+		return err
+	}
+	if newURI != pkg.URI {
+		s.deleteMisplacedPackage(release, pkg, newURI)
+		return fmt.Errorf("Package was stored as '%s' instead of '%s'", newURI, pkg.URI)
+	}
+	return nil
+}
+
+// The backends don't say where a package will be stored until it's written,
+// so a package that ended up somewhere else is removed again. Unless it
+// replaced the package under the same key, or it's registered itself, in
+// which case it's still in use.
+func (s *storageProvider) deleteMisplacedPackage(release *types.Release, pkg storedPackage, uri string) {
+	if storage.PackageKey(uri) == storage.PackageKey(pkg.URI) {
+		return
+	}
+	packages, err := s.releasePackages(release)
+	if err != nil {
+		return
+	}
+	registered := []string{}
+	for _, p := range packages {
+		registered = append(registered, p.URI)
+	}
+	s.deleteUploads(release.Application.Project, unregisteredURIs([]string{uri}, registered))
+}
+
+// Returns the name of the configured backend that stores the URI.
+func (s *storageProvider) backendForURI(uri string) string {
+	scheme := uriScheme(uri)
+	for _, backend := range s.ConfiguredBackends() {
+		if storage.URIScheme(backend) == scheme {
+			return backend
+		}
+	}
+	return ""
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+	. "gopkg.in/check.v1"
+)
+
+// Packages stored by the fake are prefixed with the id of the key they're
+// "encrypted" with.
+func (f *fakeStorage) encryptingProvider() *storageProvider {
+	provider := f.provider()
+	provider.UploadTo = func(backend, namespace, releaseId string, pkg io.Reader) (string, error) {
+		data, err := ioutil.ReadAll(pkg)
+		if err != nil {
+			return "", err
+		}
+		f.Uploads += 1
+		uri := "file:///releases/" + releaseId + ".tgz"
+		f.Files[uri] = "new:" + string(data)
+		return uri, nil
+	}
+	provider.StoreArtifactTo = func(backend, namespace, releaseId, artifact string, pkg io.Reader) (string, error) {
+		return provider.UploadTo(backend, namespace, releaseId+"-"+artifact, pkg)
+	}
+	provider.Download = func(namespace, uri string) (io.ReadSeekCloser, error) {
+		data, ok := f.Files[uri]
+		if !ok {
+			return nil, types.NotFound
+		}
+		data = strings.TrimPrefix(strings.TrimPrefix(data, "old:"), "new:")
+		return nopCloser{bytes.NewReader([]byte(data))}, nil
+	}
+	provider.ConfiguredBackends = func() []string {
+		return []string{"local"}
+	}
+	provider.EncryptionEnabled = func() bool {
+		return true
+	}
+	provider.NeedsReencryption = func(namespace, uri string) (bool, error) {
+		data, ok := f.Files[uri]
+		if !ok {
+			return false, types.NotFound
+		}
+		return !strings.HasPrefix(data, "new:"), nil
+	}
+	return provider
+}
+
+func (s *suite) Test_ReencryptStorage(c *C) {
+	storage := newFakeStorage()
+	release := storage.addRelease(c, "1.0.0", "file:///releases/name-v1.0.0.tgz", "package data")
+	storage.addRelease(c, "1.0.1", "file:///releases/name-v1.0.1.tgz", "old:package data 2")
+	storage.addRelease(c, "1.0.2", "file:///releases/name-v1.0.2.tgz", "new:package data 3")
+	artifact := &types.Artifact{Name: "docs", URIs: []string{"file:///releases/name-v1.0.0-docs.tgz"}}
+	c.Assert(dao.AddArtifact(release, artifact), IsNil)
+	storage.Files["file:///releases/name-v1.0.0-docs.tgz"] = "old:docs"
+	progress := bytes.NewBuffer([]byte{})
+
+	err := storage.encryptingProvider().ReencryptStorage(&StorageReencryption{}, progress)
+	c.Assert(err, IsNil)
+	c.Assert(progress.String(), Equals, `[1/3] namespace/name-v1.0.0: re-encrypted file:///releases/name-v1.0.0.tgz
+[1/3] namespace/name-v1.0.0: re-encrypted file:///releases/name-v1.0.0-docs.tgz
+[2/3] namespace/name-v1.0.1: re-encrypted file:///releases/name-v1.0.1.tgz
+Re-encrypted 3 packages, 1 were up to date, 0 errors.
+`)
+	c.Assert(storage.Files, DeepEquals, map[string]string{
+		"file:///releases/name-v1.0.0.tgz":      "new:package data",
+		"file:///releases/name-v1.0.0-docs.tgz": "new:docs",
+		"file:///releases/name-v1.0.1.tgz":      "new:package data 2",
+		"file:///releases/name-v1.0.2.tgz":      "new:package data 3",
+	})
+}
+
+func (s *suite) Test_ReencryptStorage_dry_run(c *C) {
+	storage := newFakeStorage()
+	storage.addRelease(c, "1.0.0", "file:///releases/name-v1.0.0.tgz", "old:package data")
+	storage.addRelease(c, "1.0.1", "file:///releases/name-v1.0.1.tgz", "new:package data 2")
+	progress := bytes.NewBuffer([]byte{})
+
+	err := storage.encryptingProvider().ReencryptStorage(&StorageReencryption{DryRun: true}, progress)
+	c.Assert(err, IsNil)
+	c.Assert(progress.String(), Equals, `[1/2] namespace/name-v1.0.0: needs re-encryption: file:///releases/name-v1.0.0.tgz
+1 packages need re-encryption, 1 are up to date, 0 errors.
+`)
+	c.Assert(storage.Uploads, Equals, 0)
+}
+
+func (s *suite) Test_ReencryptStorage_reports_failures(c *C) {
+	storage := newFakeStorage()
+	storage.addRelease(c, "1.0.0", "file:///releases/name-v1.0.0.tgz", "old:package data")
+	release := storage.addRelease(c, "1.0.1", "gcs://bucket/name-v1.0.1.tgz", "old:package data 2")
+	c.Assert(dao.AddPackageURI(release, "file:///releases/missing.tgz"), IsNil)
+	progress := bytes.NewBuffer([]byte{})
+
+	err := storage.encryptingProvider().ReencryptStorage(&StorageReencryption{}, progress)
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Re-encryption failed with 2 errors")
+	c.Assert(progress.String(), Equals, `[1/2] namespace/name-v1.0.0: re-encrypted file:///releases/name-v1.0.0.tgz
+[2/2] namespace/name-v1.0.1: failed to re-encrypt gcs://bucket/name-v1.0.1.tgz: The storage backend for 'gcs://bucket/name-v1.0.1.tgz' is not configured
+[2/2] namespace/name-v1.0.1: failed to re-encrypt file:///releases/missing.tgz: Not found
+Re-encrypted 1 packages, 0 were up to date, 2 errors.
+`)
+}
+
+func (s *suite) Test_ReencryptStorage_deletes_package_stored_elsewhere(c *C) {
+	storage := newFakeStorage()
+	storage.addRelease(c, "1.0.0", "file:///legacy/name-v1.0.0.tgz", "old:package data")
+	release := storage.addRelease(c, "1.0.1", "file:///legacy/name-v1.0.1.tgz", "old:package data 2")
+	c.Assert(dao.AddPackageURI(release, "file:///releases/name-v1.0.1.tgz"), IsNil)
+	storage.Files["file:///releases/name-v1.0.1.tgz"] = "new:package data 2"
+	provider := storage.encryptingProvider()
+	deleted := []string{}
+	provider.DeletePackage = func(namespace, uri string) error {
+		deleted = append(deleted, uri)
+		delete(storage.Files, uri)
+		return nil
+	}
+
+	err := provider.ReencryptStorage(&StorageReencryption{}, ioutil.Discard)
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Re-encryption failed with 2 errors")
+	c.Assert(deleted, DeepEquals, []string{"file:///releases/name-v1.0.0.tgz"})
+	c.Assert(storage.Files["file:///legacy/name-v1.0.0.tgz"], Equals, "old:package data")
+	c.Assert(storage.Files["file:///releases/name-v1.0.1.tgz"], Equals, "new:package data 2")
+}
+
+func (s *suite) Test_ReencryptStorage_fails_if_encryption_is_not_configured(c *C) {
+	provider := newFakeStorage().provider()
+	provider.EncryptionEnabled = func() bool { return false }
+	err := provider.ReencryptStorage(&StorageReencryption{}, ioutil.Discard)
+	c.Assert(err, DeepEquals, NewUserError(fmt.Errorf("Encryption at rest is not configured")))
+}
@@ -0,0 +1,259 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/storage"
+)
+
+// Copies the packages and artifacts of every release to the Target storage
+// backend and registers the new URIs. When a Source backend is given only
+// files stored in that backend are copied. Retire unregisters the URIs that were
+// migrated away from; the stored files themselves are left alone.
+//
+// Packages and artifacts that already have a copy in the Target backend are
+// skipped, so an interrupted migration can be resumed by running it again.
+type StorageMigration struct {
+	Target string `json:"target"`
+	Source string `json:"source"`
+	Retire bool   `json:"retire"`
+}
+
+func MigrateStorage(migration *StorageMigration, progress io.Writer) error {
+	return newStorageProvider().MigrateStorage(migration, progress)
+}
+
+func (s *storageProvider) MigrateStorage(migration *StorageMigration, progress io.Writer) error {
+	if migration.Target == "" {
+		return NewUserError(fmt.Errorf("Missing target storage backend"))
+	}
+	if !s.IsConfigured(migration.Target) {
+		return NewUserError(fmt.Errorf("Target storage backend '%s' is not configured", migration.Target))
+	}
+	if migration.Source == migration.Target {
+		return NewUserError(fmt.Errorf("Source and target storage backend can't be the same"))
+	}
+	releases, err := dao.GetAllReleases()
+	if err != nil {
+		return err
+	}
+	sortReleases(releases)
+	copied, retired, failed := 0, 0, 0
+	for i, release := range releases {
+		prefix := fmt.Sprintf("[%d/%d] %s/%s:", i+1, len(releases), release.Application.Project, release.ReleaseId)
+		copiedURIs, retiredURIs, err := s.migrateRelease(release, migration)
+		for _, u := range copiedURIs {
+			copied += 1
+			fmt.Fprintf(progress, "%s copied to %s\n", prefix, u)
+		}
+		if err == nil && len(copiedURIs) == 0 {
+			fmt.Fprintf(progress, "%s nothing to copy\n", prefix)
+		}
+		for _, u := range retiredURIs {
+			retired += 1
+			fmt.Fprintf(progress, "%s retired %s\n", prefix, u)
+		}
+		if err != nil {
+			failed += 1
+			log.Printf("Error: Failed to migrate release %s/%s: %s\n", release.Application.Project, release.ReleaseId, err.Error())
+			fmt.Fprintf(progress, "%s failed: %s\n", prefix, err.Error())
+		}
+	}
+	fmt.Fprintf(progress, "Copied %d files, retired %d URIs, %d releases failed.\n", copied, retired, failed)
+	if failed > 0 {
+		return fmt.Errorf("Failed to migrate %d out of %d releases", failed, len(releases))
+	}
+	return nil
+}
+
+// Returns the URIs the package and artifacts were copied to and the URIs that
+// were retired.
+func (s *storageProvider) migrateRelease(release *types.Release, migration *StorageMigration) ([]string, []string, error) {
+	lock := releaseLock(release.Application.Project, release.ReleaseId)
+	lock.Lock()
+	defer lock.Unlock()
+
+	copied, retired, err := s.migratePackage(release, migration)
+	if err != nil {
+		return copied, retired, err
+	}
+	artifacts, err := dao.GetArtifacts(release)
+	if err != nil {
+		return copied, retired, err
+	}
+	for _, artifact := range artifacts {
+		newURI, retiredURIs, err := s.migrateArtifact(release, artifact, migration)
+		if newURI != "" {
+			copied = append(copied, newURI)
+		}
+		retired = append(retired, retiredURIs...)
+		if err != nil {
+			return copied, retired, err
+		}
+	}
+	return copied, retired, nil
+}
+
+func (s *storageProvider) migratePackage(release *types.Release, migration *StorageMigration) ([]string, []string, error) {
+	uris, err := dao.GetPackageURIs(release)
+	if err != nil {
+		return nil, nil, err
+	}
+	migrated, sources := migrationSources(uris, migration)
+	copied := []string{}
+	if !migrated && len(sources) > 0 {
+		newURI, err := s.copyFile(release.Application.Project, sources, release.PackageSHA256, release.PackageSize, func(pkg io.Reader) (string, error) {
+			return s.UploadTo(migration.Target, release.Application.Project, release.ReleaseId, pkg)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := dao.AddPackageURI(release, newURI); err != nil && err != types.AlreadyExists {
+			return nil, nil, err
+		}
+		copied = append(copied, newURI)
+	}
+	retired := []string{}
+	if migration.Retire && (migrated || len(copied) > 0) {
+		for _, uri := range sources {
+			if err := dao.RemovePackageURI(release, uri); err != nil && err != types.NotFound {
+				return copied, retired, err
+			}
+			retired = append(retired, uri)
+		}
+	}
+	return copied, retired, nil
+}
+
+// Returns the new URI, if the artifact had to be copied, and the URIs that
+// were retired.
+func (s *storageProvider) migrateArtifact(release *types.Release, artifact *types.Artifact, migration *StorageMigration) (string, []string, error) {
+	migrated, sources := migrationSources(artifact.URIs, migration)
+	newURI := ""
+	uris := artifact.URIs
+	if !migrated && len(sources) > 0 {
+		var err error
+		newURI, err = s.copyFile(release.Application.Project, sources, artifact.SHA256, artifact.Size, func(pkg io.Reader) (string, error) {
+			return s.StoreArtifactTo(migration.Target, release.Application.Project, release.ReleaseId, artifact.Name, pkg)
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		uris = append(unregisteredURIs(uris, []string{newURI}), newURI)
+	}
+	retired := []string{}
+	if migration.Retire && (migrated || newURI != "") {
+		uris = unregisteredURIs(uris, sources)
+		retired = sources
+	}
+	if newURI == "" && len(retired) == 0 {
+		return "", nil, nil
+	}
+	updated := *artifact
+	updated.URIs = uris
+	if err := dao.UpdateArtifactURIs(release, &updated); err != nil {
+		return "", nil, err
+	}
+	return newURI, retired, nil
+}
+
+// Returns whether the URIs include one in the target backend, and the URIs
+// that should be migrated, sorted by preference.
+func migrationSources(uris []string, migration *StorageMigration) (bool, []string) {
+	targetScheme := storage.URIScheme(migration.Target)
+	migrated := false
+	sources := []string{}
+	for _, uri := range uris {
+		scheme := uriScheme(uri)
+		if scheme == targetScheme {
+			migrated = true
+		} else if migration.Source == "" || scheme == storage.URIScheme(migration.Source) {
+			sources = append(sources, uri)
+		}
+	}
+	return migrated, storage.SortURIsByPreference(sources)
+}
+
+// Downloads the file from the first source that works into a temporary
+// file, verifying its checksum, and uploads it with the upload function.
+func (s *storageProvider) copyFile(namespace string, sources []string, checksum string, size int64, upload func(io.Reader) (string, error)) (string, error) {
+	tmp, err := ioutil.TempFile("", "escape-inventory-migration")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var lastError error
+	for _, uri := range sources {
+		lastError = s.downloadTo(tmp, namespace, uri, checksum, size)
+		if lastError == nil {
+			break
+		}
+		log.Printf("Warn: %s\n", lastError.Error())
+	}
+	if lastError != nil {
+		return "", lastError
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return upload(tmp)
+}
+
+func (s *storageProvider) downloadTo(dst *os.File, namespace, uri, checksum string, size int64) error {
+	if err := dst.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := dst.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	reader, err := s.Download(namespace, uri)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = io.Copy(dst, NewPackageReader(reader, checksum, size))
+	return err
+}
+
+func sortReleases(releases []*types.Release) {
+	sort.Slice(releases, func(i, j int) bool {
+		if releases[i].Application.Project != releases[j].Application.Project {
+			return releases[i].Application.Project < releases[j].Application.Project
+		}
+		return releases[i].ReleaseId < releases[j].ReleaseId
+	})
+}
+
+func uriScheme(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+	. "gopkg.in/check.v1"
+)
+
+type fakeStorage struct {
+	Files   map[string]string
+	Uploads int
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{
+		Files: map[string]string{},
+	}
+}
+
+func (f *fakeStorage) provider() *storageProvider {
+	return &storageProvider{
+		UploadTo: func(backend, namespace, releaseId string, pkg io.Reader) (string, error) {
+			data, err := ioutil.ReadAll(pkg)
+			if err != nil {
+				return "", err
+			}
+			f.Uploads += 1
+			uri := backend + "://bucket/" + namespace + "/" + releaseId + ".tgz"
+			f.Files[uri] = string(data)
+			return uri, nil
+		},
+		StoreArtifactTo: func(backend, namespace, releaseId, artifact string, pkg io.Reader) (string, error) {
+			data, err := ioutil.ReadAll(pkg)
+			if err != nil {
+				return "", err
+			}
+			f.Uploads += 1
+			uri := backend + "://bucket/" + namespace + "/" + releaseId + "-" + artifact + ".tgz"
+			f.Files[uri] = string(data)
+			return uri, nil
+		},
+		Download: func(namespace, uri string) (io.ReadSeekCloser, error) {
+			data, ok := f.Files[uri]
+			if !ok {
+				return nil, types.NotFound
+			}
+			return nopCloser{bytes.NewReader([]byte(data))}, nil
+		},
+		IsConfigured: func(backend string) bool {
+			return backend == "gcs"
+		},
+	}
+}
+
+func (f *fakeStorage) addRelease(c *C, version, uri, data string) *types.Release {
+	_, err := AddRelease("namespace", `{"name": "name", "version": "`+version+`"}`)
+	c.Assert(err, IsNil)
+	release, err := dao.GetRelease("namespace", "name", "name-v"+version)
+	c.Assert(err, IsNil)
+	c.Assert(dao.AddPackageURI(release, uri), IsNil)
+	f.Files[uri] = data
+	return release
+}
+
+func (s *suite) Test_MigrateStorage_copies_packages_to_target(c *C) {
+	storage := newFakeStorage()
+	storage.addRelease(c, "1.0.0", "file:///releases/name-v1.0.0.tgz", "package data")
+	storage.addRelease(c, "1.0.1", "file:///releases/name-v1.0.1.tgz", "package data 2")
+	progress := bytes.NewBuffer([]byte{})
+
+	err := storage.provider().MigrateStorage(&StorageMigration{Target: "gcs"}, progress)
+	c.Assert(err, IsNil)
+	c.Assert(progress.String(), Equals, `[1/2] namespace/name-v1.0.0: copied to gcs://bucket/namespace/name-v1.0.0.tgz
+[2/2] namespace/name-v1.0.1: copied to gcs://bucket/namespace/name-v1.0.1.tgz
+Copied 2 files, retired 0 URIs, 0 releases failed.
+`)
+	c.Assert(storage.Files["gcs://bucket/namespace/name-v1.0.1.tgz"], Equals, "package data 2")
+
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	uris, err := dao.GetPackageURIs(release)
+	c.Assert(err, IsNil)
+	c.Assert(uris, DeepEquals, []string{"file:///releases/name-v1.0.0.tgz", "gcs://bucket/namespace/name-v1.0.0.tgz"})
+}
+
+func (s *suite) Test_MigrateStorage_is_resumable(c *C) {
+	storage := newFakeStorage()
+	storage.addRelease(c, "1.0.0", "file:///releases/name-v1.0.0.tgz", "package data")
+	c.Assert(storage.provider().MigrateStorage(&StorageMigration{Target: "gcs"}, ioutil.Discard), IsNil)
+	storage.addRelease(c, "1.0.1", "file:///releases/name-v1.0.1.tgz", "package data 2")
+	progress := bytes.NewBuffer([]byte{})
+
+	c.Assert(storage.provider().MigrateStorage(&StorageMigration{Target: "gcs"}, progress), IsNil)
+	c.Assert(storage.Uploads, Equals, 2)
+	c.Assert(progress.String(), Equals, `[1/2] namespace/name-v1.0.0: nothing to copy
+[2/2] namespace/name-v1.0.1: copied to gcs://bucket/namespace/name-v1.0.1.tgz
+Copied 1 files, retired 0 URIs, 0 releases failed.
+`)
+}
+
+func (s *suite) Test_MigrateStorage_retires_source_uris(c *C) {
+	storage := newFakeStorage()
+	release := storage.addRelease(c, "1.0.0", "file:///releases/name-v1.0.0.tgz", "package data")
+	c.Assert(dao.AddPackageURI(release, "s3://bucket/namespace/name-v1.0.0.tgz"), IsNil)
+	progress := bytes.NewBuffer([]byte{})
+
+	err := storage.provider().MigrateStorage(&StorageMigration{Target: "gcs", Source: "local", Retire: true}, progress)
+	c.Assert(err, IsNil)
+	c.Assert(progress.String(), Equals, `[1/1] namespace/name-v1.0.0: copied to gcs://bucket/namespace/name-v1.0.0.tgz
+[1/1] namespace/name-v1.0.0: retired file:///releases/name-v1.0.0.tgz
+Copied 1 files, retired 1 URIs, 0 releases failed.
+`)
+	uris, err := dao.GetPackageURIs(release)
+	c.Assert(err, IsNil)
+	c.Assert(uris, DeepEquals, []string{"s3://bucket/namespace/name-v1.0.0.tgz", "gcs://bucket/namespace/name-v1.0.0.tgz"})
+}
+
+func (s *suite) Test_MigrateStorage_copies_artifacts_to_target(c *C) {
+	storage := newFakeStorage()
+	release := storage.addRelease(c, "1.0.0", "file:///releases/name-v1.0.0.tgz", "package data")
+	c.Assert(dao.AddArtifact(release, &types.Artifact{
+		Name:   "docs",
+		SHA256: fileDigest("docs"),
+		Size:   4,
+		URIs:   []string{"file:///releases/name-v1.0.0-docs.tgz"},
+	}), IsNil)
+	storage.Files["file:///releases/name-v1.0.0-docs.tgz"] = "docs"
+	progress := bytes.NewBuffer([]byte{})
+
+	err := storage.provider().MigrateStorage(&StorageMigration{Target: "gcs", Retire: true}, progress)
+	c.Assert(err, IsNil)
+	c.Assert(progress.String(), Equals, `[1/1] namespace/name-v1.0.0: copied to gcs://bucket/namespace/name-v1.0.0.tgz
+[1/1] namespace/name-v1.0.0: copied to gcs://bucket/namespace/name-v1.0.0-docs.tgz
+[1/1] namespace/name-v1.0.0: retired file:///releases/name-v1.0.0.tgz
+[1/1] namespace/name-v1.0.0: retired file:///releases/name-v1.0.0-docs.tgz
+Copied 2 files, retired 2 URIs, 0 releases failed.
+`)
+	c.Assert(storage.Files["gcs://bucket/namespace/name-v1.0.0-docs.tgz"], Equals, "docs")
+	artifacts, err := dao.GetArtifacts(release)
+	c.Assert(err, IsNil)
+	c.Assert(artifacts, HasLen, 1)
+	c.Assert(artifacts[0].URIs, DeepEquals, []string{"gcs://bucket/namespace/name-v1.0.0-docs.tgz"})
+
+	progress = bytes.NewBuffer([]byte{})
+	c.Assert(storage.provider().MigrateStorage(&StorageMigration{Target: "gcs", Retire: true}, progress), IsNil)
+	c.Assert(storage.Uploads, Equals, 2)
+	c.Assert(progress.String(), Equals, `[1/1] namespace/name-v1.0.0: nothing to copy
+Copied 0 files, retired 0 URIs, 0 releases failed.
+`)
+}
+
+func (s *suite) Test_MigrateStorage_fails_on_corrupt_artifact(c *C) {
+	storage := newFakeStorage()
+	release := storage.addRelease(c, "1.0.0", "file:///releases/name-v1.0.0.tgz", "package data")
+	c.Assert(dao.AddArtifact(release, &types.Artifact{
+		Name:   "docs",
+		SHA256: fileDigest("docs"),
+		Size:   4,
+		URIs:   []string{"file:///releases/name-v1.0.0-docs.tgz"},
+	}), IsNil)
+	storage.Files["file:///releases/name-v1.0.0-docs.tgz"] = "corrupt"
+
+	err := storage.provider().MigrateStorage(&StorageMigration{Target: "gcs", Retire: true}, ioutil.Discard)
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Failed to migrate 1 out of 1 releases")
+	artifacts, err := dao.GetArtifacts(release)
+	c.Assert(err, IsNil)
+	c.Assert(artifacts[0].URIs, DeepEquals, []string{"file:///releases/name-v1.0.0-docs.tgz"})
+}
+
+func (s *suite) Test_MigrateStorage_reports_failures(c *C) {
+	storage := newFakeStorage()
+	release := storage.addRelease(c, "1.0.0", "file:///releases/name-v1.0.0.tgz", "corrupt data")
+	release.PackageSHA256 = "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a"
+	release.PackageSize = 12
+	c.Assert(dao.UpdateRelease(release), IsNil)
+	progress := bytes.NewBuffer([]byte{})
+
+	err := storage.provider().MigrateStorage(&StorageMigration{Target: "gcs", Retire: true}, progress)
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Failed to migrate 1 out of 1 releases")
+	c.Assert(strings.HasPrefix(progress.String(), "[1/1] namespace/name-v1.0.0: failed: Package checksum mismatch"), Equals, true)
+	c.Assert(storage.Uploads, Equals, 0)
+	uris, err := dao.GetPackageURIs(release)
+	c.Assert(err, IsNil)
+	c.Assert(uris, DeepEquals, []string{"file:///releases/name-v1.0.0.tgz"})
+}
+
+func (s *suite) Test_MigrateStorage_fails_on_invalid_target(c *C) {
+	storage := newFakeStorage()
+	err := storage.provider().MigrateStorage(&StorageMigration{}, ioutil.Discard)
+	c.Assert(err, DeepEquals, NewUserError(fmt.Errorf("Missing target storage backend")))
+	err = storage.provider().MigrateStorage(&StorageMigration{Target: "s3"}, ioutil.Discard)
+	c.Assert(err, DeepEquals, NewUserError(fmt.Errorf("Target storage backend 's3' is not configured")))
+	err = storage.provider().MigrateStorage(&StorageMigration{Target: "gcs", Source: "gcs"}, ioutil.Discard)
+	c.Assert(err, DeepEquals, NewUserError(fmt.Errorf("Source and target storage backend can't be the same")))
+}
@@ -0,0 +1,279 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	core "github.com/ankyra/escape-core"
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/storage"
+)
+
+// Rebuilds the database from the packages in a storage backend, for when the
+// database was lost but the packages weren't. Every package's release.json
+// is read and the releases that aren't registered yet are added, including
+// their namespace, application, dependencies and providers. Packages of
+// releases that are already registered are added to their package URIs.
+// Nothing is changed if DryRun is set. The primary backend is scanned unless
+// another Backend is given.
+type StorageRecovery struct {
+	Backend string `json:"backend"`
+	DryRun  bool   `json:"dry_run"`
+}
+
+// A package that was found in storage.
+type recoveredPackage struct {
+	URI       string
+	Namespace string
+	Metadata  *core.ReleaseMetadata
+	SHA256    string
+	Size      int64
+	ModTime   time.Time
+}
+
+func RecoverFromStorage(recovery *StorageRecovery, progress io.Writer) error {
+	return newStorageProvider().RecoverFromStorage(recovery, progress)
+}
+
+func (s *storageProvider) RecoverFromStorage(recovery *StorageRecovery, progress io.Writer) error {
+	backend := recovery.Backend
+	if backend == "" {
+		backend = s.ConfiguredBackends()[0]
+	}
+	if !s.IsConfigured(backend) {
+		return NewUserError(fmt.Errorf("Storage backend '%s' is not configured", backend))
+	}
+	uris, err := s.ListPackages(backend)
+	if err == storage.ErrListingNotSupported {
+		return NewUserError(fmt.Errorf("The '%s' storage backend doesn't support listing packages, so it can't be recovered from", backend))
+	} else if err != nil {
+		return err
+	}
+	sort.Strings(uris)
+	packages := []*recoveredPackage{}
+	skipped, failed := 0, 0
+	for _, uri := range uris {
+		pkg, err := s.readRecoveredPackage(uri)
+		if err != nil {
+			failed += 1
+			log.Printf("Error: Failed to read '%s': %s\n", uri, err.Error())
+			fmt.Fprintf(progress, "%s: failed to read: %s\n", uri, err.Error())
+		} else if pkg == nil {
+			skipped += 1
+			fmt.Fprintf(progress, "%s: skipped, not a release package\n", uri)
+		} else if pkg.Namespace == "" {
+			failed += 1
+			fmt.Fprintf(progress, "%s: can't tell which namespace release '%s' belongs to\n", uri, pkg.Metadata.GetReleaseId())
+		} else {
+			packages = append(packages, pkg)
+		}
+	}
+	sortRecoveredPackages(packages)
+	recovered, registered, alreadyRegistered := 0, 0, 0
+	for _, pkg := range packages {
+		name := pkg.Namespace + "/" + pkg.Metadata.GetReleaseId()
+		result, err := s.recoverPackage(pkg, recovery.DryRun)
+		if err != nil {
+			failed += 1
+			log.Printf("Error: Failed to recover '%s' from '%s': %s\n", name, pkg.URI, err.Error())
+			fmt.Fprintf(progress, "%s: failed to recover from %s: %s\n", name, pkg.URI, err.Error())
+			continue
+		}
+		switch result {
+		case releaseRecovered:
+			recovered += 1
+			if recovery.DryRun {
+				fmt.Fprintf(progress, "%s: not registered, stored at %s\n", name, pkg.URI)
+			} else {
+				fmt.Fprintf(progress, "%s: recovered from %s\n", name, pkg.URI)
+			}
+		case packageURIRegistered:
+			registered += 1
+			if recovery.DryRun {
+				fmt.Fprintf(progress, "%s: unregistered package %s\n", name, pkg.URI)
+			} else {
+				fmt.Fprintf(progress, "%s: registered package %s\n", name, pkg.URI)
+			}
+		default:
+			alreadyRegistered += 1
+		}
+	}
+	if recovery.DryRun {
+		fmt.Fprintf(progress, "Scanned %d packages in the '%s' storage backend: %d releases to recover, %d package URIs to register, %d already registered, %d skipped, %d errors.\n",
+			len(uris), backend, recovered, registered, alreadyRegistered, skipped, failed)
+	} else {
+		fmt.Fprintf(progress, "Scanned %d packages in the '%s' storage backend: %d releases recovered, %d package URIs registered, %d already registered, %d skipped, %d errors.\n",
+			len(uris), backend, recovered, registered, alreadyRegistered, skipped, failed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("Recovery failed with %d errors", failed)
+	}
+	return nil
+}
+
+// Downloads the package and reads its release.json. Returns nil if the
+// package isn't a release package, which is the case for artifacts: they
+// don't contain a release.json and are named after the release id suffixed
+// with the artifact name.
+func (s *storageProvider) readRecoveredPackage(uri string) (*recoveredPackage, error) {
+	releaseId := strings.TrimSuffix(path.Base(uriPath(uri)), ".tgz")
+	reader, err := s.Download("", uri)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	hasher := newPackageHasher()
+	if err := hasher.ReadFrom(reader); err != nil {
+		return nil, err
+	}
+	var metadata *core.ReleaseMetadata
+	err = walkPackage(reader, releaseId, func(path string, header *tar.Header, entry io.Reader) error {
+		if path != "release.json" {
+			return nil
+		}
+		data, err := ioutil.ReadAll(entry)
+		if err != nil {
+			return err
+		}
+		metadata, err = core.NewReleaseMetadataFromJsonString(string(data))
+		return err
+	})
+	if err != nil || metadata == nil || metadata.GetReleaseId() != releaseId {
+		return nil, nil
+	}
+	_, modTime, err := s.Stat("", uri)
+	if err != nil {
+		return nil, err
+	}
+	return &recoveredPackage{
+		URI:       uri,
+		Namespace: recoveredNamespace(uri, metadata),
+		Metadata:  metadata,
+		SHA256:    hasher.SHA256(),
+		Size:      hasher.Size,
+		ModTime:   modTime,
+	}, nil
+}
+
+const (
+	releaseRecovered = iota
+	packageURIRegistered
+	packageAlreadyRegistered
+)
+
+func (s *storageProvider) recoverPackage(pkg *recoveredPackage, dryRun bool) (int, error) {
+	metadata := pkg.Metadata
+	release, err := dao.GetRelease(pkg.Namespace, metadata.Name, metadata.GetReleaseId())
+	if dao.IsNotFound(err) {
+		if dryRun {
+			return releaseRecovered, nil
+		}
+		release = types.NewRelease(types.NewApplication(pkg.Namespace, metadata.Name), metadata)
+		release.UploadedAt = pkg.ModTime
+		release.PackageSHA256 = pkg.SHA256
+		release.PackageSize = pkg.Size
+		err := dao.RunInTransaction(func(tx types.DAO) error {
+			if err := ensureNamespaceExists(tx, pkg.Namespace, ""); err != nil {
+				return err
+			}
+			if err := registerImportedRelease(tx, pkg.Namespace, release); err != nil {
+				return err
+			}
+			return tx.AddPackageURI(release, pkg.URI)
+		})
+		if err != nil {
+			return 0, err
+		}
+		return releaseRecovered, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if release.PackageSHA256 != "" && release.PackageSHA256 != pkg.SHA256 {
+		return 0, fmt.Errorf("The registered release has a package with a different checksum")
+	}
+	uris, err := dao.GetPackageURIs(release)
+	if err != nil {
+		return 0, err
+	}
+	for _, uri := range uris {
+		if uri == pkg.URI {
+			return packageAlreadyRegistered, nil
+		}
+	}
+	if dryRun {
+		return packageURIRegistered, nil
+	}
+	if err := dao.AddPackageURI(release, pkg.URI); err != nil {
+		return 0, err
+	}
+	if release.PackageSHA256 == "" {
+		release.PackageSHA256 = pkg.SHA256
+		release.PackageSize = pkg.Size
+		if err := dao.UpdateRelease(release); err != nil {
+			return 0, err
+		}
+	}
+	return packageURIRegistered, nil
+}
+
+// The backends store packages under <namespace>/<application>/<release id>,
+// so the namespace is taken from the package's path. Backends that don't
+// use that layout fall back on the project in the release metadata.
+func recoveredNamespace(uri string, metadata *core.ReleaseMetadata) string {
+	parts := strings.Split(strings.Trim(uriPath(uri), "/"), "/")
+	if len(parts) >= 3 && parts[len(parts)-2] == metadata.Name {
+		return parts[len(parts)-3]
+	}
+	if metadata.Project != "_" {
+		return metadata.Project
+	}
+	return ""
+}
+
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	return u.Host + u.Path
+}
+
+// Releases are recovered in version order, so that every application ends
+// up with the right latest version.
+func sortRecoveredPackages(packages []*recoveredPackage) {
+	sort.SliceStable(packages, func(i, j int) bool {
+		a, b := packages[i], packages[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Metadata.Name != b.Metadata.Name {
+			return a.Metadata.Name < b.Metadata.Name
+		}
+		return !core.NewSemanticVersion(b.Metadata.Version).LessOrEqual(core.NewSemanticVersion(a.Metadata.Version))
+	})
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/storage"
+
+	. "gopkg.in/check.v1"
+)
+
+type recoveryStorage struct {
+	Packages map[string][]byte
+	ModTime  time.Time
+}
+
+func (f *recoveryStorage) provider() *storageProvider {
+	return &storageProvider{
+		Download: func(namespace, uri string) (io.ReadSeekCloser, error) {
+			pkg, ok := f.Packages[uri]
+			if !ok {
+				return nil, types.NotFound
+			}
+			return nopCloser{bytes.NewReader(pkg)}, nil
+		},
+		Stat: func(namespace, uri string) (int64, time.Time, error) {
+			return int64(len(f.Packages[uri])), f.ModTime, nil
+		},
+		IsConfigured: func(backend string) bool {
+			return backend == "gcs" || backend == "memory"
+		},
+		ConfiguredBackends: func() []string {
+			return []string{"gcs", "memory"}
+		},
+		ListPackages: func(backend string) ([]string, error) {
+			if backend == "memory" {
+				return nil, storage.ErrListingNotSupported
+			}
+			uris := []string{}
+			for uri := range f.Packages {
+				uris = append(uris, uri)
+			}
+			return uris, nil
+		},
+	}
+}
+
+func (s *appSuite) setUpStorageRecovery(c *C) *recoveryStorage {
+	dao.TestSetup()
+	return &recoveryStorage{
+		ModTime: time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC),
+		Packages: map[string][]byte{
+			"gcs://bucket/namespace/name/name-v1.0.1.tgz": releasePackage(c, "name-v1.0.1",
+				`{"name": "name", "version": "1.0.1", "description": "newest", "provides": [{"name": "kubernetes"}]}`),
+			"gcs://bucket/namespace/name/name-v1.0.0.tgz": releasePackage(c, "name-v1.0.0",
+				`{"name": "name", "version": "1.0.0", "description": "oldest"}`),
+			"gcs://bucket/namespace/name/name-v1.0.0-docs.tgz": []byte("not a release package"),
+			"gcs://bucket/namespace/other/other-v0.1.tgz": releasePackage(c, "other-v0.1",
+				`{"name": "other", "version": "0.1", "depends": [{"release_id": "namespace/name-v1.0.0"}]}`),
+			"gcs://bucket/other-v2.tgz": releasePackage(c, "other-v2",
+				`{"name": "other", "version": "2", "project": "project"}`),
+		},
+	}
+}
+
+func (s *appSuite) Test_RecoverFromStorage(c *C) {
+	fake := s.setUpStorageRecovery(c)
+	progress := bytes.NewBuffer(nil)
+	err := fake.provider().RecoverFromStorage(&StorageRecovery{}, progress)
+	c.Assert(err, IsNil)
+	c.Assert(progress.String(), Equals, `gcs://bucket/namespace/name/name-v1.0.0-docs.tgz: skipped, not a release package
+namespace/name-v1.0.0: recovered from gcs://bucket/namespace/name/name-v1.0.0.tgz
+namespace/name-v1.0.1: recovered from gcs://bucket/namespace/name/name-v1.0.1.tgz
+namespace/other-v0.1: recovered from gcs://bucket/namespace/other/other-v0.1.tgz
+project/other-v2: recovered from gcs://bucket/other-v2.tgz
+Scanned 5 packages in the 'gcs' storage backend: 4 releases recovered, 0 package URIs registered, 0 already registered, 1 skipped, 0 errors.
+`)
+
+	app, err := dao.GetApplication("namespace", "name")
+	c.Assert(err, IsNil)
+	c.Assert(app.LatestVersion, Equals, "1.0.1")
+	c.Assert(app.Description, Equals, "newest")
+
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	pkg := fake.Packages["gcs://bucket/namespace/name/name-v1.0.0.tgz"]
+	c.Assert(release.PackageSHA256, Equals, fileDigest(string(pkg)))
+	c.Assert(release.PackageSize, Equals, int64(len(pkg)))
+	c.Assert(release.UploadedAt.Equal(fake.ModTime), Equals, true)
+	uris, err := dao.GetPackageURIs(release)
+	c.Assert(err, IsNil)
+	c.Assert(uris, DeepEquals, []string{"gcs://bucket/namespace/name/name-v1.0.0.tgz"})
+
+	downstream, err := dao.GetDownstreamDependencies(release)
+	c.Assert(err, IsNil)
+	c.Assert(downstream, HasLen, 1)
+	c.Assert(downstream[0].Application, Equals, "other")
+
+	providers, err := dao.GetProviders("kubernetes")
+	c.Assert(err, IsNil)
+	c.Assert(providers, HasLen, 1)
+
+	_, err = dao.GetRelease("project", "other", "other-v2")
+	c.Assert(err, IsNil)
+}
+
+func (s *appSuite) Test_RecoverFromStorage_dry_run(c *C) {
+	fake := s.setUpStorageRecovery(c)
+	progress := bytes.NewBuffer(nil)
+	err := fake.provider().RecoverFromStorage(&StorageRecovery{DryRun: true}, progress)
+	c.Assert(err, IsNil)
+	c.Assert(progress.String(), Equals, `gcs://bucket/namespace/name/name-v1.0.0-docs.tgz: skipped, not a release package
+namespace/name-v1.0.0: not registered, stored at gcs://bucket/namespace/name/name-v1.0.0.tgz
+namespace/name-v1.0.1: not registered, stored at gcs://bucket/namespace/name/name-v1.0.1.tgz
+namespace/other-v0.1: not registered, stored at gcs://bucket/namespace/other/other-v0.1.tgz
+project/other-v2: not registered, stored at gcs://bucket/other-v2.tgz
+Scanned 5 packages in the 'gcs' storage backend: 4 releases to recover, 0 package URIs to register, 0 already registered, 1 skipped, 0 errors.
+`)
+	_, err = dao.GetNamespace("namespace")
+	c.Assert(dao.IsNotFound(err), Equals, true)
+}
+
+func (s *appSuite) Test_RecoverFromStorage_registers_missing_package_URIs(c *C) {
+	fake := s.setUpStorageRecovery(c)
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0", "description": "oldest"}`)
+	c.Assert(err, IsNil)
+	_, err = AddRelease("namespace", `{"name": "name", "version": "1.0.1"}`)
+	c.Assert(err, IsNil)
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.1")
+	c.Assert(err, IsNil)
+	c.Assert(dao.AddPackageURI(release, "gcs://bucket/namespace/name/name-v1.0.1.tgz"), IsNil)
+	_, err = AddRelease("namespace", `{"name": "other", "version": "0.1"}`)
+	c.Assert(err, IsNil)
+	release, err = dao.GetRelease("namespace", "other", "other-v0.1")
+	c.Assert(err, IsNil)
+	release.PackageSHA256 = fileDigest("a different package")
+	c.Assert(dao.UpdateRelease(release), IsNil)
+
+	progress := bytes.NewBuffer(nil)
+	err = fake.provider().RecoverFromStorage(&StorageRecovery{Backend: "gcs"}, progress)
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Recovery failed with 1 errors")
+	c.Assert(progress.String(), Equals, `gcs://bucket/namespace/name/name-v1.0.0-docs.tgz: skipped, not a release package
+namespace/name-v1.0.0: registered package gcs://bucket/namespace/name/name-v1.0.0.tgz
+namespace/other-v0.1: failed to recover from gcs://bucket/namespace/other/other-v0.1.tgz: The registered release has a package with a different checksum
+project/other-v2: recovered from gcs://bucket/other-v2.tgz
+Scanned 5 packages in the 'gcs' storage backend: 1 releases recovered, 1 package URIs registered, 1 already registered, 1 skipped, 1 errors.
+`)
+	release, err = dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	pkg := fake.Packages["gcs://bucket/namespace/name/name-v1.0.0.tgz"]
+	c.Assert(release.PackageSHA256, Equals, fileDigest(string(pkg)))
+	c.Assert(release.PackageSize, Equals, int64(len(pkg)))
+}
+
+func (s *appSuite) Test_RecoverFromStorage_fails_if_namespace_is_unknown(c *C) {
+	fake := s.setUpStorageRecovery(c)
+	fake.Packages = map[string][]byte{
+		"gcs://name-v1.0.0.tgz": releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.0"}`),
+	}
+	progress := bytes.NewBuffer(nil)
+	err := fake.provider().RecoverFromStorage(&StorageRecovery{}, progress)
+	c.Assert(err, Not(IsNil))
+	c.Assert(progress.String(), Equals, `gcs://name-v1.0.0.tgz: can't tell which namespace release 'name-v1.0.0' belongs to
+Scanned 1 packages in the 'gcs' storage backend: 0 releases recovered, 0 package URIs registered, 0 already registered, 0 skipped, 1 errors.
+`)
+}
+
+func (s *appSuite) Test_RecoverFromStorage_fails_if_backend_cant_be_listed(c *C) {
+	fake := s.setUpStorageRecovery(c)
+	err := fake.provider().RecoverFromStorage(&StorageRecovery{Backend: "memory"}, bytes.NewBuffer(nil))
+	c.Assert(IsUserError(err), Equals, true)
+	c.Assert(err.Error(), Equals, "The 'memory' storage backend doesn't support listing packages, so it can't be recovered from")
+}
+
+func (s *appSuite) Test_RecoverFromStorage_fails_if_backend_is_not_configured(c *C) {
+	fake := s.setUpStorageRecovery(c)
+	err := fake.provider().RecoverFromStorage(&StorageRecovery{Backend: "s3"}, bytes.NewBuffer(nil))
+	c.Assert(IsUserError(err), Equals, true)
+	c.Assert(err.Error(), Equals, "Storage backend 's3' is not configured")
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ankyra/escape-core/parsers"
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/storage"
+)
+
+func CreateUploadSession(namespace, releaseId string) (*storage.UploadSession, error) {
+	parsed, err := parsers.ParseReleaseId(releaseId)
+	if err != nil {
+		return nil, NewUserError(err)
+	}
+	if parsed.NeedsResolving() {
+		return nil, NewUserError(fmt.Errorf("Can't upload package against unresolved version '%s/%s'", namespace, releaseId))
+	}
+	if _, err := dao.GetRelease(namespace, parsed.Name, releaseId); err != nil {
+		return nil, NewUserError(err)
+	}
+	return storage.NewUploadSession(namespace, releaseId)
+}
+
+func GetUploadSession(namespace, releaseId, id string) (*storage.UploadSession, error) {
+	session, err := storage.GetUploadSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Namespace != namespace || session.ReleaseId != releaseId {
+		return nil, types.NotFound
+	}
+	return session, nil
+}
+
+func AppendToUploadSession(namespace, releaseId, id string, offset int64, data io.Reader) (*storage.UploadSession, error) {
+	session, err := GetUploadSession(namespace, releaseId, id)
+	if err != nil {
+		return nil, err
+	}
+	err = session.Append(offset, data)
+	if _, ok := err.(*storage.OffsetMismatchError); ok {
+		return nil, NewUserError(err)
+	}
+	return session, err
+}
+
+// Uploads the staged package to the storage backends and removes the session.
+// The package is only registered once all the backends have stored it. If an
+// expected checksum is given the package is verified against it first.
+func FinalizeUploadSession(namespace, releaseId, id, expectedChecksum string) error {
+	return newStorageProvider().FinalizeUploadSession(namespace, releaseId, id, expectedChecksum)
+}
+
+// Sessions for the same release are finalized one at a time, so that only
+// one of their packages can be stored and registered.
+func (s *storageProvider) FinalizeUploadSession(namespace, releaseId, id, expectedChecksum string) error {
+	session, err := GetUploadSession(namespace, releaseId, id)
+	if err != nil {
+		return err
+	}
+	parsed, err := parsers.ParseReleaseId(releaseId)
+	if err != nil {
+		return NewUserError(err)
+	}
+	lock := releaseLock(namespace, releaseId)
+	lock.Lock()
+	defer lock.Unlock()
+	return session.Finalize(func(pkg io.Reader) error {
+		return s.storePackage(namespace, parsed.Name, releaseId, pkg, expectedChecksum)
+	})
+}
+
+func AbortUploadSession(namespace, releaseId, id string) error {
+	session, err := GetUploadSession(namespace, releaseId, id)
+	if err != nil {
+		return err
+	}
+	return session.Remove()
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/ankyra/escape-inventory/dao"
+	"github.com/ankyra/escape-inventory/dao/types"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *appSuite) Test_UploadSession_happy_path(c *C) {
+	dao.TestSetup()
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+
+	pkg := releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.0"}`)
+	session, err := CreateUploadSession("namespace", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	_, err = AppendToUploadSession("namespace", "name-v1.0.0", session.ID, 0, bytes.NewReader(pkg[:8]))
+	c.Assert(err, IsNil)
+	session, err = AppendToUploadSession("namespace", "name-v1.0.0", session.ID, 8, bytes.NewReader(pkg[8:]))
+	c.Assert(err, IsNil)
+	c.Assert(session.Offset, Equals, int64(len(pkg)))
+
+	err = FinalizeUploadSession("namespace", "name-v1.0.0", session.ID, fileDigest(string(pkg)))
+	c.Assert(err, IsNil)
+	_, err = GetUploadSession("namespace", "name-v1.0.0", session.ID)
+	c.Assert(err, Equals, types.NotFound)
+
+	reader, err := GetDownloadReadSeeker("namespace", "name", "v1.0.0")
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, pkg)
+}
+
+func (s *appSuite) Test_CreateUploadSession_fails_if_release_not_found(c *C) {
+	dao.TestSetup()
+	_, err := CreateUploadSession("namespace", "name-v1.0.0")
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Not found")
+}
+
+func (s *appSuite) Test_CreateUploadSession_fails_on_release_id_that_needs_resolving(c *C) {
+	_, err := CreateUploadSession("namespace", "name-latest")
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Can't upload package against unresolved version 'namespace/name-latest'")
+}
+
+func (s *appSuite) Test_GetUploadSession_fails_if_release_differs(c *C) {
+	dao.TestSetup()
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	session, err := CreateUploadSession("namespace", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	defer session.Remove()
+
+	_, err = GetUploadSession("namespace", "name-v1.0.1", session.ID)
+	c.Assert(err, Equals, types.NotFound)
+	_, err = GetUploadSession("other-namespace", "name-v1.0.0", session.ID)
+	c.Assert(err, Equals, types.NotFound)
+}
+
+func (s *appSuite) Test_AppendToUploadSession_fails_on_offset_mismatch(c *C) {
+	dao.TestSetup()
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	session, err := CreateUploadSession("namespace", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	defer session.Remove()
+
+	_, err = AppendToUploadSession("namespace", "name-v1.0.0", session.ID, 5, strings.NewReader("data"))
+	c.Assert(err, Not(IsNil))
+	c.Assert(IsUserError(err), Equals, true)
+	c.Assert(err.Error(), Equals, "Upload offset mismatch: expecting offset 0, got 5")
+}
+
+func (s *appSuite) Test_FinalizeUploadSession_fails_on_checksum_mismatch(c *C) {
+	dao.TestSetup()
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	session, err := CreateUploadSession("namespace", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	defer session.Remove()
+	_, err = AppendToUploadSession("namespace", "name-v1.0.0", session.ID, 0, strings.NewReader("corrupt data"))
+	c.Assert(err, IsNil)
+
+	err = FinalizeUploadSession("namespace", "name-v1.0.0", session.ID, "9e3db5e385d89a1d1017a54f9803b8d2dd41e2c17c5b2b650b2d5d40f3f97e8a")
+	c.Assert(err, Not(IsNil))
+	c.Assert(IsUserError(err), Equals, true)
+	release, err := dao.GetRelease("namespace", "name", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	uris, err := dao.GetPackageURIs(release)
+	c.Assert(err, IsNil)
+	c.Assert(uris, HasLen, 0)
+	_, err = GetUploadSession("namespace", "name-v1.0.0", session.ID)
+	c.Assert(err, IsNil)
+}
+
+func (s *appSuite) Test_FinalizeUploadSession_serialises_sessions_for_a_release(c *C) {
+	dao.TestSetup()
+	stored := map[string][]byte{}
+	uploads := 0
+	uploading := make(chan bool)
+	proceed := make(chan bool)
+	provider := &storageProvider{
+		Upload: func(namespace, releaseId string, pkg io.Reader) ([]string, error) {
+			data, err := ioutil.ReadAll(pkg)
+			if err != nil {
+				return nil, err
+			}
+			uploads += 1
+			if uploads == 1 {
+				uploading <- true
+				<-proceed
+			}
+			uri := "mem://" + namespace + "/" + releaseId + ".tgz"
+			stored[uri] = data
+			return []string{uri}, nil
+		},
+	}
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	pkg := releasePackage(c, "name-v1.0.0", `{"name": "name", "version": "1.0.0"}`)
+	other := buildPackage(c, "name-v1.0.0", map[string]string{
+		"release.json": `{"name": "name", "version": "1.0.0"}`,
+		"README.md":    "other data",
+	})
+	sessions := []string{}
+	for _, data := range [][]byte{pkg, other} {
+		session, err := CreateUploadSession("namespace", "name-v1.0.0")
+		c.Assert(err, IsNil)
+		defer session.Remove()
+		_, err = AppendToUploadSession("namespace", "name-v1.0.0", session.ID, 0, bytes.NewReader(data))
+		c.Assert(err, IsNil)
+		sessions = append(sessions, session.ID)
+	}
+
+	first := make(chan error)
+	go func() {
+		first <- provider.FinalizeUploadSession("namespace", "name-v1.0.0", sessions[0], "")
+	}()
+	<-uploading
+	second := make(chan error)
+	go func() {
+		second <- provider.FinalizeUploadSession("namespace", "name-v1.0.0", sessions[1], "")
+	}()
+	select {
+	case err := <-second:
+		c.Fatalf("Second session didn't wait for the first one: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	proceed <- true
+	c.Assert(<-first, IsNil)
+	err = <-second
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "A package with a different checksum has already been uploaded for 'namespace/name-v1.0.0'")
+	c.Assert(stored["mem://namespace/name-v1.0.0.tgz"], DeepEquals, pkg)
+	_, err = GetUploadSession("namespace", "name-v1.0.0", sessions[1])
+	c.Assert(err, IsNil)
+}
+
+func (s *appSuite) Test_AbortUploadSession(c *C) {
+	dao.TestSetup()
+	_, err := AddRelease("namespace", `{"name": "name", "version": "1.0.0"}`)
+	c.Assert(err, IsNil)
+	session, err := CreateUploadSession("namespace", "name-v1.0.0")
+	c.Assert(err, IsNil)
+
+	c.Assert(AbortUploadSession("namespace", "name-v1.0.0", session.ID), IsNil)
+	_, err = GetUploadSession("namespace", "name-v1.0.0", session.ID)
+	c.Assert(err, Equals, types.NotFound)
+}
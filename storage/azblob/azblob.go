@@ -0,0 +1,380 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azblob
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ankyra/escape-core/parsers"
+	"github.com/ankyra/escape-inventory/config"
+	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/storage/ranged"
+)
+
+const apiVersion = "2019-12-12"
+
+// Packages bigger than a block are uploaded block by block, so only one block
+// is held in memory at a time.
+var blockSize = 8 * 1024 * 1024
+
+type AzureBlobStorageBackend struct {
+	Account   string
+	Container string
+	Endpoint  *url.URL
+	Client    *http.Client
+	sasToken  url.Values
+	signer    *signer
+}
+
+func NewAzureBlobStorageBackend() *AzureBlobStorageBackend {
+	return &AzureBlobStorageBackend{}
+}
+
+func (a *AzureBlobStorageBackend) Init(settings config.StorageSettings) error {
+	if settings.Account == "" {
+		return fmt.Errorf("Missing storage_settings.account configuration variable")
+	}
+	if settings.Container == "" {
+		return fmt.Errorf("Missing storage_settings.container configuration variable")
+	}
+	if settings.AccountKey != "" && settings.SASToken != "" {
+		return fmt.Errorf("Only one of storage_settings.account_key and storage_settings.sas_token can be set")
+	}
+	endpoint := settings.Endpoint
+	if endpoint == "" {
+		endpoint = "https://" + settings.Account + ".blob.core.windows.net"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("Invalid storage_settings.endpoint '%s': %s", endpoint, err.Error())
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("Invalid storage_settings.endpoint '%s': expecting an http(s) URL", endpoint)
+	}
+	a.Account = settings.Account
+	a.Container = settings.Container
+	a.Endpoint = u
+	a.Client = http.DefaultClient
+	a.signer = nil
+	a.sasToken = nil
+	if settings.AccountKey != "" {
+		key, err := base64.StdEncoding.DecodeString(settings.AccountKey)
+		if err != nil {
+			return fmt.Errorf("Invalid storage_settings.account_key: %s", err.Error())
+		}
+		a.signer = &signer{
+			Account: settings.Account,
+			Key:     key,
+		}
+	}
+	if settings.SASToken != "" {
+		token, err := url.ParseQuery(strings.TrimPrefix(settings.SASToken, "?"))
+		if err != nil {
+			return fmt.Errorf("Invalid storage_settings.sas_token: %s", err.Error())
+		}
+		a.sasToken = token
+	}
+	return nil
+}
+
+func (a *AzureBlobStorageBackend) Upload(namespace string, releaseId *parsers.ReleaseId, pkg io.Reader) (string, error) {
+	blob := strings.Join([]string{namespace, releaseId.Name, releaseId.ToString() + ".tgz"}, "/")
+	uri := "azblob://" + a.Container + "/" + blob
+	block := make([]byte, blockSize)
+	n, err := io.ReadFull(pkg, block)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return uri, a.putBlob(blob, block[:n])
+	} else if err != nil {
+		return "", err
+	}
+	return uri, a.putBlocks(blob, block, pkg)
+}
+
+func (a *AzureBlobStorageBackend) putBlob(blob string, data []byte) error {
+	req, err := a.newRequest("PUT", a.Container, blob, nil, data)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	return a.doAndExpect(req, http.StatusCreated)
+}
+
+// Blocks that are uploaded but never committed are removed by Azure, so
+// there's nothing to clean up when an upload fails halfway.
+func (a *AzureBlobStorageBackend) putBlocks(blob string, buf []byte, rest io.Reader) error {
+	blockIds := []string{}
+	block := buf
+	for len(block) > 0 {
+		blockId := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%08d", len(blockIds))))
+		query := url.Values{
+			"comp":    []string{"block"},
+			"blockid": []string{blockId},
+		}
+		req, err := a.newRequest("PUT", a.Container, blob, query, block)
+		if err != nil {
+			return err
+		}
+		if err := a.doAndExpect(req, http.StatusCreated); err != nil {
+			return err
+		}
+		blockIds = append(blockIds, blockId)
+		n, err := io.ReadFull(rest, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		block = buf[:n]
+	}
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"BlockList"`
+		Latest  []string `xml:"Latest"`
+	}{Latest: blockIds})
+	if err != nil {
+		return err
+	}
+	req, err := a.newRequest("PUT", a.Container, blob, url.Values{"comp": []string{"blocklist"}}, append([]byte(xml.Header), body...))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-ms-blob-content-type", "application/gzip")
+	return a.doAndExpect(req, http.StatusCreated)
+}
+
+// Blobs are read lazily using range requests, so that downloads can start at
+// any offset.
+func (a *AzureBlobStorageBackend) Download(namespace, uri string) (io.ReadSeekCloser, error) {
+	container, blob, err := parseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	size, _, err := a.Stat(namespace, uri)
+	if err != nil {
+		return nil, err
+	}
+	return ranged.NewReader(size, func(offset int64) (io.ReadCloser, error) {
+		return a.getBlob(container, blob, offset)
+	}), nil
+}
+
+func (a *AzureBlobStorageBackend) getBlob(container, blob string, offset int64) (io.ReadCloser, error) {
+	req, err := a.newRequest("GET", container, blob, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("x-ms-range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	resp, err := a.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, types.NotFound
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+	return resp.Body, nil
+}
+
+func (a *AzureBlobStorageBackend) Stat(namespace, uri string) (int64, time.Time, error) {
+	container, blob, err := parseURI(uri)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	req, err := a.newRequest("HEAD", container, blob, nil, nil)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	resp, err := a.do(req)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, time.Time{}, types.NotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, time.Time{}, readError(resp)
+	}
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return resp.ContentLength, modTime, nil
+}
+
+// Returns a service SAS URL for the blob. URLs can only be signed when the
+// backend is configured with an account key.
+func (a *AzureBlobStorageBackend) SignedURL(uri string, expires time.Time) (string, error) {
+	if a.signer == nil {
+		return "", nil
+	}
+	container, blob, err := parseURI(uri)
+	if err != nil {
+		return "", err
+	}
+	req, err := a.newRequest("GET", container, blob, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	query := a.signer.BlobSAS(container, blob, expires)
+	req.URL.RawQuery = query.Encode()
+	return req.URL.String(), nil
+}
+
+// Returns the URIs of all the packages in the container.
+func (a *AzureBlobStorageBackend) List() ([]string, error) {
+	uris := []string{}
+	marker := ""
+	for {
+		query := url.Values{
+			"restype": []string{"container"},
+			"comp":    []string{"list"},
+		}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		req, err := a.newRequest("GET", a.Container, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := a.do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return nil, readError(resp)
+		}
+		result := struct {
+			Blobs struct {
+				Blob []struct {
+					Name string
+				}
+			}
+			NextMarker string
+		}{}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse Azure Blob Storage response: %s", err.Error())
+		}
+		for _, blob := range result.Blobs.Blob {
+			if strings.HasSuffix(blob.Name, ".tgz") {
+				uris = append(uris, "azblob://"+a.Container+"/"+blob.Name)
+			}
+		}
+		if result.NextMarker == "" {
+			return uris, nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+func (a *AzureBlobStorageBackend) Delete(uri string) error {
+	container, blob, err := parseURI(uri)
+	if err != nil {
+		return err
+	}
+	req, err := a.newRequest("DELETE", container, blob, nil, nil)
+	if err != nil {
+		return err
+	}
+	return a.doAndExpect(req, http.StatusAccepted)
+}
+
+func parseURI(uri string) (string, string, error) {
+	path := uri[len("azblob://"):]
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("Invalid Azure Blob Storage URI '%s'", uri)
+	}
+	return parts[0], parts[1], nil
+}
+
+// Blobs are addressed as <endpoint>/<container>/<blob>. Local stand-ins like
+// Azurite put the account name in the endpoint path.
+func (a *AzureBlobStorageBackend) newRequest(method, container, blob string, query url.Values, body []byte) (*http.Request, error) {
+	u := *a.Endpoint
+	rawPath := strings.TrimSuffix(a.Endpoint.EscapedPath(), "/") + "/" + url.PathEscape(container)
+	if blob != "" {
+		rawPath += "/" + escapeBlob(blob)
+	}
+	path, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path
+	u.RawPath = rawPath
+	values := url.Values{}
+	for key, vals := range query {
+		values[key] = vals
+	}
+	for key, vals := range a.sasToken {
+		values[key] = vals
+	}
+	u.RawQuery = values.Encode()
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	return http.NewRequest(method, u.String(), reader)
+}
+
+func (a *AzureBlobStorageBackend) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("x-ms-version", apiVersion)
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	if a.signer != nil {
+		a.signer.Sign(req)
+	}
+	return a.Client.Do(req)
+}
+
+func (a *AzureBlobStorageBackend) doAndExpect(req *http.Request, status int) error {
+	resp, err := a.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		return readError(resp)
+	}
+	return nil
+}
+
+func escapeBlob(blob string) string {
+	parts := strings.Split(blob, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+func readError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("Azure Blob Storage request '%s %s' failed with status %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,376 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azblob
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ankyra/escape-core/parsers"
+	"github.com/ankyra/escape-inventory/config"
+	"github.com/ankyra/escape-inventory/dao/types"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type azblobSuite struct{}
+
+var _ = Suite(&azblobSuite{})
+
+const testAccount = "devstoreaccount1"
+
+var testAccountKey = base64.StdEncoding.EncodeToString([]byte("account key"))
+
+// fakeAzurite is a minimal Azurite style stand-in that serves blobs from
+// <endpoint>/<account>/<container>/<blob>, supports block uploads and rejects
+// requests that aren't signed with the account key or carry the SAS token.
+type fakeAzurite struct {
+	Blobs    map[string][]byte
+	Blocks   map[string][]byte
+	SASToken string
+	signer   *signer
+}
+
+var fakeAzuriteModTime = time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newFakeAzurite() *fakeAzurite {
+	key, _ := base64.StdEncoding.DecodeString(testAccountKey)
+	return &fakeAzurite{
+		Blobs:  map[string][]byte{},
+		Blocks: map[string][]byte{},
+		signer: &signer{
+			Account: testAccount,
+			Key:     key,
+		},
+	}
+}
+
+func (f *fakeAzurite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.authorized(r) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("<Error><Code>AuthenticationFailed</Code></Error>"))
+		return
+	}
+	data, _ := ioutil.ReadAll(r.Body)
+	query := r.URL.Query()
+	switch r.Method {
+	case "PUT":
+		switch query.Get("comp") {
+		case "block":
+			f.Blocks[r.URL.Path+"#"+query.Get("blockid")] = data
+		case "blocklist":
+			blockList := struct {
+				Latest []string `xml:"Latest"`
+			}{}
+			if err := xml.Unmarshal(data, &blockList); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			blob := []byte{}
+			for _, blockId := range blockList.Latest {
+				block, ok := f.Blocks[r.URL.Path+"#"+blockId]
+				if !ok {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte("<Error><Code>InvalidBlockList</Code></Error>"))
+					return
+				}
+				blob = append(blob, block...)
+				delete(f.Blocks, r.URL.Path+"#"+blockId)
+			}
+			f.Blobs[r.URL.Path] = blob
+		default:
+			if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			f.Blobs[r.URL.Path] = data
+		}
+		w.WriteHeader(http.StatusCreated)
+	case "DELETE":
+		if _, ok := f.Blobs[r.URL.Path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.Blobs, r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	case "GET", "HEAD":
+		if query.Get("restype") == "container" && query.Get("comp") == "list" {
+			f.listBlobs(w, r.URL.Path, query.Get("marker"))
+			return
+		}
+		data, ok := f.Blobs[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("<Error><Code>BlobNotFound</Code></Error>"))
+			return
+		}
+		if rangeHeader := r.Header.Get("x-ms-range"); rangeHeader != "" {
+			r.Header.Set("Range", rangeHeader)
+		}
+		http.ServeContent(w, r, "", fakeAzuriteModTime, bytes.NewReader(data))
+	}
+}
+
+// Returns two blobs per page to exercise pagination.
+func (f *fakeAzurite) listBlobs(w http.ResponseWriter, containerPath, marker string) {
+	names := []string{}
+	for path := range f.Blobs {
+		if strings.HasPrefix(path, containerPath+"/") {
+			names = append(names, strings.TrimPrefix(path, containerPath+"/"))
+		}
+	}
+	sort.Strings(names)
+	start, _ := strconv.Atoi(marker)
+	end := start + 2
+	if end > len(names) {
+		end = len(names)
+	}
+	result := "<EnumerationResults><Blobs>"
+	for _, name := range names[start:end] {
+		result += "<Blob><Name>" + name + "</Name></Blob>"
+	}
+	result += "</Blobs><NextMarker>"
+	if end < len(names) {
+		result += strconv.Itoa(end)
+	}
+	w.Write([]byte(result + "</NextMarker></EnumerationResults>"))
+}
+
+func (f *fakeAzurite) authorized(r *http.Request) bool {
+	if f.SASToken != "" {
+		return r.URL.Query().Get("sig") == f.SASToken
+	}
+	if _, err := http.ParseTime(r.Header.Get("x-ms-date")); err != nil {
+		return false
+	}
+	expected, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	expected.ContentLength = r.ContentLength
+	for key, values := range r.Header {
+		if key != "Authorization" {
+			expected.Header[key] = values
+		}
+	}
+	f.signer.Sign(expected)
+	return expected.Header.Get("Authorization") == r.Header.Get("Authorization")
+}
+
+func (s *azblobSuite) newBackend(c *C, server *httptest.Server) *AzureBlobStorageBackend {
+	backend := NewAzureBlobStorageBackend()
+	err := backend.Init(config.StorageSettings{
+		Account:    testAccount,
+		Container:  "escape-releases",
+		Endpoint:   server.URL + "/" + testAccount,
+		AccountKey: testAccountKey,
+	})
+	c.Assert(err, IsNil)
+	return backend
+}
+
+func (s *azblobSuite) Test_AzureBlob_Storage_Backend_Upload_and_Download(c *C) {
+	fake := newFakeAzurite()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	backend := s.newBackend(c, server)
+
+	releaseId, err := parsers.ParseReleaseId("archive-upload-test-v1")
+	c.Assert(err, IsNil)
+	uri, err := backend.Upload("namespace", releaseId, bytes.NewReader([]byte("package data")))
+	c.Assert(err, IsNil)
+	c.Assert(uri, Equals, "azblob://escape-releases/namespace/archive-upload-test/archive-upload-test-v1.tgz")
+	c.Assert(string(fake.Blobs["/devstoreaccount1/escape-releases/namespace/archive-upload-test/archive-upload-test-v1.tgz"]), Equals, "package data")
+
+	reader, err := backend.Download("namespace", uri)
+	c.Assert(err, IsNil)
+	payload, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(payload), Equals, "package data")
+}
+
+func (s *azblobSuite) Test_AzureBlob_Storage_Backend_Stat_and_ranged_Download(c *C) {
+	fake := newFakeAzurite()
+	fake.Blobs["/devstoreaccount1/escape-releases/namespace/name/name-v1.tgz"] = []byte("package data")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	backend := s.newBackend(c, server)
+	uri := "azblob://escape-releases/namespace/name/name-v1.tgz"
+
+	size, modTime, err := backend.Stat("namespace", uri)
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, int64(12))
+	c.Assert(modTime.Equal(fakeAzuriteModTime), Equals, true)
+
+	reader, err := backend.Download("namespace", uri)
+	c.Assert(err, IsNil)
+	defer reader.Close()
+	_, err = reader.Seek(8, io.SeekStart)
+	c.Assert(err, IsNil)
+	payload, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(payload), Equals, "data")
+}
+
+func (s *azblobSuite) Test_AzureBlob_Storage_Backend_List_and_Delete(c *C) {
+	fake := newFakeAzurite()
+	fake.Blobs["/devstoreaccount1/escape-releases/namespace/name/name-v1.tgz"] = []byte("package data")
+	fake.Blobs["/devstoreaccount1/escape-releases/namespace/name/name-v2.tgz"] = []byte("package data")
+	fake.Blobs["/devstoreaccount1/escape-releases/namespace/other/other-v1.tgz"] = []byte("package data")
+	fake.Blobs["/devstoreaccount1/escape-releases/README"] = []byte("not a package")
+	fake.Blobs["/devstoreaccount1/other-container/namespace/name/name-v1.tgz"] = []byte("package data")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	backend := s.newBackend(c, server)
+
+	uris, err := backend.List()
+	c.Assert(err, IsNil)
+	c.Assert(uris, DeepEquals, []string{
+		"azblob://escape-releases/namespace/name/name-v1.tgz",
+		"azblob://escape-releases/namespace/name/name-v2.tgz",
+		"azblob://escape-releases/namespace/other/other-v1.tgz",
+	})
+
+	c.Assert(backend.Delete("azblob://escape-releases/namespace/name/name-v1.tgz"), IsNil)
+	_, exists := fake.Blobs["/devstoreaccount1/escape-releases/namespace/name/name-v1.tgz"]
+	c.Assert(exists, Equals, false)
+}
+
+func (s *azblobSuite) Test_AzureBlob_Storage_Backend_Block_Upload(c *C) {
+	fake := newFakeAzurite()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	backend := s.newBackend(c, server)
+	blockSize = 5
+	defer func() { blockSize = 8 * 1024 * 1024 }()
+
+	releaseId, err := parsers.ParseReleaseId("archive-upload-test-v1")
+	c.Assert(err, IsNil)
+	uri, err := backend.Upload("namespace", releaseId, strings.NewReader("package data"))
+	c.Assert(err, IsNil)
+	c.Assert(uri, Equals, "azblob://escape-releases/namespace/archive-upload-test/archive-upload-test-v1.tgz")
+	c.Assert(string(fake.Blobs["/devstoreaccount1/escape-releases/namespace/archive-upload-test/archive-upload-test-v1.tgz"]), Equals, "package data")
+	c.Assert(fake.Blocks, HasLen, 0)
+}
+
+func (s *azblobSuite) Test_AzureBlob_Storage_Backend_uses_SAS_token(c *C) {
+	fake := newFakeAzurite()
+	fake.SASToken = "token"
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	backend := NewAzureBlobStorageBackend()
+	err := backend.Init(config.StorageSettings{
+		Account:   testAccount,
+		Container: "escape-releases",
+		Endpoint:  server.URL + "/" + testAccount,
+		SASToken:  "?sv=2019-12-12&sp=rwdl&sig=token",
+	})
+	c.Assert(err, IsNil)
+
+	releaseId, err := parsers.ParseReleaseId("archive-upload-test-v1")
+	c.Assert(err, IsNil)
+	uri, err := backend.Upload("namespace", releaseId, bytes.NewReader([]byte("package data")))
+	c.Assert(err, IsNil)
+	reader, err := backend.Download("namespace", uri)
+	c.Assert(err, IsNil)
+	payload, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(payload), Equals, "package data")
+}
+
+func (s *azblobSuite) Test_AzureBlob_Storage_Backend_Download_returns_NotFound(c *C) {
+	server := httptest.NewServer(newFakeAzurite())
+	defer server.Close()
+	backend := s.newBackend(c, server)
+	_, err := backend.Download("namespace", "azblob://escape-releases/namespace/name/name-v1.tgz")
+	c.Assert(err, Equals, types.NotFound)
+}
+
+func (s *azblobSuite) Test_AzureBlob_Storage_Backend_Upload_fails_with_wrong_credentials(c *C) {
+	server := httptest.NewServer(newFakeAzurite())
+	defer server.Close()
+	backend := s.newBackend(c, server)
+	backend.signer.Key = []byte("wrong")
+	releaseId, err := parsers.ParseReleaseId("archive-upload-test-v1")
+	c.Assert(err, IsNil)
+	_, err = backend.Upload("namespace", releaseId, bytes.NewReader([]byte("package data")))
+	c.Assert(err, Not(IsNil))
+	c.Assert(strings.Contains(err.Error(), "status 403"), Equals, true)
+}
+
+func (s *azblobSuite) Test_AzureBlob_Storage_Backend_Init_fails_without_account(c *C) {
+	err := NewAzureBlobStorageBackend().Init(config.StorageSettings{Container: "escape-releases"})
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Missing storage_settings.account configuration variable")
+}
+
+func (s *azblobSuite) Test_AzureBlob_Storage_Backend_Init_fails_without_container(c *C) {
+	err := NewAzureBlobStorageBackend().Init(config.StorageSettings{Account: testAccount})
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Missing storage_settings.container configuration variable")
+}
+
+func (s *azblobSuite) Test_AzureBlob_Storage_Backend_Init_fails_with_key_and_SAS_token(c *C) {
+	err := NewAzureBlobStorageBackend().Init(config.StorageSettings{
+		Account:    testAccount,
+		Container:  "escape-releases",
+		AccountKey: testAccountKey,
+		SASToken:   "sig=token",
+	})
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Only one of storage_settings.account_key and storage_settings.sas_token can be set")
+}
+
+func (s *azblobSuite) Test_AzureBlob_Storage_Backend_uses_account_endpoint_by_default(c *C) {
+	backend := NewAzureBlobStorageBackend()
+	c.Assert(backend.Init(config.StorageSettings{Account: "escape", Container: "escape-releases"}), IsNil)
+	req, err := backend.newRequest("GET", "escape-releases", "namespace/name/name-v1.tgz", nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(req.URL.String(), Equals, "https://escape.blob.core.windows.net/escape-releases/namespace/name/name-v1.tgz")
+}
+
+func (s *azblobSuite) Test_AzureBlob_Storage_Backend_SignedURL(c *C) {
+	backend := NewAzureBlobStorageBackend()
+	c.Assert(backend.Init(config.StorageSettings{Account: "escape", Container: "escape-releases", AccountKey: testAccountKey}), IsNil)
+	signedURL, err := backend.SignedURL("azblob://escape-releases/namespace/name/name-v1.tgz", time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC))
+	c.Assert(err, IsNil)
+	u, err := url.Parse(signedURL)
+	c.Assert(err, IsNil)
+	c.Assert(u.Host, Equals, "escape.blob.core.windows.net")
+	c.Assert(u.Path, Equals, "/escape-releases/namespace/name/name-v1.tgz")
+	c.Assert(u.Query().Get("se"), Equals, "2018-03-01T12:00:00Z")
+	c.Assert(u.Query().Get("sp"), Equals, "r")
+	c.Assert(u.Query().Get("sr"), Equals, "b")
+	c.Assert(u.Query().Get("sig"), Not(Equals), "")
+}
+
+func (s *azblobSuite) Test_AzureBlob_Storage_Backend_SignedURL_needs_account_key(c *C) {
+	backend := NewAzureBlobStorageBackend()
+	c.Assert(backend.Init(config.StorageSettings{Account: "escape", Container: "escape-releases", SASToken: "sig=token"}), IsNil)
+	signedURL, err := backend.SignedURL("azblob://escape-releases/namespace/name/name-v1.tgz", time.Now())
+	c.Assert(err, IsNil)
+	c.Assert(signedURL, Equals, "")
+}
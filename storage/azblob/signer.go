@@ -0,0 +1,132 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azblob
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sasTimeFormat = "2006-01-02T15:04:05Z"
+
+// Signs requests using Shared Key authorization, and creates service SAS
+// tokens, with the storage account's key.
+type signer struct {
+	Account string
+	Key     []byte
+}
+
+func (s *signer) Sign(req *http.Request) {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		req.Header.Get("Date"),
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonicalHeaders(req) + s.canonicalResource(req.URL),
+	}, "\n")
+	req.Header.Set("Authorization", "SharedKey "+s.Account+":"+s.sign(stringToSign))
+}
+
+// Returns the query parameters of a service SAS that allows reading the blob
+// until it expires.
+func (s *signer) BlobSAS(container, blob string, expires time.Time) url.Values {
+	expiry := expires.UTC().Format(sasTimeFormat)
+	stringToSign := strings.Join([]string{
+		"r",
+		"",
+		expiry,
+		"/blob/" + s.Account + "/" + container + "/" + blob,
+		"",
+		"",
+		"https,http",
+		apiVersion,
+		"b",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+	}, "\n")
+	return url.Values{
+		"sv":  []string{apiVersion},
+		"sr":  []string{"b"},
+		"sp":  []string{"r"},
+		"se":  []string{expiry},
+		"spr": []string{"https,http"},
+		"sig": []string{s.sign(stringToSign)},
+	}
+}
+
+func (s *signer) sign(stringToSign string) string {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func canonicalHeaders(req *http.Request) string {
+	keys := []string{}
+	values := map[string]string{}
+	for key, vals := range req.Header {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "x-ms-") {
+			keys = append(keys, lower)
+			values[lower] = strings.TrimSpace(strings.Join(vals, ","))
+		}
+	}
+	sort.Strings(keys)
+	result := ""
+	for _, key := range keys {
+		result += key + ":" + values[key] + "\n"
+	}
+	return result
+}
+
+func (s *signer) canonicalResource(u *url.URL) string {
+	result := "/" + s.Account + u.EscapedPath()
+	query := u.Query()
+	keys := []string{}
+	for key := range query {
+		keys = append(keys, strings.ToLower(key))
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		result += "\n" + key + ":" + strings.Join(values, ",")
+	}
+	return result
+}
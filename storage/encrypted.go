@@ -0,0 +1,149 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"io"
+	"time"
+
+	"github.com/ankyra/escape-core/parsers"
+	"github.com/ankyra/escape-inventory/config"
+	"github.com/ankyra/escape-inventory/storage/encryption"
+)
+
+// The master keys used to encrypt packages at rest, if encryption is enabled.
+var keyring *encryption.Keyring
+
+// Wraps a backend so that packages are encrypted before they're stored and
+// decrypted when they're read. Packages that were stored before encryption
+// was enabled are still read as they are.
+//
+// Signed URLs aren't supported, because they'd give out the encrypted
+// package, so downloads go through the Inventory instead.
+type encryptedBackend struct {
+	backend StorageBackend
+	keyring *encryption.Keyring
+}
+
+func encrypted(backend StorageBackend) StorageBackend {
+	if keyring == nil {
+		return backend
+	}
+	return &encryptedBackend{
+		backend: backend,
+		keyring: keyring,
+	}
+}
+
+func (e *encryptedBackend) Init(settings config.StorageSettings) error {
+	return e.backend.Init(settings)
+}
+
+func (e *encryptedBackend) Upload(namespace string, releaseId *parsers.ReleaseId, pkg io.Reader) (string, error) {
+	encryptedPkg, err := e.keyring.Encrypt(pkg)
+	if err != nil {
+		return "", err
+	}
+	return e.backend.Upload(namespace, releaseId, encryptedPkg)
+}
+
+func (e *encryptedBackend) Download(namespace, uri string) (io.ReadSeekCloser, error) {
+	src, err := e.backend.Download(namespace, uri)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := e.keyring.NewReader(src)
+	if err == encryption.ErrNotEncrypted {
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			src.Close()
+			return nil, err
+		}
+		return src, nil
+	} else if err != nil {
+		src.Close()
+		return nil, err
+	}
+	return &decryptingReader{reader, src}, nil
+}
+
+// The size of an encrypted package is only known after reading its header.
+func (e *encryptedBackend) Stat(namespace, uri string) (int64, time.Time, error) {
+	size, modTime, err := e.backend.Stat(namespace, uri)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	src, err := e.backend.Download(namespace, uri)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer src.Close()
+	reader, err := e.keyring.NewReader(src)
+	if err == encryption.ErrNotEncrypted {
+		return size, modTime, nil
+	} else if err != nil {
+		return 0, time.Time{}, err
+	}
+	return reader.Size(), modTime, nil
+}
+
+func (e *encryptedBackend) List() ([]string, error) {
+	lister, ok := e.backend.(ListingBackend)
+	if !ok {
+		return nil, ErrListingNotSupported
+	}
+	return lister.List()
+}
+
+func (e *encryptedBackend) Delete(uri string) error {
+	deleter, ok := e.backend.(ListingBackend)
+	if !ok {
+		return ErrListingNotSupported
+	}
+	return deleter.Delete(uri)
+}
+
+type decryptingReader struct {
+	*encryption.Reader
+	src io.Closer
+}
+
+func (d *decryptingReader) Close() error {
+	return d.src.Close()
+}
+
+func EncryptionEnabled() bool {
+	return keyring != nil
+}
+
+// Returns true if the package isn't encrypted with the current master key,
+// either because it was stored before encryption was enabled or because the
+// master key has been rotated since.
+func NeedsReencryption(namespace, uri string) (bool, error) {
+	if keyring == nil {
+		return false, nil
+	}
+	reader, err := Download(namespace, uri)
+	if err != nil {
+		return false, err
+	}
+	defer reader.Close()
+	decrypting, ok := reader.(*decryptingReader)
+	if !ok {
+		return true, nil
+	}
+	return decrypting.KeyId() != keyring.CurrentKeyId(), nil
+}
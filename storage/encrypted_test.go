@@ -0,0 +1,177 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ankyra/escape-inventory/config"
+	"github.com/ankyra/escape-inventory/storage/encryption"
+
+	. "gopkg.in/check.v1"
+)
+
+func writeKeyFile(c *C, keyIds ...string) string {
+	content := ""
+	for _, keyId := range keyIds {
+		content += keyId + " " + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte(keyId[:1]), 32)) + "\n"
+	}
+	path := testStoragePath + "/keys"
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0600), IsNil)
+	return path
+}
+
+func loadKeyring(c *C, keyIds ...string) {
+	k, err := encryption.LoadKeyring(writeKeyFile(c, keyIds...))
+	c.Assert(err, IsNil)
+	keyring = k
+}
+
+func (s *suite) Test_LoadFromConfig_enables_encryption(c *C) {
+	conf := &config.Config{
+		StorageBackend: "local",
+		StorageSettings: config.StorageSettings{
+			Path:              testStoragePath,
+			EncryptionKeyFile: writeKeyFile(c, "key-1"),
+		},
+	}
+	c.Assert(LoadFromConfig(conf), IsNil)
+	c.Assert(EncryptionEnabled(), Equals, true)
+	c.Assert(keyring.CurrentKeyId(), Equals, "key-1")
+}
+
+func (s *suite) Test_LoadFromConfig_fails_on_invalid_encryption_key_file(c *C) {
+	conf := &config.Config{
+		StorageBackend: "local",
+		StorageSettings: config.StorageSettings{
+			Path:              testStoragePath,
+			EncryptionKeyFile: testStoragePath + "/doesnt-exist",
+		},
+	}
+	err := LoadFromConfig(conf)
+	c.Assert(err, Not(IsNil))
+	c.Assert(strings.HasPrefix(err.Error(), "Could not read encryption key file"), Equals, true)
+	c.Assert(EncryptionEnabled(), Equals, false)
+}
+
+func (s *suite) Test_Encrypted_Upload_and_Download(c *C) {
+	c.Assert(localBackend.Init(config.StorageSettings{Path: testStoragePath}), IsNil)
+	uploadBackends = []string{"memory", "local"}
+	loadKeyring(c, "key-1")
+
+	uris, err := Upload("namespace", "name-v1.0.0", bytes.NewReader([]byte("package data")))
+	c.Assert(err, IsNil)
+	c.Assert(uris, HasLen, 2)
+	c.Assert(strings.Contains(memoryBackend.URIs[uris[0]], "package data"), Equals, false)
+	stored, err := ioutil.ReadFile(testStoragePath + "/namespace/name/name-v1.0.0.tgz")
+	c.Assert(err, IsNil)
+	c.Assert(bytes.Contains(stored, []byte("package data")), Equals, false)
+
+	for _, uri := range uris {
+		reader, err := Download("namespace", uri)
+		c.Assert(err, IsNil)
+		_, err = reader.Seek(8, io.SeekStart)
+		c.Assert(err, IsNil)
+		data, err := ioutil.ReadAll(reader)
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, "data")
+		c.Assert(reader.Close(), IsNil)
+
+		size, _, err := Stat("namespace", uri)
+		c.Assert(err, IsNil)
+		c.Assert(size, Equals, int64(12))
+	}
+}
+
+func (s *suite) Test_Encrypted_Download_reads_packages_stored_before_encryption(c *C) {
+	uris, err := Upload("namespace", "name-v1.0.0", bytes.NewReader([]byte("package data")))
+	c.Assert(err, IsNil)
+	loadKeyring(c, "key-1")
+
+	reader, err := Download("namespace", uris[0])
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "package data")
+	size, _, err := Stat("namespace", uris[0])
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, int64(12))
+}
+
+func (s *suite) Test_Encrypted_backends_dont_hand_out_signed_URLs(c *C) {
+	loadKeyring(c, "key-1")
+	_, ok := encrypted(storageBackends["gcs"]).(SignedURLBackend)
+	c.Assert(ok, Equals, false)
+}
+
+func (s *suite) Test_Encrypted_ListPackages_and_DeletePackage(c *C) {
+	loadKeyring(c, "key-1")
+	uris, err := Upload("namespace", "name-v1.0.0", bytes.NewReader([]byte("package data")))
+	c.Assert(err, IsNil)
+	listed, err := ListPackages("memory")
+	c.Assert(err, IsNil)
+	c.Assert(listed, DeepEquals, uris)
+	c.Assert(DeletePackage("namespace", uris[0]), IsNil)
+	listed, err = ListPackages("memory")
+	c.Assert(err, IsNil)
+	c.Assert(listed, HasLen, 0)
+}
+
+func (s *suite) Test_NeedsReencryption(c *C) {
+	plain, err := Upload("namespace", "plain-v1.0.0", bytes.NewReader([]byte("package data")))
+	c.Assert(err, IsNil)
+	needsReencryption, err := NeedsReencryption("namespace", plain[0])
+	c.Assert(err, IsNil)
+	c.Assert(needsReencryption, Equals, false)
+
+	loadKeyring(c, "old")
+	old, err := Upload("namespace", "old-v1.0.0", bytes.NewReader([]byte("package data")))
+	c.Assert(err, IsNil)
+	loadKeyring(c, "new", "old")
+	current, err := Upload("namespace", "current-v1.0.0", bytes.NewReader([]byte("package data")))
+	c.Assert(err, IsNil)
+
+	for uri, expected := range map[string]bool{
+		plain[0]:   true,
+		old[0]:     true,
+		current[0]: false,
+	} {
+		needsReencryption, err := NeedsReencryption("namespace", uri)
+		c.Assert(err, IsNil)
+		c.Assert(needsReencryption, Equals, expected)
+	}
+}
+
+func (s *suite) Test_UploadArtifactTo(c *C) {
+	loadKeyring(c, "key-1")
+	uri, err := UploadArtifactTo("memory", "namespace", "name-v1.0.0", "linux-amd64", bytes.NewReader([]byte("artifact data")))
+	c.Assert(err, IsNil)
+	c.Assert(uri, Equals, "mem://name-v1.0.0-linux-amd64.tgz")
+	reader, err := Download("namespace", uri)
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "artifact data")
+
+	_, err = UploadArtifactTo("gcs", "namespace", "name-v1.0.0", "linux-amd64", bytes.NewReader([]byte("artifact data")))
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Storage backend 'gcs' is not configured")
+}
@@ -0,0 +1,326 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package encryption implements envelope encryption for stored packages.
+//
+// Every package is encrypted with its own random data key, which is stored
+// next to the package after encrypting ("wrapping") it with a master key. The
+// id of the master key is stored as well, so that master keys can be rotated:
+// packages encrypted with an old key can still be read while the old key is
+// kept around, and re-encrypting a package only needs the current key.
+//
+// Packages are encrypted in segments using AES-256-GCM, so that they can be
+// decrypted from any offset. An encrypted package looks like this:
+//
+//	magic | key id length | key id | wrapped data key | nonce prefix
+//	segment 0 | segment 1 | ... | last segment
+//
+// Every segment holds segmentSize bytes of plaintext, apart from the last
+// one, followed by a GCM tag. Its nonce is made up of the nonce prefix, the
+// segment number and a flag that marks the last segment, which means that
+// segments can't be reordered and that truncated packages are detected. The
+// header is authenticated as additional data of every segment.
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+var magic = []byte("ESCENC01")
+
+const (
+	keySize         = 32
+	nonceSize       = 12
+	noncePrefixSize = nonceSize - 5
+	tagSize         = 16
+	wrappedKeySize  = nonceSize + keySize + tagSize
+)
+
+// The amount of plaintext in a segment. Changing this breaks reading packages
+// that are already stored.
+var segmentSize = 64 * 1024
+
+var ErrNotEncrypted = fmt.Errorf("Package is not encrypted")
+
+// Returns a reader that produces the encrypted package, using the current
+// master key.
+func (k *Keyring) Encrypt(pkg io.Reader) (io.Reader, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	noncePrefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(noncePrefix); err != nil {
+		return nil, err
+	}
+	wrappedKey, err := k.wrap(k.current, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	header := bytes.NewBuffer(nil)
+	header.Write(magic)
+	header.WriteByte(byte(len(k.current)))
+	header.WriteString(k.current)
+	header.Write(wrappedKey)
+	header.Write(noncePrefix)
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptingReader{
+		src:         bufio.NewReader(pkg),
+		aead:        aead,
+		header:      header.Bytes(),
+		noncePrefix: noncePrefix,
+		buf:         header.Bytes(),
+		segment:     make([]byte, segmentSize),
+	}, nil
+}
+
+type encryptingReader struct {
+	src         *bufio.Reader
+	aead        cipher.AEAD
+	header      []byte
+	noncePrefix []byte
+	buf         []byte
+	out         []byte
+	segment     []byte
+	index       uint32
+	done        bool
+}
+
+func (e *encryptingReader) Read(b []byte) (int, error) {
+	for len(e.buf) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.encryptSegment(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, e.buf)
+	e.buf = e.buf[n:]
+	return n, nil
+}
+
+func (e *encryptingReader) encryptSegment() error {
+	n, err := io.ReadFull(e.src, e.segment)
+	last := false
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		last = true
+	} else if err != nil {
+		return err
+	} else if _, err := e.src.Peek(1); err == io.EOF {
+		last = true
+	} else if err != nil {
+		return err
+	}
+	e.out = e.aead.Seal(e.out[:0], segmentNonce(e.noncePrefix, e.index, last), e.segment[:n], e.header)
+	e.buf = e.out
+	e.index += 1
+	e.done = last
+	return nil
+}
+
+// Reader decrypts a package from any offset.
+type Reader struct {
+	src         io.ReadSeeker
+	aead        cipher.AEAD
+	header      []byte
+	noncePrefix []byte
+	keyId       string
+	size        int64
+	segments    int64
+	offset      int64
+	srcOffset   int64
+	current     int64
+	plaintext   []byte
+	ciphertext  []byte
+}
+
+// Reads the header of the encrypted package. Returns ErrNotEncrypted if the
+// package wasn't encrypted at all.
+func (k *Keyring) NewReader(src io.ReadSeeker) (*Reader, error) {
+	keyId, wrappedKey, noncePrefix, header, err := readHeader(src)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := k.unwrap(keyId, wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	total, err := src.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	size, segments, err := plaintextSize(total - int64(len(header)))
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{
+		src:         src,
+		aead:        aead,
+		header:      header,
+		noncePrefix: noncePrefix,
+		keyId:       keyId,
+		size:        size,
+		segments:    segments,
+		srcOffset:   total,
+		current:     -1,
+	}, nil
+}
+
+// Returns the id of the master key the package is encrypted with.
+func (r *Reader) KeyId() string {
+	return r.keyId
+}
+
+// Returns the size of the decrypted package.
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+func (r *Reader) Read(b []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	index := r.offset / int64(segmentSize)
+	if index != r.current {
+		if err := r.decryptSegment(index); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, r.plaintext[r.offset%int64(segmentSize):])
+	r.offset += int64(n)
+	return n, nil
+}
+
+func (r *Reader) decryptSegment(index int64) error {
+	start := int64(len(r.header)) + index*int64(segmentSize+tagSize)
+	if start != r.srcOffset {
+		if _, err := r.src.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+		r.srcOffset = start
+	}
+	last := index == r.segments-1
+	length := segmentSize + tagSize
+	if last {
+		length = int(r.size-index*int64(segmentSize)) + tagSize
+	}
+	if cap(r.ciphertext) < length {
+		r.ciphertext = make([]byte, length)
+	}
+	n, err := io.ReadFull(r.src, r.ciphertext[:length])
+	r.srcOffset += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("Encrypted package is truncated")
+	} else if err != nil {
+		return err
+	}
+	r.current = -1
+	plaintext, err := r.aead.Open(r.plaintext[:0], segmentNonce(r.noncePrefix, uint32(index), last), r.ciphertext[:length], r.header)
+	if err != nil {
+		return fmt.Errorf("Failed to decrypt package: %s", err.Error())
+	}
+	r.plaintext = plaintext
+	r.current = index
+	return nil
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	case io.SeekStart:
+	default:
+		return r.offset, fmt.Errorf("Invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return r.offset, fmt.Errorf("Can't seek to negative offset %d", offset)
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func readHeader(src io.Reader) (keyId string, wrappedKey, noncePrefix, header []byte, err error) {
+	prefix := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(src, prefix); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return "", nil, nil, nil, ErrNotEncrypted
+	} else if err != nil {
+		return "", nil, nil, nil, err
+	}
+	if !bytes.Equal(prefix[:len(magic)], magic) {
+		return "", nil, nil, nil, ErrNotEncrypted
+	}
+	keyIdLength := int(prefix[len(magic)])
+	rest := make([]byte, keyIdLength+wrappedKeySize+noncePrefixSize)
+	if _, err := io.ReadFull(src, rest); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return "", nil, nil, nil, fmt.Errorf("Encrypted package is truncated")
+	} else if err != nil {
+		return "", nil, nil, nil, err
+	}
+	keyId = string(rest[:keyIdLength])
+	wrappedKey = rest[keyIdLength : keyIdLength+wrappedKeySize]
+	noncePrefix = rest[keyIdLength+wrappedKeySize:]
+	return keyId, wrappedKey, noncePrefix, append(prefix, rest...), nil
+}
+
+// Returns the plaintext size and the number of segments, given the size of
+// the encrypted segments.
+func plaintextSize(encrypted int64) (int64, int64, error) {
+	encryptedSegmentSize := int64(segmentSize + tagSize)
+	full := encrypted / encryptedSegmentSize
+	remainder := encrypted % encryptedSegmentSize
+	if remainder == 0 && full > 0 {
+		return full * int64(segmentSize), full, nil
+	}
+	if remainder < tagSize {
+		return 0, 0, fmt.Errorf("Encrypted package is truncated")
+	}
+	return full*int64(segmentSize) + remainder - tagSize, full + 1, nil
+}
+
+func segmentNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, nonceSize)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], index)
+	if last {
+		nonce[nonceSize-1] = 1
+	}
+	return nonce
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type encryptionSuite struct{}
+
+var _ = Suite(&encryptionSuite{})
+
+func (s *encryptionSuite) SetUpTest(c *C) {
+	segmentSize = 16
+}
+
+func (s *encryptionSuite) TearDownTest(c *C) {
+	segmentSize = 64 * 1024
+}
+
+func newKeyring(c *C, keyIds ...string) *Keyring {
+	keyring := &Keyring{}
+	for _, keyId := range keyIds {
+		c.Assert(keyring.Add(keyId, bytes.Repeat([]byte(keyId[:1]), keySize)), IsNil)
+	}
+	return keyring
+}
+
+func encrypt(c *C, keyring *Keyring, plaintext []byte) []byte {
+	reader, err := keyring.Encrypt(bytes.NewReader(plaintext))
+	c.Assert(err, IsNil)
+	encrypted, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	return encrypted
+}
+
+func (s *encryptionSuite) Test_Encrypt_and_Decrypt(c *C) {
+	keyring := newKeyring(c, "key-1")
+	for _, size := range []int{0, 1, 15, 16, 17, 32, 100} {
+		plaintext := bytes.Repeat([]byte("x"), size)
+		encrypted := encrypt(c, keyring, plaintext)
+		c.Assert(bytes.Contains(encrypted, []byte("xxxxxxxx")), Equals, false)
+
+		reader, err := keyring.NewReader(bytes.NewReader(encrypted))
+		c.Assert(err, IsNil)
+		c.Assert(reader.KeyId(), Equals, "key-1")
+		c.Assert(reader.Size(), Equals, int64(size))
+		decrypted, err := ioutil.ReadAll(reader)
+		c.Assert(err, IsNil)
+		c.Assert(decrypted, DeepEquals, plaintext)
+	}
+}
+
+func (s *encryptionSuite) Test_Encrypt_uses_a_new_data_key_for_every_package(c *C) {
+	keyring := newKeyring(c, "key-1")
+	c.Assert(encrypt(c, keyring, []byte("package data")), Not(DeepEquals), encrypt(c, keyring, []byte("package data")))
+}
+
+func (s *encryptionSuite) Test_Reader_Seek(c *C) {
+	keyring := newKeyring(c, "key-1")
+	plaintext := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	reader, err := keyring.NewReader(bytes.NewReader(encrypt(c, keyring, plaintext)))
+	c.Assert(err, IsNil)
+	for _, offset := range []int64{20, 3, 16, 35, 0} {
+		_, err := reader.Seek(offset, io.SeekStart)
+		c.Assert(err, IsNil)
+		rest, err := ioutil.ReadAll(reader)
+		c.Assert(err, IsNil)
+		c.Assert(string(rest), Equals, string(plaintext[offset:]))
+	}
+	pos, err := reader.Seek(-4, io.SeekEnd)
+	c.Assert(err, IsNil)
+	c.Assert(pos, Equals, int64(32))
+}
+
+func (s *encryptionSuite) Test_NewReader_returns_ErrNotEncrypted(c *C) {
+	keyring := newKeyring(c, "key-1")
+	for _, data := range []string{"", "plain", "\x1f\x8b\x08 package data"} {
+		_, err := keyring.NewReader(bytes.NewReader([]byte(data)))
+		c.Assert(err, Equals, ErrNotEncrypted)
+	}
+}
+
+func (s *encryptionSuite) Test_Reader_detects_tampering(c *C) {
+	keyring := newKeyring(c, "key-1")
+	encrypted := encrypt(c, keyring, []byte("0123456789abcdefghijklmnopqrstuvwxyz"))
+	encrypted[len(encrypted)-20] ^= 1
+	reader, err := keyring.NewReader(bytes.NewReader(encrypted))
+	c.Assert(err, IsNil)
+	_, err = ioutil.ReadAll(reader)
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Matches, "Failed to decrypt package: .*")
+}
+
+func (s *encryptionSuite) Test_Reader_detects_truncation_at_segment_boundary(c *C) {
+	keyring := newKeyring(c, "key-1")
+	encrypted := encrypt(c, keyring, []byte("0123456789abcdefghijklmnopqrstuvwxyz"))
+	truncated := encrypted[:len(encrypted)-(4+tagSize)]
+	reader, err := keyring.NewReader(bytes.NewReader(truncated))
+	c.Assert(err, IsNil)
+	c.Assert(reader.Size(), Equals, int64(32))
+	_, err = ioutil.ReadAll(reader)
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Matches, "Failed to decrypt package: .*")
+}
+
+func (s *encryptionSuite) Test_Rotated_keys_can_still_decrypt(c *C) {
+	old := newKeyring(c, "old")
+	encrypted := encrypt(c, old, []byte("package data"))
+
+	rotated := newKeyring(c, "new", "old")
+	c.Assert(rotated.CurrentKeyId(), Equals, "new")
+	reader, err := rotated.NewReader(bytes.NewReader(encrypted))
+	c.Assert(err, IsNil)
+	c.Assert(reader.KeyId(), Equals, "old")
+	decrypted, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(decrypted), Equals, "package data")
+
+	_, err = newKeyring(c, "new").NewReader(bytes.NewReader(encrypted))
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Package is encrypted with unknown key 'old'")
+}
+
+func (s *encryptionSuite) Test_LoadKeyring(c *C) {
+	file, err := ioutil.TempFile("", "escape-inventory-keys")
+	c.Assert(err, IsNil)
+	defer os.Remove(file.Name())
+	key1 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("1"), keySize))
+	key2 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("2"), keySize))
+	file.WriteString("# Rotated on 2018-03-01\nkey-2 " + key2 + "\n\nkey-1 " + key1 + "\n")
+	file.Close()
+
+	keyring, err := LoadKeyring(file.Name())
+	c.Assert(err, IsNil)
+	c.Assert(keyring.CurrentKeyId(), Equals, "key-2")
+	c.Assert(keyring.keys, HasLen, 2)
+}
+
+func (s *encryptionSuite) Test_LoadKeyring_fails_on_invalid_keys(c *C) {
+	cases := map[string]string{
+		"":                     "Encryption key file '%s' doesn't contain any keys",
+		"key-1":                "Invalid key on line 1 of encryption key file '%s': expecting a key id and a key",
+		"key-1 not-base64!":    "Invalid key on line 1 of encryption key file '%s': illegal base64 data at input byte 3",
+		"key-1 c2hvcnQ=":       "Invalid key on line 1 of encryption key file '%s': Key 'key-1' should be 32 bytes long",
+		"key/1 " + validKey(c): "Invalid key on line 1 of encryption key file '%s': Invalid key id 'key/1'",
+		"k " + validKey(c) + "\nk " + validKey(c): "Invalid key on line 2 of encryption key file '%s': Duplicate key id 'k'",
+	}
+	for content, expected := range cases {
+		file, err := ioutil.TempFile("", "escape-inventory-keys")
+		c.Assert(err, IsNil)
+		file.WriteString(content)
+		file.Close()
+		_, err = LoadKeyring(file.Name())
+		os.Remove(file.Name())
+		c.Assert(err, Not(IsNil))
+		c.Assert(err.Error(), Equals, fmt.Sprintf(expected, file.Name()))
+	}
+}
+
+func (s *encryptionSuite) Test_LoadKeyring_fails_if_file_doesnt_exist(c *C) {
+	_, err := LoadKeyring("/doesnt/exist")
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Could not read encryption key file '/doesnt/exist': open /doesnt/exist: no such file or directory")
+}
+
+func validKey(c *C) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("k"), keySize))
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var keyIdRegex = regexp.MustCompile(`^[A-Za-z0-9._-]{1,255}$`)
+
+// Keyring holds the master keys. New packages are encrypted with the current
+// key; the other keys are only used to read packages that haven't been
+// re-encrypted yet.
+type Keyring struct {
+	current string
+	keys    map[string][]byte
+}
+
+// Loads the master keys from a file with one key per line, formatted as the
+// key id followed by the base64 encoded 32 byte key. The first key is the
+// current key. Empty lines and lines starting with '#' are ignored.
+func LoadKeyring(path string) (*Keyring, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read encryption key file '%s': %s", path, err.Error())
+	}
+	defer file.Close()
+	keyring := &Keyring{
+		keys: map[string][]byte{},
+	}
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line += 1
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Invalid key on line %d of encryption key file '%s': expecting a key id and a key", line, path)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid key on line %d of encryption key file '%s': %s", line, path, err.Error())
+		}
+		if err := keyring.Add(fields[0], key); err != nil {
+			return nil, fmt.Errorf("Invalid key on line %d of encryption key file '%s': %s", line, path, err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Could not read encryption key file '%s': %s", path, err.Error())
+	}
+	if keyring.current == "" {
+		return nil, fmt.Errorf("Encryption key file '%s' doesn't contain any keys", path)
+	}
+	return keyring, nil
+}
+
+// Adds a master key. The first key that's added becomes the current key.
+func (k *Keyring) Add(keyId string, key []byte) error {
+	if k.keys == nil {
+		k.keys = map[string][]byte{}
+	}
+	if !keyIdRegex.MatchString(keyId) {
+		return fmt.Errorf("Invalid key id '%s'", keyId)
+	}
+	if len(key) != keySize {
+		return fmt.Errorf("Key '%s' should be %d bytes long", keyId, keySize)
+	}
+	if _, exists := k.keys[keyId]; exists {
+		return fmt.Errorf("Duplicate key id '%s'", keyId)
+	}
+	k.keys[keyId] = key
+	if k.current == "" {
+		k.current = keyId
+	}
+	return nil
+}
+
+// Returns the id of the key that new packages are encrypted with.
+func (k *Keyring) CurrentKeyId() string {
+	return k.current
+}
+
+func (k *Keyring) wrap(keyId string, dataKey []byte) ([]byte, error) {
+	aead, err := newAEAD(k.keys[keyId])
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dataKey, wrappingData(keyId)), nil
+}
+
+func (k *Keyring) unwrap(keyId string, wrappedKey []byte) ([]byte, error) {
+	key, ok := k.keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("Package is encrypted with unknown key '%s'", keyId)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := aead.Open(nil, wrappedKey[:nonceSize], wrappedKey[nonceSize:], wrappingData(keyId))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decrypt data key with key '%s': %s", keyId, err.Error())
+	}
+	return dataKey, nil
+}
+
+func wrappingData(keyId string) []byte {
+	return append(append([]byte{}, magic...), keyId...)
+}
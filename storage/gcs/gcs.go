@@ -17,14 +17,20 @@ limitations under the License.
 package gcs
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/ankyra/escape-core/parsers"
 	"github.com/ankyra/escape-inventory/config"
+	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/storage/ranged"
 	"golang.org/x/net/context"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
@@ -33,6 +39,13 @@ type GoogleCloudStorageBackend struct {
 	Bucket       *storage.BucketHandle
 	Client       *storage.Client
 	Context      context.Context
+	signer       *serviceAccount
+}
+
+// The part of a service account key file that's needed to sign URLs.
+type serviceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
 }
 
 func NewGoogleCloudStorageBackend() *GoogleCloudStorageBackend {
@@ -57,12 +70,32 @@ func (ls *GoogleCloudStorageBackend) Init(settings config.StorageSettings) error
 	}
 	ls.Client = client
 	ls.Bucket = client.Bucket(ls.BucketString)
+	ls.signer = nil
+	if settings.Credentials != "" {
+		ls.signer = readServiceAccount(settings.Credentials)
+	}
 	return nil
 }
 
-func (ls *GoogleCloudStorageBackend) Upload(namespace string, releaseId *parsers.ReleaseId, pkg io.ReadSeeker) (string, error) {
+// URLs can only be signed when a service account key file is configured.
+func readServiceAccount(path string) *serviceAccount {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	account := &serviceAccount{}
+	if err := json.Unmarshal(data, account); err != nil || account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil
+	}
+	return account
+}
+
+func (ls *GoogleCloudStorageBackend) Upload(namespace string, releaseId *parsers.ReleaseId, pkg io.Reader) (string, error) {
 	archive := strings.Join([]string{namespace, releaseId.Name, releaseId.ToString() + ".tgz"}, "/")
-	writer := ls.Bucket.Object(archive).NewWriter(ls.Context)
+	// Cancelling the context aborts the upload without creating the object.
+	ctx, cancel := context.WithCancel(ls.Context)
+	defer cancel()
+	writer := ls.Bucket.Object(archive).NewWriter(ctx)
 	if _, err := io.Copy(writer, pkg); err != nil {
 		return "", err
 	}
@@ -72,9 +105,76 @@ func (ls *GoogleCloudStorageBackend) Upload(namespace string, releaseId *parsers
 	return "gcs://" + ls.BucketString + "/" + archive, nil
 }
 
-func (ls *GoogleCloudStorageBackend) Download(namespace, uri string) (io.Reader, error) {
+// Objects are read lazily using range requests, so that downloads can start
+// at any offset.
+func (ls *GoogleCloudStorageBackend) Download(namespace, uri string) (io.ReadSeekCloser, error) {
+	object := ls.object(uri)
+	attrs, err := object.Attrs(ls.Context)
+	if err == storage.ErrObjectNotExist {
+		return nil, types.NotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return ranged.NewReader(attrs.Size, func(offset int64) (io.ReadCloser, error) {
+		return object.NewRangeReader(ls.Context, offset, -1)
+	}), nil
+}
+
+func (ls *GoogleCloudStorageBackend) Stat(namespace, uri string) (int64, time.Time, error) {
+	attrs, err := ls.object(uri).Attrs(ls.Context)
+	if err == storage.ErrObjectNotExist {
+		return 0, time.Time{}, types.NotFound
+	} else if err != nil {
+		return 0, time.Time{}, err
+	}
+	return attrs.Size, attrs.Updated, nil
+}
+
+func (ls *GoogleCloudStorageBackend) SignedURL(uri string, expires time.Time) (string, error) {
+	if ls.signer == nil {
+		return "", nil
+	}
+	path := uri[len("gcs://"):]
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("Invalid GCS URI '%s'", uri)
+	}
+	return storage.SignedURL(parts[0], parts[1], &storage.SignedURLOptions{
+		GoogleAccessID: ls.signer.ClientEmail,
+		PrivateKey:     []byte(ls.signer.PrivateKey),
+		Method:         "GET",
+		Expires:        expires,
+	})
+}
+
+// Returns the URIs of all the packages in the bucket.
+func (ls *GoogleCloudStorageBackend) List() ([]string, error) {
+	uris := []string{}
+	objects := ls.Bucket.Objects(ls.Context, nil)
+	for {
+		attrs, err := objects.Next()
+		if err == iterator.Done {
+			return uris, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(attrs.Name, ".tgz") {
+			uris = append(uris, "gcs://"+ls.BucketString+"/"+attrs.Name)
+		}
+	}
+}
+
+func (ls *GoogleCloudStorageBackend) Delete(uri string) error {
+	err := ls.object(uri).Delete(ls.Context)
+	if err == storage.ErrObjectNotExist {
+		return types.NotFound
+	}
+	return err
+}
+
+func (ls *GoogleCloudStorageBackend) object(uri string) *storage.ObjectHandle {
 	path := uri[len("gcs://"):]
 	parts := strings.SplitN(path, "/", 2)
 	bucket := ls.Client.Bucket(parts[0])
-	return bucket.Object(parts[1]).NewReader(ls.Context)
+	return bucket.Object(parts[1])
 }
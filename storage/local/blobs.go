@@ -0,0 +1,281 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The blob store lives inside the storage directory, so that blobs can be
+// hard linked to the releases' paths.
+const blobsDir = ".blobs"
+
+// Written once the storage directory has been migrated to the blob store.
+const layoutMarker = "layout-v2"
+
+// The paths that link to a blob share its modification time, so the time a
+// path was uploaded is recorded separately, as the modification time of an
+// empty file in this directory at the same relative path.
+const uploadsDir = "uploads"
+
+// Guards placing blobs, linking paths to them and removing them, so that a
+// blob can't be removed as unused between storing and linking it.
+var blobsLock sync.Mutex
+
+// Writes the package to a temporary file, which is synced to disk and then
+// renamed into the blob store, so that an interrupted upload never leaves a
+// partial blob behind. The target path is then linked to the blob.
+//
+// Packages that are encrypted at rest never share a blob, because every
+// package is encrypted with its own random data key.
+func storeBlob(storage string, pkg io.Reader, target string) error {
+	tmpDir := filepath.Join(storage, blobsDir, "tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(tmpDir, "upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), pkg); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	blob := blobPath(storage, hex.EncodeToString(hash.Sum(nil)))
+	blobsLock.Lock()
+	defer blobsLock.Unlock()
+	if err := placeBlob(blob, tmp.Name()); err != nil {
+		return err
+	}
+	if err := linkBlob(storage, blob, target); err != nil {
+		return err
+	}
+	return markUploaded(storage, target)
+}
+
+func placeBlob(blob, tmp string) error {
+	if PathExists(blob) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, blob); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(blob))
+}
+
+// Atomically points the target path at the blob. The blob that the target
+// pointed to before is removed if it's no longer used. Needs to be called
+// with the blobsLock held.
+func linkBlob(storage, blob, target string) error {
+	var previous string
+	if st, err := os.Stat(target); err == nil {
+		blobSt, err := os.Stat(blob)
+		if err != nil {
+			return err
+		}
+		if os.SameFile(st, blobSt) {
+			return nil
+		}
+		if previous, err = blobPathFor(storage, target); err != nil {
+			return err
+		}
+	}
+	tmp := target + ".link"
+	os.Remove(tmp)
+	if err := os.Link(blob, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := syncDir(filepath.Dir(target)); err != nil {
+		return err
+	}
+	if previous != "" {
+		return removeUnusedBlob(previous)
+	}
+	return nil
+}
+
+func uploadMarkerPath(storage, path string) (string, error) {
+	rel, err := filepath.Rel(storage, path)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("Path %s is outside of the storage directory", path)
+	}
+	return filepath.Join(storage, blobsDir, uploadsDir, rel), nil
+}
+
+func markUploaded(storage, path string) error {
+	marker, err := uploadMarkerPath(storage, path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(marker), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(marker, []byte{}, 0644); err != nil {
+		return err
+	}
+	now := time.Now()
+	return os.Chtimes(marker, now, now)
+}
+
+// Packages stored before upload times were recorded fall back to the
+// modification time of the path itself.
+func uploadTime(storage, path string, fallback time.Time) time.Time {
+	marker, err := uploadMarkerPath(storage, path)
+	if err != nil {
+		return fallback
+	}
+	st, err := os.Stat(marker)
+	if err != nil {
+		return fallback
+	}
+	return st.ModTime()
+}
+
+func removeUploadMarker(storage, path string) {
+	if marker, err := uploadMarkerPath(storage, path); err == nil {
+		os.Remove(marker)
+	}
+}
+
+func blobPath(storage, digest string) string {
+	return filepath.Join(storage, blobsDir, "sha256", digest[:2], digest)
+}
+
+// Returns the path of the blob with the same contents as the file.
+func blobPathFor(storage, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return blobPath(storage, hex.EncodeToString(hash.Sum(nil))), nil
+}
+
+// Removes the blob if no release's path links to it anymore. Needs to be
+// called with the blobsLock held.
+func removeUnusedBlob(blob string) error {
+	st, err := os.Stat(blob)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if links, ok := linkCount(st); ok && links == 1 {
+		return os.Remove(blob)
+	}
+	return nil
+}
+
+// Moves packages stored by earlier versions, which were plain files, into the
+// blob store. The existing files are hard linked into the blob store, so
+// nothing needs to be copied, and duplicates are replaced by a link to the
+// first copy. This only runs once, but it's safe to resume when it was
+// interrupted.
+func migrateLayout(storage string) error {
+	marker := filepath.Join(storage, blobsDir, layoutMarker)
+	if PathExists(marker) {
+		return nil
+	}
+	blobsLock.Lock()
+	defer blobsLock.Unlock()
+	migrated := 0
+	err := filepath.Walk(storage, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path == filepath.Join(storage, blobsDir) {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() || !strings.HasSuffix(path, ".tgz") {
+			return nil
+		}
+		blob, err := blobPathFor(storage, path)
+		if err != nil {
+			return err
+		}
+		if blobSt, err := os.Stat(blob); err == nil {
+			if os.SameFile(info, blobSt) {
+				return nil
+			}
+			migrated += 1
+			return linkBlob(storage, blob, path)
+		}
+		if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+			return err
+		}
+		migrated += 1
+		return os.Link(path, blob)
+	})
+	if err != nil {
+		return fmt.Errorf("Could not migrate local storage to the blob store: %s", err.Error())
+	}
+	if migrated > 0 {
+		log.Printf("INFO: Moved %d packages in '%s' to the blob store\n", migrated, storage)
+	}
+	if err := os.MkdirAll(filepath.Dir(marker), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(marker, []byte{}, 0644)
+}
+
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	if err := dir.Sync(); err != nil && !os.IsPermission(err) {
+		return err
+	}
+	return nil
+}
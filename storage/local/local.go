@@ -21,6 +21,8 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/ankyra/escape-core/parsers"
 	"github.com/ankyra/escape-inventory/config"
@@ -48,14 +50,22 @@ func (ls *LocalStorageBackend) Init(settings config.StorageSettings) error {
 		return fmt.Errorf("Local file storage path '%s' does not exist", settings.Path)
 	}
 	ls.localStoragePath = settings.Path
-	return nil
+	storage, err := ls.getStoragePath()
+	if err != nil {
+		return err
+	}
+	return migrateLayout(storage)
 }
 
 func (ls *LocalStorageBackend) getStoragePath() (string, error) {
 	return filepath.Abs(ls.localStoragePath)
 }
 
-func (ls *LocalStorageBackend) Upload(namespace string, releaseId *parsers.ReleaseId, pkg io.ReadSeeker) (string, error) {
+// Packages are stored once in the blob store, by their SHA-256 digest, and
+// the release's path is a hard link to the blob. This means identical
+// packages only take up space once, while the URIs keep pointing at the
+// release's path.
+func (ls *LocalStorageBackend) Upload(namespace string, releaseId *parsers.ReleaseId, pkg io.Reader) (string, error) {
 	storage, err := ls.getStoragePath()
 	if err != nil {
 		return "", err
@@ -69,17 +79,13 @@ func (ls *LocalStorageBackend) Upload(namespace string, releaseId *parsers.Relea
 		return "", fmt.Errorf("Path %s exists, but is not a directory", targetDir)
 	}
 	target := filepath.Join(targetDir, releaseId.ToString()+".tgz")
-	dst, err := os.Create(target)
-	if err != nil {
-		return "", err
-	}
-	if _, err := io.Copy(dst, pkg); err != nil {
+	if err := storeBlob(storage, pkg, target); err != nil {
 		return "", err
 	}
 	return "file://" + target, nil
 }
 
-func (ls *LocalStorageBackend) Download(namespace, uri string) (io.Reader, error) {
+func (ls *LocalStorageBackend) Download(namespace, uri string) (io.ReadSeekCloser, error) {
 	file, err := os.Open(uri[len("file://"):])
 	if err != nil {
 		return nil, err
@@ -87,6 +93,64 @@ func (ls *LocalStorageBackend) Download(namespace, uri string) (io.Reader, error
 	return file, nil
 }
 
+// The modification time is when the path was uploaded, rather than when its
+// blob was first stored.
+func (ls *LocalStorageBackend) Stat(namespace, uri string) (int64, time.Time, error) {
+	storage, err := ls.getStoragePath()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	path := uri[len("file://"):]
+	st, err := os.Stat(path)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return st.Size(), uploadTime(storage, path, st.ModTime()), nil
+}
+
+// Returns the URIs of all the packages in the storage directory.
+func (ls *LocalStorageBackend) List() ([]string, error) {
+	storage, err := ls.getStoragePath()
+	if err != nil {
+		return nil, err
+	}
+	uris := []string{}
+	err = filepath.Walk(storage, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path == filepath.Join(storage, blobsDir) {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".tgz") {
+			uris = append(uris, "file://"+path)
+		}
+		return nil
+	})
+	return uris, err
+}
+
+// Removes the release's path, and the blob it pointed to if no other
+// release uses it anymore.
+func (ls *LocalStorageBackend) Delete(uri string) error {
+	storage, err := ls.getStoragePath()
+	if err != nil {
+		return err
+	}
+	path := uri[len("file://"):]
+	blob, err := blobPathFor(storage, path)
+	if err != nil {
+		return err
+	}
+	blobsLock.Lock()
+	defer blobsLock.Unlock()
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	removeUploadMarker(storage, path)
+	return removeUnusedBlob(blob)
+}
+
 func PathExists(path string) bool {
 	_, err := os.Stat(path)
 	return !os.IsNotExist(err)
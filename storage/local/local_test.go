@@ -17,11 +17,18 @@ limitations under the License.
 package local
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/ankyra/escape-core/parsers"
+	"github.com/ankyra/escape-inventory/config"
 	. "gopkg.in/check.v1"
 )
 
@@ -70,3 +77,207 @@ func (s *localSuite) Test_Local_Storage_Backend_Download(c *C) {
 	os.RemoveAll(test_data_path)
 	os.RemoveAll(test_local_storage_path)
 }
+
+func (s *localSuite) Test_Local_Storage_Backend_Stat(c *C) {
+	backend := NewLocalStorageBackendWithStoragePath(test_local_storage_path)
+	releaseId, err := parsers.ParseReleaseId("archive-upload-test-v1")
+	c.Assert(err, IsNil)
+	uri, err := backend.Upload("namespace", releaseId, bytes.NewReader(test_data))
+	c.Assert(err, IsNil)
+
+	size, modTime, err := backend.Stat("namespace", uri)
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, int64(len(test_data)))
+	c.Assert(modTime.IsZero(), Equals, false)
+
+	os.RemoveAll(test_local_storage_path)
+}
+
+func (s *localSuite) Test_Local_Storage_Backend_List_and_Delete(c *C) {
+	os.RemoveAll(test_local_storage_path)
+	backend := NewLocalStorageBackendWithStoragePath(test_local_storage_path)
+	releaseId, err := parsers.ParseReleaseId("archive-upload-test-v1")
+	c.Assert(err, IsNil)
+	uri, err := backend.Upload("namespace", releaseId, bytes.NewReader(test_data))
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(test_local_storage_path+"namespace/archive-upload-test/archive-upload-test-v2.tgz.part", test_data, 0644), IsNil)
+
+	uris, err := backend.List()
+	c.Assert(err, IsNil)
+	c.Assert(uris, DeepEquals, []string{uri})
+
+	c.Assert(backend.Delete(uri), IsNil)
+	uris, err = backend.List()
+	c.Assert(err, IsNil)
+	c.Assert(uris, HasLen, 0)
+
+	os.RemoveAll(test_local_storage_path)
+}
+
+func (s *localSuite) upload(c *C, backend *LocalStorageBackend, releaseId string, data []byte) string {
+	parsed, err := parsers.ParseReleaseId(releaseId)
+	c.Assert(err, IsNil)
+	uri, err := backend.Upload("namespace", parsed, bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	return uri
+}
+
+func blobs(c *C) []string {
+	paths, err := filepath.Glob(test_local_storage_path + ".blobs/sha256/*/*")
+	c.Assert(err, IsNil)
+	return paths
+}
+
+func sameFile(c *C, a, b string) bool {
+	stA, err := os.Stat(a)
+	c.Assert(err, IsNil)
+	stB, err := os.Stat(b)
+	c.Assert(err, IsNil)
+	return os.SameFile(stA, stB)
+}
+
+func (s *localSuite) Test_Local_Storage_Backend_stores_identical_packages_once(c *C) {
+	os.RemoveAll(test_local_storage_path)
+	defer os.RemoveAll(test_local_storage_path)
+	backend := NewLocalStorageBackendWithStoragePath(test_local_storage_path)
+	uri1 := s.upload(c, backend, "name-v1", test_data)
+	uri2 := s.upload(c, backend, "name-v2", test_data)
+	s.upload(c, backend, "name-v3", []byte("Different"))
+
+	c.Assert(blobs(c), HasLen, 2)
+	c.Assert(sameFile(c, uri1[len("file://"):], uri2[len("file://"):]), Equals, true)
+	c.Assert(sameFile(c, uri1[len("file://"):], test_local_storage_path+".blobs/sha256/33/334d016f755cd6dc58c53a86e183882f8ec14f52fb05345887c8a5edd42c87b7"), Equals, true)
+	tmpFiles, err := ioutil.ReadDir(test_local_storage_path + ".blobs/tmp")
+	c.Assert(err, IsNil)
+	c.Assert(tmpFiles, HasLen, 0)
+}
+
+func (s *localSuite) Test_Local_Storage_Backend_Stat_reports_upload_time_per_path(c *C) {
+	os.RemoveAll(test_local_storage_path)
+	defer os.RemoveAll(test_local_storage_path)
+	backend := NewLocalStorageBackendWithStoragePath(test_local_storage_path)
+	uri1 := s.upload(c, backend, "name-v1", test_data)
+	old := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	c.Assert(os.Chtimes(uri1[len("file://"):], old, old), IsNil)
+	c.Assert(os.Chtimes(test_local_storage_path+".blobs/uploads/namespace/name/name-v1.tgz", old, old), IsNil)
+
+	uri2 := s.upload(c, backend, "name-v2", test_data)
+	_, modTime, err := backend.Stat("namespace", uri1)
+	c.Assert(err, IsNil)
+	c.Assert(modTime.Equal(old), Equals, true)
+	_, modTime, err = backend.Stat("namespace", uri2)
+	c.Assert(err, IsNil)
+	c.Assert(time.Since(modTime) < time.Minute, Equals, true)
+	st, err := os.Stat(uri2[len("file://"):])
+	c.Assert(err, IsNil)
+	c.Assert(st.ModTime().Equal(old), Equals, true)
+
+	c.Assert(backend.Delete(uri2), IsNil)
+	c.Assert(PathExists(test_local_storage_path+".blobs/uploads/namespace/name/name-v2.tgz"), Equals, false)
+}
+
+func (s *localSuite) Test_Local_Storage_Backend_Delete_removes_unused_blobs(c *C) {
+	os.RemoveAll(test_local_storage_path)
+	defer os.RemoveAll(test_local_storage_path)
+	backend := NewLocalStorageBackendWithStoragePath(test_local_storage_path)
+	uri1 := s.upload(c, backend, "name-v1", test_data)
+	uri2 := s.upload(c, backend, "name-v2", test_data)
+
+	c.Assert(backend.Delete(uri1), IsNil)
+	c.Assert(blobs(c), HasLen, 1)
+	reader, err := backend.Download("namespace", uri2)
+	c.Assert(err, IsNil)
+	payload, err := ioutil.ReadAll(reader)
+	reader.Close()
+	c.Assert(err, IsNil)
+	c.Assert(payload, DeepEquals, test_data)
+
+	c.Assert(backend.Delete(uri2), IsNil)
+	c.Assert(blobs(c), HasLen, 0)
+}
+
+func (s *localSuite) Test_Local_Storage_Backend_Upload_and_Delete_of_same_blob_can_run_concurrently(c *C) {
+	os.RemoveAll(test_local_storage_path)
+	defer os.RemoveAll(test_local_storage_path)
+	backend := NewLocalStorageBackendWithStoragePath(test_local_storage_path)
+	for i := 0; i < 50; i++ {
+		uri := s.upload(c, backend, "name-v1", test_data)
+		parsed, err := parsers.ParseReleaseId("name-v2")
+		c.Assert(err, IsNil)
+		uploadErr := make(chan error)
+		go func() {
+			_, err := backend.Upload("namespace", parsed, bytes.NewReader(test_data))
+			uploadErr <- err
+		}()
+		c.Assert(backend.Delete(uri), IsNil)
+		c.Assert(<-uploadErr, IsNil)
+		c.Assert(blobs(c), HasLen, 1)
+		c.Assert(backend.Delete("file://"+test_local_storage_path+"namespace/name/name-v2.tgz"), IsNil)
+	}
+}
+
+func (s *localSuite) Test_Local_Storage_Backend_Upload_replaces_package(c *C) {
+	os.RemoveAll(test_local_storage_path)
+	defer os.RemoveAll(test_local_storage_path)
+	backend := NewLocalStorageBackendWithStoragePath(test_local_storage_path)
+	s.upload(c, backend, "name-v1", test_data)
+	uri := s.upload(c, backend, "name-v1", []byte("Replaced"))
+
+	c.Assert(blobs(c), HasLen, 1)
+	payload, err := ioutil.ReadFile(uri[len("file://"):])
+	c.Assert(err, IsNil)
+	c.Assert(string(payload), Equals, "Replaced")
+}
+
+func (s *localSuite) Test_Local_Storage_Backend_failed_Upload_leaves_nothing_behind(c *C) {
+	os.RemoveAll(test_local_storage_path)
+	defer os.RemoveAll(test_local_storage_path)
+	backend := NewLocalStorageBackendWithStoragePath(test_local_storage_path)
+	uri := s.upload(c, backend, "name-v1", test_data)
+	releaseId, err := parsers.ParseReleaseId("name-v1")
+	c.Assert(err, IsNil)
+
+	pkg := io.MultiReader(bytes.NewReader([]byte("partial")), iotest.ErrReader(errors.New("connection reset")))
+	_, err = backend.Upload("namespace", releaseId, pkg)
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "connection reset")
+
+	payload, err := ioutil.ReadFile(uri[len("file://"):])
+	c.Assert(err, IsNil)
+	c.Assert(payload, DeepEquals, test_data)
+	c.Assert(blobs(c), HasLen, 1)
+	tmpFiles, err := ioutil.ReadDir(test_local_storage_path + ".blobs/tmp")
+	c.Assert(err, IsNil)
+	c.Assert(tmpFiles, HasLen, 0)
+}
+
+func (s *localSuite) Test_Local_Storage_Backend_Init_migrates_existing_layout(c *C) {
+	os.RemoveAll(test_local_storage_path)
+	defer os.RemoveAll(test_local_storage_path)
+	c.Assert(os.MkdirAll(test_local_storage_path+"namespace/name", 0755), IsNil)
+	c.Assert(os.MkdirAll(test_local_storage_path+"other/name", 0755), IsNil)
+	v1 := test_local_storage_path + "namespace/name/name-v1.tgz"
+	v2 := test_local_storage_path + "namespace/name/name-v2.tgz"
+	other := test_local_storage_path + "other/name/name-v1.tgz"
+	c.Assert(ioutil.WriteFile(v1, test_data, 0644), IsNil)
+	c.Assert(ioutil.WriteFile(v2, []byte("Different"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(other, test_data, 0644), IsNil)
+
+	backend := NewLocalStorageBackend()
+	c.Assert(backend.Init(config.StorageSettings{Path: test_local_storage_path}), IsNil)
+	c.Assert(blobs(c), HasLen, 2)
+	c.Assert(sameFile(c, v1, other), Equals, true)
+	c.Assert(sameFile(c, v1, v2), Equals, false)
+	payload, err := ioutil.ReadFile(v2)
+	c.Assert(err, IsNil)
+	c.Assert(string(payload), Equals, "Different")
+
+	uris, err := backend.List()
+	c.Assert(err, IsNil)
+	c.Assert(uris, DeepEquals, []string{"file://" + v1, "file://" + v2, "file://" + other})
+
+	// Only runs once.
+	c.Assert(ioutil.WriteFile(test_local_storage_path+"namespace/name/name-v3.tgz", test_data, 0644), IsNil)
+	c.Assert(backend.Init(config.StorageSettings{Path: test_local_storage_path}), IsNil)
+	c.Assert(sameFile(c, v1, test_local_storage_path+"namespace/name/name-v3.tgz"), Equals, false)
+}
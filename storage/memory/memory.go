@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"io"
 	"io/ioutil"
+	"time"
 
 	"github.com/ankyra/escape-core/parsers"
 	"github.com/ankyra/escape-inventory/config"
@@ -27,12 +28,14 @@ import (
 )
 
 type InMemoryStorageBackend struct {
-	URIs map[string]string
+	URIs     map[string]string
+	ModTimes map[string]time.Time
 }
 
 func NewInMemoryStorageBackend() *InMemoryStorageBackend {
 	return &InMemoryStorageBackend{
-		URIs: map[string]string{},
+		URIs:     map[string]string{},
+		ModTimes: map[string]time.Time{},
 	}
 }
 
@@ -40,20 +43,54 @@ func (m *InMemoryStorageBackend) Init(settings config.StorageSettings) error {
 	return nil
 }
 
-func (m *InMemoryStorageBackend) Upload(namespace string, releaseId *parsers.ReleaseId, pkg io.ReadSeeker) (string, error) {
+func (m *InMemoryStorageBackend) Upload(namespace string, releaseId *parsers.ReleaseId, pkg io.Reader) (string, error) {
 	uri := "mem://" + releaseId.Name + "-v" + releaseId.Version + ".tgz"
 	data, err := ioutil.ReadAll(pkg)
 	if err != nil {
 		return "", err
 	}
 	m.URIs[uri] = string(data)
+	m.ModTimes[uri] = time.Now()
 	return uri, nil
 }
 
-func (m *InMemoryStorageBackend) Download(namespace, uri string) (io.Reader, error) {
+func (m *InMemoryStorageBackend) Download(namespace, uri string) (io.ReadSeekCloser, error) {
 	data, exists := m.URIs[uri]
 	if !exists {
 		return nil, types.NotFound
 	}
-	return bytes.NewReader([]byte(data)), nil
+	return nopCloser{bytes.NewReader([]byte(data))}, nil
+}
+
+func (m *InMemoryStorageBackend) Stat(namespace, uri string) (int64, time.Time, error) {
+	data, exists := m.URIs[uri]
+	if !exists {
+		return 0, time.Time{}, types.NotFound
+	}
+	return int64(len(data)), m.ModTimes[uri], nil
+}
+
+func (m *InMemoryStorageBackend) List() ([]string, error) {
+	uris := []string{}
+	for uri := range m.URIs {
+		uris = append(uris, uri)
+	}
+	return uris, nil
+}
+
+func (m *InMemoryStorageBackend) Delete(uri string) error {
+	if _, exists := m.URIs[uri]; !exists {
+		return types.NotFound
+	}
+	delete(m.URIs, uri)
+	delete(m.ModTimes, uri)
+	return nil
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (n nopCloser) Close() error {
+	return nil
 }
@@ -54,4 +54,26 @@ func (s *suite) Test_InMemoryStorageBackend(c *C) {
 	bytes, err := ioutil.ReadAll(data)
 	c.Assert(err, IsNil)
 	c.Assert(string(bytes), Equals, "package data")
+
+	size, modTime, err := unit.Stat("namespace", uri)
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, int64(12))
+	c.Assert(modTime.IsZero(), Equals, false)
+}
+
+func (s *suite) Test_InMemoryStorageBackend_List_and_Delete(c *C) {
+	unit := NewInMemoryStorageBackend()
+	releaseId, err := parsers.ParseReleaseId("name-v1.0")
+	c.Assert(err, IsNil)
+	uri, err := unit.Upload("namespace", releaseId, bytes.NewReader([]byte("package data")))
+	c.Assert(err, IsNil)
+
+	uris, err := unit.List()
+	c.Assert(err, IsNil)
+	c.Assert(uris, DeepEquals, []string{uri})
+
+	c.Assert(unit.Delete(uri), IsNil)
+	_, err = unit.Download("namespace", uri)
+	c.Assert(err, Equals, types.NotFound)
+	c.Assert(unit.Delete(uri), Equals, types.NotFound)
 }
@@ -0,0 +1,89 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ranged implements seeking for storage backends that can only read
+// objects from a given offset, like GCS and S3.
+package ranged
+
+import (
+	"fmt"
+	"io"
+)
+
+type OpenFunc func(offset int64) (io.ReadCloser, error)
+
+type reader struct {
+	size   int64
+	offset int64
+	open   OpenFunc
+	body   io.ReadCloser
+}
+
+// Returns a reader for an object of the given size. The object is only opened
+// when it's read, starting from the current offset, and it's opened again at
+// the new offset when the reader is seeked.
+func NewReader(size int64, open OpenFunc) io.ReadSeekCloser {
+	return &reader{
+		size: size,
+		open: open,
+	}
+}
+
+func (r *reader) Read(b []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.open(r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(b)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	case io.SeekStart:
+	default:
+		return r.offset, fmt.Errorf("Invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return r.offset, fmt.Errorf("Can't seek to negative offset %d", offset)
+	}
+	if offset != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *reader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
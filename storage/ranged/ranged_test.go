@@ -0,0 +1,91 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ranged
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type suite struct{}
+
+var _ = Suite(&suite{})
+
+func (s *suite) newReader(data string, opened *[]int64) io.ReadSeekCloser {
+	return NewReader(int64(len(data)), func(offset int64) (io.ReadCloser, error) {
+		*opened = append(*opened, offset)
+		return ioutil.NopCloser(strings.NewReader(data[offset:])), nil
+	})
+}
+
+func (s *suite) Test_Reader_opens_object_lazily(c *C) {
+	opened := []int64{}
+	reader := s.newReader("package data", &opened)
+	c.Assert(opened, HasLen, 0)
+	size, err := reader.Seek(0, io.SeekEnd)
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, int64(12))
+	_, err = reader.Seek(0, io.SeekStart)
+	c.Assert(err, IsNil)
+	c.Assert(opened, HasLen, 0)
+
+	data, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "package data")
+	c.Assert(opened, DeepEquals, []int64{0})
+	c.Assert(reader.Close(), IsNil)
+}
+
+func (s *suite) Test_Reader_reopens_object_at_new_offset(c *C) {
+	opened := []int64{}
+	reader := s.newReader("package data", &opened)
+	b := make([]byte, 3)
+	_, err := io.ReadFull(reader, b)
+	c.Assert(err, IsNil)
+	c.Assert(string(b), Equals, "pac")
+
+	_, err = reader.Seek(5, io.SeekCurrent)
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "data")
+	c.Assert(opened, DeepEquals, []int64{0, 8})
+}
+
+func (s *suite) Test_Reader_returns_EOF_at_end_without_opening(c *C) {
+	opened := []int64{}
+	reader := s.newReader("package data", &opened)
+	_, err := reader.Seek(12, io.SeekStart)
+	c.Assert(err, IsNil)
+	n, err := reader.Read(make([]byte, 10))
+	c.Assert(n, Equals, 0)
+	c.Assert(err, Equals, io.EOF)
+	c.Assert(opened, HasLen, 0)
+}
+
+func (s *suite) Test_Reader_fails_on_negative_offset(c *C) {
+	opened := []int64{}
+	reader := s.newReader("package data", &opened)
+	_, err := reader.Seek(-1, io.SeekStart)
+	c.Assert(err, Not(IsNil))
+}
@@ -0,0 +1,444 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ankyra/escape-core/parsers"
+	"github.com/ankyra/escape-inventory/config"
+	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/storage/ranged"
+)
+
+const defaultRegion = "us-east-1"
+
+// S3 requires all parts but the last one to be at least 5MB.
+var multipartPartSize = 8 * 1024 * 1024
+
+type S3StorageBackend struct {
+	Bucket    string
+	Endpoint  *url.URL
+	PathStyle bool
+	Client    *http.Client
+	signer    *signer
+}
+
+func NewS3StorageBackend() *S3StorageBackend {
+	return &S3StorageBackend{}
+}
+
+func (s *S3StorageBackend) Init(settings config.StorageSettings) error {
+	if settings.Bucket == "" {
+		return fmt.Errorf("Missing storage_settings.bucket configuration variable")
+	}
+	region := settings.Region
+	if region == "" {
+		region = defaultRegion
+	}
+	endpoint := settings.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("Invalid storage_settings.endpoint '%s': %s", endpoint, err.Error())
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("Invalid storage_settings.endpoint '%s': expecting an http(s) URL", endpoint)
+	}
+	if (settings.AccessKeyID == "") != (settings.SecretAccessKey == "") {
+		return fmt.Errorf("Both storage_settings.access_key_id and storage_settings.secret_access_key need to be set")
+	}
+	s.Bucket = settings.Bucket
+	s.Endpoint = u
+	s.PathStyle = settings.PathStyle
+	s.Client = http.DefaultClient
+	s.signer = nil
+	if settings.AccessKeyID != "" {
+		s.signer = &signer{
+			AccessKeyID:     settings.AccessKeyID,
+			SecretAccessKey: settings.SecretAccessKey,
+			Region:          region,
+		}
+	}
+	return nil
+}
+
+// Packages that fit in a single part are uploaded with one PUT request. Bigger
+// packages are streamed using a multipart upload, so only one part is held in
+// memory at a time.
+func (s *S3StorageBackend) Upload(namespace string, releaseId *parsers.ReleaseId, pkg io.Reader) (string, error) {
+	key := strings.Join([]string{namespace, releaseId.Name, releaseId.ToString() + ".tgz"}, "/")
+	uri := "s3://" + s.Bucket + "/" + key
+	part := make([]byte, multipartPartSize)
+	n, err := io.ReadFull(pkg, part)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return uri, s.putObject(key, part[:n])
+	} else if err != nil {
+		return "", err
+	}
+	return uri, s.multipartUpload(key, part, pkg)
+}
+
+func (s *S3StorageBackend) putObject(key string, data []byte) error {
+	req, err := s.newRequest("PUT", s.Bucket, key, nil, data)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	resp, err := s.do(req, hashHex(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+	return nil
+}
+
+func (s *S3StorageBackend) multipartUpload(key string, firstPart []byte, rest io.Reader) error {
+	uploadId, err := s.initiateMultipartUpload(key)
+	if err != nil {
+		return err
+	}
+	parts := []completedPart{}
+	part := firstPart
+	for len(part) > 0 {
+		etag, err := s.uploadPart(key, uploadId, len(parts)+1, part)
+		if err != nil {
+			s.abortMultipartUpload(key, uploadId)
+			return err
+		}
+		parts = append(parts, completedPart{PartNumber: len(parts) + 1, ETag: etag})
+		part = firstPart[:multipartPartSize]
+		n, err := io.ReadFull(rest, part)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			s.abortMultipartUpload(key, uploadId)
+			return err
+		}
+		part = part[:n]
+	}
+	if err := s.completeMultipartUpload(key, uploadId, parts); err != nil {
+		s.abortMultipartUpload(key, uploadId)
+		return err
+	}
+	return nil
+}
+
+func (s *S3StorageBackend) initiateMultipartUpload(key string) (string, error) {
+	req, err := s.newRequest("POST", s.Bucket, key, url.Values{"uploads": []string{""}}, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	resp, err := s.do(req, emptyPayloadHash)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", readError(resp)
+	}
+	result := struct {
+		UploadId string
+	}{}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("Could not parse S3 response: %s", err.Error())
+	}
+	return result.UploadId, nil
+}
+
+func (s *S3StorageBackend) uploadPart(key, uploadId string, partNumber int, data []byte) (string, error) {
+	query := url.Values{
+		"partNumber": []string{strconv.Itoa(partNumber)},
+		"uploadId":   []string{uploadId},
+	}
+	req, err := s.newRequest("PUT", s.Bucket, key, query, data)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.do(req, hashHex(data))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", readError(resp)
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+func (s *S3StorageBackend) completeMultipartUpload(key, uploadId string, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	req, err := s.newRequest("POST", s.Bucket, key, url.Values{"uploadId": []string{uploadId}}, body)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req, hashHex(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+	// S3 can report errors with a 200 status once it has started responding.
+	result, err := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(result), "<Error>") {
+		return fmt.Errorf("S3 request '%s %s' failed: %s", req.Method, req.URL.Path, strings.TrimSpace(string(result)))
+	}
+	return nil
+}
+
+func (s *S3StorageBackend) abortMultipartUpload(key, uploadId string) {
+	req, err := s.newRequest("DELETE", s.Bucket, key, url.Values{"uploadId": []string{uploadId}}, nil)
+	if err != nil {
+		return
+	}
+	resp, err := s.do(req, emptyPayloadHash)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
+
+// Objects are read lazily using range requests, so that downloads can start
+// at any offset.
+func (s *S3StorageBackend) Download(namespace, uri string) (io.ReadSeekCloser, error) {
+	bucket, key, err := parseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	size, _, err := s.Stat(namespace, uri)
+	if err != nil {
+		return nil, err
+	}
+	return ranged.NewReader(size, func(offset int64) (io.ReadCloser, error) {
+		return s.getObject(bucket, key, offset)
+	}), nil
+}
+
+func (s *S3StorageBackend) getObject(bucket, key string, offset int64) (io.ReadCloser, error) {
+	req, err := s.newRequest("GET", bucket, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	resp, err := s.do(req, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, types.NotFound
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3StorageBackend) Stat(namespace, uri string) (int64, time.Time, error) {
+	bucket, key, err := parseURI(uri)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	req, err := s.newRequest("HEAD", bucket, key, nil, nil)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	resp, err := s.do(req, emptyPayloadHash)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, time.Time{}, types.NotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, time.Time{}, readError(resp)
+	}
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return resp.ContentLength, modTime, nil
+}
+
+// Returns the URIs of all the packages in the bucket.
+func (s *S3StorageBackend) List() ([]string, error) {
+	uris := []string{}
+	continuationToken := ""
+	for {
+		query := url.Values{"list-type": []string{"2"}}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		req, err := s.newRequest("GET", s.Bucket, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req, emptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return nil, readError(resp)
+		}
+		result := struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}{}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse S3 response: %s", err.Error())
+		}
+		for _, object := range result.Contents {
+			if strings.HasSuffix(object.Key, ".tgz") {
+				uris = append(uris, "s3://"+s.Bucket+"/"+object.Key)
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return uris, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+func (s *S3StorageBackend) Delete(uri string) error {
+	bucket, key, err := parseURI(uri)
+	if err != nil {
+		return err
+	}
+	req, err := s.newRequest("DELETE", bucket, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return readError(resp)
+	}
+	return nil
+}
+
+func parseURI(uri string) (string, string, error) {
+	path := uri[len("s3://"):]
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("Invalid S3 URI '%s'", uri)
+	}
+	return parts[0], parts[1], nil
+}
+
+func (s *S3StorageBackend) newRequest(method, bucket, key string, query url.Values, body []byte) (*http.Request, error) {
+	u := *s.Endpoint
+	rawPath := strings.TrimSuffix(s.Endpoint.EscapedPath(), "/")
+	if s.PathStyle {
+		rawPath += "/" + uriEncode(bucket)
+	} else {
+		u.Host = bucket + "." + u.Host
+	}
+	rawPath += "/" + escapeKey(key)
+	path, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path
+	u.RawPath = rawPath
+	u.RawQuery = encodeQuery(query)
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	return http.NewRequest(method, u.String(), reader)
+}
+
+func (s *S3StorageBackend) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	if s.signer != nil {
+		s.signer.Sign(req, payloadHash, time.Now())
+	}
+	return s.Client.Do(req)
+}
+
+// Like url.Values.Encode, but leaves out the '=' for empty values; some S3
+// compatible stores don't accept "?uploads=".
+func encodeQuery(query url.Values) string {
+	keys := []string{}
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := []string{}
+	for _, key := range keys {
+		for _, value := range query[key] {
+			if value == "" {
+				result = append(result, uriEncode(key))
+			} else {
+				result = append(result, uriEncode(key)+"="+uriEncode(value))
+			}
+		}
+	}
+	return strings.Join(result, "&")
+}
+
+func escapeKey(key string) string {
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		parts[i] = uriEncode(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+func readError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("S3 request '%s %s' failed with status %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+}
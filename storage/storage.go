@@ -20,62 +20,317 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/ankyra/escape-core/parsers"
 	"github.com/ankyra/escape-inventory/config"
+	"github.com/ankyra/escape-inventory/storage/azblob"
+	"github.com/ankyra/escape-inventory/storage/encryption"
 	"github.com/ankyra/escape-inventory/storage/gcs"
 	"github.com/ankyra/escape-inventory/storage/local"
 	"github.com/ankyra/escape-inventory/storage/memory"
+	"github.com/ankyra/escape-inventory/storage/s3"
+	"github.com/ankyra/escape-inventory/storage/webdav"
 )
 
 type StorageBackend interface {
 	Init(settings config.StorageSettings) error
-	Upload(namespace string, releaseId *parsers.ReleaseId, pkg io.ReadSeeker) (string, error)
-	Download(namespace, uri string) (io.Reader, error)
+	Upload(namespace string, releaseId *parsers.ReleaseId, pkg io.Reader) (string, error)
+	Download(namespace, uri string) (io.ReadSeekCloser, error)
+	Stat(namespace, uri string) (size int64, modTime time.Time, err error)
 }
 
+// Implemented by backends that can issue their own time limited download URLs.
+type SignedURLBackend interface {
+	SignedURL(uri string, expires time.Time) (string, error)
+}
+
+// Implemented by backends that can enumerate and remove the packages they
+// store, which is needed to find and clean up orphaned packages.
+type ListingBackend interface {
+	List() ([]string, error)
+	Delete(uri string) error
+}
+
+// Implemented by backends whose URI scheme depends on their configuration.
+type SchemeBackend interface {
+	URIScheme() string
+}
+
+var ErrListingNotSupported = fmt.Errorf("Storage backend doesn't support listing packages")
+
+var localBackend = local.NewLocalStorageBackend()
+var memoryBackend = memory.NewInMemoryStorageBackend()
+var webdavBackend = webdav.NewWebDAVStorageBackend()
+
 var storageBackends = map[string]StorageBackend{
-	"local":  local.NewLocalStorageBackend(),
-	"file":   local.NewLocalStorageBackend(),
-	"memory": memory.NewInMemoryStorageBackend(),
+	"local":  localBackend,
+	"file":   localBackend,
+	"memory": memoryBackend,
+	"mem":    memoryBackend,
 	"gcs":    gcs.NewGoogleCloudStorageBackend(),
+	"s3":     s3.NewS3StorageBackend(),
+	"azblob": azblob.NewAzureBlobStorageBackend(),
+	"webdav": webdavBackend,
+	"http":   webdavBackend,
+	"https":  webdavBackend,
 }
 
-var uploadBackend = "local"
+// The URI schemes used by backends that are configured under a different name.
+var uriSchemes = map[string]string{
+	"local":  "file",
+	"memory": "mem",
+}
+
+// The backends packages are uploaded to. The first one is the primary backend,
+// which is preferred for downloads.
+var uploadBackends = []string{"local"}
 
 func TestSetup() {
-	uploadBackend = "memory"
+	uploadBackends = []string{"memory"}
+	keyring = nil
 }
 
 func LoadFromConfig(conf *config.Config) error {
-	switch conf.StorageBackend {
-	case "":
+	if conf.StorageBackend == "" {
 		return fmt.Errorf("Missing storage backend configuration variable")
-	case "local", "gcs":
-		backend, _ := storageBackends[conf.StorageBackend]
-		err := backend.Init(conf.StorageSettings)
+	}
+	backends := []string{conf.StorageBackend}
+	for _, name := range conf.StorageBackends {
+		if !contains(backends, name) {
+			backends = append(backends, name)
+		}
+	}
+	for _, name := range backends {
+		switch name {
+		case "local", "gcs", "s3", "azblob", "webdav":
+			backend, _ := storageBackends[name]
+			err := backend.Init(conf.StorageSettingsFor(name))
+			if err != nil {
+				return fmt.Errorf("Could not initialize '%s' storage backend: %s", name, err.Error())
+			}
+		default:
+			return fmt.Errorf("Unknown storage backend: %s", name)
+		}
+	}
+	if err := initUploadSessions(conf.UploadSessionsPath); err != nil {
+		return err
+	}
+	keyring = nil
+	if conf.StorageSettings.EncryptionKeyFile != "" {
+		k, err := encryption.LoadKeyring(conf.StorageSettings.EncryptionKeyFile)
 		if err != nil {
-			return fmt.Errorf("Could not initialize '%s' storage backend: %s", conf.StorageBackend, err.Error())
+			return err
 		}
-		uploadBackend = conf.StorageBackend
-		return nil
+		keyring = k
 	}
-	return fmt.Errorf("Unknown storage backend: %s", conf.StorageBackend)
+	uploadBackends = backends
+	return nil
 }
 
-func Upload(namespace, releaseId string, pkg io.ReadSeeker) (string, error) {
-	backend, ok := storageBackends[uploadBackend]
-	if !ok {
-		return "", fmt.Errorf("Unknown scheme")
+// Uploads the package to every configured backend and returns the URIs,
+// starting with the one for the primary backend. The package is streamed to
+// all the backends at the same time and the upload fails if any of the
+// backends fails. The URIs of the copies that were written anyway
+// are returned with the error, so that they can be cleaned up.
+func Upload(namespace, releaseId string, pkg io.Reader) ([]string, error) {
+	parsedReleaseId, err := parsers.ParseReleaseId(releaseId)
+	if err != nil {
+		return nil, err
+	}
+	return upload(namespace, parsedReleaseId, pkg)
+}
+
+// Uploads a release artifact to every configured backend, like Upload. The
+// backends name what they store after the release id, so the artifact is
+// passed on as a release whose version is suffixed with the artifact name.
+// Versions never contain a dash, so this can't clash with another release.
+func UploadArtifact(namespace, releaseId, artifact string, pkg io.Reader) ([]string, error) {
+	parsedReleaseId, err := parsers.ParseReleaseId(releaseId)
+	if err != nil {
+		return nil, err
+	}
+	parsedReleaseId.Version += "-" + artifact
+	return upload(namespace, parsedReleaseId, pkg)
+}
+
+func upload(namespace string, parsedReleaseId *parsers.ReleaseId, pkg io.Reader) ([]string, error) {
+	backends := []StorageBackend{}
+	for _, name := range uploadBackends {
+		backend, ok := storageBackends[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown scheme")
+		}
+		backends = append(backends, encrypted(backend))
+	}
+	if len(backends) == 1 {
+		uri, err := backends[0].Upload(namespace, parsedReleaseId, pkg)
+		if err != nil {
+			return nil, err
+		}
+		return []string{uri}, nil
+	}
+
+	type uploadResult struct {
+		URI   string
+		Error error
+	}
+	pipes := []*io.PipeWriter{}
+	writers := []io.Writer{}
+	results := []chan uploadResult{}
+	for _, backend := range backends {
+		reader, writer := io.Pipe()
+		result := make(chan uploadResult, 1)
+		go func(backend StorageBackend) {
+			uri, err := backend.Upload(namespace, parsedReleaseId, reader)
+			// Unblocks the writer if the backend stopped reading early.
+			reader.CloseWithError(err)
+			result <- uploadResult{uri, err}
+		}(backend)
+		pipes = append(pipes, writer)
+		writers = append(writers, writer)
+		results = append(results, result)
+	}
+	src := &errorRecordingReader{Reader: pkg}
+	_, err := io.Copy(io.MultiWriter(writers...), src)
+	if err != nil && src.Err == nil {
+		// One of the backends failed; make the others abort their upload.
+		err = errUploadAborted
+	}
+	for _, pipe := range pipes {
+		pipe.CloseWithError(err)
+	}
+	uris := []string{}
+	written := []string{}
+	var uploadError error
+	for i, result := range results {
+		r := <-result
+		if r.Error != nil && r.Error != errUploadAborted && uploadError == nil {
+			uploadError = fmt.Errorf("Upload to '%s' storage backend failed: %s", uploadBackends[i], r.Error.Error())
+		}
+		if r.Error == nil {
+			written = append(written, r.URI)
+		}
+		uris = append(uris, r.URI)
+	}
+	if src.Err != nil {
+		return written, src.Err
+	}
+	if uploadError != nil {
+		return written, uploadError
+	}
+	return uris, nil
+}
+
+var errUploadAborted = fmt.Errorf("Upload aborted")
+
+type errorRecordingReader struct {
+	io.Reader
+	Err error
+}
+
+func (r *errorRecordingReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	if err != nil && err != io.EOF {
+		r.Err = err
+	}
+	return n, err
+}
+
+func IsConfigured(backendName string) bool {
+	return contains(uploadBackends, backendName)
+}
+
+// Uploads the package to a single configured backend.
+func UploadTo(backendName, namespace, releaseId string, pkg io.Reader) (string, error) {
+	if !IsConfigured(backendName) {
+		return "", fmt.Errorf("Storage backend '%s' is not configured", backendName)
 	}
 	parsedReleaseId, err := parsers.ParseReleaseId(releaseId)
 	if err != nil {
 		return "", err
 	}
-	return backend.Upload(namespace, parsedReleaseId, pkg)
+	return encrypted(storageBackends[backendName]).Upload(namespace, parsedReleaseId, pkg)
 }
 
-func Download(namespace, uri string) (io.Reader, error) {
+// Uploads a release artifact to a single configured backend.
+func UploadArtifactTo(backendName, namespace, releaseId, artifact string, pkg io.Reader) (string, error) {
+	if !IsConfigured(backendName) {
+		return "", fmt.Errorf("Storage backend '%s' is not configured", backendName)
+	}
+	parsedReleaseId, err := parsers.ParseReleaseId(releaseId)
+	if err != nil {
+		return "", err
+	}
+	parsedReleaseId.Version += "-" + artifact
+	return encrypted(storageBackends[backendName]).Upload(namespace, parsedReleaseId, pkg)
+}
+
+func Download(namespace, uri string) (io.ReadSeekCloser, error) {
+	backend, err := getBackendForURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	return backend.Download(namespace, uri)
+}
+
+// Returns the size and modification time of the stored package.
+func Stat(namespace, uri string) (int64, time.Time, error) {
+	backend, err := getBackendForURI(uri)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return backend.Stat(namespace, uri)
+}
+
+// Returns a URL that the package can be downloaded from without credentials
+// until it expires, or an empty string if the backend can't sign URLs.
+func SignedURL(namespace, uri string, expires time.Time) (string, error) {
+	backend, err := getBackendForURI(uri)
+	if err != nil {
+		return "", err
+	}
+	signer, ok := backend.(SignedURLBackend)
+	if !ok {
+		return "", nil
+	}
+	return signer.SignedURL(uri, expires)
+}
+
+// Returns the names of the configured backends, starting with the primary one.
+func ConfiguredBackends() []string {
+	result := make([]string, len(uploadBackends))
+	copy(result, uploadBackends)
+	return result
+}
+
+// Returns the URIs of all the packages stored in a configured backend.
+func ListPackages(backendName string) ([]string, error) {
+	if !IsConfigured(backendName) {
+		return nil, fmt.Errorf("Storage backend '%s' is not configured", backendName)
+	}
+	lister, ok := storageBackends[backendName].(ListingBackend)
+	if !ok {
+		return nil, ErrListingNotSupported
+	}
+	return lister.List()
+}
+
+func DeletePackage(namespace, uri string) error {
+	backend, err := getBackendForURI(uri)
+	if err != nil {
+		return err
+	}
+	deleter, ok := backend.(ListingBackend)
+	if !ok {
+		return ErrListingNotSupported
+	}
+	return deleter.Delete(uri)
+}
+
+func getBackendForURI(uri string) (StorageBackend, error) {
 	u, err := url.Parse(uri)
 	if err != nil {
 		return nil, err
@@ -84,5 +339,68 @@ func Download(namespace, uri string) (io.Reader, error) {
 	if !ok {
 		return nil, fmt.Errorf("Unknown scheme")
 	}
-	return backend.Download(namespace, uri)
+	return encrypted(backend), nil
+}
+
+// Returns the URIs ordered by backend preference: URIs for the primary backend
+// come first, followed by the other configured backends and finally by
+// backends that are no longer configured. The relative order of URIs using the
+// same backend is preserved.
+func SortURIsByPreference(uris []string) []string {
+	result := make([]string, len(uris))
+	copy(result, uris)
+	sort.SliceStable(result, func(i, j int) bool {
+		return schemePreference(result[i]) < schemePreference(result[j])
+	})
+	return result
+}
+
+func schemePreference(uri string) int {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return len(uploadBackends)
+	}
+	for i, name := range uploadBackends {
+		if URIScheme(name) == u.Scheme {
+			return i
+		}
+	}
+	return len(uploadBackends)
+}
+
+// Returns the scheme of the URIs produced by the backend.
+func URIScheme(backend string) string {
+	if b, ok := storageBackends[backend].(SchemeBackend); ok {
+		return b.URIScheme()
+	}
+	if scheme, ok := uriSchemes[backend]; ok {
+		return scheme
+	}
+	return backend
+}
+
+// Returns the URI's scheme and the part of its path that's relative to the
+// root of the backend, e.g. "file:namespace/name/name-v1.0.0.tgz". Every
+// backend stores packages under "<namespace>/<name>/", so the key stays the
+// same when the root moves, for instance when the local storage directory is
+// moved or reached through a symlink.
+func PackageKey(uri string) string {
+	parts := strings.SplitN(uri, "://", 2)
+	if len(parts) != 2 {
+		return uri
+	}
+	path := strings.Split(strings.Trim(parts[1], "/"), "/")
+	if len(path) > 3 {
+		path = path[len(path)-3:]
+	}
+	return parts[0] + ":" + strings.Join(path, "/")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
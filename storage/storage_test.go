@@ -0,0 +1,227 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"testing/iotest"
+
+	"github.com/ankyra/escape-inventory/config"
+
+	. "gopkg.in/check.v1"
+)
+
+const testStoragePath = "/tmp/escape-inventory-storage-test"
+
+func Test(t *testing.T) { TestingT(t) }
+
+type suite struct{}
+
+var _ = Suite(&suite{})
+
+func (s *suite) SetUpTest(c *C) {
+	os.RemoveAll(testStoragePath)
+	os.MkdirAll(testStoragePath, 0755)
+	TestSetup()
+}
+
+func (s *suite) TearDownTest(c *C) {
+	os.RemoveAll(testStoragePath)
+}
+
+func (s *suite) Test_LoadFromConfig_puts_primary_backend_first(c *C) {
+	conf := &config.Config{
+		StorageBackend:  "s3",
+		StorageBackends: []string{"local", "s3"},
+		StorageSettings: config.StorageSettings{
+			Path:   testStoragePath,
+			Bucket: "escape-releases",
+		},
+	}
+	c.Assert(LoadFromConfig(conf), IsNil)
+	c.Assert(uploadBackends, DeepEquals, []string{"s3", "local"})
+}
+
+func (s *suite) Test_LoadFromConfig_uses_backend_settings(c *C) {
+	conf := &config.Config{
+		StorageBackend:  "s3",
+		StorageBackends: []string{"local", "s3"},
+		StorageSettings: config.StorageSettings{
+			Path:   "/does/not/exist",
+			Bucket: "escape-releases",
+		},
+		BackendSettings: map[string]config.StorageSettings{
+			"local": {Path: testStoragePath},
+		},
+	}
+	c.Assert(LoadFromConfig(conf), IsNil)
+	uri, err := UploadTo("local", "namespace", "name-v1.0.0", bytes.NewReader([]byte("package data")))
+	c.Assert(err, IsNil)
+	c.Assert(uri, Equals, "file://"+testStoragePath+"/namespace/name/name-v1.0.0.tgz")
+}
+
+func (s *suite) Test_PackageKey(c *C) {
+	cases := map[string]string{
+		"file:///var/lib/escape/releases/namespace/name/name-v1.0.0.tgz": "file:namespace/name/name-v1.0.0.tgz",
+		"file:///mnt/releases/namespace/name/name-v1.0.0.tgz":            "file:namespace/name/name-v1.0.0.tgz",
+		"gcs://bucket/namespace/name/name-v1.0.0.tgz":                    "gcs:namespace/name/name-v1.0.0.tgz",
+		"https://dav.example.com/escape/namespace/name/name-v1.0.0.tgz":  "https:namespace/name/name-v1.0.0.tgz",
+		"mem://name-v1.0.0.tgz":                                          "mem:name-v1.0.0.tgz",
+	}
+	for uri, key := range cases {
+		c.Assert(PackageKey(uri), Equals, key, Commentf(uri))
+	}
+}
+
+func (s *suite) Test_LoadFromConfig_fails_on_unknown_backend(c *C) {
+	conf := &config.Config{
+		StorageBackend:  "local",
+		StorageBackends: []string{"local", "ftp"},
+		StorageSettings: config.StorageSettings{Path: testStoragePath},
+	}
+	err := LoadFromConfig(conf)
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Unknown storage backend: ftp")
+	c.Assert(uploadBackends, DeepEquals, []string{"memory"})
+}
+
+func (s *suite) Test_Upload_writes_to_every_backend(c *C) {
+	c.Assert(localBackend.Init(config.StorageSettings{Path: testStoragePath}), IsNil)
+	uploadBackends = []string{"memory", "local"}
+
+	uris, err := Upload("namespace", "name-v1.0.0", bytes.NewReader([]byte("package data")))
+	c.Assert(err, IsNil)
+	c.Assert(uris, HasLen, 2)
+	c.Assert(uris[0], Equals, "mem://name-v1.0.0.tgz")
+	c.Assert(uris[1], Equals, "file://"+testStoragePath+"/namespace/name/name-v1.0.0.tgz")
+	for _, uri := range uris {
+		reader, err := Download("namespace", uri)
+		c.Assert(err, IsNil)
+		data, err := ioutil.ReadAll(reader)
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, "package data")
+	}
+}
+
+func (s *suite) Test_UploadArtifact_stores_artifact_next_to_package(c *C) {
+	c.Assert(localBackend.Init(config.StorageSettings{Path: testStoragePath}), IsNil)
+	uploadBackends = []string{"memory", "local"}
+
+	uris, err := UploadArtifact("namespace", "name-v1.0.0", "linux-amd64", bytes.NewReader([]byte("artifact data")))
+	c.Assert(err, IsNil)
+	c.Assert(uris, DeepEquals, []string{
+		"mem://name-v1.0.0-linux-amd64.tgz",
+		"file://" + testStoragePath + "/namespace/name/name-v1.0.0-linux-amd64.tgz",
+	})
+	for _, uri := range uris {
+		reader, err := Download("namespace", uri)
+		c.Assert(err, IsNil)
+		data, err := ioutil.ReadAll(reader)
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, "artifact data")
+	}
+}
+
+func (s *suite) Test_Upload_fails_if_any_backend_fails(c *C) {
+	c.Assert(localBackend.Init(config.StorageSettings{Path: testStoragePath}), IsNil)
+	c.Assert(ioutil.WriteFile(testStoragePath+"/namespace", []byte("not a directory"), 0644), IsNil)
+	uploadBackends = []string{"memory", "local"}
+
+	_, err := Upload("namespace", "name-v1.0.0", bytes.NewReader([]byte("package data")))
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Upload to 'local' storage backend failed: Path "+testStoragePath+"/namespace/name exists, but is not a directory")
+}
+
+func (s *suite) Test_Upload_returns_written_copies_if_a_backend_fails(c *C) {
+	c.Assert(localBackend.Init(config.StorageSettings{Path: testStoragePath}), IsNil)
+	c.Assert(os.MkdirAll(testStoragePath+"/namespace/name/name-v1.0.0.tgz", 0755), IsNil)
+	uploadBackends = []string{"memory", "local"}
+
+	uris, err := Upload("namespace", "name-v1.0.0", bytes.NewReader([]byte("package data")))
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Matches, "Upload to 'local' storage backend failed: .*")
+	c.Assert(uris, DeepEquals, []string{"mem://name-v1.0.0.tgz"})
+}
+
+func (s *suite) Test_Upload_fails_if_package_cant_be_read(c *C) {
+	c.Assert(localBackend.Init(config.StorageSettings{Path: testStoragePath}), IsNil)
+	uploadBackends = []string{"memory", "local"}
+
+	pkg := io.MultiReader(bytes.NewReader([]byte("package")), iotest.ErrReader(errors.New("connection reset")))
+	_, err := Upload("namespace", "name-v1.0.0", pkg)
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "connection reset")
+	_, err = os.Stat(testStoragePath + "/namespace/name/name-v1.0.0.tgz")
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *suite) Test_SortURIsByPreference(c *C) {
+	uploadBackends = []string{"gcs", "local"}
+	uris := []string{
+		"s3://bucket/name-v1.tgz",
+		"file:///releases/name-v1.tgz",
+		"gcs://bucket/name-v1.tgz",
+		"mem://name-v1.tgz",
+	}
+	c.Assert(SortURIsByPreference(uris), DeepEquals, []string{
+		"gcs://bucket/name-v1.tgz",
+		"file:///releases/name-v1.tgz",
+		"s3://bucket/name-v1.tgz",
+		"mem://name-v1.tgz",
+	})
+}
+
+func (s *suite) Test_SortURIsByPreference_uses_scheme_of_webdav_url(c *C) {
+	c.Assert(webdavBackend.Init(config.StorageSettings{URL: "https://artifacts.example.com/repo"}), IsNil)
+	defer func() { webdavBackend.BaseURL = nil }()
+	uploadBackends = []string{"local", "webdav"}
+	c.Assert(URIScheme("webdav"), Equals, "https")
+	uris := []string{
+		"s3://bucket/name-v1.tgz",
+		"https://artifacts.example.com/repo/name-v1.tgz",
+		"file:///releases/name-v1.tgz",
+	}
+	c.Assert(SortURIsByPreference(uris), DeepEquals, []string{
+		"file:///releases/name-v1.tgz",
+		"https://artifacts.example.com/repo/name-v1.tgz",
+		"s3://bucket/name-v1.tgz",
+	})
+}
+
+func (s *suite) Test_ListPackages_and_DeletePackage(c *C) {
+	uris, err := Upload("namespace", "name-v1.0.0", bytes.NewReader([]byte("package data")))
+	c.Assert(err, IsNil)
+	listed, err := ListPackages("memory")
+	c.Assert(err, IsNil)
+	c.Assert(listed, DeepEquals, uris)
+
+	c.Assert(DeletePackage("namespace", uris[0]), IsNil)
+	listed, err = ListPackages("memory")
+	c.Assert(err, IsNil)
+	c.Assert(listed, HasLen, 0)
+}
+
+func (s *suite) Test_ListPackages_fails_if_backend_not_configured(c *C) {
+	_, err := ListPackages("gcs")
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Storage backend 'gcs' is not configured")
+}
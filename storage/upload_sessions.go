@@ -0,0 +1,234 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/ankyra/escape-inventory/dao/types"
+)
+
+// Upload sessions stage a package on local disk while it's being uploaded in
+// chunks. The session's offset is the size of the staged data, so a client
+// that lost its connection can ask for the offset and resume from there.
+type UploadSession struct {
+	ID        string    `json:"id"`
+	Namespace string    `json:"namespace"`
+	ReleaseId string    `json:"release_id"`
+	Offset    int64     `json:"offset"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Sessions that haven't received any data within this time are removed.
+const uploadSessionTTL = 24 * time.Hour
+
+var uploadSessionsPath = filepath.Join(os.TempDir(), "escape-inventory-uploads")
+
+var uploadSessionIdPattern = regexp.MustCompile("^[0-9a-f]{32}$")
+
+var uploadSessionLocks = map[string]*sync.Mutex{}
+var uploadSessionLocksMutex sync.Mutex
+
+func initUploadSessions(path string) error {
+	if path == "" {
+		path = filepath.Join(os.TempDir(), "escape-inventory-uploads")
+	}
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return fmt.Errorf("Could not create upload sessions directory '%s': %s", path, err.Error())
+	}
+	uploadSessionsPath = path
+	return nil
+}
+
+func NewUploadSession(namespace, releaseId string) (*UploadSession, error) {
+	if err := os.MkdirAll(uploadSessionsPath, 0700); err != nil {
+		return nil, err
+	}
+	removeExpiredUploadSessions()
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	session := &UploadSession{
+		ID:        hex.EncodeToString(id),
+		Namespace: namespace,
+		ReleaseId: releaseId,
+		CreatedAt: time.Now(),
+	}
+	if err := ioutil.WriteFile(session.dataPath(), []byte{}, 0600); err != nil {
+		return nil, err
+	}
+	metadata, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(session.metadataPath(), metadata, 0600); err != nil {
+		os.Remove(session.dataPath())
+		return nil, err
+	}
+	return session, nil
+}
+
+func GetUploadSession(id string) (*UploadSession, error) {
+	if !uploadSessionIdPattern.MatchString(id) {
+		return nil, types.NotFound
+	}
+	session := &UploadSession{ID: id}
+	metadata, err := ioutil.ReadFile(session.metadataPath())
+	if os.IsNotExist(err) {
+		return nil, types.NotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(metadata, session); err != nil {
+		return nil, err
+	}
+	st, err := os.Stat(session.dataPath())
+	if os.IsNotExist(err) {
+		return nil, types.NotFound
+	} else if err != nil {
+		return nil, err
+	}
+	session.Offset = st.Size()
+	return session, nil
+}
+
+// Appends data to the session, which only succeeds if offset matches the
+// amount of data that has been staged so far. Whatever was received before
+// an error occurred is kept.
+func (s *UploadSession) Append(offset int64, data io.Reader) error {
+	lock := uploadSessionLock(s.ID)
+	lock.Lock()
+	defer lock.Unlock()
+	f, err := os.OpenFile(s.dataPath(), os.O_WRONLY|os.O_APPEND, 0600)
+	if os.IsNotExist(err) {
+		return types.NotFound
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	s.Offset = st.Size()
+	if offset != s.Offset {
+		return &OffsetMismatchError{Expected: s.Offset, Got: offset}
+	}
+	n, err := io.Copy(f, data)
+	s.Offset += n
+	return err
+}
+
+func (s *UploadSession) Open() (*os.File, error) {
+	return os.Open(s.dataPath())
+}
+
+// Passes the staged data to upload and removes the session once that has
+// succeeded. The session stays locked until then, so that it can't be
+// appended to or finalized again while it's being uploaded.
+func (s *UploadSession) Finalize(upload func(pkg io.Reader) error) error {
+	lock := uploadSessionLock(s.ID)
+	lock.Lock()
+	defer lock.Unlock()
+	pkg, err := s.Open()
+	if os.IsNotExist(err) {
+		return types.NotFound
+	} else if err != nil {
+		return err
+	}
+	defer pkg.Close()
+	if err := upload(pkg); err != nil {
+		return err
+	}
+	return s.remove()
+}
+
+func (s *UploadSession) Remove() error {
+	lock := uploadSessionLock(s.ID)
+	lock.Lock()
+	defer lock.Unlock()
+	return s.remove()
+}
+
+func (s *UploadSession) remove() error {
+	os.Remove(s.metadataPath())
+	err := os.Remove(s.dataPath())
+	uploadSessionLocksMutex.Lock()
+	delete(uploadSessionLocks, s.ID)
+	uploadSessionLocksMutex.Unlock()
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *UploadSession) dataPath() string {
+	return filepath.Join(uploadSessionsPath, s.ID+".data")
+}
+
+func (s *UploadSession) metadataPath() string {
+	return filepath.Join(uploadSessionsPath, s.ID+".json")
+}
+
+type OffsetMismatchError struct {
+	Expected int64
+	Got      int64
+}
+
+func (e *OffsetMismatchError) Error() string {
+	return fmt.Sprintf("Upload offset mismatch: expecting offset %d, got %d", e.Expected, e.Got)
+}
+
+func uploadSessionLock(id string) *sync.Mutex {
+	uploadSessionLocksMutex.Lock()
+	defer uploadSessionLocksMutex.Unlock()
+	lock, ok := uploadSessionLocks[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		uploadSessionLocks[id] = lock
+	}
+	return lock
+}
+
+func removeExpiredUploadSessions() {
+	files, err := ioutil.ReadDir(uploadSessionsPath)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		id := file.Name()[:len(file.Name())-len(filepath.Ext(file.Name()))]
+		if filepath.Ext(file.Name()) != ".json" || !uploadSessionIdPattern.MatchString(id) {
+			continue
+		}
+		session := &UploadSession{ID: id}
+		st, err := os.Stat(session.dataPath())
+		if err != nil || time.Since(st.ModTime()) > uploadSessionTTL {
+			session.Remove()
+		}
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ankyra/escape-inventory/dao/types"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *suite) Test_UploadSession_Append_and_Open(c *C) {
+	c.Assert(initUploadSessions(filepath.Join(testStoragePath, "uploads")), IsNil)
+	session, err := NewUploadSession("namespace", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(session.Offset, Equals, int64(0))
+
+	c.Assert(session.Append(0, strings.NewReader("package ")), IsNil)
+	c.Assert(session.Append(8, strings.NewReader("data")), IsNil)
+	c.Assert(session.Offset, Equals, int64(12))
+
+	session, err = GetUploadSession(session.ID)
+	c.Assert(err, IsNil)
+	c.Assert(session.Namespace, Equals, "namespace")
+	c.Assert(session.ReleaseId, Equals, "name-v1.0.0")
+	c.Assert(session.Offset, Equals, int64(12))
+
+	f, err := session.Open()
+	c.Assert(err, IsNil)
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "package data")
+}
+
+func (s *suite) Test_UploadSession_Append_fails_on_offset_mismatch(c *C) {
+	c.Assert(initUploadSessions(filepath.Join(testStoragePath, "uploads")), IsNil)
+	session, err := NewUploadSession("namespace", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(session.Append(0, strings.NewReader("package ")), IsNil)
+
+	err = session.Append(0, strings.NewReader("package "))
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Upload offset mismatch: expecting offset 8, got 0")
+	c.Assert(session.Offset, Equals, int64(8))
+}
+
+func (s *suite) Test_GetUploadSession_returns_NotFound(c *C) {
+	c.Assert(initUploadSessions(filepath.Join(testStoragePath, "uploads")), IsNil)
+	_, err := GetUploadSession("0123456789abcdef0123456789abcdef")
+	c.Assert(err, Equals, types.NotFound)
+	_, err = GetUploadSession("../../etc/passwd")
+	c.Assert(err, Equals, types.NotFound)
+}
+
+func (s *suite) Test_UploadSession_Remove(c *C) {
+	c.Assert(initUploadSessions(filepath.Join(testStoragePath, "uploads")), IsNil)
+	session, err := NewUploadSession("namespace", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(session.Remove(), IsNil)
+	_, err = GetUploadSession(session.ID)
+	c.Assert(err, Equals, types.NotFound)
+}
+
+func (s *suite) Test_UploadSession_Finalize(c *C) {
+	c.Assert(initUploadSessions(filepath.Join(testStoragePath, "uploads")), IsNil)
+	session, err := NewUploadSession("namespace", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(session.Append(0, strings.NewReader("package data")), IsNil)
+
+	uploaded := ""
+	err = session.Finalize(func(pkg io.Reader) error {
+		data, err := ioutil.ReadAll(pkg)
+		uploaded = string(data)
+		return err
+	})
+	c.Assert(err, IsNil)
+	c.Assert(uploaded, Equals, "package data")
+	_, err = GetUploadSession(session.ID)
+	c.Assert(err, Equals, types.NotFound)
+	c.Assert(session.Finalize(func(io.Reader) error { return nil }), Equals, types.NotFound)
+}
+
+func (s *suite) Test_UploadSession_Finalize_keeps_session_if_upload_fails(c *C) {
+	c.Assert(initUploadSessions(filepath.Join(testStoragePath, "uploads")), IsNil)
+	session, err := NewUploadSession("namespace", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(session.Append(0, strings.NewReader("package data")), IsNil)
+
+	err = session.Finalize(func(io.Reader) error { return fmt.Errorf("Upload failed") })
+	c.Assert(err, DeepEquals, fmt.Errorf("Upload failed"))
+	session, err = GetUploadSession(session.ID)
+	c.Assert(err, IsNil)
+	c.Assert(session.Offset, Equals, int64(12))
+}
+
+func (s *suite) Test_UploadSession_Append_waits_for_Finalize(c *C) {
+	c.Assert(initUploadSessions(filepath.Join(testStoragePath, "uploads")), IsNil)
+	session, err := NewUploadSession("namespace", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	c.Assert(session.Append(0, strings.NewReader("package")), IsNil)
+
+	uploading := make(chan bool)
+	appended := make(chan error)
+	err = session.Finalize(func(io.Reader) error {
+		go func() {
+			close(uploading)
+			appended <- session.Append(7, strings.NewReader(" data"))
+		}()
+		<-uploading
+		select {
+		case err := <-appended:
+			return fmt.Errorf("Appended during upload: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(<-appended, Equals, types.NotFound)
+}
+
+func (s *suite) Test_NewUploadSession_removes_expired_sessions(c *C) {
+	c.Assert(initUploadSessions(filepath.Join(testStoragePath, "uploads")), IsNil)
+	expired, err := NewUploadSession("namespace", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	old := time.Now().Add(-uploadSessionTTL - time.Minute)
+	c.Assert(os.Chtimes(expired.dataPath(), old, old), IsNil)
+
+	_, err = NewUploadSession("namespace", "name-v1.0.0")
+	c.Assert(err, IsNil)
+	_, err = GetUploadSession(expired.ID)
+	c.Assert(err, Equals, types.NotFound)
+}
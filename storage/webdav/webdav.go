@@ -0,0 +1,320 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webdav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ankyra/escape-core/parsers"
+	"github.com/ankyra/escape-inventory/config"
+	"github.com/ankyra/escape-inventory/dao/types"
+	"github.com/ankyra/escape-inventory/storage/ranged"
+)
+
+// Stores packages on a plain HTTP server that accepts PUT requests, like a
+// WebDAV share or an Artifactory or Nexus raw repository. Packages are stored
+// under the configured base URL, and their URIs are regular http(s) URLs.
+type WebDAVStorageBackend struct {
+	BaseURL *url.URL
+	Headers http.Header
+	Client  *http.Client
+}
+
+func NewWebDAVStorageBackend() *WebDAVStorageBackend {
+	return &WebDAVStorageBackend{}
+}
+
+func (w *WebDAVStorageBackend) Init(settings config.StorageSettings) error {
+	if settings.URL == "" {
+		return fmt.Errorf("Missing storage_settings.url configuration variable")
+	}
+	u, err := url.Parse(settings.URL)
+	if err != nil {
+		return fmt.Errorf("Invalid storage_settings.url '%s': %s", settings.URL, err.Error())
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Invalid storage_settings.url '%s': expecting an http(s) URL", settings.URL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	u.RawQuery = ""
+	u.Fragment = ""
+	w.BaseURL = u
+	w.Headers = http.Header{}
+	for key, value := range settings.Headers {
+		w.Headers.Set(key, value)
+	}
+	w.Client = http.DefaultClient
+	return nil
+}
+
+// Returns the scheme of the configured base URL.
+func (w *WebDAVStorageBackend) URIScheme() string {
+	if w.BaseURL == nil {
+		return "http"
+	}
+	return w.BaseURL.Scheme
+}
+
+func (w *WebDAVStorageBackend) Upload(namespace string, releaseId *parsers.ReleaseId, pkg io.Reader) (string, error) {
+	if w.BaseURL == nil {
+		return "", fmt.Errorf("WebDAV storage backend is not configured")
+	}
+	dir := w.BaseURL.Path + "/" + path.Join(namespace, releaseId.Name)
+	w.makeCollections(strings.TrimPrefix(dir, w.BaseURL.Path))
+	uri := w.uriFor(dir + "/" + releaseId.ToString() + ".tgz")
+	req, err := w.newRequest("PUT", uri, pkg)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	if err := w.doAndExpect(req, http.StatusOK, http.StatusCreated, http.StatusNoContent); err != nil {
+		return "", err
+	}
+	return uri, nil
+}
+
+// WebDAV servers refuse to PUT files into collections that don't exist, so
+// these are created first. Other servers create directories implicitly and
+// may reject MKCOL, which is why errors are ignored here: if the collections
+// are really missing the PUT will fail and report it.
+func (w *WebDAVStorageBackend) makeCollections(dir string) {
+	current := w.BaseURL.Path
+	for _, part := range strings.Split(strings.Trim(dir, "/"), "/") {
+		current += "/" + part
+		req, err := w.newRequest("MKCOL", w.uriFor(current+"/"), nil)
+		if err != nil {
+			return
+		}
+		resp, err := w.Client.Do(req)
+		if err != nil {
+			return
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// Packages are read lazily using range requests, so that downloads can start
+// at any offset. Servers that ignore the Range header are supported by
+// skipping ahead in the response.
+func (w *WebDAVStorageBackend) Download(namespace, uri string) (io.ReadSeekCloser, error) {
+	size, _, err := w.Stat(namespace, uri)
+	if err != nil {
+		return nil, err
+	}
+	return ranged.NewReader(size, func(offset int64) (io.ReadCloser, error) {
+		return w.get(uri, offset)
+	}), nil
+}
+
+func (w *WebDAVStorageBackend) get(uri string, offset int64) (io.ReadCloser, error) {
+	req, err := w.newRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, types.NotFound
+	}
+	if resp.StatusCode == http.StatusOK && offset > 0 {
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	} else if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+	return resp.Body, nil
+}
+
+func (w *WebDAVStorageBackend) Stat(namespace, uri string) (int64, time.Time, error) {
+	req, err := w.newRequest("HEAD", uri, nil)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, time.Time{}, types.NotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, time.Time{}, readError(resp)
+	}
+	if resp.ContentLength < 0 {
+		return 0, time.Time{}, fmt.Errorf("WebDAV server didn't report the size of '%s'", uri)
+	}
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return resp.ContentLength, modTime, nil
+}
+
+// Returns the URIs of all the packages under the base URL. This walks the
+// collections one level at a time using PROPFIND, because many servers don't
+// allow infinite depth requests.
+func (w *WebDAVStorageBackend) List() ([]string, error) {
+	if w.BaseURL == nil {
+		return nil, fmt.Errorf("WebDAV storage backend is not configured")
+	}
+	uris := []string{}
+	pending := []string{w.BaseURL.Path + "/"}
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+		entries, err := w.propfind(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.Path == dir {
+				continue
+			}
+			if entry.Collection {
+				pending = append(pending, entry.Path)
+			} else if strings.HasSuffix(entry.Path, ".tgz") {
+				uris = append(uris, w.uriFor(entry.Path))
+			}
+		}
+	}
+	sort.Strings(uris)
+	return uris, nil
+}
+
+type propfindEntry struct {
+	Path       string
+	Collection bool
+}
+
+func (w *WebDAVStorageBackend) propfind(dir string) ([]propfindEntry, error) {
+	body := `<?xml version="1.0" encoding="utf-8"?><propfind xmlns="DAV:"><prop><resourcetype/></prop></propfind>`
+	req, err := w.newRequest("PROPFIND", w.uriFor(dir), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", "1")
+	req.Header.Set("Content-Type", "application/xml")
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, readError(resp)
+	}
+	result := struct {
+		Responses []struct {
+			Href       string    `xml:"DAV: href"`
+			Collection *struct{} `xml:"DAV: propstat>prop>resourcetype>collection"`
+		} `xml:"DAV: response"`
+	}{}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("Could not parse WebDAV response: %s", err.Error())
+	}
+	entries := []propfindEntry{}
+	for _, r := range result.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse WebDAV response: %s", err.Error())
+		}
+		p := href.Path
+		if r.Collection != nil && !strings.HasSuffix(p, "/") {
+			p += "/"
+		}
+		// Don't follow references outside of the base URL.
+		if !strings.HasPrefix(p, w.BaseURL.Path+"/") {
+			continue
+		}
+		entries = append(entries, propfindEntry{Path: p, Collection: r.Collection != nil})
+	}
+	return entries, nil
+}
+
+func (w *WebDAVStorageBackend) Delete(uri string) error {
+	req, err := w.newRequest("DELETE", uri, nil)
+	if err != nil {
+		return err
+	}
+	return w.doAndExpect(req, http.StatusOK, http.StatusAccepted, http.StatusNoContent)
+}
+
+func (w *WebDAVStorageBackend) uriFor(p string) string {
+	u := *w.BaseURL
+	u.Path = p
+	return u.String()
+}
+
+// The configured headers usually carry credentials, so requests are only made
+// for URIs under the base URL.
+func (w *WebDAVStorageBackend) newRequest(method, uri string, body io.Reader) (*http.Request, error) {
+	if w.BaseURL == nil {
+		return nil, fmt.Errorf("WebDAV storage backend is not configured")
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != w.BaseURL.Scheme || u.Host != w.BaseURL.Host || !strings.HasPrefix(u.Path, w.BaseURL.Path+"/") {
+		return nil, fmt.Errorf("URI '%s' is not under the configured storage_settings.url", uri)
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range w.Headers {
+		req.Header[key] = values
+	}
+	return req, nil
+}
+
+func (w *WebDAVStorageBackend) doAndExpect(req *http.Request, statuses ...int) error {
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	for _, status := range statuses {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+	return readError(resp)
+}
+
+func readError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("WebDAV request '%s %s' failed with status %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,317 @@
+/*
+Copyright 2017, 2018 Ankyra
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webdav
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ankyra/escape-core/parsers"
+	"github.com/ankyra/escape-inventory/config"
+	"github.com/ankyra/escape-inventory/dao/types"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type webdavSuite struct{}
+
+var _ = Suite(&webdavSuite{})
+
+// fakeWebDAV is a minimal WebDAV server that requires an API key, refuses to
+// store files in collections that don't exist and lists collections with
+// PROPFIND. With RawRepository set it behaves like an Artifactory or Nexus raw
+// repository instead: directories are created implicitly, MKCOL and PROPFIND
+// aren't supported and Range headers are ignored.
+type fakeWebDAV struct {
+	Files         map[string][]byte
+	Collections   map[string]bool
+	RawRepository bool
+	Requests      []string
+}
+
+var fakeWebDAVModTime = time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newFakeWebDAV() *fakeWebDAV {
+	return &fakeWebDAV{
+		Files: map[string][]byte{},
+		Collections: map[string]bool{
+			"/":       true,
+			"/repo/":  true,
+			"/other/": true,
+		},
+	}
+}
+
+func (f *fakeWebDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Requests = append(f.Requests, r.Method+" "+r.URL.Path)
+	if r.Header.Get("X-Api-Key") != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+		return
+	}
+	data, _ := ioutil.ReadAll(r.Body)
+	switch r.Method {
+	case "MKCOL":
+		if f.RawRepository {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if f.Collections[r.URL.Path] {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !f.Collections[parent(r.URL.Path)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.Collections[r.URL.Path] = true
+		w.WriteHeader(http.StatusCreated)
+	case "PUT":
+		if !f.RawRepository && !f.Collections[parent(r.URL.Path)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.Files[r.URL.Path] = data
+		w.WriteHeader(http.StatusCreated)
+	case "DELETE":
+		if _, ok := f.Files[r.URL.Path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.Files, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	case "PROPFIND":
+		if f.RawRepository || r.Header.Get("Depth") != "1" || !f.Collections[r.URL.Path] {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		f.propfind(w, r.URL.Path)
+	case "GET", "HEAD":
+		data, ok := f.Files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if f.RawRepository {
+			r.Header.Del("Range")
+		}
+		http.ServeContent(w, r, "", fakeWebDAVModTime, bytes.NewReader(data))
+	}
+}
+
+func (f *fakeWebDAV) propfind(w http.ResponseWriter, dir string) {
+	result := `<?xml version="1.0"?><D:multistatus xmlns:D="DAV:">`
+	result += `<D:response><D:href>` + dir + `</D:href><D:propstat><D:prop><D:resourcetype><D:collection/></D:resourcetype></D:prop></D:propstat></D:response>`
+	for path := range f.Collections {
+		if path != dir && parent(path) == dir {
+			result += `<D:response><D:href>` + path + `</D:href><D:propstat><D:prop><D:resourcetype><D:collection/></D:resourcetype></D:prop></D:propstat></D:response>`
+		}
+	}
+	for path := range f.Files {
+		if parent(path) == dir {
+			result += `<D:response><D:href>` + path + `</D:href><D:propstat><D:prop><D:resourcetype/></D:prop></D:propstat></D:response>`
+		}
+	}
+	w.WriteHeader(http.StatusMultiStatus)
+	w.Write([]byte(result + `</D:multistatus>`))
+}
+
+func parent(path string) string {
+	path = strings.TrimSuffix(path, "/")
+	return path[:strings.LastIndex(path, "/")+1]
+}
+
+func (s *webdavSuite) newBackend(c *C, server *httptest.Server) *WebDAVStorageBackend {
+	backend := NewWebDAVStorageBackend()
+	err := backend.Init(config.StorageSettings{
+		URL: server.URL + "/repo/",
+		Headers: map[string]string{
+			"X-Api-Key": "secret",
+		},
+	})
+	c.Assert(err, IsNil)
+	return backend
+}
+
+func (s *webdavSuite) Test_WebDAV_Storage_Backend_Upload_and_Download(c *C) {
+	fake := newFakeWebDAV()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	backend := s.newBackend(c, server)
+
+	releaseId, err := parsers.ParseReleaseId("archive-upload-test-v1")
+	c.Assert(err, IsNil)
+	uri, err := backend.Upload("namespace", releaseId, bytes.NewReader([]byte("package data")))
+	c.Assert(err, IsNil)
+	c.Assert(uri, Equals, server.URL+"/repo/namespace/archive-upload-test/archive-upload-test-v1.tgz")
+	c.Assert(string(fake.Files["/repo/namespace/archive-upload-test/archive-upload-test-v1.tgz"]), Equals, "package data")
+	c.Assert(fake.Collections["/repo/namespace/"], Equals, true)
+	c.Assert(fake.Collections["/repo/namespace/archive-upload-test/"], Equals, true)
+
+	reader, err := backend.Download("namespace", uri)
+	c.Assert(err, IsNil)
+	payload, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(payload), Equals, "package data")
+}
+
+func (s *webdavSuite) Test_WebDAV_Storage_Backend_Upload_to_raw_repository(c *C) {
+	fake := newFakeWebDAV()
+	fake.RawRepository = true
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	backend := s.newBackend(c, server)
+
+	releaseId, err := parsers.ParseReleaseId("archive-upload-test-v1")
+	c.Assert(err, IsNil)
+	uri, err := backend.Upload("namespace", releaseId, bytes.NewReader([]byte("package data")))
+	c.Assert(err, IsNil)
+	c.Assert(uri, Equals, server.URL+"/repo/namespace/archive-upload-test/archive-upload-test-v1.tgz")
+	c.Assert(string(fake.Files["/repo/namespace/archive-upload-test/archive-upload-test-v1.tgz"]), Equals, "package data")
+}
+
+func (s *webdavSuite) Test_WebDAV_Storage_Backend_Stat_and_ranged_Download(c *C) {
+	fake := newFakeWebDAV()
+	fake.Files["/repo/namespace/name/name-v1.tgz"] = []byte("package data")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	backend := s.newBackend(c, server)
+	uri := server.URL + "/repo/namespace/name/name-v1.tgz"
+
+	size, modTime, err := backend.Stat("namespace", uri)
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, int64(12))
+	c.Assert(modTime.Equal(fakeWebDAVModTime), Equals, true)
+
+	reader, err := backend.Download("namespace", uri)
+	c.Assert(err, IsNil)
+	defer reader.Close()
+	_, err = reader.Seek(8, io.SeekStart)
+	c.Assert(err, IsNil)
+	payload, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(payload), Equals, "data")
+}
+
+func (s *webdavSuite) Test_WebDAV_Storage_Backend_ranged_Download_without_Range_support(c *C) {
+	fake := newFakeWebDAV()
+	fake.RawRepository = true
+	fake.Files["/repo/namespace/name/name-v1.tgz"] = []byte("package data")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	backend := s.newBackend(c, server)
+
+	reader, err := backend.Download("namespace", server.URL+"/repo/namespace/name/name-v1.tgz")
+	c.Assert(err, IsNil)
+	defer reader.Close()
+	_, err = reader.Seek(8, io.SeekStart)
+	c.Assert(err, IsNil)
+	payload, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(payload), Equals, "data")
+}
+
+func (s *webdavSuite) Test_WebDAV_Storage_Backend_List_and_Delete(c *C) {
+	fake := newFakeWebDAV()
+	fake.Collections["/repo/namespace/"] = true
+	fake.Collections["/repo/namespace/name/"] = true
+	fake.Collections["/repo/namespace/other/"] = true
+	fake.Files["/repo/namespace/name/name-v1.tgz"] = []byte("package data")
+	fake.Files["/repo/namespace/name/name-v2.tgz"] = []byte("package data")
+	fake.Files["/repo/namespace/other/other-v1.tgz"] = []byte("package data")
+	fake.Files["/repo/README"] = []byte("not a package")
+	fake.Files["/other/name-v1.tgz"] = []byte("not in the repository")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	backend := s.newBackend(c, server)
+
+	uris, err := backend.List()
+	c.Assert(err, IsNil)
+	c.Assert(uris, DeepEquals, []string{
+		server.URL + "/repo/namespace/name/name-v1.tgz",
+		server.URL + "/repo/namespace/name/name-v2.tgz",
+		server.URL + "/repo/namespace/other/other-v1.tgz",
+	})
+
+	c.Assert(backend.Delete(server.URL+"/repo/namespace/name/name-v1.tgz"), IsNil)
+	_, exists := fake.Files["/repo/namespace/name/name-v1.tgz"]
+	c.Assert(exists, Equals, false)
+}
+
+func (s *webdavSuite) Test_WebDAV_Storage_Backend_Download_returns_NotFound(c *C) {
+	server := httptest.NewServer(newFakeWebDAV())
+	defer server.Close()
+	backend := s.newBackend(c, server)
+	_, err := backend.Download("namespace", server.URL+"/repo/namespace/name/name-v1.tgz")
+	c.Assert(err, Equals, types.NotFound)
+}
+
+func (s *webdavSuite) Test_WebDAV_Storage_Backend_Upload_fails_with_wrong_credentials(c *C) {
+	server := httptest.NewServer(newFakeWebDAV())
+	defer server.Close()
+	backend := s.newBackend(c, server)
+	backend.Headers.Set("X-Api-Key", "wrong")
+	releaseId, err := parsers.ParseReleaseId("archive-upload-test-v1")
+	c.Assert(err, IsNil)
+	_, err = backend.Upload("namespace", releaseId, bytes.NewReader([]byte("package data")))
+	c.Assert(err, Not(IsNil))
+	c.Assert(strings.Contains(err.Error(), "status 401"), Equals, true)
+}
+
+func (s *webdavSuite) Test_WebDAV_Storage_Backend_doesnt_send_headers_outside_of_base_URL(c *C) {
+	fake := newFakeWebDAV()
+	fake.Files["/other/name-v1.tgz"] = []byte("package data")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	backend := s.newBackend(c, server)
+
+	for _, uri := range []string{
+		server.URL + "/other/name-v1.tgz",
+		server.URL + "/repository/name-v1.tgz",
+		"http://example.com/repo/name-v1.tgz",
+	} {
+		_, err := backend.Download("namespace", uri)
+		c.Assert(err, Not(IsNil))
+		c.Assert(err.Error(), Equals, "URI '"+uri+"' is not under the configured storage_settings.url")
+	}
+	c.Assert(fake.Requests, HasLen, 0)
+}
+
+func (s *webdavSuite) Test_WebDAV_Storage_Backend_Init_fails_without_url(c *C) {
+	err := NewWebDAVStorageBackend().Init(config.StorageSettings{})
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Missing storage_settings.url configuration variable")
+}
+
+func (s *webdavSuite) Test_WebDAV_Storage_Backend_Init_fails_with_invalid_url(c *C) {
+	err := NewWebDAVStorageBackend().Init(config.StorageSettings{URL: "ftp://example.com/repo"})
+	c.Assert(err, Not(IsNil))
+	c.Assert(err.Error(), Equals, "Invalid storage_settings.url 'ftp://example.com/repo': expecting an http(s) URL")
+}
+
+func (s *webdavSuite) Test_WebDAV_Storage_Backend_URIScheme(c *C) {
+	backend := NewWebDAVStorageBackend()
+	c.Assert(backend.Init(config.StorageSettings{URL: "https://example.com/repo"}), IsNil)
+	c.Assert(backend.URIScheme(), Equals, "https")
+}